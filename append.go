@@ -0,0 +1,113 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Append works like Overwrite, but the written content is appended to the
+// file. The writer starts empty, and the content is joined to the file on
+// Commit, while the file is locked, so appends committed concurrently are
+// all kept, in the order of their commits. As with Overwrite, the file is
+// replaced atomically, with its current version recorded to history, so
+// the live content is copied, unless the file system supports reflinks.
+// If the file doesn't exist, it's created.
+func (S *Store) Append(file string) (*Writer, error) {
+	w, err := S.Overwrite(file)
+	if err != nil {
+		return nil, err
+	}
+	w.appending = true
+	return w, nil
+}
+
+// Truncate changes the size of the file, like os.Truncate, recording its
+// current version to history first. If the file is extended, the added
+// bytes are zero. The file is replaced atomically, like with Overwrite.
+func (S *Store) Truncate(file string, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("truncate %s: negative size", file)
+	}
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "truncate", Name: file, Err: err}
+	}
+	if normalizeName(file, false) == "" {
+		return &StoreError{Op: "truncate", Name: file, Err: ErrInvalidName}
+	}
+	defer S.lock(file)()
+	tmp, err := S.stageLive(file)
+	if err != nil {
+		return &StoreError{Op: "truncate", Name: file, Err: err}
+	}
+	f, err := S.fs().OpenFile(tmp, os.O_WRONLY, 0)
+	if err == nil {
+		err = f.Truncate(size)
+		if err == nil {
+			err = f.Sync()
+		}
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+	}
+	if err == nil {
+		err = S.encodeFile(file, tmp)
+	}
+	if err != nil {
+		S.fs().Remove(tmp)
+		return &StoreError{Op: "truncate", Name: file, Err: err}
+	}
+	if err := S.commit(file, tmp, nil); err != nil {
+		return &StoreError{Op: "truncate", Name: file, Err: err}
+	}
+	return nil
+}
+
+// stageLive copies the decoded content of the live file to a temporary
+// file, see stage, and returns its path.
+func (S *Store) stageLive(file string) (string, error) {
+	f, err := S.openDecoded(file, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return S.stageFile(f, Progress{})
+}
+
+// appendLive returns the path of a new temporary file holding the decoded
+// content of the live file followed by the content of the temporary file
+// at tmp, which is removed. A missing file counts as empty, and then tmp
+// itself is returned. The file must be locked.
+func (S *Store) appendLive(file, tmp string) (string, error) {
+	joined, err := S.stageLive(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return tmp, nil
+	}
+	defer S.fs().Remove(tmp)
+	if err != nil {
+		return "", err
+	}
+	src, err := S.fs().Open(tmp)
+	if err != nil {
+		S.fs().Remove(joined)
+		return "", err
+	}
+	defer src.Close()
+	dst, err := S.fs().OpenFile(joined, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		S.fs().Remove(joined)
+		return "", err
+	}
+	err = S.copyData(dst, src, Progress{})
+	if err == nil {
+		err = dst.Sync()
+	}
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		S.fs().Remove(joined)
+		return "", err
+	}
+	return joined, nil
+}
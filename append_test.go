@@ -0,0 +1,161 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	w, err := S.Append("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString(" Bye!")
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "Hello! Bye!" {
+		t.Error("Got", string(b), err, "but expected Hello! Bye!")
+	}
+	if b, err := S.ReadFile("file", 124); err != nil || string(b) != "Hello!" {
+		t.Error("Got", string(b), err, "but expected the previous version in history")
+	}
+
+	w, err = S.Append("log/new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("first line\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("log/new", 0); err != nil || string(b) != "first line\n" {
+		t.Error("Got", string(b), err, "but expected a new file")
+	}
+
+	w, err = S.Append("file2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("Discarded")
+	w.Abort()
+	if b, err := S.ReadFile("file2", 0); err != nil || string(b) != "Hello from the second file!" {
+		t.Error("Got", string(b), err, "but expected the file to be unchanged")
+	}
+
+	// Encoded content is appended to after decoding.
+	E, err := NewMemory(WithWriteStages(xorStage{}, GzipStage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer E.Close()
+	for _, line := range []string{"one\n", "two\n"} {
+		w, err := E.Append("log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString(line)
+		if err := w.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b, err := E.ReadFile("log", 0); err != nil || string(b) != "one\ntwo\n" {
+		t.Error("Got", string(b), err, "but expected one\\ntwo\\n")
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("log", []byte("start\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Both writers are opened before either is committed.
+	w1, err := S.Append("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := S.Append("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w1.WriteString("one\n")
+	w2.WriteString("two\n")
+	if err := w1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("log", 0); err != nil || string(b) != "start\none\ntwo\n" {
+		t.Errorf("Got %q %v but expected both appends", b, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := S.Append("parallel")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			w.WriteString("x")
+			if err := w.Commit(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if b, err := S.ReadFile("parallel", 0); err != nil || string(b) != strings.Repeat("x", 20) {
+		t.Errorf("Got %q %v but expected 20 appends", b, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{5, "Hello"},
+		{7, "Hello\x00\x00"},
+		{0, ""},
+	}
+	for i, tt := range tests {
+		if err := S.Truncate("file", tt.size); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := S.ReadFile("file", 0); err != nil || string(b) != tt.expected {
+			t.Errorf("Got %q %v but expected %q", b, err, tt.expected)
+		}
+		if h, err := S.History("file"); err != nil || len(h) != i+2 {
+			t.Error("Got", h, err, "but expected the previous version in history")
+		}
+	}
+	if err := S.Truncate("missing", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	if err := S.Truncate("file2", -1); err == nil {
+		t.Error("Got", err, "but expected an error")
+	}
+	entries, err := os.ReadDir(S.historyDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			t.Error("Expected no temporary files but got", entry.Name())
+		}
+	}
+}
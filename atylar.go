@@ -1,117 +1,230 @@
 // Package atylar is an opinionated file storage system with version history.
-// It uses a flat directory structure (no subdirectories). To start, initialize a new Store using the function New(),
-// supplying the store's root directory path as the argument. All functions which may be used to modify the files
-// automatically copy the current file to the `.history` directory in the current store. Historic versions are marked
-// with an @ sign and the version number after the file name. The numbers are designated based on the generation,
-// an always-increasing counter characteristic for the store.
+// Files may be organized in subdirectories, using slash-separated names. To start, initialize a new Store using the
+// function New(), supplying the store's root directory path as the argument. All functions which may be used to modify
+// the files automatically copy the current file to the `.history` directory in the current store, which mirrors the
+// directory structure of the store. Historic versions are marked with an @ sign and the version number after the file
+// name. The numbers are designated based on the generation, an always-increasing counter characteristic for the store.
 package atylar
 
 // TODO:
-// Handle concurrency problems.
-// Garbage collect old file versions.
 // Write tests.
 
 import (
 	"bytes"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// Store is a directory of files with version history. Stores opened with
+// New are safe for concurrent use: modifications of the same file are
+// serialized, so that every version is captured exactly once, and GC
+// excludes all other operations. Reads may observe a modification which
+// is in progress, for example a file which is still being written.
 type Store struct {
 	Directory  string // Path to store root
 	Generation uint64 // Used to set files' versions
+
+	// ChunkThreshold enables chunked storage of historic versions of files
+	// at least this many bytes large. Zero disables it. See chunk.go.
+	ChunkThreshold int64
+
+	// Retry configures retrying of filesystem operations which failed
+	// with a transient error. The zero value disables retrying.
+	Retry RetryPolicy
+
+	capabilities Capabilities // Detected by New
+	locks        *locks       // Created by New
+	ops          *operations  // Created by New, see operation.go
+	counter      *counter     // Created by New, see generation.go
+	index        *index       // Created by New, see index.go
+	hashes       *hashCache   // Created by New, see compare.go
+	dirs         *dirSet      // Created by New, see dir.go
+	names        *nameCache   // Created by New, see capabilities.go
+	subs         *subscribers // Created by New, see event.go
+	lockHandle   File         // Locked while the store is open, see lockfile.go
+	holder       LockInfo     // Recorded while the store is open, see holder.go
+	epoch        uint64       // Taken by New, see epoch.go
+	readOnly     bool         // Set by NewReadOnly
+	closed       bool         // Set by Close
+	mutations    uint64       // Counted by mutated, see ListVersion
+	options                   // Set by options passed to New, see options.go
+}
+
+// Entry describes a live file in the store.
+type Entry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
 }
 
-// normalizeName turns the filename into a normalized file name.
+// Version describes a historic version of a file.
+type Version struct {
+	Generation uint64
+	Size       int64
+	ModTime    time.Time   // Modification time of the file when the version was captured
+	Meta       *CommitMeta // Written with OverwriteWithMeta, nil if there is none
+}
+
+// normalizeName turns the filename into a normalized file name, which is
+// a relative slash-separated path that can't point outside of the store.
+// Both slashes and backslashes separate path elements. Elements don't begin
+// or end with a dot and `@` characters are replaced.
 // If `history` is true, the `@` character before the version number is preserved.
-func normalizeName(filename string, history bool) (normalized string) {
-	normalized = strings.Trim(filepath.Clean(filename), "/\\.")
-	normalized = strings.ReplaceAll(normalized, "/", "_")
-	normalized = strings.ReplaceAll(normalized, "\\", "_")
-	normalized = strings.ReplaceAll(normalized, string(filepath.Separator), "_")
-	if history {
-		c := strings.Count(normalized, "@")
-		return strings.Replace(normalized, "@", "_", c-1)
+func normalizeName(filename string, history bool) string {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	filename = strings.ReplaceAll(filename, string(filepath.Separator), "/")
+	elements := []string{}
+	for _, e := range strings.Split(path.Clean("/"+filename), "/") {
+		if e = strings.Trim(e, "."); e != "" {
+			elements = append(elements, e)
+		}
 	}
-	return strings.ReplaceAll(normalized, "@", "_")
+	for i, e := range elements {
+		c := strings.Count(e, "@")
+		if history && i == len(elements)-1 {
+			c--
+		}
+		elements[i] = strings.Replace(e, "@", "_", c)
+	}
+	return strings.Join(elements, "/")
+}
+
+// isMetadata reports whether an entry of the history directory holds the
+// store's own metadata. Normalized names never begin with a dot, so such
+// names are reserved for it.
+func isMetadata(name string) bool {
+	return strings.HasPrefix(name, ".")
 }
 
 // normalize ensures that all file names are normalized.
 func (S *Store) normalize() error {
-	// TODO: Handle superfluous directories
-
-	dir, err := os.ReadDir(filepath.Join(S.Directory, ".history"))
-	if err != nil {
+	if err := S.normalizeDir(S.historyDir(), true); err != nil {
 		return fmt.Errorf("normalize %s: %w", S.Directory, err)
 	}
-	for _, entry := range dir {
-		norm := normalizeName(entry.Name(), true)
-		if norm != entry.Name() {
-			if err = os.Rename(filepath.Join(S.Directory, ".history", entry.Name()), filepath.Join(S.Directory, ".history", norm)); err != nil {
-				return fmt.Errorf("normalize %s: %w", S.Directory, err)
-			}
-		}
+	if err := S.normalizeDir(S.Directory, false); err != nil {
+		return fmt.Errorf("normalize %s: %w", S.Directory, err)
 	}
+	return nil
+}
 
-	dir, err = os.ReadDir(S.Directory)
+// normalizeDir renames the entries of the directory and its subdirectories
+// whose names aren't normalized. If `history` is true, names of files are
+// expected to carry a version and metadata is left alone.
+func (S *Store) normalizeDir(dir string, history bool) error {
+	entries, err := S.fs().ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("normalize %s: %w", S.Directory, err)
+		return err
 	}
-	for _, entry := range dir {
-		norm := normalizeName(entry.Name(), false)
-		if norm != entry.Name() && entry.Name() != ".history" {
-			if err = os.Rename(filepath.Join(S.Directory, entry.Name()), filepath.Join(S.Directory, norm)); err != nil {
-				return fmt.Errorf("normalize %s: %w", S.Directory, err)
+	for _, entry := range entries {
+		if history && isMetadata(entry.Name()) || dir == S.Directory && entry.Name() == S.historyName() {
+			continue
+		}
+		norm := normalizeName(entry.Name(), history && !entry.IsDir())
+		if norm == "" {
+			continue // Nothing sensible to rename it to.
+		}
+		if norm != entry.Name() {
+			target := filepath.Join(dir, filepath.FromSlash(norm))
+			if err := S.fs().MkdirAll(filepath.Dir(target), S.dirPerm()); err != nil {
+				return err
+			}
+			if err := S.fs().Rename(filepath.Join(dir, entry.Name()), target); err != nil {
+				return err
+			}
+		}
+		if entry.IsDir() {
+			if err := S.normalizeDir(filepath.Join(dir, filepath.FromSlash(norm)), history); err != nil {
+				return err
 			}
 		}
 	}
-
 	return nil
 }
 
-// generation reads the file name and returns value of the number after the last `@` sign.
-// If there is no generation specified or there is a parsing error, 0 is returned.
-func generation(filename string) (generation uint64) {
-	if filename == "" {
-		return 0
-	}
-	filename = strings.TrimRight(filename, "/")
-	for i := len(filename) - 2; i >= 0; i-- {
-		switch filename[i] {
-		case '/', '\\':
-			return 0
-		case '@':
-			generation, _ = strconv.ParseUint(filename[i+1:], 10, 64)
-			return
+// walkFiles calls fn for every live file, or every history entry if `history`
+// is true, passing its slash-separated path relative to the root of the tree.
+// The history directory and metadata are skipped.
+func (S *Store) walkFiles(history bool, fn func(name string, entry fs.DirEntry) error) error {
+	root := S.filePath("", history)
+	return walkDir(S.fs(), root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if history && isMetadata(entry.Name()) || !history && path == S.historyDir() {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), entry)
+	})
+}
+
+// parseVersion splits the canonical name of a history entry into the name of the file and
+// the generation, which is the number after the last `@` sign of the final path element.
+// A suffix beginning with a dot, which marks the encoding of a history entry, is ignored.
+// If there is no generation specified or there is a parsing error, the generation is 0.
+// Only slashes separate path elements, on every platform, so paths obtained from
+// the filesystem must be converted with filepath.ToSlash first.
+func parseVersion(name string) (string, uint64) {
+	name = strings.TrimRight(name, "/")
+	i := strings.LastIndexByte(name, '@')
+	if i < 0 || strings.IndexByte(name[i:], '/') >= 0 {
+		return name, 0
+	}
+	digits := name[i+1:]
+	if j := strings.IndexByte(digits, '.'); j >= 0 {
+		digits = digits[:j]
 	}
-	return
+	generation, _ := strconv.ParseUint(digits, 10, 64)
+	return name[:i], generation
+}
+
+// generation returns the generation of a history entry. See parseVersion.
+func generation(filename string) uint64 {
+	_, g := parseVersion(filename)
+	return g
 }
 
-// baseName strips version info (text after `@`) from the file name.
+// baseName strips version info (text after `@`) from the name of a history entry.
 func baseName(filename string) string {
-	return strings.Split(filename, "@")[0]
+	name, _ := parseVersion(filename)
+	return name
 }
 
 // initGeneration sets the generation to the maximal present
-// in the .history directory.
+// in the .history directory. See also loadGeneration.
 func (S *Store) initGeneration() error {
-	dir, err := os.ReadDir(S.Directory + "/.history")
-	if err != nil {
-		return fmt.Errorf("initGeneration %s: %w", S.Directory, err)
-	}
-	for _, entry := range dir {
-		if g := generation(entry.Name()); g > S.Generation {
+	err := S.walkFiles(true, func(name string, _ fs.DirEntry) error {
+		if g := generation(name); g > S.Generation {
 			S.Generation = g
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("initGeneration %s: %w", S.Directory, err)
 	}
 	return nil
 }
@@ -119,53 +232,263 @@ func (S *Store) initGeneration() error {
 // GetGeneration increments current generation if the argument is true and returns it.
 func (S *Store) GetGeneration(increment bool) uint64 {
 	if increment {
-		return atomic.AddUint64(&S.Generation, 1)
+		g := atomic.AddUint64(&S.Generation, 1)
+		S.persistGeneration(g)
+		return g
 	} else {
 		return S.Generation
 	}
 }
 
-// New opens or creates a new store.
-func New(root string) (Store, error) {
+// ReserveGenerations allocates a contiguous block of n generations and
+// returns the first of them, or 0 if n isn't positive. The store won't
+// assign them to any other version, even after it is reopened, unless
+// its counter file is lost, see generation.go.
+func (S *Store) ReserveGenerations(n int) (start uint64) {
+	if n <= 0 {
+		return 0
+	}
+	end := atomic.AddUint64(&S.Generation, uint64(n))
+	S.persistGeneration(end)
+	return end - uint64(n) + 1
+}
+
+// New opens or creates a new store, configured by the given options.
+// The store is locked, so that no other process can open it until it's
+// closed with Close. If it's open elsewhere, the returned error wraps ErrLocked.
+func New(root string, opts ...Option) (Store, error) {
 	S := Store{Directory: root, Generation: 0}
-	if err := os.MkdirAll(root, 0755); err != nil {
+	if err := S.apply(opts); err != nil {
+		return S, fmt.Errorf("new: %w", err)
+	}
+	if err := S.fs().MkdirAll(root, S.dirPerm()); err != nil {
+		return S, fmt.Errorf("new: %w", err)
+	}
+	if err := S.fs().MkdirAll(S.historyDir(), S.dirPerm()); err != nil {
+		return S, fmt.Errorf("new: %w", err)
+	}
+	if err := S.acquire(); err != nil {
+		return S, fmt.Errorf("new: %w", err)
+	}
+	if err := S.takeEpoch(); err != nil {
+		S.Close()
+		return S, fmt.Errorf("new: %w", err)
+	}
+	if !S.noNormalize {
+		if err := S.normalize(); err != nil {
+			S.Close()
+			return S, fmt.Errorf("new: %w", err)
+		}
+	}
+	if err := S.openIndex(); err != nil {
+		S.Close()
 		return S, fmt.Errorf("new: %w", err)
 	}
-	if err := os.MkdirAll(root+"/.history", 0755); err != nil {
+	if err := S.loadDirs(); err != nil {
+		S.Close()
 		return S, fmt.Errorf("new: %w", err)
 	}
-	if err := S.normalize(); err != nil {
+	if err := S.loadGeneration(); err != nil {
+		S.Close()
+		return S, fmt.Errorf("new: %w", err)
+	}
+	S.counter = &counter{}
+	S.persistGeneration(S.Generation)
+	S.hashes = &hashCache{}
+	S.subs = &subscribers{}
+	caps, err := S.probe()
+	if err != nil {
+		S.Close()
 		return S, fmt.Errorf("new: %w", err)
 	}
-	if err := S.initGeneration(); err != nil {
+	S.capabilities = caps
+	S.names = &nameCache{}
+	S.locks = newLocks()
+	S.ops = newOperations()
+	if err := S.recoverTx(); err != nil {
+		S.Close()
 		return S, fmt.Errorf("new: %w", err)
 	}
 	return S, nil
 }
 
+// NewReadOnly opens an existing store for reading. Any number of processes
+// may open the store this way at once, but not while it's open with New.
+// Names aren't normalized, nothing is created in the store's directory
+// and modifications fail with ErrReadOnly. Of the options, only
+// WithHistoryDir, WithPersistentIndex and WithBackend have any effect.
+func NewReadOnly(root string, opts ...Option) (Store, error) {
+	S := Store{Directory: root, Generation: 0, readOnly: true}
+	if err := S.apply(opts); err != nil {
+		return S, fmt.Errorf("newReadOnly: %w", err)
+	}
+	if info, err := S.fs().Stat(S.historyDir()); err != nil {
+		return S, fmt.Errorf("newReadOnly: %w", err)
+	} else if !info.IsDir() {
+		return S, fmt.Errorf("newReadOnly: %s is not a directory", S.historyDir())
+	}
+	if err := S.acquire(); err != nil {
+		return S, fmt.Errorf("newReadOnly: %w", err)
+	}
+	if err := S.openIndex(); err != nil {
+		S.Close()
+		return S, fmt.Errorf("newReadOnly: %w", err)
+	}
+	if err := S.loadGeneration(); err != nil {
+		S.Close()
+		return S, fmt.Errorf("newReadOnly: %w", err)
+	}
+	S.locks = newLocks()
+	S.ops = newOperations()
+	return S, nil
+}
+
 // filePath returns the filesystem path to the file with the given name.
 // If `history` is true, then the path will point to the file in the
 // history directory, but a generation number needs to be appended to it
 // for it to be useful. The file name is normalized.
 func (S *Store) filePath(name string, history bool) string {
 	if history {
-		return filepath.Join(S.Directory, ".history", normalizeName(name, false))
+		return filepath.Join(S.historyDir(), filepath.FromSlash(normalizeName(name, false)))
 	} else {
-		return filepath.Join(S.Directory, normalizeName(name, false))
+		return filepath.Join(S.Directory, filepath.FromSlash(normalizeName(name, false)))
+	}
+}
+
+// makeParent creates the directories containing the live file.
+func (S *Store) makeParent(file string) error {
+	return S.fs().MkdirAll(filepath.Dir(S.filePath(file, false)), S.dirPerm())
+}
+
+// pruneParent removes the directories containing the live file
+// which were left empty, up to the store root. Directories created
+// with Mkdir are kept.
+func (S *Store) pruneParent(file string) {
+	root := filepath.Clean(S.Directory)
+	for dir := filepath.Dir(S.filePath(file, false)); len(dir) > len(root); dir = filepath.Dir(dir) {
+		if rel, err := filepath.Rel(root, dir); err != nil || S.dirs.has(filepath.ToSlash(rel)) {
+			return
+		}
+		if S.fs().Remove(dir) != nil {
+			return
+		}
 	}
 }
 
+// versionPath returns the filesystem path to the given historic version
+// of the file. The file name is normalized.
+func (S *Store) versionPath(file string, generation uint64) string {
+	return S.filePath(file, true) + "@" + strconv.FormatUint(generation, 10)
+}
+
+// encoding is the way a historic version is stored, marked by the suffix
+// of its history entry.
+type encoding int
+
+const (
+	plain      encoding = iota // A copy of the file
+	chunked                    // A manifest of chunks, see chunk.go
+	compressed                 // A compressed copy, see compress.go
+	delta                      // A delta against another version, see delta.go
+)
+
+// suffixes of the history entries of the encodings.
+var suffixes = [...]string{plain: "", chunked: chunkedSuffix, compressed: compressedSuffix, delta: deltaSuffix}
+
+// versionEntry returns the path to the history entry holding the given
+// version of the file and how the version is stored.
+func (S *Store) versionEntry(file string, generation uint64) (string, encoding, error) {
+	path := S.versionPath(file, generation)
+	for enc, suffix := range suffixes {
+		if _, err := S.fs().Stat(path + suffix); err == nil {
+			return path + suffix, encoding(enc), nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", plain, err
+		}
+	}
+	return "", plain, ErrVersionNotFound
+}
+
+// versionInfo returns information about the given historic version of the file.
+func (S *Store) versionInfo(file string, generation uint64) (Version, error) {
+	path, enc, err := S.versionEntry(file, generation)
+	if err != nil {
+		return Version{}, err
+	}
+	info, err := S.fs().Stat(path)
+	if err != nil {
+		return Version{}, err
+	}
+	meta, err := S.readMeta(file, generation)
+	if err != nil {
+		return Version{}, err
+	}
+	v := Version{Generation: generation, Size: info.Size(), ModTime: info.ModTime(), Meta: meta}
+	switch enc {
+	case chunked:
+		refs, err := readManifest(S.fs(), path)
+		if err != nil {
+			return Version{}, err
+		}
+		v.Size = 0
+		for _, ref := range refs {
+			v.Size += ref.size
+		}
+	case compressed:
+		if v.Size, err = compressedSize(S.fs(), path); err != nil {
+			return Version{}, err
+		}
+	case delta:
+		h, err := deltaInfo(S.fs(), path)
+		if err != nil {
+			return Version{}, err
+		}
+		v.Size = h.size
+	}
+	return v, nil
+}
+
+// equalsVersion reports whether the file at the given path has the same
+// content as the given historic version of the file.
+func (S *Store) equalsVersion(path, file string, generation uint64) (bool, error) {
+	version, enc, err := S.versionEntry(file, generation)
+	if err != nil {
+		return false, err
+	}
+	switch enc {
+	case chunked:
+		return S.compareChunked(path, version)
+	case compressed:
+		return compareCompressed(S.fs(), path, version)
+	case delta:
+		return S.compareDelta(path, file, version)
+	}
+	return compareFiles(S.fs(), path, version)
+}
+
 // History returns generations available for the given file.
 // The name is normalized
 func (S *Store) History(file string) ([]uint64, error) {
 	generations := []uint64{}
 	file = normalizeName(file, false)
-	dir, err := os.ReadDir(filepath.Join(S.Directory, ".history"))
-	if err != nil {
+	if file == "" {
+		return generations, nil
+	}
+	if S.index != nil {
+		return S.index.get(file), nil
+	}
+	var dir []fs.DirEntry
+	err := S.retry(func() (err error) {
+		dir, err = S.fs().ReadDir(filepath.Dir(S.filePath(file, true)))
+		return
+	})
+	if errors.Is(err, os.ErrNotExist) && strings.Contains(file, "/") {
+		return generations, nil // No history in this directory yet.
+	} else if err != nil {
 		return generations, fmt.Errorf("history %s: %w", file, err)
 	}
 	for _, entry := range dir {
-		if n := entry.Name(); strings.HasPrefix(n, filepath.Base(file)+"@") {
+		if n := entry.Name(); !entry.IsDir() && strings.HasPrefix(n, path.Base(file)+"@") {
 			if g := generation(n); g != 0 {
 				generations = append(generations, g)
 			}
@@ -176,41 +499,145 @@ func (S *Store) History(file string) ([]uint64, error) {
 	return generations, nil
 }
 
+// ModTime returns the modification time of the live file, if generation
+// is 0, or of the given historic version, which is the modification time of
+// the file when the version was captured. Unlike HistoryInfo, it doesn't
+// read the content of any version.
+func (S *Store) ModTime(file string, generation uint64) (time.Time, error) {
+	path := S.filePath(file, false)
+	if generation != 0 {
+		var err error
+		if path, _, err = S.versionEntry(file, generation); err != nil {
+			return time.Time{}, &StoreError{Op: "modTime", Name: file, Generation: generation, Err: err}
+		}
+	}
+	info, err := S.fs().Stat(path)
+	if err != nil {
+		return time.Time{}, &StoreError{Op: "modTime", Name: file, Generation: generation, Err: err}
+	}
+	return info.ModTime(), nil
+}
+
+// HistoryInfo returns the available versions of the given file,
+// starting from the newest. The name is normalized. Pruned tells whether
+// GC removed any older versions.
+func (S *Store) HistoryInfo(file string) ([]Version, error) {
+	versions := []Version{}
+	generations, err := S.History(file)
+	if err != nil {
+		return versions, fmt.Errorf("historyInfo %s: %w", file, err)
+	}
+	for _, g := range generations {
+		v, err := S.versionInfo(file, g)
+		if err != nil {
+			return versions, fmt.Errorf("historyInfo %s: %w", file, err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
 // recordHistory backups a file. If the file doesn't exist or the current
 // version is already saved, it does nothing. The file name is normalized.
 func (S *Store) recordHistory(file string) error {
+	return S.recordHistoryAs(file, func() uint64 { return S.GetGeneration(true) })
+}
+
+// recordHistoryAs works like recordHistory, but the generation of the
+// captured version is obtained from next, which is only called if the
+// file actually needs to be captured.
+func (S *Store) recordHistoryAs(file string, next func() uint64) error {
 	file = normalizeName(file, false)
 	path := S.filePath(file, false)
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+	var info fs.FileInfo
+	err := S.retry(func() (err error) {
+		info, err = S.fs().Stat(path)
+		return
+	})
+	if errors.Is(err, os.ErrNotExist) {
 		return nil // File doesn't exist.
+	} else if err != nil {
+		return fmt.Errorf("recordHistory %s: %w", file, err)
 	}
 	generations, err := S.History(file)
 	if err != nil {
 		return fmt.Errorf("recordHistory %s: %w", file, err)
 	}
+	if len(generations) == 0 && S.isPlaceholder(file, info) {
+		return nil // Nothing was written to it yet.
+	}
+	var hash string
 	if len(generations) != 0 {
-		latest := S.filePath(file, true) + "@" + strconv.FormatUint(generations[0], 10)
-		if eq, err := compareFiles(path, latest); err != nil {
+		var eq bool
+		if eq, hash, err = S.unchanged(path, info, file, generations[0]); err != nil {
 			return fmt.Errorf("recordHistory %s: %w", file, err)
 		} else if eq {
 			return nil // This version is already saved
 		}
 	}
-	// Capturing
-	if err := copyFile(path, S.filePath(file, true)+"@"+strconv.FormatUint(S.GetGeneration(true), 10), false); err != nil {
+	// Capturing, with the modification time of the file preserved
+	g := next()
+	version, err := S.writeVersion(path, info.Size(), file, g, generations)
+	if err != nil {
+		return fmt.Errorf("recordHistory %s: %w", file, err)
+	}
+	S.index.add(file, g)
+	S.captureMeta(file, g)
+	if hash != "" {
+		S.hashes.set(file+"@"+strconv.FormatUint(g, 10), hash)
+	}
+	if err = S.fs().Chtimes(version, info.ModTime(), info.ModTime()); err != nil {
 		return fmt.Errorf("recordHistory %s: %w", file, err)
 	}
 	return nil
 }
 
+// writeVersion writes the file at path, of the given size, to history as
+// the given version of the file, chunked, delta-encoded against the newest
+// of the previous generations or in full, according to the options. It
+// returns the path of the history entry.
+func (S *Store) writeVersion(path string, size int64, file string, generation uint64, previous []uint64) (string, error) {
+	version := S.versionPath(file, generation)
+	p := Progress{Op: "recordHistory", Name: file, Total: size}
+	if S.dedup || S.ChunkThreshold > 0 && size >= S.ChunkThreshold {
+		version += chunkedSuffix
+		return version, S.retry(func() error { return S.writeChunked(path, version, p) })
+	}
+	if S.delta && len(previous) != 0 {
+		stored := false
+		err := S.retry(func() (err error) {
+			stored, err = S.writeDelta(path, file, previous[0], version+deltaSuffix)
+			return
+		})
+		if stored {
+			p.Copied = p.Total
+			S.report(p)
+		}
+		if err != nil || stored {
+			return version + deltaSuffix, err
+		}
+	}
+	return S.writeFull(path, version, p)
+}
+
+// writeFull writes the file at path to history as the given version in
+// full, compressed if compression is enabled, reporting the progress p.
+// It returns the path of the history entry.
+func (S *Store) writeFull(path, version string, p Progress) (string, error) {
+	if S.compression != NoCompression {
+		version += compressedSuffix
+		return version, S.retry(func() error { return S.writeCompressed(path, version, p) })
+	}
+	return version, S.retry(func() error { return S.copyFile(path, version, false, p) })
+}
+
 // compareFiles return true if both files are equal.
-// Based on https://stackoverflow.com/a/30038571
-func compareFiles(file1, file2 string) (bool, error) {
-	f1s, err := os.Stat(file1)
+func compareFiles(fsys Backend, file1, file2 string) (bool, error) {
+	f1s, err := fsys.Stat(file1)
 	if err != nil {
 		return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err)
 	}
-	f2s, err := os.Stat(file2)
+	f2s, err := fsys.Stat(file2)
 	if err != nil {
 		return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err)
 	}
@@ -218,47 +645,64 @@ func compareFiles(file1, file2 string) (bool, error) {
 		return false, nil
 	}
 
-	f1, err := os.Open(file1)
+	f1, err := fsys.Open(file1)
 	if err != nil {
 		return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err)
 	}
-	f2, err := os.Open(file2)
+	defer f1.Close()
+	f2, err := fsys.Open(file2)
+	if err != nil {
+		return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err)
+	}
+	defer f2.Close()
+	eq, err := compareReaders(f1, f2)
 	if err != nil {
 		return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err)
 	}
+	return eq, nil
+}
+
+// compareBuffers holds pairs of buffers used by compareReaders.
+var compareBuffers = sync.Pool{New: func() interface{} { return new([2][64 * 1024]byte) }}
 
+// compareReaders returns true if both readers have the same content. They
+// are read in full blocks, so short reads don't affect the result, and
+// reading stops at the first difference.
+func compareReaders(r1, r2 io.Reader) (bool, error) {
+	bufs := compareBuffers.Get().(*[2][64 * 1024]byte)
+	defer compareBuffers.Put(bufs)
+	b1, b2 := bufs[0][:], bufs[1][:]
 	for {
-		b1 := make([]byte, 64000)
-		_, err1 := f1.Read(b1)
-		b2 := make([]byte, 64000)
-		_, err2 := f2.Read(b2)
-		if err1 != nil || err2 != nil {
-			if err1 == io.EOF && err2 == io.EOF {
-				return true, nil
-			} else if err1 == io.EOF || err2 == io.EOF {
-				return false, nil
-			} else if err1 != nil {
-				return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err1)
-			} else {
-				return false, fmt.Errorf("compareFiles %s %s: %w", file1, file2, err2)
-			}
+		n1, err1 := io.ReadFull(r1, b1)
+		n2, err2 := io.ReadFull(r2, b2)
+		end1 := err1 == io.EOF || err1 == io.ErrUnexpectedEOF
+		end2 := err2 == io.EOF || err2 == io.ErrUnexpectedEOF
+		if err1 != nil && !end1 {
+			return false, err1
+		}
+		if err2 != nil && !end2 {
+			return false, err2
 		}
-		if !bytes.Equal(b1, b2) {
+		if !bytes.Equal(b1[:n1], b2[:n2]) {
 			return false, nil
 		}
+		if end1 || end2 {
+			return end1 && end2, nil
+		}
 	}
 }
 
 // copyFile is a helper function to copy files. If overwrite flag is set
 // to false and the target file exists, the file will not be copied
-// and an error will be returned.
-func copyFile(from, to string, overwrite bool) error {
-	f1, err := os.Open(from)
+// and an error will be returned. If copying fails midway, the partially
+// written target is removed. The progress p is reported as it copies.
+func (S *Store) copyFile(from, to string, overwrite bool, p Progress) error {
+	f1, err := S.fs().Open(from)
 	if err != nil {
 		return fmt.Errorf("copyFile %s %s: %w", from, to, err)
 	}
 	defer f1.Close()
-	if err = os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+	if err = S.fs().MkdirAll(filepath.Dir(to), S.dirPerm()); err != nil {
 		return fmt.Errorf("copyFile %s %s: %w", from, to, err)
 	}
 	flags := 0
@@ -267,109 +711,416 @@ func copyFile(from, to string, overwrite bool) error {
 	} else {
 		flags = os.O_CREATE | os.O_WRONLY | os.O_EXCL
 	}
-	f2, err := os.OpenFile(to, flags, 0644)
+	f2, err := S.fs().OpenFile(to, flags, S.filePerm())
 	if err != nil {
 		return fmt.Errorf("copyFile %s %s: %w", from, to, err)
 	}
-	defer f2.Close()
-	if _, err = io.Copy(f2, f1); err != nil {
+	if err = S.copyContent(f2, f1, p); err != nil {
+		f2.Close()
+		S.fs().Remove(to)
+		return fmt.Errorf("copyFile %s %s: %w", from, to, err)
+	}
+	if err = f2.Close(); err != nil {
+		S.fs().Remove(to)
 		return fmt.Errorf("copyFile %s %s: %w", from, to, err)
 	}
 	return nil
 }
 
-// Overwrite returns a file descriptor for writing.
-// If the file exists, it is truncated.
-func (S *Store) Overwrite(file string) (*os.File, error) {
-	if err := S.recordHistory(file); err != nil {
-		return nil, fmt.Errorf("overwrite %s: %w", file, err)
+// Overwrite returns a writer of the new content of the file. The content
+// replaces the file only when the writer is closed, see Writer.
+func (S *Store) Overwrite(file string) (*Writer, error) {
+	if err := S.writable(); err != nil {
+		return nil, &StoreError{Op: "overwrite", Name: file, Err: err}
 	}
-	f, err := os.OpenFile(S.filePath(file, false), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err := S.checkName(file); err != nil {
+		return nil, &StoreError{Op: "overwrite", Name: file, Err: err}
+	}
+	if err := S.locks.enter(); err != nil {
+		return nil, &StoreError{Op: "overwrite", Name: file, Err: err}
+	}
+	var f File
+	err := S.retry(func() (err error) {
+		f, err = S.fs().CreateTemp(S.historyDir(), ".tmp-")
+		return
+	})
 	if err != nil {
-		return f, fmt.Errorf("overwrite %s: %w", file, err)
-	} else {
-		return f, nil
+		S.locks.leave()
+		return nil, &StoreError{Op: "overwrite", Name: file, Err: err}
 	}
+	if err := f.Chmod(S.filePerm()); err != nil {
+		f.Close()
+		S.fs().Remove(f.Name())
+		S.locks.leave()
+		return nil, &StoreError{Op: "overwrite", Name: file, Err: err}
+	}
+	return &Writer{File: f, store: S, file: file}, nil
 }
 
 // Open opens given file for reading. If generation is non-zero, it opens a historic version.
-func (S *Store) Open(file string, generation uint64) (*os.File, error) {
+// Versions stored in chunks are reassembled into a temporary file first, and so is content
+// decoded by the read pipeline, see WithReadStages.
+func (S *Store) Open(file string, generation uint64) (File, error) {
+	defer S.lock()()
+	return S.openDecoded(file, generation)
+}
+
+// open implements Open.
+func (S *Store) open(file string, generation uint64) (File, error) {
 	if generation == 0 {
-		f, err := os.Open(S.filePath(file, false))
+		var f File
+		err := S.retry(func() (err error) {
+			f, err = S.fs().Open(S.filePath(file, false))
+			return
+		})
 		if err != nil {
-			return f, fmt.Errorf("open %s: %w", file, err)
+			return f, &StoreError{Op: "open", Name: file, Generation: generation, Err: err}
 		} else {
 			return f, nil
 		}
 	} else {
-		f, err := os.Open(S.filePath(file, true) + "@" + strconv.FormatUint(generation, 10))
+		path, enc, err := S.versionEntry(file, generation)
 		if err != nil {
-			return f, fmt.Errorf("open %s: %w", file, err)
+			return nil, &StoreError{Op: "open", Name: file, Generation: generation, Err: err}
+		}
+		var f File
+		err = S.retry(func() (err error) {
+			switch enc {
+			case chunked:
+				f, err = S.materialize(path)
+			case compressed:
+				f, err = S.decompress(path)
+			case delta:
+				f, err = S.openDelta(file, path)
+			default:
+				f, err = S.fs().Open(path)
+			}
+			return
+		})
+		if err != nil {
+			return f, &StoreError{Op: "open", Name: file, Generation: generation, Err: err}
 		} else {
 			return f, nil
 		}
 	}
 }
 
-// Copy copies a file.
+// OpenAt opens the version of the file which was current at the given time,
+// i.e. the newest version last modified at or before it. It's the live file
+// if it hasn't been modified since. Modification times which are out of
+// order are resolved according to the clock policy, see WithClockPolicy.
+// If there is no such version, the returned error wraps os.ErrNotExist.
+func (S *Store) OpenAt(file string, t time.Time) (File, error) {
+	defer S.lock()()
+	versions, err := S.HistoryInfo(file)
+	if err != nil {
+		return nil, fmt.Errorf("openAt %s: %w", file, err)
+	}
+	if info, err := S.fs().Stat(S.filePath(file, false)); err == nil {
+		versions = append([]Version{{ModTime: info.ModTime()}}, versions...)
+	}
+	times := make([]time.Time, len(versions))
+	for i, v := range versions {
+		times[i] = v.ModTime
+	}
+	S.resolveTimes(times)
+	for i, v := range versions {
+		if !times[i].After(t) {
+			f, err := S.openDecoded(file, v.Generation)
+			if err != nil {
+				return nil, fmt.Errorf("openAt %s: %w", file, err)
+			}
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("openAt %s: %w", file, os.ErrNotExist)
+}
+
+// stage copies the file at the given path to a temporary file in the
+// history directory and returns its path, reporting the progress p. The
+// temporary file can then be atomically renamed to its final location.
+func (S *Store) stage(from string, p Progress) (string, error) {
+	f1, err := S.fs().Open(from)
+	if err != nil {
+		return "", fmt.Errorf("stage %s: %w", from, err)
+	}
+	defer f1.Close()
+	return S.stageFile(f1, p)
+}
+
+// stageFile works like stage, but copies the content of an open file
+// from its current offset.
+func (S *Store) stageFile(f1 File, p Progress) (string, error) {
+	f2, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("stage %s: %w", f1.Name(), err)
+	}
+	if err = f2.Chmod(S.filePerm()); err != nil {
+		f2.Close()
+		S.fs().Remove(f2.Name())
+		return "", fmt.Errorf("stage %s: %w", f1.Name(), err)
+	}
+	if err = S.copyContent(f2, f1, p); err != nil {
+		f2.Close()
+		S.fs().Remove(f2.Name())
+		return "", fmt.Errorf("stage %s: %w", f1.Name(), err)
+	}
+	if err = f2.Sync(); err != nil {
+		f2.Close()
+		S.fs().Remove(f2.Name())
+		return "", fmt.Errorf("stage %s: %w", f1.Name(), err)
+	}
+	if err = f2.Close(); err != nil {
+		S.fs().Remove(f2.Name())
+		return "", fmt.Errorf("stage %s: %w", f1.Name(), err)
+	}
+	return f2.Name(), nil
+}
+
+// Copy copies a file. The source is copied to a temporary file first,
+// so if it is missing or unreadable, neither the destination nor its
+// history is modified.
 func (S *Store) Copy(from, to string) error {
-	if err := S.recordHistory(to); err != nil {
-		return fmt.Errorf("copy %s %s: %w", from, to, err)
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "copy", Name: from, To: to, Err: err}
 	}
-	if err := copyFile(S.filePath(from, false), S.filePath(to, false), true); err != nil {
-		return fmt.Errorf("copy %s %s: %w", from, to, err)
+	defer S.lock(from, to)()
+	if err := S.copy(from, to, func() uint64 { return S.GetGeneration(true) }); err != nil {
+		return &StoreError{Op: "copy", Name: from, To: to, Err: err}
 	}
 	return nil
 }
 
-// Move moves a file.
+// copy implements Copy, capturing history with generations obtained from next.
+func (S *Store) copy(from, to string, next func() uint64) error {
+	if err := S.checkName(to); err != nil {
+		return err
+	}
+	var g uint64
+	next = tracked(next, &g)
+	var tmp string
+	err := S.retry(func() (err error) {
+		tmp, err = S.stage(S.filePath(from, false), Progress{Op: "copy", Name: normalizeName(from, false)})
+		return
+	})
+	if err != nil {
+		return err
+	}
+	if err := S.recordHistoryAs(to, next); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.makeParent(to); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.retry(func() error { return S.fs().Rename(tmp, S.filePath(to, false)) }); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.copyMeta(from, to); err != nil {
+		return err
+	}
+	S.emit(Event{Kind: EventCopy, Name: normalizeName(from, false), To: normalizeName(to, false), Generation: g}, g)
+	return S.syncDir(filepath.Dir(S.filePath(to, false)))
+}
+
+// Move moves a file. If the source doesn't exist, nothing is modified.
 func (S *Store) Move(from, to string) error {
-	if err := S.recordHistory(to); err != nil {
-		return fmt.Errorf("move %s %s: %w", from, to, err)
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "move", Name: from, To: to, Err: err}
+	}
+	defer S.lock(from, to)()
+	if err := S.move(from, to, func() uint64 { return S.GetGeneration(true) }); err != nil {
+		return &StoreError{Op: "move", Name: from, To: to, Err: err}
+	}
+	return nil
+}
+
+// move implements Move, capturing history with generations obtained from next.
+func (S *Store) move(from, to string, next func() uint64) error {
+	if err := S.checkName(to); err != nil {
+		return err
 	}
-	if err := S.recordHistory(from); err != nil {
-		return fmt.Errorf("move %s %s: %w", from, to, err)
+	var g uint64
+	next = tracked(next, &g)
+	if _, err := S.fs().Stat(S.filePath(from, false)); err != nil {
+		return err
+	}
+	// Capturing the source moves its description to history.
+	meta, err := S.readMeta(from, 0)
+	if err != nil {
+		return err
 	}
-	if err := os.Rename(S.filePath(from, false), S.filePath(to, false)); err != nil {
-		return fmt.Errorf("move %s %s: %w", from, to, err)
+	if err := S.recordHistoryAs(to, next); err != nil {
+		return err
 	}
+	if err := S.recordHistoryAs(from, next); err != nil {
+		return err
+	}
+	if err := S.makeParent(to); err != nil {
+		return err
+	}
+	if err := S.retry(func() error { return S.fs().Rename(S.filePath(from, false), S.filePath(to, false)) }); err != nil {
+		return err
+	}
+	if err := S.setMeta(to, meta); err != nil {
+		return err
+	}
+	if err := S.setMeta(from, nil); err != nil {
+		return err
+	}
+	S.pruneParent(from)
+	S.invalidateDerived(from, 0)
+	S.emit(Event{Kind: EventMove, Name: normalizeName(from, false), To: normalizeName(to, false), Generation: g}, g)
 	return nil
 }
 
 // Remove removes a file.
 func (S *Store) Remove(file string) error {
-	if err := S.recordHistory(file); err != nil {
-		return fmt.Errorf("remove %s: %w", file, err)
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "remove", Name: file, Err: err}
+	}
+	defer S.lock(file)()
+	if err := S.remove(file, func() uint64 { return S.GetGeneration(true) }); err != nil {
+		return &StoreError{Op: "remove", Name: file, Err: err}
+	}
+	return nil
+}
+
+// remove implements Remove, capturing history with a generation obtained from next.
+func (S *Store) remove(file string, next func() uint64) error {
+	var g uint64
+	if err := S.recordHistoryAs(file, tracked(next, &g)); err != nil {
+		return err
+	}
+	if err := S.retry(func() error { return S.fs().Remove(S.filePath(file, false)) }); err != nil {
+		return err
+	}
+	if err := S.setMeta(file, nil); err != nil {
+		return err
+	}
+	S.pruneParent(file)
+	S.invalidateDerived(file, 0)
+	S.emit(Event{Kind: EventRemove, Name: normalizeName(file, false), Generation: g}, g)
+	return nil
+}
+
+// Restore reverts the file to the given historic version. The current
+// version is recorded to history first, like when the file is overwritten.
+func (S *Store) Restore(file string, generation uint64) error {
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "restore", Name: file, Generation: generation, Err: err}
 	}
-	if err := os.Remove(S.filePath(file, false)); err != nil {
-		return fmt.Errorf("remove %s: %w", file, err)
+	defer S.lock(file)()
+	if err := S.restore(file, file, generation); err != nil {
+		return &StoreError{Op: "restore", Name: file, Generation: generation, Err: err}
 	}
 	return nil
 }
 
-// Stat runs os.Stat on the specified file.
+// RestoreAs copies the given historic version of the file to the target,
+// recording the current version of the target to history first.
+func (S *Store) RestoreAs(file, target string, generation uint64) error {
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "restoreAs", Name: file, Generation: generation, To: target, Err: err}
+	}
+	defer S.lock(target)()
+	if err := S.restore(file, target, generation); err != nil {
+		return &StoreError{Op: "restoreAs", Name: file, Generation: generation, To: target, Err: err}
+	}
+	return nil
+}
+
+// restore implements Restore and RestoreAs. The version is staged first,
+// so if it is missing or unreadable, the target isn't modified.
+func (S *Store) restore(file, target string, generation uint64) error {
+	if err := S.checkName(target); err != nil {
+		return err
+	}
+	if generation == 0 {
+		return ErrVersionNotFound
+	}
+	src, err := S.open(file, generation)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var tmp string
+	err = S.retry(func() (err error) {
+		if _, err = src.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		tmp, err = S.stageFile(src, Progress{Op: "restore", Name: normalizeName(file, false)})
+		return
+	})
+	if err != nil {
+		return err
+	}
+	var g uint64
+	if err := S.recordHistoryAs(target, tracked(func() uint64 { return S.GetGeneration(true) }, &g)); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.makeParent(target); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.retry(func() error { return S.fs().Rename(tmp, S.filePath(target, false)) }); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.setMeta(target, nil); err != nil {
+		return err
+	}
+	e := Event{Kind: EventRestore, Name: normalizeName(file, false), Generation: generation}
+	if to := normalizeName(target, false); to != e.Name {
+		e.To = to
+	}
+	S.emit(e, g)
+	return S.syncDir(filepath.Dir(S.filePath(target, false)))
+}
+
+// Stat returns information about the specified file, like os.Stat.
 func (S *Store) Stat(file string, history bool) (fs.FileInfo, error) {
-	return os.Stat(S.filePath(file, history))
+	return S.fs().Stat(S.filePath(file, history))
 }
 
-// List lists all files. If history is true, returns all backed up files'
-// names, without the version string.
+// List lists all files, as slash-separated paths. If history is true,
+// returns all backed up files' names, without the version string.
 func (S *Store) List(history bool) ([]string, error) {
 	files := []string{}
-	dir, err := os.ReadDir(S.filePath("", history))
-	if err != nil {
-		return nil, fmt.Errorf("list: %w", err)
-	}
 	processed := make(map[string]bool)
-	for _, entry := range dir {
-		if entry.Name() == ".history" {
-			continue
-		}
-		file := baseName(entry.Name())
+	err := S.walkFiles(history, func(name string, _ fs.DirEntry) error {
+		file := baseName(name)
 		if !processed[file] {
 			files = append(files, file)
 			processed[file] = true
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list: %w", err)
 	}
 	return files, nil
 }
+
+// ListVersion returns a token which changes whenever the set of files
+// returned by List(false) changes, so that clients can cheaply poll
+// for changes and only fetch the listing when needed. The token also
+// changes when a new version of any file is captured. It's derived from
+// the generation and a count of the modifications made through the store
+// since it was opened, along with its Epoch, as the count starts over on
+// every New. So it's cheap, but it doesn't notice files changed behind
+// the store's back, and it may change when the set of files didn't, e.g.
+// when a file is written or the store is reopened.
+func (S *Store) ListVersion() (string, error) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%d\x00%d", S.epoch, S.GetGeneration(false), atomic.LoadUint64(&S.mutations))
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
+
+// mutated counts a modification of the live files, see ListVersion.
+func (S *Store) mutated() {
+	atomic.AddUint64(&S.mutations, 1)
+}
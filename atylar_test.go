@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestNormalizeName(t *testing.T) {
@@ -16,12 +17,19 @@ func TestNormalizeName(t *testing.T) {
 		outHistory string // when history=true; may be empty if the output should be the same as usual
 	}{
 		{"", "", ""},
-		{"/abc/def", "abc_def", ""},
-		{"abc/def", "abc_def", ""},
+		{"/abc/def", "abc/def", ""},
+		{"abc/def", "abc/def", ""},
+		{"abc\\def", "abc/def", ""},
+		{"abc//def/", "abc/def", ""},
 		{"abc-def/", "abc-def", ""},
 		{".hidden", "hidden", ""},
+		{"abc/.hidden/def", "abc/hidden/def", ""},
+		{"abc/../../def", "def", ""},
+		{"abc/.../def", "abc/def", ""},
 		{"abc@12", "abc_12", "abc@12"},
 		{"ab@b@3", "ab_b_3", "ab_b@3"},
+		{"a@1/b@2", "a_1/b_2", "a_1/b@2"},
+		{"a@1/b@2/...", "a_1/b_2", "a_1/b@2"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.in, func(t *testing.T) {
@@ -55,6 +63,12 @@ func TestGeneration(t *testing.T) {
 		{"@324", 324},
 		{"a@165", 165},
 		{"abcdefgh@431", 431},
+		{"abc@12.chunks", 12},
+		{"abc@.chunks", 0},
+		{"dir/abc@7", 7},
+		{"dir@3/abc", 0},
+		{"abc@5/", 5},
+		{"dir\\abc@7", 7},
 	}
 	for _, tt := range tests {
 		t.Run(tt.in, func(t *testing.T) {
@@ -80,6 +94,9 @@ func TestBaseName(t *testing.T) {
 		{"@324", ""},
 		{"a@165", "a"},
 		{"abcdefgh@431", "abcdefgh"},
+		{"abc@12.chunks", "abc"},
+		{"dir/abc@7", "dir/abc"},
+		{"dir@3/abc", "dir@3/abc"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.in, func(t *testing.T) {
@@ -91,7 +108,7 @@ func TestBaseName(t *testing.T) {
 }
 
 func TestFilePath(t *testing.T) {
-	S := Store{"/tmp/dir/", 42}
+	S := Store{Directory: "/tmp/dir/", Generation: 42}
 	tests := []struct {
 		in         string
 		out        string
@@ -101,7 +118,8 @@ func TestFilePath(t *testing.T) {
 		{"../file", "/tmp/dir/file", "/tmp/dir/.history/file"},
 		{"../../file", "/tmp/dir/file", "/tmp/dir/.history/file"},
 		{"file/../../", "/tmp/dir", "/tmp/dir/.history"},
-		{"dir/file", "/tmp/dir/dir_file", "/tmp/dir/.history/dir_file"},
+		{"dir/file", "/tmp/dir/dir/file", "/tmp/dir/.history/dir/file"},
+		{"dir/../../file", "/tmp/dir/file", "/tmp/dir/.history/file"},
 		{"file@1", "/tmp/dir/file_1", "/tmp/dir/.history/file_1"},
 	}
 	for _, tt := range tests {
@@ -154,7 +172,7 @@ func TestNormalize(t *testing.T) {
 		f.Close()
 	}
 
-	S := Store{d, 123}
+	S := Store{Directory: d, Generation: 123}
 	if err := S.normalize(); err != nil {
 		t.Fatal(err)
 	}
@@ -216,7 +234,7 @@ func TestInitGeneration(t *testing.T) {
 		if err := os.Mkdir(filepath.Join(d, ".history"), 0755); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		if err := S.initGeneration(); err != nil {
 			t.Error(err)
 		}
@@ -235,7 +253,7 @@ func TestInitGeneration(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc@14"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		if err := S.initGeneration(); err != nil {
 			t.Error(err)
 		}
@@ -251,7 +269,7 @@ func TestInitGeneration(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		if err := S.initGeneration(); err != nil {
 			t.Error(err)
 		}
@@ -267,7 +285,7 @@ func TestInitGeneration(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc@jkl"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		if err := S.initGeneration(); err != nil {
 			t.Error(err)
 		}
@@ -279,7 +297,7 @@ func TestInitGeneration(t *testing.T) {
 
 func TestGetGeneration(t *testing.T) {
 	d := t.TempDir()
-	S := Store{d, 0}
+	S := Store{Directory: d, Generation: 0}
 	if g := S.GetGeneration(false); g != 0 {
 		t.Error("Got", g, "but expected", 0)
 	}
@@ -297,13 +315,29 @@ func TestGetGeneration(t *testing.T) {
 	}
 }
 
+func TestReserveGenerations(t *testing.T) {
+	S := Store{Directory: t.TempDir(), Generation: 5}
+	if g := S.ReserveGenerations(0); g != 0 {
+		t.Error("Got", g, "but expected", 0)
+	}
+	if g := S.ReserveGenerations(3); g != 6 {
+		t.Error("Got", g, "but expected", 6)
+	}
+	if g := S.GetGeneration(true); g != 9 {
+		t.Error("Got", g, "but expected", 9)
+	}
+	if g := S.ReserveGenerations(1); g != 10 {
+		t.Error("Got", g, "but expected", 10)
+	}
+}
+
 func TestHistory(t *testing.T) {
 	t.Run("Nonexistent", func(t *testing.T) {
 		d := t.TempDir()
 		if err := os.Mkdir(filepath.Join(d, ".history"), 0755); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		h, err := S.History("abc")
 		if err != nil || len(h) != 0 {
 			t.Error("Expected [] <nil> but got", h, err)
@@ -320,7 +354,7 @@ func TestHistory(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc@14"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		h, err := S.History("abc")
 		if err != nil || len(h) != 2 || h[0] != 14 || h[1] != 12 {
 			t.Error("Expected [14 12] <nil> but got", h, err)
@@ -337,7 +371,7 @@ func TestHistory(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		h, err := S.History("abc")
 		if err != nil || len(h) != 1 || h[0] != 12 {
 			t.Error("Expected [12] <nil> but got", h, err)
@@ -351,7 +385,7 @@ func TestHistory(t *testing.T) {
 		if err := os.WriteFile(filepath.Join(d, ".history", "abc@jkl"), []byte{}, 0644); err != nil {
 			t.Error(err)
 		}
-		S := Store{d, 0}
+		S := Store{Directory: d, Generation: 0}
 		h, err := S.History("abc")
 		if err != nil || len(h) != 0 {
 			t.Error("Expected [] <nil> but got", h, err)
@@ -367,7 +401,7 @@ func TestRecordHistory(t *testing.T) {
 	if err := os.WriteFile(filepath.Join(d, "abc"), []byte("v1"), 0644); err != nil {
 		t.Fatal(err)
 	}
-	S := Store{d, 0}
+	S := Store{Directory: d, Generation: 0}
 	if err := S.recordHistory("abc"); err != nil {
 		t.Fatal(err)
 	}
@@ -404,6 +438,55 @@ func TestRecordHistory(t *testing.T) {
 	}
 }
 
+func TestHistoryInfo(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	mtime := time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(d, "file"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.recordHistory("file"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := S.HistoryInfo("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatal("Expected 2 versions but got", versions)
+	}
+	if v := versions[0]; v.Generation != 124 || v.Size != 6 || !v.ModTime.Equal(mtime) {
+		t.Error("Got", v, "but expected generation 124 of 6 bytes from", mtime)
+	}
+	if v := versions[1]; v.Generation != 123 || v.Size != 0 {
+		t.Error("Got", v, "but expected generation 123 of 0 bytes")
+	}
+	if versions, err := S.HistoryInfo("missing"); err != nil || len(versions) != 0 {
+		t.Error("Expected [] <nil> but got", versions, err)
+	}
+}
+
+func TestModTime(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	mtime := time.Date(2024, 3, 2, 14, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(d, "file"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := S.ModTime("file", 0); err != nil || !m.Equal(mtime) {
+		t.Error("Got", m, err, "but expected", mtime)
+	}
+	if err := S.recordHistory("file"); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := S.ModTime("file", 124); err != nil || !m.Equal(mtime) {
+		t.Error("Got", m, err, "but expected", mtime)
+	}
+	if _, err := S.ModTime("file", 999); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+}
+
 func TestAtylar(t *testing.T) {
 	d := t.TempDir()
 	S, err := New(filepath.Join(d, "test"))
@@ -417,23 +500,27 @@ func TestAtylar(t *testing.T) {
 		t.Error("Expected S.Generation to be", 0, "but it is", S.Generation)
 	}
 
-	f, err := S.Overwrite("abc")
+	w, err := S.Overwrite("abc")
 	if err != nil {
 		t.Error(err)
 	} else {
-		defer f.Close()
-		f.WriteString("v1")
+		w.WriteString("v1")
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
 	}
 
-	f, err = S.Overwrite("abc")
+	w, err = S.Overwrite("abc")
 	if err != nil {
 		t.Error(err)
 	} else {
-		defer f.Close()
-		f.WriteString("v2")
+		w.WriteString("v2")
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
 	}
 
-	f, err = S.Open("abc", 0)
+	f, err := S.Open("abc", 0)
 	if err != nil {
 		t.Error(err)
 	} else {
@@ -457,12 +544,14 @@ func TestAtylar(t *testing.T) {
 		}
 	}
 
-	f, err = S.Overwrite("abc")
+	w, err = S.Overwrite("abc")
 	if err != nil {
 		t.Error(err)
 	} else {
-		defer f.Close()
-		f.WriteString("v3")
+		w.WriteString("v3")
+		if err := w.Close(); err != nil {
+			t.Error(err)
+		}
 	}
 
 	f, err = S.Open("abc", 0)
@@ -501,6 +590,9 @@ func TestAtylar(t *testing.T) {
 		}
 	}
 
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
 	S, err = New(filepath.Join(d, "test"))
 	if err != nil {
 		t.Fatal(err)
@@ -532,4 +624,258 @@ func TestAtylar(t *testing.T) {
 	}
 }
 
-// TODO: copy, move, stat, list; and optionally: new, overwrite, open, remove
+func TestCopy(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d}
+	if err := S.Copy("file", "file2"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file2")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, ".history", "file2@1")); err != nil || string(b) != "Hello from the second file!" {
+		t.Error("Expected Hello from the second file! <nil> but got", string(b), err)
+	}
+
+	// A missing source must leave the destination and its history untouched.
+	if err := S.Copy("missing", "file"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+	dir, err := os.ReadDir(filepath.Join(d, ".history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dir) != 2 {
+		t.Error("Expected only [file2@1 file@123] in history but got", len(dir), "entries")
+	}
+}
+
+func TestMove(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d}
+	if err := S.Move("missing", "file"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if h, err := S.History("file"); err != nil || len(h) != 1 {
+		t.Error("Expected [123] <nil> but got", h, err)
+	}
+	if err := S.Move("file2", "file3"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file3")); err != nil || string(b) != "Hello from the second file!" {
+		t.Error("Expected Hello from the second file! <nil> but got", string(b), err)
+	}
+	if _, err := os.Stat(filepath.Join(d, "file2")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected file2 to be moved but got", err)
+	}
+	if h, err := S.History("file2"); err != nil || len(h) != 1 || h[0] != 1 {
+		t.Error("Expected [1] <nil> but got", h, err)
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	day := func(n int) time.Time { return time.Date(2024, 3, n, 12, 0, 0, 0, time.UTC) }
+	for _, v := range []struct {
+		path string
+		time time.Time
+	}{
+		{filepath.Join(d, ".history", "file@123"), day(1)},
+		{filepath.Join(d, ".history", "file@124"), day(5)},
+		{filepath.Join(d, "file"), day(10)},
+	} {
+		if err := os.WriteFile(v.path, []byte(v.time.Format("Jan 2")), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(v.path, v.time, v.time); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		time    time.Time
+		content string
+	}{
+		{day(1), "Mar 1"},
+		{day(4), "Mar 1"},
+		{day(5), "Mar 5"},
+		{day(9), "Mar 5"},
+		{day(20), "Mar 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.time.Format("Jan 2"), func(t *testing.T) {
+			f, err := S.OpenAt("file", tt.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if b, err := io.ReadAll(f); err != nil || string(b) != tt.content {
+				t.Error("Expected", tt.content, "<nil> but got", string(b), err)
+			}
+		})
+	}
+	if _, err := S.OpenAt("file", day(0)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if err := os.WriteFile(filepath.Join(d, ".history", "file@100"), []byte("Old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Restore("file", 100); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file")); err != nil || string(b) != "Old" {
+		t.Error("Expected Old <nil> but got", string(b), err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, ".history", "file@124")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+
+	if err := S.RestoreAs("file", "dir/file3", 124); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "dir", "file3")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+
+	// A missing version must leave the target and its history untouched.
+	if err := S.Restore("file2", 7); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if h, err := S.History("file2"); err != nil || len(h) != 0 {
+		t.Error("Expected [] <nil> but got", h, err)
+	}
+	if err := S.RestoreAs("file", "/", 100); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+}
+
+func TestSubdirectories(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"v1", "v2"} {
+		f, err := S.Overwrite("notes/2024/todo.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		f.Close()
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "notes", "2024", "todo.md")); err != nil || string(b) != "v2" {
+		t.Error("Expected v2 <nil> but got", string(b), err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, ".history", "notes", "2024", "todo.md@1")); err != nil || string(b) != "v1" {
+		t.Error("Expected v1 <nil> but got", string(b), err)
+	}
+	if h, err := S.History("/notes/2024/todo.md"); err != nil || len(h) != 1 || h[0] != 1 {
+		t.Error("Expected [1] <nil> but got", h, err)
+	}
+	if h, err := S.History("other/file"); err != nil || len(h) != 0 {
+		t.Error("Expected [] <nil> but got", h, err)
+	}
+	for _, history := range []bool{false, true} {
+		if files, err := S.List(history); err != nil || len(files) != 1 || files[0] != "notes/2024/todo.md" {
+			t.Error("Expected [notes/2024/todo.md] <nil> but got", files, err)
+		}
+	}
+
+	// Names in subdirectories are normalized too.
+	if err := os.WriteFile(filepath.Join(d, "notes", ".draft@1"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if S.Generation != 1 {
+		t.Error("Expected S.Generation to be", 1, "but it is", S.Generation)
+	}
+	if _, err := os.Stat(filepath.Join(d, "notes", "draft_1")); err != nil {
+		t.Error(err)
+	}
+
+	if err := S.Remove("notes/2024/todo.md"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d, "notes", "2024")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the empty directory to be removed but got", err)
+	}
+	if _, err := os.Stat(filepath.Join(d, "notes")); err != nil {
+		t.Error("Expected the non-empty directory to be kept but got", err)
+	}
+}
+
+func TestListVersion(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	v1, err := S.ListVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := S.ListVersion(); err != nil || v != v1 {
+		t.Error("Expected", v1, "<nil> but got", v, err)
+	}
+	if err := S.WriteFile("file3", nil); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := S.ListVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2 == v1 {
+		t.Error("Expected the token to change after adding a file")
+	}
+	if err := S.Move("file3", "file4"); err != nil {
+		t.Fatal(err)
+	}
+	v3, err := S.ListVersion()
+	if err != nil || v3 == v2 {
+		t.Error("Expected the token to change after renaming a file but got", v3, err)
+	}
+	if err := S.Remove("file4"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := S.ListVersion(); err != nil || v == v3 {
+		t.Error("Expected the token to change after removing a file but got", v, err)
+	}
+}
+
+func TestListVersionReopen(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	v1, _ := S.ListVersion()
+	S.Close()
+	// After reopening, as many creations as before don't repeat the token.
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("b", nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := S.ListVersion(); v == v1 {
+		t.Error("Got", v, "after reopening but expected it to differ from", v1)
+	}
+}
+
+// TODO: stat, list; and optionally: new, overwrite, open, remove
@@ -0,0 +1,38 @@
+package atylar
+
+import "testing"
+
+func TestFilePathWindows(t *testing.T) {
+	S := Store{Directory: `C:\store`}
+	tests := []struct {
+		in         string
+		out        string
+		outHistory string
+	}{
+		{"file", `C:\store\file`, `C:\store\.history\file`},
+		{"dir/file", `C:\store\dir\file`, `C:\store\.history\dir\file`},
+		{`dir\file`, `C:\store\dir\file`, `C:\store\.history\dir\file`},
+		{`..\..\file`, `C:\store\file`, `C:\store\.history\file`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if p := S.filePath(tt.in, false); p != tt.out {
+				t.Error("Got", p, "but expected", tt.out)
+			}
+			if p := S.filePath(tt.in, true); p != tt.outHistory {
+				t.Error("Got", p, "but expected", tt.outHistory, "(history)")
+			}
+		})
+	}
+}
+
+func TestVersionPathWindows(t *testing.T) {
+	S := Store{Directory: `C:\store`}
+	p := S.versionPath("dir/file", 3)
+	if p != `C:\store\.history\dir\file@3` {
+		t.Error("Got", p)
+	}
+	if name, g := parseVersion("dir/file@3"); name != "dir/file" || g != 3 {
+		t.Error("Got", name, g, "but expected dir/file 3")
+	}
+}
@@ -0,0 +1,401 @@
+// Package atylardav exposes an atylar store to WebDAV servers, so that it
+// can be mounted in file managers. FileSystem has the methods of the
+// FileSystem interface of golang.org/x/net/webdav, which this module doesn't
+// depend on. As OpenFile returns File instead of webdav.File, it needs to be
+// wrapped to be used with webdav.Handler:
+//
+//	type davFS struct{ *atylardav.FileSystem }
+//
+//	func (fs davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+//		return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+//	}
+//
+//	handler := &webdav.Handler{
+//		FileSystem: davFS{atylardav.NewFileSystem(&S)},
+//		LockSystem: webdav.NewMemLS(),
+//	}
+//
+// Writes go through the store, so every file which is overwritten, moved
+// or removed is recorded to history. Names which the store would normalize
+// to something else, like `.DS_Store`, are refused with a permission error,
+// and the history directory isn't listed.
+package atylardav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/atmatto/atylar"
+)
+
+// File is a file opened by FileSystem. It has the methods of webdav.File.
+type File interface {
+	http.File
+	io.Writer
+}
+
+// FileSystem serves a store to a WebDAV server, see the package documentation.
+type FileSystem struct {
+	store *atylar.Store
+}
+
+// NewFileSystem returns a FileSystem backed by the store.
+func NewFileSystem(S *atylar.Store) *FileSystem {
+	return &FileSystem{store: S}
+}
+
+// storeName turns a WebDAV path into the name of a file in the store, ""
+// for the root. Names which the store would normalize differently are
+// refused.
+func storeName(op, name string) (string, error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", nil
+	}
+	for _, e := range strings.Split(name, "/") {
+		if strings.HasPrefix(e, ".") || strings.HasSuffix(e, ".") || strings.ContainsAny(e, `@\`) {
+			return "", &os.PathError{Op: op, Path: name, Err: os.ErrPermission}
+		}
+	}
+	return name, nil
+}
+
+// pathError turns an error of the store into one recognized by os.IsNotExist
+// and similar functions, which WebDAV servers use to pick status codes.
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = os.ErrNotExist
+	case errors.Is(err, fs.ErrExist):
+		err = os.ErrExist
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, atylar.ErrReadOnly), errors.Is(err, atylar.ErrInvalidName):
+		err = os.ErrPermission
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Mkdir creates the directory, which the store keeps when it's empty. Like
+// os.Mkdir, it fails if the directory exists or its parent doesn't.
+func (d *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name, err := storeName("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if _, err := d.store.Stat(name, false); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if parent := path.Dir(name); parent != "." {
+		if info, err := d.store.Stat(parent, false); err != nil || !info.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrNotExist}
+		}
+	}
+	if err := d.store.Mkdir(name); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// OpenFile opens the file or directory. Files opened for writing are
+// written like with Overwrite and replace the file when they are closed.
+// Unless the flags include os.O_TRUNC, they start with the current content.
+func (d *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (File, error) {
+	name, err := storeName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.store.Stat(name, false)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, pathError("open", name, err)
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		if !exists {
+			return nil, pathError("open", name, err)
+		}
+		if info.IsDir() {
+			return &dir{fs: d, name: name, info: info}, nil
+		}
+		f, err := d.store.Open(name, 0)
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+		return &readFile{File: f, info: info}, nil
+	}
+	switch {
+	case name == "" || exists && info.IsDir():
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	w, err := d.store.Overwrite(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if exists && flag&os.O_TRUNC == 0 {
+		if err := d.preload(w, name, flag&os.O_APPEND != 0); err != nil {
+			w.Abort()
+			return nil, pathError("open", name, err)
+		}
+	}
+	return &writeFile{Writer: w, name: path.Base(name)}, nil
+}
+
+// preload copies the current content of the file to the writer, leaving
+// it at the start, or at the end for appending.
+func (d *FileSystem) preload(w *atylar.Writer, name string, appending bool) error {
+	f, err := d.store.Open(name, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return err
+	}
+	if !appending {
+		_, err = w.Seek(0, io.SeekStart)
+	}
+	return err
+}
+
+// RemoveAll removes the file, or the directory with everything in it,
+// recording the removed files to history. Removing what doesn't exist
+// does nothing, like os.RemoveAll.
+func (d *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name, err := storeName("removeAll", name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return &os.PathError{Op: "removeAll", Path: name, Err: os.ErrPermission}
+	}
+	info, err := d.store.Stat(name, false)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return pathError("removeAll", name, err)
+	}
+	if !info.IsDir() {
+		if err := d.store.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathError("removeAll", name, err)
+		}
+		return nil
+	}
+	results, err := d.store.RemovePrefix(name + "/")
+	if err != nil {
+		return pathError("removeAll", name, err)
+	}
+	for file, err := range results {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathError("removeAll", file, err)
+		}
+	}
+	return d.removeDirs(name)
+}
+
+// removeDirs removes the empty directory and the ones inside it, deepest
+// first, which are left after their files were removed.
+func (d *FileSystem) removeDirs(name string) error {
+	dirs := []string{}
+	if err := d.collectDirs(name, &dirs); errors.Is(err, fs.ErrNotExist) {
+		return nil // Pruned along with the last file.
+	} else if err != nil {
+		return pathError("removeAll", name, err)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		if err := d.store.RemoveDir(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathError("removeAll", name, err)
+		}
+	}
+	return nil
+}
+
+// collectDirs appends the directory and the ones inside it to dirs.
+func (d *FileSystem) collectDirs(name string, dirs *[]string) error {
+	entries, err := d.store.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	*dirs = append(*dirs, name)
+	for _, e := range entries {
+		if e.IsDir() {
+			if err := d.collectDirs(name+"/"+e.Name(), dirs); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rename moves the file, or the directory with everything in it, recording
+// the moved files to history.
+func (d *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, err := storeName("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newName, err = storeName("rename", newName)
+	if err != nil {
+		return err
+	}
+	if oldName == "" || newName == "" || strings.HasPrefix(newName+"/", oldName+"/") {
+		return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrPermission}
+	}
+	info, err := d.store.Stat(oldName, false)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	if !info.IsDir() {
+		if err := d.store.Move(oldName, newName); err != nil {
+			return pathError("rename", oldName, err)
+		}
+		return nil
+	}
+	if err := d.store.Mkdir(newName); err != nil {
+		return pathError("rename", newName, err)
+	}
+	results, err := d.store.MovePrefix(oldName+"/", newName+"/")
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	for file, err := range results {
+		if err != nil {
+			return pathError("rename", file, err)
+		}
+	}
+	return d.removeDirs(oldName)
+}
+
+// Stat describes the file or directory.
+func (d *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name, err := storeName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := d.store.Stat(name, false)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// readFile is a file opened for reading, described by the store.
+type readFile struct {
+	atylar.File
+	info os.FileInfo
+}
+
+func (f *readFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.info.Name(), Err: errors.New("not a directory")}
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.info.Name(), Err: os.ErrPermission}
+}
+
+// writeFile is a file opened for writing.
+type writeFile struct {
+	*atylar.Writer
+	name string
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	info, err := f.Writer.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return namedInfo{FileInfo: info, name: f.name}, nil
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+}
+
+// namedInfo replaces the name of the temporary file of a writer.
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string {
+	return i.name
+}
+
+// dir is an opened directory. Its entries are read when Readdir is first
+// called, leaving out the history directory.
+type dir struct {
+	fs      *FileSystem
+	name    string
+	info    os.FileInfo
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Seek(offset int64, whence int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		d.read = true
+		entries, err := d.fs.store.ReadDir(d.name)
+		if err != nil {
+			return nil, pathError("readdir", d.name, err)
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, pathError("readdir", d.name, err)
+			}
+			d.entries = append(d.entries, info)
+		}
+	}
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
@@ -0,0 +1,174 @@
+package atylardav
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/atmatto/atylar"
+)
+
+// webdavFileSystem and webdavFile mirror the interfaces of
+// golang.org/x/net/webdav, to check that the adapter in the package
+// documentation compiles.
+type webdavFile interface {
+	File
+}
+
+type webdavFileSystem interface {
+	Mkdir(ctx context.Context, name string, perm os.FileMode) error
+	OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdavFile, error)
+	RemoveAll(ctx context.Context, name string) error
+	Rename(ctx context.Context, oldName, newName string) error
+	Stat(ctx context.Context, name string) (os.FileInfo, error)
+}
+
+type davFS struct{ *FileSystem }
+
+func (fs davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdavFile, error) {
+	return fs.FileSystem.OpenFile(ctx, name, flag, perm)
+}
+
+var _ webdavFileSystem = davFS{}
+
+// createFileSystem returns a file system backed by a new store, on the
+// disk or in memory.
+func createFileSystem(t *testing.T, memory bool) (*FileSystem, *atylar.Store) {
+	var S atylar.Store
+	var err error
+	if memory {
+		S, err = atylar.NewMemory()
+	} else {
+		S, err = atylar.New(t.TempDir())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { S.Close() })
+	return NewFileSystem(&S), &S
+}
+
+func put(t *testing.T, d *FileSystem, name, content string, flag int) {
+	f, err := d.OpenFile(context.Background(), name, os.O_RDWR|os.O_CREATE|flag, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := f.Stat(); err != nil || info.Name() != path.Base(name) {
+		t.Error("Got", info, err, "for", name)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func get(d *FileSystem, name string) (string, error) {
+	f, err := d.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
+
+func names(t *testing.T, d *FileSystem, name string) []string {
+	f, err := d.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	infos, err := f.Readdir(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFileSystem(t *testing.T) {
+	t.Run("Disk", func(t *testing.T) { testFileSystem(t, false) })
+	t.Run("Memory", func(t *testing.T) { testFileSystem(t, true) })
+}
+
+func testFileSystem(t *testing.T, memory bool) {
+	ctx := context.Background()
+	d, S := createFileSystem(t, memory)
+	if err := d.Mkdir(ctx, "/a/b", 0755); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected a missing parent")
+	}
+	if err := d.Mkdir(ctx, "/a", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mkdir(ctx, "/a", 0755); !os.IsExist(err) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	put(t, d, "/a/file", "first", os.O_TRUNC)
+	put(t, d, "/a/file", "second", os.O_TRUNC)
+	put(t, d, "/a/file", "!", os.O_APPEND)
+	put(t, d, "/a/file", "S", 0)
+	if content, err := get(d, "/a/file"); err != nil || content != "Second!" {
+		t.Error("Got", content, err, "but expected Second!")
+	}
+	if generations, err := S.History("a/file"); err != nil || len(generations) != 3 {
+		t.Error("Got", generations, err, "but expected three versions")
+	}
+	if _, err := d.OpenFile(ctx, "/a/file", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666); !os.IsExist(err) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	if _, err := d.OpenFile(ctx, "/missing", os.O_RDWR, 0666); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	if _, err := d.Stat(ctx, "/missing"); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	for _, name := range []string{"/.DS_Store", "/.history", "/a/b@1"} {
+		if _, err := d.OpenFile(ctx, name, os.O_RDWR|os.O_CREATE, 0666); !os.IsPermission(err) {
+			t.Error("Got", err, "for", name, "but expected", os.ErrPermission)
+		}
+	}
+	if got := names(t, d, "/"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Error("Got", got, "but expected the history directory to be hidden")
+	}
+
+	if err := d.Rename(ctx, "/a", "/c"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := get(d, "/c/file"); err != nil || content != "Second!" {
+		t.Error("Got", content, err, "but expected Second!")
+	}
+	if _, err := d.Stat(ctx, "/a"); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected the directory to be moved")
+	}
+	if err := d.Rename(ctx, "/c/file", "/c/b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, d, "/c"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Error("Got", got, "but expected [b]")
+	}
+	if err := d.Mkdir(ctx, "/c/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RemoveAll(ctx, "/c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, d, "/"); !reflect.DeepEqual(got, []string{}) {
+		t.Error("Got", got, "but expected nothing")
+	}
+	if generations, err := S.History("c/b"); err != nil || len(generations) != 1 {
+		t.Error("Got", generations, err, "but expected the removed file in history")
+	}
+	if err := d.RemoveAll(ctx, "/c"); err != nil {
+		t.Error("Got", err, "but expected removing nothing to succeed")
+	}
+}
@@ -0,0 +1,342 @@
+package atylarhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/atmatto/atylar"
+)
+
+// Client accesses a store served by NewHandler on another machine. It has
+// the methods of atylar.Store which the handler has endpoints for: Open,
+// ReadFile, WriteFile, Overwrite, OverwriteIf, Remove, Restore, Copy, Move,
+// Stat, List, History and HistoryInfo. Open returns a stream of the content
+// rather than an atylar.File, so it can't seek. Errors wrap the same errors
+// as the store's, like atylar.ErrNotExist or atylar.ErrConflict, as far as
+// they can be told apart by the status code; errors for 503 Service
+// Unavailable wrap ErrUnavailable instead of the reason the store refused
+// the request.
+type Client struct {
+	base   string
+	client *http.Client
+}
+
+// ErrUnavailable is returned by Client when the server's store is closed,
+// draining or fenced.
+var ErrUnavailable = errors.New("store unavailable")
+
+// NewClient returns a client of the store served at the base URL, with the
+// handler's endpoints under it. Requests are made with the given client, or
+// http.DefaultClient if it's nil.
+func NewClient(base string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(base, "/"), client: client}
+}
+
+// url returns the URL of the endpoint for the file with the query
+// parameter, if it's not empty.
+func (c *Client) url(endpoint, file, param string, value uint64) string {
+	u := c.base + endpoint
+	if file != "" {
+		u += "/" + (&url.URL{Path: file}).EscapedPath()
+	}
+	if param != "" {
+		u += "?" + param + "=" + strconv.FormatUint(value, 10)
+	}
+	return u
+}
+
+// do makes the request and returns the response if it succeeded. Otherwise
+// it returns a *atylar.StoreError for the operation.
+func (c *Client) do(op, file, method, u string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, &atylar.StoreError{Op: op, Name: file, Err: err}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, &atylar.StoreError{Op: op, Name: file, Err: err}
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, &atylar.StoreError{Op: op, Name: file, Err: statusError(resp.StatusCode, strings.TrimSpace(string(text)))}
+}
+
+// statusError returns the error for the status code, the reverse of status.
+// The text of the response is only kept for codes which don't map to one.
+func statusError(code int, text string) error {
+	switch code {
+	case http.StatusNotFound:
+		return atylar.ErrNotExist
+	case http.StatusBadRequest:
+		return atylar.ErrInvalidName
+	case http.StatusConflict:
+		return atylar.ErrConflict
+	case http.StatusForbidden:
+		return atylar.ErrReadOnly
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	}
+	return fmt.Errorf("%d %s", code, text)
+}
+
+// decode reads the JSON response into v.
+func decode(op string, resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return &atylar.StoreError{Op: op, Err: err}
+	}
+	return nil
+}
+
+// Open opens the given version of the file for reading, or the live file if
+// the generation is 0. The content is streamed from the server, so the
+// returned reader must be closed.
+func (c *Client) Open(file string, generation uint64) (io.ReadCloser, error) {
+	param := ""
+	if generation != 0 {
+		param = "generation"
+	}
+	resp, err := c.do("open", file, http.MethodGet, c.url("/files", file, param, generation), nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// ReadFile reads the given version of the file, like Open.
+func (c *Client) ReadFile(file string, generation uint64) ([]byte, error) {
+	f, err := c.Open(file, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, &atylar.StoreError{Op: "readFile", Name: file, Err: err}
+	}
+	return b, nil
+}
+
+// WriteFile replaces the file with data.
+func (c *Client) WriteFile(file string, data []byte) error {
+	resp, err := c.do("writeFile", file, http.MethodPut, c.url("/files", file, "", 0), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Overwrite returns a writer replacing the file, like Store.Overwrite. The
+// content is streamed to the server as it's written, and the file is only
+// replaced once the writer is committed.
+func (c *Client) Overwrite(file string) (*Writer, error) {
+	return c.overwrite("overwrite", file, c.url("/files", file, "", 0))
+}
+
+// OverwriteIf is like Overwrite, but Commit fails with an error wrapping
+// atylar.ErrConflict if the newest version of the file isn't the expected
+// one, like Store.OverwriteIf.
+func (c *Client) OverwriteIf(file string, expected uint64) (*Writer, error) {
+	return c.overwrite("overwriteIf", file, c.url("/files", file, "expected", expected))
+}
+
+// overwrite starts the PUT request of the writer.
+func (c *Client) overwrite(op, file, u string) (*Writer, error) {
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		resp, err := c.do(op, file, http.MethodPut, u, r)
+		if err == nil {
+			resp.Body.Close()
+			r.CloseWithError(io.ErrClosedPipe)
+		} else {
+			r.CloseWithError(err) // Fails further writes if the request ended early.
+		}
+		done <- err
+	}()
+	return &Writer{pipe: w, done: done}, nil
+}
+
+// errAborted fails the request body of an aborted Writer, so the server
+// doesn't replace the file.
+var errAborted = errors.New("write aborted")
+
+// Writer replaces a file on the server, see Client.Overwrite.
+type Writer struct {
+	pipe  *io.PipeWriter
+	done  chan error
+	ended bool
+	err   error // Outcome of the request, once it has ended
+}
+
+// Write sends the data to the server.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+// Commit finishes the request and returns its outcome. The file has been
+// replaced if it returns nil.
+func (w *Writer) Commit() error {
+	w.pipe.Close()
+	return w.wait()
+}
+
+// Close commits the writer, so it can be used as an io.WriteCloser.
+func (w *Writer) Close() error {
+	return w.Commit()
+}
+
+// Abort cancels the request, leaving the file as it was.
+func (w *Writer) Abort() error {
+	w.pipe.CloseWithError(errAborted)
+	w.wait()
+	return nil
+}
+
+// wait waits for the request to end and returns its outcome.
+func (w *Writer) wait() error {
+	if !w.ended {
+		w.ended = true
+		w.err = <-w.done
+	}
+	return w.err
+}
+
+// Remove removes the file.
+func (c *Client) Remove(file string) error {
+	resp, err := c.do("remove", file, http.MethodDelete, c.url("/files", file, "", 0), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Restore restores the given version of the file, like Store.Restore.
+func (c *Client) Restore(file string, generation uint64) error {
+	resp, err := c.do("restore", file, http.MethodPost, c.url("/restore", file, "generation", generation), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Copy copies a file, like Store.Copy.
+func (c *Client) Copy(from, to string) error {
+	return c.transfer("copy", from, to)
+}
+
+// Move moves a file, like Store.Move.
+func (c *Client) Move(from, to string) error {
+	return c.transfer("move", from, to)
+}
+
+// transfer copies or moves a file, depending on the operation.
+func (c *Client) transfer(op, from, to string) error {
+	u := c.url("/"+op, from, "", 0) + "?to=" + url.QueryEscape(to)
+	resp, err := c.do(op, from, http.MethodPost, u, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Stat returns information about the file, or about its history entry if
+// history is true, like Store.Stat.
+func (c *Client) Stat(file string, history bool) (fs.FileInfo, error) {
+	u := c.url("/stat", file, "", 0)
+	if history {
+		u += "?history=true"
+	}
+	resp, err := c.do("stat", file, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	var info fileInfo
+	if err := decode("stat", resp, &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// List returns the names of the live files, or of the files with history
+// if history is true.
+func (c *Client) List(history bool) ([]string, error) {
+	if history {
+		resp, err := c.do("list", "", http.MethodGet, c.url("/history", "", "", 0), nil)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{}
+		if err := decode("list", resp, &files); err != nil {
+			return nil, err
+		}
+		return files, nil
+	}
+	entries, err := c.ListEntries()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, e := range entries {
+		files = append(files, e.Name)
+	}
+	return files, nil
+}
+
+// ListEntries returns the live files with their sizes and modification
+// times.
+func (c *Client) ListEntries() ([]atylar.Entry, error) {
+	resp, err := c.do("list", "", http.MethodGet, c.url("/files", "", "", 0), nil)
+	if err != nil {
+		return nil, err
+	}
+	entries := []atylar.Entry{}
+	if err := decode("list", resp, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// History returns the generations of the file's versions, from the newest.
+func (c *Client) History(file string) ([]uint64, error) {
+	versions, err := c.HistoryInfo(file)
+	if err != nil {
+		return nil, err
+	}
+	generations := []uint64{}
+	for _, v := range versions {
+		generations = append(generations, v.Generation)
+	}
+	return generations, nil
+}
+
+// HistoryInfo returns the file's versions, from the newest.
+func (c *Client) HistoryInfo(file string) ([]atylar.Version, error) {
+	resp, err := c.do("history", file, http.MethodGet, c.url("/history", file, "", 0), nil)
+	if err != nil {
+		return nil, err
+	}
+	versions := []atylar.Version{}
+	if err := decode("history", resp, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
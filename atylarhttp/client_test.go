@@ -0,0 +1,121 @@
+package atylarhttp
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/atmatto/atylar"
+)
+
+func TestClient(t *testing.T) {
+	server, S := createServer(t)
+	c := NewClient(server.URL+"/", nil)
+	if b, err := c.ReadFile("dir/file", 0); err != nil || string(b) != "second" {
+		t.Error("Got", string(b), err, "but expected second")
+	}
+	generations, err := c.History("dir/file")
+	if err != nil || len(generations) != 1 {
+		t.Fatal("Got", generations, err, "but expected one version")
+	}
+	if b, err := c.ReadFile("dir/file", generations[0]); err != nil || string(b) != "first" {
+		t.Error("Got", string(b), err, "but expected first")
+	}
+	if _, err := c.ReadFile("missing", 0); !errors.Is(err, atylar.ErrNotExist) {
+		t.Error("Got", err, "but expected", atylar.ErrNotExist)
+	}
+	if err := c.WriteFile("new file", []byte("created")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("new file", 0); err != nil || string(b) != "created" {
+		t.Error("Got", string(b), err, "but expected created")
+	}
+	files, err := c.List(false)
+	if err != nil || len(files) != 2 || files[0] != "dir/file" || files[1] != "new file" {
+		t.Error("Got", files, err, "but expected dir/file and new file")
+	}
+	files, err = c.List(true)
+	if err != nil || len(files) != 1 || files[0] != "dir/file" {
+		t.Error("Got", files, err, "but expected dir/file")
+	}
+	if err := c.Restore("dir/file", generations[0]); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("dir/file", 0); err != nil || string(b) != "first" {
+		t.Error("Got", string(b), err, "but expected first")
+	}
+	if err := c.Copy("new file", "dir/copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Move("dir/copy", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("moved", 0); err != nil || string(b) != "created" {
+		t.Error("Got", string(b), err, "but expected the copy to be moved")
+	}
+	if err := c.Move("dir/copy", "moved"); !errors.Is(err, atylar.ErrNotExist) {
+		t.Error("Got", err, "but expected", atylar.ErrNotExist)
+	}
+	info, err := c.Stat("moved", false)
+	if err != nil || info.Name() != "moved" || info.Size() != 7 || info.IsDir() {
+		t.Error("Got", info, err, "but expected moved of 7 bytes")
+	}
+	if info, err := c.Stat("dir", false); err != nil || !info.IsDir() {
+		t.Error("Got", info, err, "but expected a directory")
+	}
+	if _, err := c.Stat("missing", false); !errors.Is(err, atylar.ErrNotExist) {
+		t.Error("Got", err, "but expected", atylar.ErrNotExist)
+	}
+	if err := c.Remove("new file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove("new file"); !errors.Is(err, atylar.ErrNotExist) {
+		t.Error("Got", err, "but expected", atylar.ErrNotExist)
+	}
+}
+
+func TestClientWriter(t *testing.T) {
+	server, S := createServer(t)
+	c := NewClient(server.URL, nil)
+	w, err := c.Overwrite("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "third")
+	w.Abort()
+	if b, err := S.ReadFile("dir/file", 0); err != nil || string(b) != "second" {
+		t.Error("Got", string(b), err, "but expected the aborted write to be discarded")
+	}
+	generations, err := S.History("dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err = c.OverwriteIf("dir/file", generations[0]+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "third")
+	if err := w.Commit(); !errors.Is(err, atylar.ErrConflict) {
+		t.Error("Got", err, "but expected", atylar.ErrConflict)
+	}
+	w, err = c.OverwriteIf("dir/file", generations[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "third")
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("dir/file", 0); err != nil || string(b) != "third" {
+		t.Error("Got", string(b), err, "but expected third")
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	server, S := createServer(t)
+	S.Close()
+	c := NewClient(server.URL, nil)
+	if err := c.WriteFile("dir/file", []byte("third")); !errors.Is(err, ErrUnavailable) {
+		t.Error("Got", err, "but expected", ErrUnavailable)
+	}
+}
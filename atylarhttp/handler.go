@@ -0,0 +1,361 @@
+// Package atylarhttp exposes an atylar store over HTTP. The handler returned
+// by NewHandler serves these endpoints, which can be mounted under a prefix
+// with http.StripPrefix:
+//
+//	GET    /files                         JSON list of the live files
+//	GET    /files/{name}                  content of the live file
+//	GET    /files/{name}?generation={g}   content of a historic version
+//	PUT    /files/{name}                  replaces the file with the request body
+//	PUT    /files/{name}?expected={g}     replaces it if its newest version is g, like OverwriteIf
+//	DELETE /files/{name}                  removes the file
+//	GET    /history                       JSON list of the names of files with history
+//	GET    /history/{name}                JSON list of the file's versions, newest first
+//	POST   /restore/{name}?generation={g} restores the version, like Restore
+//	POST   /copy/{name}?to={dest}         copies the file, like Copy
+//	POST   /move/{name}?to={dest}         moves the file, like Move
+//	GET    /stat/{name}                   JSON information about the live file, like Stat
+//	GET    /stat/{name}?history=true      the same about the file's history entry
+//	GET    /share/{token}                 content of the shared version, see CreateShare
+//
+// Errors are reported with the matching status code, e.g. 404 for files and
+// versions which don't exist, and its text. Client accesses a store served
+// this way from another machine.
+package atylarhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atmatto/atylar"
+)
+
+// handler serves a store, see NewHandler.
+type handler struct {
+	store *atylar.Store
+}
+
+// NewHandler returns a handler serving the store over HTTP.
+func NewHandler(S *atylar.Store) http.Handler {
+	return &handler{store: S}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/files" || r.URL.Path == "/files/":
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.list(w, r)
+	case strings.HasPrefix(r.URL.Path, "/files/"):
+		name := strings.TrimPrefix(r.URL.Path, "/files/")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.get(w, r, name)
+		case http.MethodPut:
+			h.put(w, r, name)
+		case http.MethodDelete:
+			h.delete(w, name)
+		default:
+			allow(w, r, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+		}
+	case r.URL.Path == "/history" || r.URL.Path == "/history/":
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.listHistory(w)
+	case strings.HasPrefix(r.URL.Path, "/history/"):
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.history(w, strings.TrimPrefix(r.URL.Path, "/history/"))
+	case strings.HasPrefix(r.URL.Path, "/restore/"):
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		h.restore(w, r, strings.TrimPrefix(r.URL.Path, "/restore/"))
+	case strings.HasPrefix(r.URL.Path, "/copy/"), strings.HasPrefix(r.URL.Path, "/move/"):
+		if !allow(w, r, http.MethodPost) {
+			return
+		}
+		h.transfer(w, r, r.URL.Path[1:5], r.URL.Path[6:])
+	case strings.HasPrefix(r.URL.Path, "/stat/"):
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.stat(w, r, strings.TrimPrefix(r.URL.Path, "/stat/"))
+	case strings.HasPrefix(r.URL.Path, "/share/"):
+		if !allow(w, r, http.MethodGet, http.MethodHead) {
+			return
+		}
+		h.share(w, r, strings.TrimPrefix(r.URL.Path, "/share/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// allow reports whether the request uses one of the methods, responding
+// with 405 Method Not Allowed if it doesn't.
+func allow(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+// list responds with the live files.
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	files, err := h.store.List(false)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	entries := []atylar.Entry{}
+	for _, name := range files {
+		info, err := h.store.Stat(name, false)
+		if errors.Is(err, atylar.ErrNotExist) {
+			continue // Removed in the meantime.
+		} else if err != nil {
+			fail(w, err)
+			return
+		}
+		entries = append(entries, atylar.Entry{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	respond(w, entries)
+}
+
+// get responds with the content of the live file or of the version given
+// by the generation query parameter.
+func (h *handler) get(w http.ResponseWriter, r *http.Request, name string) {
+	generation, ok := queryGeneration(w, r, "generation")
+	if !ok {
+		return
+	}
+	if generation == 0 {
+		info, err := h.store.Stat(name, false)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		if info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	f, err := h.store.Open(name, generation)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	defer f.Close()
+	h.serve(w, r, name, generation, f)
+}
+
+// share responds with the content of the version shared with the token.
+func (h *handler) share(w http.ResponseWriter, r *http.Request, token string) {
+	f, s, err := h.store.OpenShare(token)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	defer f.Close()
+	h.serve(w, r, s.File, s.Generation, f)
+}
+
+// serve responds with the content of the opened version of the file,
+// generation 0 for the live file.
+func (h *handler) serve(w http.ResponseWriter, r *http.Request, name string, generation uint64, f io.ReadSeeker) {
+	modTime, err := h.store.ModTime(name, generation)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if generation != 0 {
+		w.Header().Set("Cache-Control", "max-age=31536000, immutable") // Versions never change.
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(w, r, name, modTime, f)
+}
+
+// put replaces the file with the request body, if its newest version is
+// the one given by the expected query parameter, when it's present.
+func (h *handler) put(w http.ResponseWriter, r *http.Request, name string) {
+	var writer *atylar.Writer
+	var err error
+	if r.URL.Query().Has("expected") {
+		expected, ok := queryGeneration(w, r, "expected")
+		if !ok {
+			return
+		}
+		writer, err = h.store.OverwriteIf(name, expected)
+	} else {
+		writer, err = h.store.Overwrite(name)
+	}
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if _, err := io.Copy(writer, r.Body); err != nil {
+		writer.Abort()
+		http.Error(w, "reading the request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := writer.Commit(); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete removes the file.
+func (h *handler) delete(w http.ResponseWriter, name string) {
+	if err := h.store.Remove(name); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restore restores the version of the file given by the generation query
+// parameter.
+func (h *handler) restore(w http.ResponseWriter, r *http.Request, name string) {
+	generation, ok := queryGeneration(w, r, "generation")
+	if !ok {
+		return
+	}
+	if err := h.store.Restore(name, generation); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transfer copies or moves the file, depending on the operation, to the
+// destination given by the to query parameter.
+func (h *handler) transfer(w http.ResponseWriter, r *http.Request, op, name string) {
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		http.Error(w, "missing destination", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if op == "copy" {
+		err = h.store.Copy(name, to)
+	} else {
+		err = h.store.Move(name, to)
+	}
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stat responds with information about the file, or about its history
+// entry if the history query parameter is true.
+func (h *handler) stat(w http.ResponseWriter, r *http.Request, name string) {
+	history, err := strconv.ParseBool(r.URL.Query().Get("history"))
+	if err != nil && r.URL.Query().Has("history") {
+		http.Error(w, "invalid history "+strconv.Quote(r.URL.Query().Get("history")), http.StatusBadRequest)
+		return
+	}
+	info, err := h.store.Stat(name, history)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	respond(w, fileInfo{FileName: info.Name(), FileSize: info.Size(), FileMode: info.Mode(), FileModTime: info.ModTime()})
+}
+
+// fileInfo is the JSON form of the information returned by Stat. It
+// implements fs.FileInfo, so that Client.Stat can return it.
+type fileInfo struct {
+	FileName    string      `json:"Name"`
+	FileSize    int64       `json:"Size"`
+	FileMode    fs.FileMode `json:"Mode"`
+	FileModTime time.Time   `json:"ModTime"`
+}
+
+func (i fileInfo) Name() string       { return i.FileName }
+func (i fileInfo) Size() int64        { return i.FileSize }
+func (i fileInfo) Mode() fs.FileMode  { return i.FileMode }
+func (i fileInfo) ModTime() time.Time { return i.FileModTime }
+func (i fileInfo) IsDir() bool        { return i.FileMode.IsDir() }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+// listHistory responds with the names of the files with history.
+func (h *handler) listHistory(w http.ResponseWriter) {
+	files, err := h.store.List(true)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	respond(w, files)
+}
+
+// history responds with the versions of the file.
+func (h *handler) history(w http.ResponseWriter, name string) {
+	versions, err := h.store.HistoryInfo(name)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	respond(w, versions)
+}
+
+// queryGeneration parses the generation in the query parameter, 0 if it's
+// missing. If it's malformed, it responds with 400 Bad Request and returns
+// false.
+func queryGeneration(w http.ResponseWriter, r *http.Request, param string) (uint64, bool) {
+	g := r.URL.Query().Get(param)
+	if g == "" {
+		return 0, true
+	}
+	generation, err := strconv.ParseUint(g, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid "+param+" "+strconv.Quote(g), http.StatusBadRequest)
+		return 0, false
+	}
+	return generation, true
+}
+
+// respond writes v as JSON.
+func respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// fail responds with the status code matching the error. Only the status
+// is reported, as the messages of errors may contain paths on the server.
+func fail(w http.ResponseWriter, err error) {
+	code := status(err)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// status returns the HTTP status code matching an error returned by the
+// store, 500 Internal Server Error for unexpected ones.
+func status(err error) int {
+	switch {
+	case errors.Is(err, atylar.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, atylar.ErrInvalidName):
+		return http.StatusBadRequest
+	case errors.Is(err, atylar.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, atylar.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, atylar.ErrClosed), errors.Is(err, atylar.ErrDraining), errors.Is(err, atylar.ErrFenced):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,159 @@
+package atylarhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atmatto/atylar"
+)
+
+// createServer serves a new store with a file, which has one historic version.
+func createServer(t *testing.T) (*httptest.Server, *atylar.Store) {
+	S, err := atylar.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { S.Close() })
+	for _, content := range []string{"first", "second"} {
+		if err := S.WriteFile("dir/file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(NewHandler(&S))
+	t.Cleanup(server.Close)
+	return server, &S
+}
+
+func do(t *testing.T, method, url, body string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b)
+}
+
+func TestHandler(t *testing.T) {
+	server, S := createServer(t)
+	generations, err := S.History("dir/file")
+	if err != nil || len(generations) != 1 {
+		t.Fatal("Got", generations, err, "but expected one version")
+	}
+	g := generations[0]
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		expected                 string
+	}{
+		{"Get", "GET", "/files/dir/file", "", 200, "second"},
+		{"Get version", "GET", "/files/dir/file?generation=" + strconv.FormatUint(g, 10), "", 200, "first"},
+		{"Missing version", "GET", "/files/dir/file?generation=99", "", 404, ""},
+		{"Invalid generation", "GET", "/files/dir/file?generation=x", "", 400, ""},
+		{"Missing", "GET", "/files/missing", "", 404, ""},
+		{"Directory", "GET", "/files/dir", "", 404, ""},
+		{"Put", "PUT", "/files/new", "created", 204, ""},
+		{"Get put", "GET", "/files/new", "", 200, "created"},
+		{"Delete", "DELETE", "/files/new", "", 204, ""},
+		{"Get deleted", "GET", "/files/new", "", 404, ""},
+		{"Delete missing", "DELETE", "/files/new", "", 404, ""},
+		{"Put listing", "PUT", "/files/", "", 405, ""},
+		{"Method", "POST", "/files/dir/file", "", 405, ""},
+		{"Unknown", "GET", "/other", "", 404, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, tt.method, server.URL+tt.path, tt.body)
+			if status != tt.status || tt.expected != "" && body != tt.expected {
+				t.Error("Got", status, body, "but expected", tt.status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHandlerListing(t *testing.T) {
+	server, S := createServer(t)
+	status, body := do(t, "GET", server.URL+"/files", "")
+	var entries []atylar.Entry
+	if err := json.Unmarshal([]byte(body), &entries); status != 200 || err != nil {
+		t.Fatal("Got", status, body, err)
+	}
+	if len(entries) != 1 || entries[0].Name != "dir/file" || entries[0].Size != 6 {
+		t.Error("Got", entries, "but expected dir/file")
+	}
+	status, body = do(t, "GET", server.URL+"/history/dir/file", "")
+	var versions []atylar.Version
+	if err := json.Unmarshal([]byte(body), &versions); status != 200 || err != nil {
+		t.Fatal("Got", status, body, err)
+	}
+	expected, _ := S.HistoryInfo("dir/file")
+	if len(versions) != len(expected) || versions[0].Generation != expected[0].Generation || versions[0].Size != 5 {
+		t.Error("Got", versions, "but expected", expected)
+	}
+}
+
+func TestHandlerShare(t *testing.T) {
+	server, S := createServer(t)
+	generations, _ := S.History("dir/file")
+	version, err := S.CreateShare("dir/file", generations[0], time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := S.CreateShare("dir/file", 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := S.CreateShare("dir/file", 0, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, method, path string
+		status             int
+		expected           string
+	}{
+		{"Version", "GET", "/share/" + version.Token, 200, "first"},
+		{"Live", "GET", "/share/" + live.Token, 200, "second"},
+		{"Expired", "GET", "/share/" + expired.Token, 404, ""},
+		{"Unknown", "GET", "/share/unknown", 404, ""},
+		{"Method", "PUT", "/share/" + live.Token, 405, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, tt.method, server.URL+tt.path, "")
+			if status != tt.status || tt.expected != "" && body != tt.expected {
+				t.Error("Got", status, body, "but expected", tt.status, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHandlerReadOnly(t *testing.T) {
+	server, S := createServer(t)
+	S.Close()
+	R, err := atylar.NewReadOnly(S.Directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R.Close()
+	server.Config.Handler = NewHandler(&R)
+	if status, _ := do(t, "PUT", server.URL+"/files/dir/file", "changed"); status != http.StatusForbidden {
+		t.Error("Got", status, "but expected", http.StatusForbidden)
+	}
+	if status, body := do(t, "GET", server.URL+"/files/dir/file", ""); status != 200 || body != "second" {
+		t.Error("Got", status, body, "but expected second")
+	}
+}
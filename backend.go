@@ -0,0 +1,213 @@
+package atylar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Backend performs the file system operations of a store, so that it can
+// keep its files somewhere else than the operating system's file system,
+// e.g. in memory. The store refers to its files by paths joined with
+// filepath.Join from its Directory, and expects the errors to wrap the
+// fs errors like those of the os package, e.g. fs.ErrNotExist and
+// fs.ErrExist. The default backend is the os package, see WithBackend.
+//
+// Files outside of the store, like the source of ImportDirectory or the
+// target of Materialize, are always accessed through the os package.
+// Capabilities which need the operating system, like reflinks, extended
+// attributes and locking the store against other processes, are only
+// available with the default backend, or when its files are *os.File.
+type Backend interface {
+	Open(name string) (File, error) // Opens the file for reading, like os.Open
+	Create(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	CreateTemp(dir, pattern string) (File, error)
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(path string, perm fs.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	ReadDir(name string) ([]fs.DirEntry, error) // Sorted by name, like os.ReadDir
+	Stat(name string) (fs.FileInfo, error)
+	Chtimes(name string, atime, mtime time.Time) error
+	Link(oldname, newname string) error // May fail if hard links aren't supported
+}
+
+// File is a file opened by a Backend. *os.File implements it. Files opened
+// for reading may fail to be written and vice versa, and ReadDir only
+// works for directories.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.StringWriter
+	io.Seeker
+	io.Closer
+	Name() string // Path the file was opened with
+	Stat() (fs.FileInfo, error)
+	ReadDir(n int) ([]fs.DirEntry, error)
+	Chmod(mode fs.FileMode) error
+	Truncate(size int64) error
+	Sync() error
+}
+
+// WithBackend sets the backend which the store keeps its files in,
+// instead of the os package.
+func WithBackend(b Backend) Option {
+	return func(o *options) error {
+		if b == nil {
+			return errors.New("withBackend: nil backend")
+		}
+		o.backend = b
+		return nil
+	}
+}
+
+// fs returns the backend of the store.
+func (S *Store) fs() Backend {
+	if S.backend == nil {
+		return osBackend{}
+	}
+	return S.backend
+}
+
+// onOS reports whether the store uses the default backend, so that its
+// paths refer to files of the operating system.
+func (S *Store) onOS() bool {
+	_, ok := S.fs().(osBackend)
+	return ok
+}
+
+// osBackend is the default backend, which calls the os package.
+type osBackend struct{}
+
+func (osBackend) Open(name string) (File, error) {
+	return fileOrNil(os.Open(name))
+}
+
+func (osBackend) Create(name string) (File, error) {
+	return fileOrNil(os.Create(name))
+}
+
+func (osBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return fileOrNil(os.OpenFile(name, flag, perm))
+}
+
+func (osBackend) CreateTemp(dir, pattern string) (File, error) {
+	return fileOrNil(os.CreateTemp(dir, pattern))
+}
+
+func (osBackend) Mkdir(name string, perm fs.FileMode) error    { return os.Mkdir(name, perm) }
+func (osBackend) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (osBackend) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osBackend) Remove(name string) error                     { return os.Remove(name) }
+func (osBackend) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osBackend) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+func (osBackend) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osBackend) Link(oldname, newname string) error           { return os.Link(oldname, newname) }
+func (osBackend) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// fileOrNil returns f as a File, or nil if it's nil, so that a nil *os.File
+// doesn't become a non-nil interface.
+func fileOrNil(f *os.File, err error) (File, error) {
+	if f == nil {
+		return nil, err
+	}
+	return f, err
+}
+
+// readFile reads the whole file from the backend, like os.ReadFile.
+func readFile(b Backend, name string) ([]byte, error) {
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile writes data to the file in the backend, creating or
+// truncating it, like os.WriteFile.
+func writeFile(b Backend, name string, data []byte, perm fs.FileMode) error {
+	f, err := b.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// walkDir walks the file tree at root in the backend, like
+// filepath.WalkDir.
+func walkDir(b Backend, root string, fn fs.WalkDirFunc) error {
+	info, err := b.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkEntry(b, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkEntry walks the entry at path and, if it's a directory, its
+// contents, like filepath.WalkDir.
+func walkEntry(b Backend, path string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, entry, nil); err != nil || !entry.IsDir() {
+		if err == filepath.SkipDir && entry.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := b.ReadDir(path)
+	if err != nil {
+		if err = fn(path, entry, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		if err := walkEntry(b, filepath.Join(path, e.Name()), e, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdirTemp creates a new directory with a random name in dir, which
+// begins with prefix, and returns its path, like os.MkdirTemp.
+func mkdirTemp(b Backend, dir, prefix string) (string, error) {
+	for try := 0; ; try++ {
+		var r [4]byte
+		if _, err := rand.Read(r[:]); err != nil {
+			return "", err
+		}
+		name := filepath.Join(dir, prefix+hex.EncodeToString(r[:]))
+		err := b.Mkdir(name, 0700)
+		if err == nil {
+			return name, nil
+		} else if !errors.Is(err, fs.ErrExist) || try == 100 {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package atylar
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingBackend passes the operations on to the os package, recording
+// the paths they're called with, and fails renames to paths containing
+// failRename.
+type recordingBackend struct {
+	osBackend
+	mu         sync.Mutex
+	paths      []string
+	failRename string
+}
+
+func (b *recordingBackend) record(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paths = append(b.paths, path)
+}
+
+func (b *recordingBackend) Open(name string) (File, error) {
+	b.record(name)
+	return b.osBackend.Open(name)
+}
+
+func (b *recordingBackend) CreateTemp(dir, pattern string) (File, error) {
+	b.record(dir)
+	return b.osBackend.CreateTemp(dir, pattern)
+}
+
+func (b *recordingBackend) Rename(oldpath, newpath string) error {
+	b.record(newpath)
+	if b.failRename != "" && strings.Contains(newpath, b.failRename) {
+		return errors.New("injected failure")
+	}
+	return b.osBackend.Rename(oldpath, newpath)
+}
+
+func TestBackend(t *testing.T) {
+	d := createMockStore(t)
+	b := &recordingBackend{}
+	S, err := New(d, WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := S.ReadFile("file", 0); err != nil || string(content) != "changed" {
+		t.Error("Got", string(content), err, "but expected changed")
+	}
+	found := map[string]bool{}
+	for _, path := range b.paths {
+		found[path] = true
+	}
+	if !found[S.filePath("file", false)] || !found[S.historyDir()] {
+		t.Error("Got", b.paths, "but expected the file and a temporary file in the history")
+	}
+
+	b.failRename = "file2"
+	if err := S.WriteFile("file2", []byte("lost")); err == nil {
+		t.Error("Got", err, "but expected the injected failure")
+	}
+	if content, err := S.ReadFile("file2", 0); err != nil || string(content) != "Hello from the second file!" {
+		t.Error("Got", string(content), err, "but expected the file to be unchanged")
+	}
+}
+
+func TestWithBackendNil(t *testing.T) {
+	if _, err := New(t.TempDir(), WithBackend(nil)); err == nil {
+		t.Error("Got", err, "but expected an error")
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	d := createMockStore(t)
+	os.MkdirAll(filepath.Join(d, "dir", "skip"), 0755)
+	os.WriteFile(filepath.Join(d, "dir", "skip", "x"), nil, 0644)
+	os.WriteFile(filepath.Join(d, "dir", "y"), nil, 0644)
+	walk := func(walker func(string, fs.WalkDirFunc) error) []string {
+		paths := []string{}
+		err := walker(d, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			paths = append(paths, path)
+			if entry.IsDir() && entry.Name() == "skip" {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+	expected := walk(filepath.WalkDir)
+	got := walk(func(root string, fn fs.WalkDirFunc) error { return walkDir(osBackend{}, root, fn) })
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Error("Got", got, "but expected", expected)
+	}
+	err := walkDir(osBackend{}, filepath.Join(d, "missing"), func(path string, entry fs.DirEntry, err error) error { return err })
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Got", err, "but expected", fs.ErrNotExist)
+	}
+}
@@ -0,0 +1,218 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Pair names the source and the destination of a batched move or copy.
+type Pair struct {
+	From string
+	To   string
+}
+
+// sharedGeneration returns a function which increments the generation on its
+// first call and keeps returning that value afterwards, so that all versions
+// captured by a batch share a single generation. If nothing is captured,
+// no generation is used up.
+func (S *Store) sharedGeneration() func() uint64 {
+	var g uint64
+	return func() uint64 {
+		if g == 0 {
+			g = S.GetGeneration(true)
+		}
+		return g
+	}
+}
+
+// validateBatch checks that all names are valid and that none of the files
+// whose history may be captured appears in the batch more than once, as two
+// versions of the same file can't share a generation. Other names may repeat.
+func validateBatch(captured []string, other []string) error {
+	seen := make(map[string]bool)
+	for _, name := range captured {
+		norm := normalizeName(name, false)
+		if norm == "" {
+			return fmt.Errorf("%q: %w", name, ErrInvalidName)
+		}
+		if seen[norm] {
+			return fmt.Errorf("%s appears in the batch more than once: %w", norm, ErrInvalidName)
+		}
+		seen[norm] = true
+	}
+	for _, name := range other {
+		norm := normalizeName(name, false)
+		if norm == "" {
+			return fmt.Errorf("%q: %w", name, ErrInvalidName)
+		}
+		if seen[norm] {
+			return fmt.Errorf("%s appears in the batch more than once: %w", norm, ErrInvalidName)
+		}
+	}
+	return nil
+}
+
+// RemoveAll removes all given files, capturing their history under a single
+// generation. The names are validated before anything is removed. The
+// returned slice holds the error of each removal, in the order of names.
+func (S *Store) RemoveAll(names []string) ([]error, error) {
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("removeAll: %w", err)
+	}
+	if err := validateBatch(names, nil); err != nil {
+		return nil, fmt.Errorf("removeAll: %w", err)
+	}
+	defer S.lock(names...)()
+	next := S.sharedGeneration()
+	errs := make([]error, len(names))
+	for i, name := range names {
+		if err := S.remove(name, next); err != nil {
+			errs[i] = fmt.Errorf("remove %s: %w", name, err)
+		}
+	}
+	return errs, nil
+}
+
+// MoveAll performs all given moves, capturing history under a single
+// generation. The names are validated before anything is moved. The
+// returned slice holds the error of each move, in the order of pairs.
+func (S *Store) MoveAll(pairs []Pair) ([]error, error) {
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("moveAll: %w", err)
+	}
+	names := make([]string, 0, 2*len(pairs))
+	for _, p := range pairs {
+		names = append(names, p.From, p.To)
+	}
+	if err := validateBatch(names, nil); err != nil {
+		return nil, fmt.Errorf("moveAll: %w", err)
+	}
+	defer S.lock(names...)()
+	next := S.sharedGeneration()
+	errs := make([]error, len(pairs))
+	for i, p := range pairs {
+		if err := S.move(p.From, p.To, next); err != nil {
+			errs[i] = fmt.Errorf("move %s %s: %w", p.From, p.To, err)
+		}
+	}
+	return errs, nil
+}
+
+// CopyAll performs all given copies, capturing history under a single
+// generation. The names are validated before anything is copied. A file may
+// be the source of several copies, but can't also be a destination. The
+// returned slice holds the error of each copy, in the order of pairs.
+func (S *Store) CopyAll(pairs []Pair) ([]error, error) {
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("copyAll: %w", err)
+	}
+	destinations := make([]string, 0, len(pairs))
+	sources := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		destinations = append(destinations, p.To)
+		sources = append(sources, p.From)
+	}
+	if err := validateBatch(destinations, sources); err != nil {
+		return nil, fmt.Errorf("copyAll: %w", err)
+	}
+	defer S.lock(append(destinations, sources...)...)()
+	next := S.sharedGeneration()
+	errs := make([]error, len(pairs))
+	for i, p := range pairs {
+		if err := S.copy(p.From, p.To, next); err != nil {
+			errs[i] = fmt.Errorf("copy %s %s: %w", p.From, p.To, err)
+		}
+	}
+	return errs, nil
+}
+
+// Status describes a file for listings: its live state and its newest
+// historic version.
+type Status struct {
+	Entry
+	Generation uint64 // Newest historic version, 0 if there is none
+}
+
+// StatMany returns the status of all given files. Each directory of the
+// store is read only once, however many of the files it contains, and
+// the newest versions are looked up in the index of the history, or, for
+// stores not opened with New, read from each history directory once. The returned slices are in the order of names. If a file
+// doesn't exist, its error is set, but the newest historic version is
+// still reported.
+func (S *Store) StatMany(names []string) ([]Status, []error) {
+	statuses := make([]Status, len(names))
+	errs := make([]error, len(names))
+	byDir := make(map[string][]int)
+	for i, name := range names {
+		norm := normalizeName(name, false)
+		if norm == "" {
+			errs[i] = fmt.Errorf("statMany %q: %w", name, ErrInvalidName)
+			continue
+		}
+		statuses[i].Name = norm
+		byDir[path.Dir(norm)] = append(byDir[path.Dir(norm)], i)
+	}
+	for dir, indices := range byDir {
+		live, history, err := S.readDirs(dir, S.index == nil)
+		for _, i := range indices {
+			name := statuses[i].Name
+			if err != nil {
+				errs[i] = fmt.Errorf("statMany %s: %w", name, err)
+				continue
+			}
+			if S.index != nil {
+				statuses[i].Generation = S.index.newest(name)
+			} else {
+				statuses[i].Generation = history[path.Base(name)]
+			}
+			entry, ok := live[path.Base(name)]
+			if !ok || entry.IsDir() {
+				errs[i] = fmt.Errorf("statMany %s: %w", name, os.ErrNotExist)
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				errs[i] = fmt.Errorf("statMany %s: %w", name, err)
+				continue
+			}
+			statuses[i].Size, statuses[i].ModTime = info.Size(), info.ModTime()
+		}
+	}
+	return statuses, errs
+}
+
+// readDirs reads the directory of the store with the given slash-separated
+// name and, if history is true, the corresponding history directory. It
+// returns the live entries and the newest generation of every file in the
+// history, by name. Missing directories are treated as empty.
+func (S *Store) readDirs(dir string, history bool) (map[string]fs.DirEntry, map[string]uint64, error) {
+	live := make(map[string]fs.DirEntry)
+	newest := make(map[string]uint64)
+	entries, err := S.fs().ReadDir(filepath.Join(S.Directory, filepath.FromSlash(dir)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		live[entry.Name()] = entry
+	}
+	if !history {
+		return live, newest, nil
+	}
+	entries, err = S.fs().ReadDir(filepath.Join(S.historyDir(), filepath.FromSlash(dir)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || isMetadata(entry.Name()) {
+			continue
+		}
+		if name, g := parseVersion(entry.Name()); g > newest[name] {
+			newest[name] = g
+		}
+	}
+	return live, newest, nil
+}
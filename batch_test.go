@@ -0,0 +1,168 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		captured []string
+		other    []string
+		valid    bool
+	}{
+		{"Empty", nil, nil, true},
+		{"Distinct", []string{"a", "b"}, []string{"c", "c"}, true},
+		{"Invalid name", []string{"a", "/"}, nil, false},
+		{"Invalid other name", []string{"a"}, []string{".."}, false},
+		{"Duplicate", []string{"a", "b", "a"}, nil, false},
+		{"Duplicate after normalization", []string{"a/b", "/a//b/"}, nil, false},
+		{"Captured as other", []string{"a"}, []string{"a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBatch(tt.captured, tt.other)
+			if tt.valid && err != nil {
+				t.Error("Expected <nil> but got", err)
+			} else if !tt.valid && !errors.Is(err, ErrInvalidName) {
+				t.Error("Expected ErrInvalidName but got", err)
+			}
+		})
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.RemoveAll([]string{"file", "file"}); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+	errs, err := S.RemoveAll([]string{"file", "missing", "file2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 3 || errs[0] != nil || !errors.Is(errs[1], os.ErrNotExist) || errs[2] != nil {
+		t.Error("Expected [<nil> not exist <nil>] but got", errs)
+	}
+	if S.Generation != 124 {
+		t.Error("Expected S.Generation to be", 124, "but it is", S.Generation)
+	}
+	for _, name := range []string{"file@124", "file2@124"} {
+		if _, err := os.Stat(filepath.Join(d, ".history", name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMoveAll(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.MoveAll([]Pair{{"file", "a"}, {"a", "b"}}); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+	errs, err := S.MoveAll([]Pair{{"file", "file2"}, {"missing", "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], os.ErrNotExist) {
+		t.Error("Expected [<nil> not exist] but got", errs)
+	}
+	if S.Generation != 124 {
+		t.Error("Expected S.Generation to be", 124, "but it is", S.Generation)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file2")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, ".history", "file2@124")); err != nil || string(b) != "Hello from the second file!" {
+		t.Error("Expected Hello from the second file! <nil> but got", string(b), err)
+	}
+}
+
+func TestCopyAll(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.CopyAll([]Pair{{"file", "file2"}, {"file2", "a"}}); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+	errs, err := S.CopyAll([]Pair{{"file", "file2"}, {"file", "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0] != nil || errs[1] != nil {
+		t.Error("Expected [<nil> <nil>] but got", errs)
+	}
+	for _, name := range []string{"file2", "a"} {
+		if b, err := os.ReadFile(filepath.Join(d, name)); err != nil || string(b) != "Hello!" {
+			t.Error("Expected Hello! <nil> but got", string(b), err)
+		}
+	}
+	if h, err := S.History("file2"); err != nil || len(h) != 1 || h[0] != 124 {
+		t.Error("Expected [124] <nil> but got", h, err)
+	}
+}
+
+func TestStatMany(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if err := os.MkdirAll(filepath.Join(d, ".history", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, ".history", "dir", "gone@7"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, ".history", "file@5"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	statuses, errs := S.StatMany([]string{"file", "/file2", "dir/gone", "missing", ".."})
+	tests := []struct {
+		name       string
+		size       int64
+		generation uint64
+		err        error
+	}{
+		{"file", 6, 123, nil},
+		{"file2", 27, 0, nil},
+		{"dir/gone", 0, 7, os.ErrNotExist},
+		{"missing", 0, 0, os.ErrNotExist},
+		{"", 0, 0, ErrInvalidName},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := statuses[i]
+			if s.Name != tt.name || s.Size != tt.size || s.Generation != tt.generation {
+				t.Error("Got", s.Name, s.Size, s.Generation, "but expected", tt.name, tt.size, tt.generation)
+			}
+			if !errors.Is(errs[i], tt.err) {
+				t.Error("Expected", tt.err, "but got", errs[i])
+			}
+		})
+	}
+}
+
+func TestStatManyIndex(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	// The history directory isn't read, so a version added behind the
+	// store's back isn't noticed.
+	if err := os.WriteFile(filepath.Join(d, ".history", "file2@999"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := S.History("file")
+	statuses, errs := S.StatMany([]string{"file", "file2"})
+	if errs[0] != nil || statuses[0].Generation != h[0] || statuses[0].Size != 7 {
+		t.Error("Got", statuses[0], errs[0], "but expected the newest version", h[0])
+	}
+	if errs[1] != nil || statuses[1].Generation != 0 {
+		t.Error("Got", statuses[1], errs[1], "but expected the generation from the index")
+	}
+}
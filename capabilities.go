@@ -0,0 +1,229 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Capabilities describes the features of the filesystem holding the store.
+// They are probed when the store is opened and the store uses them to pick
+// its strategies, e.g. files are cloned instead of copied where possible,
+// and to reject names of files which couldn't be created, see checkName.
+type Capabilities struct {
+	Hardlinks       bool // Hard links can be created
+	Reflinks        bool // Files can be cloned, sharing data until it's modified
+	Xattrs          bool // Extended attributes can be set
+	CaseSensitive   bool // Names which differ only in letter case refer to different files
+	MaxNameLength   int  // Length of the longest file name which can be created
+	SyncDirectories bool // Directories can be synced to make renames durable
+}
+
+// Capabilities returns the capabilities of the store's filesystem
+// detected by New.
+func (S *Store) Capabilities() Capabilities {
+	return S.capabilities
+}
+
+// checkName returns an error wrapping ErrInvalidName if a file can't be
+// created under the name on the store's filesystem: if any element of
+// the name is longer than MaxNameLength, leaving room for the suffixes
+// of its history entries, or if the filesystem isn't CaseSensitive and
+// an existing file or directory differs from it only in letter case,
+// which would be replaced instead of a new file being created.
+func (S *Store) checkName(file string) error {
+	name := normalizeName(file, false)
+	if name == "" {
+		return ErrInvalidName
+	}
+	elements := strings.Split(name, "/")
+	if limit := S.capabilities.MaxNameLength; limit > 0 {
+		// History entries append the largest generation and a suffix.
+		extra := 0
+		for _, suffix := range suffixes {
+			if len(suffix) > extra {
+				extra = len(suffix)
+			}
+		}
+		extra += len("@18446744073709551615")
+		for i, e := range elements {
+			n := len(e)
+			if i == len(elements)-1 {
+				n += extra
+			}
+			if n > limit {
+				return fmt.Errorf("%w: %s is too long", ErrInvalidName, e)
+			}
+		}
+	}
+	if !S.capabilities.CaseSensitive {
+		dir := S.Directory
+		for _, e := range elements {
+			actual, err := S.caseVariant(dir, e)
+			if err != nil {
+				return err
+			} else if actual != "" {
+				return fmt.Errorf("%w: %s differs only in case from %s", ErrInvalidName, e, actual)
+			}
+			dir = filepath.Join(dir, e)
+		}
+	}
+	return nil
+}
+
+// nameCache remembers the names of the entries of the store's directories
+// by their lower case form, so that checking a name doesn't list its
+// directory every time. The names may be stale, so a directory is listed
+// again before a collision is reported.
+type nameCache struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]string
+}
+
+// caseVariant returns the name of the entry of dir which differs from name
+// only in letter case, or "" if there's none. Only names which are new to
+// the cache and exist already make it list the directory.
+func (S *Store) caseVariant(dir, name string) (string, error) {
+	c := S.names
+	if c == nil {
+		c = &nameCache{} // Not opened with New, so nothing is remembered.
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dirs == nil {
+		c.dirs = make(map[string]map[string]string)
+	}
+	key := strings.ToLower(name)
+	names := c.dirs[dir]
+	actual, known := names[key]
+	if known && actual == name {
+		return "", nil
+	}
+	if !known {
+		_, err := S.fs().Stat(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			if names != nil {
+				names[key] = name // It's about to be created.
+			}
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	entries, err := S.fs().ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	names = make(map[string]string, len(entries))
+	for _, entry := range entries {
+		names[strings.ToLower(entry.Name())] = entry.Name()
+	}
+	c.dirs[dir] = names
+	if actual := names[key]; actual != name {
+		return actual, nil
+	}
+	return "", nil
+}
+
+// nameLengthPath returns the path to the file holding the MaxNameLength
+// probed when the store was first opened.
+func (S *Store) nameLengthPath() string {
+	return filepath.Join(S.historyDir(), ".name-length")
+}
+
+// probe detects the capabilities of the store's filesystem, probing
+// MaxNameLength only once and keeping it in the store.
+func (S *Store) probe() (Capabilities, error) {
+	n, err := readNumber(S.fs(), S.nameLengthPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Capabilities{}, err
+	}
+	caps, err := probeCapabilities(S.fs(), S.historyDir(), int(n))
+	if err != nil {
+		return caps, err
+	}
+	if n == 0 {
+		if err := S.writeNumber(S.nameLengthPath(), uint64(caps.MaxNameLength)); err != nil {
+			return caps, err
+		}
+	}
+	return caps, nil
+}
+
+// errUnsupported is returned by platform-specific helpers
+// when an operation isn't available.
+var errUnsupported = errors.New("unsupported operation")
+
+// probeCapabilities detects the capabilities of the filesystem holding
+// dir. It works in a temporary subdirectory, which is removed afterwards.
+// Reflinks and extended attributes are only probed with the default
+// backend, as they need the operating system. Finding MaxNameLength takes
+// creating about ten files, so if nameLength isn't 0, it's used instead.
+func probeCapabilities(fsys Backend, dir string, nameLength int) (Capabilities, error) {
+	caps := Capabilities{}
+	tmp, err := mkdirTemp(fsys, dir, ".probe-")
+	if err != nil {
+		return caps, fmt.Errorf("probeCapabilities %s: %w", dir, err)
+	}
+	defer fsys.RemoveAll(tmp)
+	file := filepath.Join(tmp, "a")
+	if err := writeFile(fsys, file, []byte("probe"), 0644); err != nil {
+		return caps, fmt.Errorf("probeCapabilities %s: %w", dir, err)
+	}
+
+	caps.Hardlinks = fsys.Link(file, filepath.Join(tmp, "link")) == nil
+	if _, ok := fsys.(osBackend); ok {
+		caps.Reflinks = probeReflinks(file, filepath.Join(tmp, "clone"))
+		caps.Xattrs = probeXattrs(file)
+	}
+	if _, err := fsys.Stat(filepath.Join(tmp, "A")); errors.Is(err, os.ErrNotExist) {
+		caps.CaseSensitive = true
+	}
+	if d, err := fsys.Open(tmp); err == nil {
+		caps.SyncDirectories = d.Sync() == nil
+		d.Close()
+	}
+
+	if nameLength > 0 {
+		caps.MaxNameLength = nameLength
+		return caps, nil
+	}
+	// Binary search for the longest name which can be created.
+	low, high := 1, 1024
+	for low < high {
+		n := (low + high + 1) / 2
+		name := filepath.Join(tmp, strings.Repeat("n", n))
+		if f, err := fsys.Create(name); err == nil {
+			f.Close()
+			fsys.Remove(name)
+			low = n
+		} else {
+			high = n - 1
+		}
+	}
+	caps.MaxNameLength = low
+	return caps, nil
+}
+
+// copyContent copies the content of src to dst, cloning it
+// if the filesystem supports it, and reports the progress p.
+func (S *Store) copyContent(dst, src File, p Progress) error {
+	if S.onProgress != nil && p.Op != "" && p.Total == 0 {
+		if info, err := src.Stat(); err == nil {
+			p.Total = info.Size()
+		}
+	}
+	d, dok := dst.(*os.File)
+	s, sok := src.(*os.File)
+	if S.capabilities.Reflinks && dok && sok {
+		if err := cloneFile(d, s); err == nil {
+			p.Copied = p.Total
+			S.report(p)
+			return nil
+		}
+	}
+	return S.copyData(dst, src, p)
+}
@@ -0,0 +1,38 @@
+package atylar
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request number.
+const ficlone = 0x40049409
+
+// cloneFile makes dst share the data of src using copy-on-write.
+func cloneFile(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// probeReflinks reports whether file can be cloned to the given path.
+func probeReflinks(file, clone string) bool {
+	src, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer src.Close()
+	dst, err := os.Create(clone)
+	if err != nil {
+		return false
+	}
+	defer dst.Close()
+	return cloneFile(dst, src) == nil
+}
+
+// probeXattrs reports whether an extended attribute can be set on file.
+func probeXattrs(file string) bool {
+	return syscall.Setxattr(file, "user.atylar", []byte("probe"), 0) == nil
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package atylar
+
+import "os"
+
+// cloneFile makes dst share the data of src using copy-on-write.
+// It isn't supported on this platform.
+func cloneFile(dst, src *os.File) error {
+	return errUnsupported
+}
+
+// probeReflinks reports whether file can be cloned to the given path.
+func probeReflinks(file, clone string) bool {
+	return false
+}
+
+// probeXattrs reports whether an extended attribute can be set on file.
+func probeXattrs(file string) bool {
+	return false
+}
@@ -0,0 +1,159 @@
+package atylar
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	d := t.TempDir()
+	caps, err := probeCapabilities(osBackend{}, d, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.MaxNameLength < 8 || caps.MaxNameLength > 1024 {
+		t.Error("Got an implausible maximal name length", caps.MaxNameLength)
+	}
+	if runtime.GOOS == "linux" && (!caps.Hardlinks || !caps.CaseSensitive) {
+		t.Error("Expected hard links and case sensitivity on Linux but got", caps)
+	}
+	if dir, err := os.ReadDir(d); err != nil || len(dir) != 0 {
+		t.Error("Expected the probe to clean up but got", dir, err)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(filepath.Join(d, "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if S.Capabilities().MaxNameLength == 0 {
+		t.Error("Expected New to probe the capabilities")
+	}
+	// The name length is only probed when the store is first opened.
+	S.Close()
+	if err := os.WriteFile(filepath.Join(d, "test", ".history", ".name-length"), []byte("100"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	S, err = New(filepath.Join(d, "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if n := S.Capabilities().MaxNameLength; n != 100 {
+		t.Error("Got", n, "but expected the kept name length", 100)
+	}
+	f, err := S.Overwrite("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("v1")
+	f.Close()
+	if err := S.Copy("abc", "def"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "test", "def")); err != nil || string(b) != "v1" {
+		t.Error("Expected v1 <nil> but got", string(b), err)
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	d := createMockStore(t)
+	if err := os.Mkdir(filepath.Join(d, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	S := Store{Directory: d, Generation: 123, capabilities: Capabilities{MaxNameLength: 40}}
+	S.backend = &foldBackend{Backend: osBackend{}}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"file", true},
+		{"dir/new", true},
+		{"missing/FILE", true},
+		{"FILE", false},
+		{"Dir/new", false},
+		{"", false},
+		{strings.Repeat("n", 12), true},
+		{strings.Repeat("n", 13), false},
+		{strings.Repeat("n", 40) + "/file", true},
+		{strings.Repeat("n", 41) + "/file", false},
+	}
+	for _, tt := range tests {
+		if err := S.checkName(tt.name); (err == nil) != tt.valid || err != nil && !errors.Is(err, ErrInvalidName) {
+			t.Error("Got", err, "for", tt.name, "but expected it to be valid:", tt.valid)
+		}
+	}
+	if _, err := S.Overwrite("FILE"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+	if err := S.Copy("file", "File2"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+	S.capabilities.CaseSensitive = true
+	if err := S.checkName("FILE"); err != nil {
+		t.Error("Got", err, "but expected names differing in case to be allowed")
+	}
+}
+
+func TestCheckNameCached(t *testing.T) {
+	d := createMockStore(t)
+	b := &foldBackend{Backend: osBackend{}}
+	S := Store{Directory: d, Generation: 123, names: &nameCache{}}
+	S.backend = b
+	for i := 0; i < 3; i++ {
+		for _, name := range []string{"file", "new", "dir/new"} {
+			if err := S.checkName(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if b.listed != 1 {
+		t.Error("Got", b.listed, "listings but expected only the root to be listed once")
+	}
+	if err := S.WriteFile("new", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.checkName("NEW"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+	// Removed names aren't collisions, even while they are remembered.
+	if err := S.Remove("new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.checkName("NEW"); err != nil {
+		t.Error("Got", err, "but expected a removed name not to collide")
+	}
+}
+
+// foldBackend emulates a filesystem which isn't case sensitive on top of
+// one which is, as far as Stat is concerned, and counts directory listings.
+type foldBackend struct {
+	Backend
+	listed int
+}
+
+func (b foldBackend) Stat(name string) (fs.FileInfo, error) {
+	info, err := b.Backend.Stat(name)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+	entries, _ := b.Backend.ReadDir(filepath.Dir(name))
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), filepath.Base(name)) {
+			return entry.Info()
+		}
+	}
+	return info, err
+}
+
+func (b *foldBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	b.listed++
+	return b.Backend.ReadDir(name)
+}
@@ -0,0 +1,287 @@
+package atylar
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// With WithChangeLog, every change of a live file is appended to
+// `.history/.log` as a line of JSON, so that clients can ask for the
+// changes since the last generation they saw with Changes, e.g. to resume
+// syncing after a disconnect, follow them with Watch, or list the recent
+// ones with Log. A change is logged under the generation under which it
+// captured the previous version of a file, or a new one if it didn't
+// capture any, e.g. when a file was created. The changes of a batch or a
+// transaction share a single generation. Modifications are serialized
+// while the log is enabled, so that generations are taken and logged in
+// one step and the log is ordered by them. Changes which failed to be
+// logged, e.g. because the disk was full, are missing from the log.
+
+// Change is a change of a live file, recorded in the change log.
+type Change struct {
+	Generation uint64
+	Kind       EventKind // Not EventGC, which doesn't change live files
+	Name       string
+	To         string // Destination of moves, copies and restores to another file
+	Time       time.Time
+}
+
+// changeRecord is a line of the change log.
+type changeRecord struct {
+	Generation uint64    `json:"generation"`
+	Op         string    `json:"op"`
+	Name       string    `json:"name"`
+	To         string    `json:"to,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// changeKinds maps the operations in the change log to event kinds.
+var changeKinds = map[string]EventKind{
+	EventWrite.String():   EventWrite,
+	EventRemove.String():  EventRemove,
+	EventMove.String():    EventMove,
+	EventCopy.String():    EventCopy,
+	EventRestore.String(): EventRestore,
+}
+
+// logMu serializes appends to change logs, so that lines don't interleave.
+var logMu sync.Mutex
+
+// WithChangeLog records every change of a live file in the change log,
+// see Changes. Changes which don't capture a version, like creating a file,
+// use up a generation then.
+func WithChangeLog() Option {
+	return func(o *options) error {
+		o.changeLog = true
+		return nil
+	}
+}
+
+// logPath returns the path to the change log.
+func (S *Store) logPath() string {
+	return filepath.Join(S.historyDir(), ".log")
+}
+
+// logChange appends the change to the change log. If it didn't capture
+// a version, a new generation is assigned to it.
+func (S *Store) logChange(e Event, generation uint64) {
+	if generation == 0 {
+		generation = S.GetGeneration(true)
+	}
+	b, err := json.Marshal(changeRecord{
+		Generation: generation,
+		Op:         e.Kind.String(),
+		Name:       e.Name,
+		To:         e.To,
+		Time:       time.Now().UTC(),
+	})
+	if err != nil {
+		return
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	f, err := S.fs().OpenFile(S.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, S.filePerm())
+	if err != nil {
+		return
+	}
+	f.Write(append(b, '\n'))
+	f.Close()
+}
+
+// readChanges reads the change log from the given offset, and returns the
+// changes and the offset after the last complete line.
+func (S *Store) readChanges(offset int64) ([]Change, int64, error) {
+	changes := []Change{}
+	f, err := S.fs().Open(S.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return changes, offset, nil
+	} else if err != nil {
+		return changes, offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return changes, offset, err
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return changes, offset, nil // An incomplete line is being written.
+		} else if err != nil {
+			return changes, offset, err
+		}
+		offset += int64(len(line))
+		var record changeRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return changes, offset, fmt.Errorf("malformed change %q: %w", line, err)
+		}
+		kind, ok := changeKinds[record.Op]
+		if !ok {
+			return changes, offset, fmt.Errorf("unknown change %q", record.Op)
+		}
+		changes = append(changes, Change{record.Generation, kind, record.Name, record.To, record.Time})
+	}
+}
+
+// Changes returns the logged changes with generations above since, from
+// the oldest. Passing the generation of the newest change a client has
+// seen returns the ones it missed. Changes are only logged by stores opened
+// WithChangeLog, but the log can be read by read-only stores too.
+func (S *Store) Changes(since uint64) ([]Change, error) {
+	all, _, err := S.readChanges(0)
+	if err != nil {
+		return []Change{}, fmt.Errorf("changes: %w", err)
+	}
+	changes := []Change{}
+	for _, c := range all {
+		if c.Generation > since {
+			changes = append(changes, c)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Generation < changes[j].Generation })
+	return changes, nil
+}
+
+// checkChangeLog returns ErrNoChangeLog if the store doesn't have a change
+// log which is kept up to date.
+func (S *Store) checkChangeLog() error {
+	if S.changeLog {
+		return nil
+	}
+	if S.readOnly {
+		if _, err := S.fs().Stat(S.logPath()); err == nil {
+			return nil
+		}
+	}
+	return ErrNoChangeLog
+}
+
+// Log returns up to limit of the most recently logged changes, from the
+// newest, answering what changed in the store recently. A limit of 0 or
+// less returns all of them. Logging is opt-in, so Log fails with
+// ErrNoChangeLog unless the store was opened WithChangeLog, or it's
+// opened read-only and has a change log.
+func (S *Store) Log(limit int) ([]Change, error) {
+	if err := S.checkChangeLog(); err != nil {
+		return []Change{}, fmt.Errorf("log: %w", err)
+	}
+	changes, err := S.Changes(0)
+	if err != nil {
+		return []Change{}, fmt.Errorf("log: %w", err)
+	}
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+// ListAt lists the files of the store as it looked right before the
+// change with the given generation, like the view returned by At, as
+// sorted slash-separated paths. Which files existed is replayed from the
+// change log, as history alone doesn't record when files were created
+// or removed, so it fails with ErrNoChangeLog unless the store has one,
+// see Log, and files created before the log was enabled are missing.
+// Generation 0 lists the live files, like List.
+func (S *Store) ListAt(generation uint64) ([]string, error) {
+	if generation == 0 {
+		files, err := S.List(false)
+		if err != nil {
+			return nil, fmt.Errorf("listAt %d: %w", generation, err)
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+	if err := S.checkChangeLog(); err != nil {
+		return nil, fmt.Errorf("listAt %d: %w", generation, err)
+	}
+	changes, err := S.Changes(0)
+	if err != nil {
+		return nil, fmt.Errorf("listAt %d: %w", generation, err)
+	}
+	exists := make(map[string]bool)
+	for _, c := range changes {
+		if c.Generation >= generation {
+			break
+		}
+		switch c.Kind {
+		case EventWrite:
+			exists[c.Name] = true
+		case EventRemove:
+			delete(exists, c.Name)
+		case EventMove:
+			delete(exists, c.Name)
+			exists[c.To] = true
+		case EventCopy:
+			exists[c.To] = true
+		case EventRestore:
+			if c.To != "" {
+				exists[c.To] = true
+			} else {
+				exists[c.Name] = true
+			}
+		}
+	}
+	files := []string{}
+	for name := range exists {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Watch streams the changes logged by the store after it's called, until
+// the context is canceled, when the channel is closed. Clients which may
+// miss changes, e.g. while reconnecting, can resume with Changes.
+func (S *Store) Watch(ctx context.Context) (<-chan Change, error) {
+	if !S.changeLog {
+		return nil, fmt.Errorf("watch: %w", ErrNoChangeLog)
+	}
+	var offset int64
+	if info, err := S.fs().Stat(S.logPath()); err == nil {
+		offset = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("watch: %w", err)
+	}
+	wake := make(chan struct{}, 1)
+	cancel := S.Subscribe(func(Event) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	out := make(chan Change)
+	go func() {
+		defer close(out)
+		defer cancel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wake:
+			}
+			// Malformed lines are skipped, as they'd be read over and over.
+			changes, next, _ := S.readChanges(offset)
+			offset = next
+			for _, c := range changes {
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
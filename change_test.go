@@ -0,0 +1,267 @@
+package atylar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d, WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return S.WriteFile("new", []byte("one")) },
+		func() error { return S.WriteFile("file", []byte("changed")) },
+		func() error { return S.Move("new", "moved") },
+		func() error { return S.Remove("file2") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Generation: 124, Kind: EventWrite, Name: "new"},
+		{Generation: 125, Kind: EventWrite, Name: "file"},
+		{Generation: 126, Kind: EventMove, Name: "new", To: "moved"},
+		{Generation: 127, Kind: EventRemove, Name: "file2"},
+	}
+	R, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R.Close()
+	tests := []struct {
+		since    uint64
+		expected []Change
+	}{
+		{0, expected},
+		{125, expected[2:]},
+		{127, []Change{}},
+	}
+	for _, tt := range tests {
+		changes, err := R.Changes(tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range changes {
+			if changes[i].Time.IsZero() {
+				t.Error("Got", changes[i], "without a time")
+			}
+			changes[i].Time = time.Time{}
+		}
+		if !reflect.DeepEqual(changes, tt.expected) {
+			t.Error("Got", changes, "since", tt.since, "but expected", tt.expected)
+		}
+	}
+}
+
+func TestChangesOrdered(t *testing.T) {
+	S, err := New(t.TempDir(), WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := S.WriteFile(fmt.Sprint("file", i), []byte(fmt.Sprint(j))); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// The log itself, not just Changes, must be ordered, so that a client
+	// which saw a change has seen all the ones before it.
+	changes, _, err := S.readChanges(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 80 {
+		t.Error("Got", len(changes), "changes but expected 80")
+	}
+	for i := 1; i < len(changes); i++ {
+		if changes[i].Generation <= changes[i-1].Generation {
+			t.Fatal("Got generation", changes[i].Generation, "logged after", changes[i-1].Generation)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	S, err := New(createMockStore(t), WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("new", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Copy("new", "copied"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Change{
+		{Generation: 126, Kind: EventRemove, Name: "file"},
+		{Generation: 125, Kind: EventCopy, Name: "new", To: "copied"},
+		{Generation: 124, Kind: EventWrite, Name: "new"},
+	}
+	tests := []struct {
+		limit    int
+		expected []Change
+	}{
+		{0, expected},
+		{-1, expected},
+		{2, expected[:2]},
+		{10, expected},
+	}
+	for _, tt := range tests {
+		changes, err := S.Log(tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range changes {
+			changes[i].Time = time.Time{}
+		}
+		if !reflect.DeepEqual(changes, tt.expected) {
+			t.Error("Got", changes, "with limit", tt.limit, "but expected", tt.expected)
+		}
+	}
+}
+
+func TestLogDisabled(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("new", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := S.Log(0); !errors.Is(err, ErrNoChangeLog) {
+		t.Error("Got", changes, err, "but expected", ErrNoChangeLog)
+	}
+	S.Close()
+	R, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R.Close()
+	if changes, err := R.Log(0); !errors.Is(err, ErrNoChangeLog) {
+		t.Error("Got", changes, err, "but expected", ErrNoChangeLog)
+	}
+}
+
+func TestListAt(t *testing.T) {
+	S, err := NewMemory(WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	steps := []func() error{
+		func() error { return S.WriteFile("a", []byte("1")) },
+		func() error { return S.WriteFile("b", []byte("1")) },
+		func() error { return S.WriteFile("a", []byte("2")) },
+		func() error { return S.Remove("b") },
+		func() error { return S.Move("a", "dir/c") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, err := S.Changes(0)
+	if err != nil || len(log) != len(steps) {
+		t.Fatal("Got", log, err, "but expected a change per step")
+	}
+	tests := []struct {
+		generation uint64
+		expected   []string
+	}{
+		{log[0].Generation, []string{}},
+		{log[1].Generation, []string{"a"}},
+		{log[3].Generation, []string{"a", "b"}},
+		{log[4].Generation, []string{"a"}}, // b was removed, though its version is kept.
+		{log[4].Generation + 1, []string{"dir/c"}},
+		{0, []string{"dir/c"}},
+	}
+	for _, tt := range tests {
+		if files, err := S.ListAt(tt.generation); err != nil || !reflect.DeepEqual(files, tt.expected) {
+			t.Error("Got", files, err, "at", tt.generation, "but expected", tt.expected)
+		}
+	}
+
+	D, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer D.Close()
+	if _, err := D.ListAt(1); !errors.Is(err, ErrNoChangeLog) {
+		t.Error("Got", err, "but expected", ErrNoChangeLog)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d, WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("before", nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := S.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if err := S.WriteFile(name, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		select {
+		case c := <-changes:
+			if c.Name != name || c.Kind != EventWrite {
+				t.Error("Got", c, "but expected a write of", name)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a write of", name)
+		}
+	}
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Error("Expected no more changes")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the channel to be closed")
+	}
+
+	P, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer P.Close()
+	if _, err := P.Watch(context.Background()); err == nil {
+		t.Error("Expected Watch to fail without the change log")
+	}
+}
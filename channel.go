@@ -0,0 +1,203 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Channels name versions of a file, like "draft" and "published", so that
+// applications can tell which version to show without keeping a copy of the
+// file for each purpose. Every channel of a file points at a generation.
+// They are recorded in `.history/.channels`, in one file per store file,
+// and the versions they point at are never removed by GC.
+
+// channelPath returns the path to the record of the file's channels.
+func (S *Store) channelPath(file string) string {
+	return filepath.Join(S.historyDir(), ".channels", filepath.FromSlash(normalizeName(file, false)))
+}
+
+// readChannels reads the channels of the file, which are empty if it has none.
+func (S *Store) readChannels(file string) (map[string]uint64, error) {
+	channels := make(map[string]uint64)
+	b, err := readFile(S.fs(), S.channelPath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return channels, nil
+	} else if err != nil {
+		return channels, err
+	}
+	if err := json.Unmarshal(b, &channels); err != nil {
+		return channels, err
+	}
+	return channels, nil
+}
+
+// writeChannels replaces the record of the file's channels.
+func (S *Store) writeChannels(file string, channels map[string]uint64) error {
+	path := S.channelPath(file)
+	if len(channels) == 0 {
+		if err := S.fs().Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(channels)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+		return err
+	}
+	tmp, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	return S.fs().Rename(tmp.Name(), path)
+}
+
+// SetChannel points the channel of the file at the given version. If the
+// generation is 0, the current content of the file is recorded to history
+// first, if needed, and the channel points at that version.
+func (S *Store) SetChannel(file, channel string, generation uint64) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+	}
+	if normalizeName(file, false) == "" || channel == "" {
+		return fmt.Errorf("setChannel %s %s: %w", file, channel, ErrInvalidName)
+	}
+	defer S.lock(file)()
+	if generation == 0 {
+		if err := S.recordHistory(file); err != nil {
+			return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+		}
+		generations, err := S.History(file)
+		if err != nil {
+			return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+		}
+		if len(generations) == 0 {
+			return fmt.Errorf("setChannel %s %s: %w", file, channel, os.ErrNotExist)
+		}
+		generation = generations[0]
+	} else if _, _, err := S.versionEntry(file, generation); err != nil {
+		return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+	}
+	channels, err := S.readChannels(file)
+	if err != nil {
+		return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+	}
+	channels[channel] = generation
+	if err := S.writeChannels(file, channels); err != nil {
+		return fmt.Errorf("setChannel %s %s: %w", file, channel, err)
+	}
+	return nil
+}
+
+// Promote points the channel `to` at the version the channel `from` points
+// at, e.g. publishes the draft.
+func (S *Store) Promote(file, from, to string) error {
+	generation, err := S.Channel(file, from)
+	if err != nil {
+		return fmt.Errorf("promote %s %s %s: %w", file, from, to, err)
+	}
+	if err := S.SetChannel(file, to, generation); err != nil {
+		return fmt.Errorf("promote %s %s %s: %w", file, from, to, err)
+	}
+	return nil
+}
+
+// Channel returns the generation the channel of the file points at. If there
+// is no such channel, the returned error wraps os.ErrNotExist.
+func (S *Store) Channel(file, channel string) (uint64, error) {
+	channels, err := S.readChannels(file)
+	if err != nil {
+		return 0, fmt.Errorf("channel %s %s: %w", file, channel, err)
+	}
+	generation, ok := channels[channel]
+	if !ok {
+		return 0, fmt.Errorf("channel %s %s: %w", file, channel, os.ErrNotExist)
+	}
+	return generation, nil
+}
+
+// Channels returns all channels of the file and the generations they point at.
+func (S *Store) Channels(file string) (map[string]uint64, error) {
+	channels, err := S.readChannels(file)
+	if err != nil {
+		return channels, fmt.Errorf("channels %s: %w", file, err)
+	}
+	return channels, nil
+}
+
+// RemoveChannel removes the channel of the file. The version it pointed at
+// is kept, until GC removes it.
+func (S *Store) RemoveChannel(file, channel string) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("removeChannel %s %s: %w", file, channel, err)
+	}
+	defer S.lock(file)()
+	channels, err := S.readChannels(file)
+	if err != nil {
+		return fmt.Errorf("removeChannel %s %s: %w", file, channel, err)
+	}
+	if _, ok := channels[channel]; !ok {
+		return fmt.Errorf("removeChannel %s %s: %w", file, channel, os.ErrNotExist)
+	}
+	delete(channels, channel)
+	if err := S.writeChannels(file, channels); err != nil {
+		return fmt.Errorf("removeChannel %s %s: %w", file, channel, err)
+	}
+	return nil
+}
+
+// OpenChannel opens the version the channel of the file points at.
+func (S *Store) OpenChannel(file, channel string) (File, error) {
+	generation, err := S.Channel(file, channel)
+	if err != nil {
+		return nil, fmt.Errorf("openChannel %s %s: %w", file, channel, err)
+	}
+	f, err := S.Open(file, generation)
+	if err != nil {
+		return nil, fmt.Errorf("openChannel %s %s: %w", file, channel, err)
+	}
+	return f, nil
+}
+
+// channelVersions returns the set of versions channels point at,
+// named `name@generation`.
+func (S *Store) channelVersions() (map[string]bool, error) {
+	versions := make(map[string]bool)
+	root := filepath.Join(S.historyDir(), ".channels")
+	err := walkDir(S.fs(), root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == root {
+			return nil // No channels yet.
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		channels, err := S.readChannels(name)
+		if err != nil {
+			return err
+		}
+		for _, g := range channels {
+			versions[fmt.Sprintf("%s@%d", name, g)] = true
+		}
+		return nil
+	})
+	return versions, err
+}
@@ -0,0 +1,76 @@
+package atylar
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestChannels(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if err := S.SetChannel("file", "draft", 0); err != nil {
+		t.Fatal(err)
+	}
+	if g, err := S.Channel("file", "draft"); err != nil || g != 124 {
+		t.Error("Expected 124 <nil> but got", g, err)
+	}
+	if err := S.Promote("file", "draft", "published"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("Edited")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.SetChannel("file", "draft", 0); err != nil {
+		t.Fatal(err)
+	}
+	channels, err := S.Channels("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels["draft"] != 125 || channels["published"] != 124 {
+		t.Error("Expected map[draft:125 published:124] but got", channels)
+	}
+	f, err := S.OpenChannel("file", "published")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+
+	if err := S.SetChannel("file", "draft", 7); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if err := S.SetChannel("missing", "draft", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if err := S.Promote("file", "review", "published"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if err := S.SetChannel("file", "", 124); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+
+	// Versions which channels point at are kept by GC.
+	report, err := S.GC(RetentionPolicy{MaxBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Versions) != 1 || report.Versions[0] != "file@123" {
+		t.Error("Expected [file@123] but got", report.Versions)
+	}
+
+	if err := S.RemoveChannel("file", "draft"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.RemoveChannel("file", "published"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.channelPath("file")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the record to be removed with the last channel but got", err)
+	}
+}
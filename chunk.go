@@ -0,0 +1,385 @@
+package atylar
+
+// Chunked storage of historic versions.
+//
+// Historic versions of files at least Store.ChunkThreshold bytes large are
+// split into content-defined chunks using FastCDC-style gear hashing. Every
+// chunk is stored once in `.history/.chunks`, named after its SHA-256 hash,
+// and the version itself is a manifest named `name@generation.chunks`, which
+// lists the hashes and sizes of its chunks, one per line. Since the cut points
+// depend only on the content around them, a change in one part of a big file
+// produces new chunks only around that part and the rest is shared with the
+// previous versions. With WithDedup, all versions are stored this way.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	chunkedSuffix = ".chunks" // Suffix of chunked version manifests
+	chunkMin      = 256 << 10 // Minimal chunk size
+	chunkAvg      = 1 << 20   // Desired average chunk size
+	chunkMax      = 4 << 20   // Maximal chunk size
+
+	// Before reaching the average size, a cut point needs more zero bits
+	// in the fingerprint, and fewer after, which narrows the distribution
+	// of chunk sizes (normalized chunking).
+	chunkMaskSmall = 0xfffffc0000000000 // 22 most significant bits
+	chunkMaskLarge = 0xffffc00000000000 // 18 most significant bits
+)
+
+// gear is the table of random values used by the rolling fingerprint.
+// It is generated with splitmix64, so that cut points are stable
+// across versions of the package.
+var gear [256]uint64
+
+func init() {
+	x := uint64(0)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// cutPoint returns the length of the first chunk of data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= chunkMin {
+		return n
+	}
+	if n > chunkMax {
+		n = chunkMax
+	}
+	normal := chunkAvg
+	if n < normal {
+		normal = n
+	}
+	var fp uint64
+	i := chunkMin
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&chunkMaskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunks splits the content read from r into chunks and calls fn for each
+// of them. The slice passed to fn is only valid until it returns.
+func chunks(r io.Reader, fn func([]byte) error) error {
+	buf := make([]byte, chunkMax)
+	n := 0
+	eof := false
+	for {
+		if !eof {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		c := cutPoint(buf[:n])
+		if err := fn(buf[:c]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[c:n])
+	}
+}
+
+// chunkRef identifies a chunk in a manifest.
+type chunkRef struct {
+	hash string
+	size int64
+}
+
+// chunkDir returns the path to the directory holding the chunks.
+func (S *Store) chunkDir() string {
+	return filepath.Join(S.historyDir(), ".chunks")
+}
+
+// manifestOf splits the file at the given path into chunks
+// and returns their references without storing them.
+func manifestOf(fsys Backend, path string) ([]chunkRef, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	refs := []chunkRef{}
+	err = chunks(f, func(chunk []byte) error {
+		sum := sha256.Sum256(chunk)
+		refs = append(refs, chunkRef{hex.EncodeToString(sum[:]), int64(len(chunk))})
+		return nil
+	})
+	return refs, err
+}
+
+// readManifest reads the chunk references from a manifest.
+func readManifest(fsys Backend, path string) ([]chunkRef, error) {
+	b, err := readFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	refs := []chunkRef{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("readManifest %s: malformed line %q", path, scanner.Text())
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("readManifest %s: %w", path, err)
+		}
+		refs = append(refs, chunkRef{fields[0], size})
+	}
+	return refs, scanner.Err()
+}
+
+// writeChunk stores the chunk if it isn't stored yet.
+func (S *Store) writeChunk(hash string, chunk []byte) error {
+	path := filepath.Join(S.chunkDir(), hash)
+	if _, err := S.fs().Stat(path); err == nil {
+		return nil // Shared with another version.
+	}
+	if err := S.fs().MkdirAll(S.chunkDir(), S.dirPerm()); err != nil {
+		return err
+	}
+	f, err := S.fs().CreateTemp(S.chunkDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(chunk); err != nil {
+		f.Close()
+		S.fs().Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		S.fs().Remove(f.Name())
+		return err
+	}
+	return S.fs().Rename(f.Name(), path)
+}
+
+// writeChunked stores the file at path in chunks and writes
+// the manifest of this version to the given path, reporting the
+// progress p after each chunk.
+func (S *Store) writeChunked(path, manifest string, p Progress) error {
+	f, err := S.fs().Open(path)
+	if err != nil {
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	defer f.Close()
+	var list bytes.Buffer
+	err = chunks(f, func(chunk []byte) error {
+		sum := sha256.Sum256(chunk)
+		hash := hex.EncodeToString(sum[:])
+		fmt.Fprintf(&list, "%s %d\n", hash, len(chunk))
+		if err := S.writeChunk(hash, chunk); err != nil {
+			return err
+		}
+		p.Copied += int64(len(chunk))
+		S.report(p)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	if p.Copied == 0 {
+		S.report(p) // Empty file
+	}
+	if err = S.fs().MkdirAll(filepath.Dir(manifest), S.dirPerm()); err != nil {
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	m, err := S.fs().OpenFile(manifest, os.O_CREATE|os.O_WRONLY|os.O_EXCL, S.filePerm())
+	if err != nil {
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	if _, err = m.Write(list.Bytes()); err != nil {
+		m.Close()
+		S.fs().Remove(manifest)
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	if err = m.Close(); err != nil {
+		S.fs().Remove(manifest)
+		return fmt.Errorf("writeChunked %s: %w", path, err)
+	}
+	return nil
+}
+
+// compareChunked returns true if the file at path has the same content as
+// the chunked version with the given manifest. Only the file is read.
+func (S *Store) compareChunked(path, manifest string) (bool, error) {
+	stored, err := readManifest(S.fs(), manifest)
+	if err != nil {
+		return false, fmt.Errorf("compareChunked %s %s: %w", path, manifest, err)
+	}
+	current, err := manifestOf(S.fs(), path)
+	if err != nil {
+		return false, fmt.Errorf("compareChunked %s %s: %w", path, manifest, err)
+	}
+	if len(stored) != len(current) {
+		return false, nil
+	}
+	for i := range stored {
+		if stored[i] != current[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// chunkedReader reads the content of a chunked version,
+// opening one chunk at a time.
+type chunkedReader struct {
+	fsys Backend
+	dir  string
+	refs []chunkRef
+	cur  File
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.refs) == 0 {
+				return 0, io.EOF
+			}
+			f, err := r.fsys.Open(filepath.Join(r.dir, r.refs[0].hash))
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.refs = f, r.refs[1:]
+		}
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkedReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
+
+// openChunked returns a reader of the content of the chunked version.
+func (S *Store) openChunked(manifest string) (io.ReadCloser, error) {
+	refs, err := readManifest(S.fs(), manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkedReader{fsys: S.fs(), dir: S.chunkDir(), refs: refs}, nil
+}
+
+// materialize reassembles the chunked version into a temporary file,
+// see spool.
+func (S *Store) materialize(manifest string) (File, error) {
+	r, err := S.openChunked(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("materialize %s: %w", manifest, err)
+	}
+	defer r.Close()
+	f, err := S.spool(r)
+	if err != nil {
+		return nil, fmt.Errorf("materialize %s: %w", manifest, err)
+	}
+	return f, nil
+}
+
+// spool copies the content read from r into an unnamed temporary file,
+// which is positioned at its beginning. It's created in the history
+// directory, or in the system's temporary directory if the store is read-only.
+func (S *Store) spool(r io.Reader) (File, error) {
+	dir, fsys := S.historyDir(), S.fs()
+	if S.readOnly {
+		dir, fsys = "", osBackend{}
+	}
+	f, err := fsys.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	// The file stays readable through the descriptor after being unlinked.
+	// Where that's not possible, it is left for cleanup.
+	fsys.Remove(f.Name())
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// readChunkedRange reads up to n bytes of the chunked version starting at
+// offset off, opening only the chunks which overlap the range.
+func (S *Store) readChunkedRange(manifest string, off, n int64) ([]byte, error) {
+	refs, err := readManifest(S.fs(), manifest)
+	if err != nil {
+		return nil, err
+	}
+	buf := []byte{}
+	var pos int64
+	for _, ref := range refs {
+		start, end := pos, pos+ref.size
+		pos = end
+		if end <= off {
+			continue
+		}
+		if start >= off+n {
+			break
+		}
+		from, to := off-start, off+n-start
+		if from < 0 {
+			from = 0
+		}
+		if to > ref.size {
+			to = ref.size
+		}
+		f, err := S.fs().Open(filepath.Join(S.chunkDir(), ref.hash))
+		if err != nil {
+			return nil, err
+		}
+		part := make([]byte, to-from)
+		_, err = f.ReadAt(part, from)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, part...)
+	}
+	return buf, nil
+}
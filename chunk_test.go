@@ -0,0 +1,119 @@
+package atylar
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// randomBytes returns n pseudo-random bytes, the same for every seed.
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func TestCutPoint(t *testing.T) {
+	if c := cutPoint(make([]byte, 100)); c != 100 {
+		t.Error("Got", c, "but expected", 100)
+	}
+	if c := cutPoint(make([]byte, 2*chunkMax)); c != chunkMax {
+		t.Error("Got", c, "but expected", chunkMax)
+	}
+	data := randomBytes(1, 2*chunkMax)
+	c := cutPoint(data)
+	if c < chunkMin || c > chunkMax {
+		t.Error("Got", c, "which is outside of the allowed range")
+	}
+	if c2 := cutPoint(data); c2 != c {
+		t.Error("Got", c2, "but expected", c)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	data := randomBytes(2, 10<<20)
+	total := 0
+	err := chunks(bytes.NewReader(data), func(chunk []byte) error {
+		if len(chunk) > chunkMax || (len(chunk) < chunkMin && total+len(chunk) != len(data)) {
+			t.Error("Got a chunk of", len(chunk), "bytes")
+		}
+		if !bytes.Equal(chunk, data[total:total+len(chunk)]) {
+			t.Error("Chunk at", total, "doesn't match the data")
+		}
+		total += len(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(data) {
+		t.Error("Got", total, "bytes but expected", len(data))
+	}
+}
+
+func TestChunkedHistory(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, ".history"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	S := Store{Directory: d, ChunkThreshold: 1}
+	v1 := randomBytes(3, 6<<20)
+	v2 := append([]byte{}, v1...)
+	copy(v2[3<<20:], "a small change in the middle")
+
+	if err := os.WriteFile(filepath.Join(d, "big"), v1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.recordHistory("big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "big"), v2, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.recordHistory("big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.recordHistory("big"); err != nil {
+		t.Fatal(err)
+	}
+
+	if h, err := S.History("big"); err != nil || len(h) != 2 || h[0] != 2 || h[1] != 1 {
+		t.Error("Expected [2 1] <nil> but got", h, err)
+	}
+	refs1, err := readManifest(osBackend{}, filepath.Join(d, ".history", "big@1.chunks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs2, err := readManifest(osBackend{}, filepath.Join(d, ".history", "big@2.chunks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := os.ReadDir(S.chunkDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) >= len(refs1)+len(refs2) {
+		t.Error("Expected the versions to share chunks, but", len(stored), "chunks are stored for", len(refs1)+len(refs2), "references")
+	}
+
+	for g, expected := range map[uint64][]byte{1: v1, 2: v2} {
+		f, err := S.Open("big", g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, expected) {
+			t.Error("Content of version", g, "doesn't match")
+		}
+		if v, err := S.versionInfo("big", g); err != nil || v.Size != int64(len(expected)) {
+			t.Error("Expected size", len(expected), "<nil> but got", v.Size, err)
+		}
+	}
+}
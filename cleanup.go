@@ -0,0 +1,188 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ArtifactKind classifies leftovers found by Cleanup.
+type ArtifactKind int
+
+const (
+	// ArtifactTemporary is a temporary file or directory in the history
+	// directory, left behind by an interrupted write, copy or probe.
+	ArtifactTemporary ArtifactKind = iota
+	// ArtifactPlaceholder is an empty placeholder of an expired reservation.
+	ArtifactPlaceholder
+	// ArtifactEmpty is a zero-byte live file which isn't reserved.
+	ArtifactEmpty
+)
+
+// Artifact is a leftover found by Cleanup.
+type Artifact struct {
+	Name string // Slash-separated path relative to the store root
+	Kind ArtifactKind
+	Size int64
+}
+
+// CleanupPolicy specifies which artifacts are removed by Cleanup.
+type CleanupPolicy struct {
+	// OlderThan excludes temporary and empty files modified more recently.
+	// Temporary files of writers which are still open mustn't be removed,
+	// so it should be longer than a write may stay idle.
+	OlderThan time.Duration
+	// EmptyFiles enables the removal of zero-byte live files. Their history
+	// is recorded like when they are removed with Remove.
+	EmptyFiles bool
+	DryRun     bool // Only report what would be removed
+}
+
+// Cleanup removes artifacts left behind by crashes and abandoned operations,
+// which aren't historic versions and so aren't handled by GC. Expired
+// reservations are ended like by ExpireReservations. It returns the found
+// artifacts. It's listed by Operations while it runs.
+func (S *Store) Cleanup(policy CleanupPolicy) ([]Artifact, error) {
+	if err := S.writable(); err != nil && !policy.DryRun {
+		return []Artifact{}, fmt.Errorf("cleanup: %w", err)
+	}
+	op, end := S.begin("cleanup")
+	defer end()
+	defer S.lockStore()()
+	now := time.Now()
+
+	// Temporary files anywhere in the history directory.
+	found, temporary, err := S.findTemporary(now, policy.OlderThan)
+	if err != nil {
+		return found, fmt.Errorf("cleanup: %w", err)
+	}
+
+	// Placeholders of expired reservations.
+	expired := []string{}
+	reservations := filepath.Join(S.historyDir(), ".reservations")
+	err = walkDir(S.fs(), reservations, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == reservations {
+			return nil
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(reservations, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		r, err := S.Reserved(name)
+		if err != nil {
+			return err
+		}
+		if now.Before(r.Expires) {
+			return nil
+		}
+		if info, err := S.fs().Stat(S.filePath(name, false)); err == nil && info.Size() == 0 {
+			found = append(found, Artifact{Name: name, Kind: ArtifactPlaceholder})
+		}
+		expired = append(expired, name)
+		return nil
+	})
+	if err != nil {
+		return found, fmt.Errorf("cleanup: %w", err)
+	}
+
+	// Empty live files which aren't reserved.
+	empty := []string{}
+	if policy.EmptyFiles {
+		err = S.walkFiles(false, func(name string, entry fs.DirEntry) error {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if info.Size() != 0 || now.Sub(info.ModTime()) < policy.OlderThan {
+				return nil
+			}
+			if _, err := S.Reserved(name); err == nil {
+				return nil // Either reserved or handled above.
+			}
+			found = append(found, Artifact{Name: name, Kind: ArtifactEmpty})
+			empty = append(empty, name)
+			return nil
+		})
+		if err != nil {
+			return found, fmt.Errorf("cleanup: %w", err)
+		}
+	}
+
+	if policy.DryRun {
+		return found, nil
+	}
+	op.progress(0, int64(len(temporary)+len(expired)+len(empty)))
+	for _, path := range temporary {
+		if op.isCanceled() {
+			return found, fmt.Errorf("cleanup: %w", ErrCanceled)
+		}
+		if err := S.fs().RemoveAll(path); err != nil {
+			return found, fmt.Errorf("cleanup: %w", err)
+		}
+		op.step()
+	}
+	for _, name := range expired {
+		if op.isCanceled() {
+			return found, fmt.Errorf("cleanup: %w", ErrCanceled)
+		}
+		if _, err := S.expireReservation(name, now); err != nil {
+			return found, fmt.Errorf("cleanup: %w", err)
+		}
+		op.step()
+	}
+	for _, name := range empty {
+		if op.isCanceled() {
+			return found, fmt.Errorf("cleanup: %w", ErrCanceled)
+		}
+		if err := S.remove(name, func() uint64 { return S.GetGeneration(true) }); err != nil {
+			return found, fmt.Errorf("cleanup: %w", err)
+		}
+		op.step()
+	}
+	return found, nil
+}
+
+// findTemporary returns the temporary files and directories anywhere in the
+// history directory last modified at least olderThan before now, and their
+// paths. Staging directories of committed transactions are skipped.
+func (S *Store) findTemporary(now time.Time, olderThan time.Duration) ([]Artifact, []string, error) {
+	found := []Artifact{}
+	temporary := []string{}
+	err := walkDir(S.fs(), S.historyDir(), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(entry.Name(), ".tmp-") && !strings.HasPrefix(entry.Name(), ".probe-") {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), txPrefix) {
+			if _, err := S.fs().Stat(filepath.Join(path, "commit")); err == nil {
+				return filepath.SkipDir // Committed transaction, finished by New.
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if now.Sub(info.ModTime()) >= olderThan {
+			rel, err := filepath.Rel(S.Directory, path)
+			if err != nil {
+				return err
+			}
+			found = append(found, Artifact{Name: filepath.ToSlash(rel), Kind: ArtifactTemporary, Size: info.Size()})
+			temporary = append(temporary, path)
+		}
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return found, temporary, err
+}
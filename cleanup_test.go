@@ -0,0 +1,87 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCleanup(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	old := time.Now().Add(-time.Hour)
+	create := func(path string, content string, mtime time.Time) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create(filepath.Join(d, ".history", ".tmp-1"), "partial", old)
+	create(filepath.Join(d, ".history", ".chunks", ".tmp-2"), "chunk", old)
+	create(filepath.Join(d, ".history", ".tmp-3"), "in progress", time.Now())
+	create(filepath.Join(d, "dir", "empty"), "", old)
+	create(filepath.Join(d, "new"), "", time.Now())
+	if _, err := S.Reserve("upload", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Reserve("pending", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"upload", "pending"} {
+		if err := os.Chtimes(filepath.Join(d, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy := CleanupPolicy{OlderThan: time.Minute, EmptyFiles: true, DryRun: true}
+	found, err := S.Cleanup(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, a := range found {
+		names = append(names, a.Name)
+	}
+	sort.Strings(names)
+	expected := []string{".history/.chunks/.tmp-2", ".history/.tmp-1", "dir/empty", "upload"}
+	if len(names) != len(expected) {
+		t.Fatal("Got", names, "but expected", expected)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Error("Got", names, "but expected", expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(d, ".history", ".tmp-1")); err != nil {
+		t.Error("Expected a dry run not to remove anything but got", err)
+	}
+
+	policy.DryRun = false
+	if _, err := S.Cleanup(policy); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{".history/.tmp-1", ".history/.chunks/.tmp-2", "dir/empty", "dir", "upload"} {
+		if _, err := os.Stat(filepath.Join(d, filepath.FromSlash(path))); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Expected", path, "to be removed but got", err)
+		}
+	}
+	for _, path := range []string{".history/.tmp-3", "new", "pending"} {
+		if _, err := os.Stat(filepath.Join(d, filepath.FromSlash(path))); err != nil {
+			t.Error("Expected", path, "to be kept but got", err)
+		}
+	}
+	if h, err := S.History("dir/empty"); err != nil || len(h) != 1 {
+		t.Error("Expected the removed empty file to be recorded but got", h, err)
+	}
+	if _, err := S.Reserved("upload"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the reservation to end but got", err)
+	}
+}
@@ -0,0 +1,61 @@
+package atylar
+
+import (
+	"fmt"
+	"time"
+)
+
+// Versions are ordered by their generations, which never decrease, but the
+// functions which look them up by time, OpenAt and GC with KeepYoungerThan,
+// use their modification times, which come from the wall clock. When the
+// clock jumps, e.g. after being corrected, or files are written with clocks
+// which disagree, a newer version of a file can appear older than the one
+// before it. The clock policy decides how such times are resolved, so that
+// the times of the versions of a file follow their generations.
+
+// ClockPolicy specifies how modification times of the versions of a file
+// which are out of order are resolved.
+type ClockPolicy int
+
+const (
+	// ClockMonotonic, the default, takes a version which appears older than
+	// the version before it to have been modified at the same time, which
+	// suits clocks which jumped back.
+	ClockMonotonic ClockPolicy = iota
+	// ClockRewind takes a version which appears newer than the version after
+	// it to have been modified at the same time, which suits clocks which
+	// jumped ahead and were corrected later.
+	ClockRewind
+	// ClockTrust uses the modification times as recorded.
+	ClockTrust
+)
+
+// WithClockPolicy sets how out of order modification times are resolved.
+func WithClockPolicy(p ClockPolicy) Option {
+	return func(o *options) error {
+		if p < ClockMonotonic || p > ClockTrust {
+			return fmt.Errorf("withClockPolicy %d: unknown policy", p)
+		}
+		o.clock = p
+		return nil
+	}
+}
+
+// resolveTimes resolves the modification times of the versions of a file,
+// listed from the newest, in place, according to the clock policy.
+func (S *Store) resolveTimes(times []time.Time) {
+	switch S.clock {
+	case ClockMonotonic:
+		for i := len(times) - 2; i >= 0; i-- {
+			if times[i].Before(times[i+1]) {
+				times[i] = times[i+1]
+			}
+		}
+	case ClockRewind:
+		for i := 1; i < len(times); i++ {
+			if times[i].After(times[i-1]) {
+				times[i] = times[i-1]
+			}
+		}
+	}
+}
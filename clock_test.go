@@ -0,0 +1,113 @@
+package atylar
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// createSkewedStore creates a store with the file written three times, and
+// returns the generations of its versions. The clock jumped back between
+// the first and the second write.
+func createSkewedStore(t *testing.T, base time.Time, opts ...Option) (Store, []uint64) {
+	S, err := New(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{"first", "second", "third"} {
+		if err := S.WriteFile("file", []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	generations, err := S.History("file")
+	if err != nil || len(generations) != 2 {
+		t.Fatal("Got", generations, err, "but expected 2 versions")
+	}
+	times := map[string]time.Time{
+		S.versionPath("file", generations[1]): base.Add(2 * time.Hour),
+		S.versionPath("file", generations[0]): base,
+		S.filePath("file", false):             base.Add(3 * time.Hour),
+	}
+	for path, mtime := range times {
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return S, generations
+}
+
+func TestOpenAtClockPolicy(t *testing.T) {
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		policy   ClockPolicy
+		at       time.Duration
+		expected string
+	}{
+		{"trust before jump", ClockTrust, time.Hour, "second"},
+		{"trust after jump", ClockTrust, 150 * time.Minute, "second"},
+		{"trust live", ClockTrust, 4 * time.Hour, "third"},
+		{"monotonic before jump", ClockMonotonic, time.Hour, ""},
+		{"monotonic after jump", ClockMonotonic, 150 * time.Minute, "second"},
+		{"monotonic live", ClockMonotonic, 3 * time.Hour, "third"},
+		{"rewind before jump", ClockRewind, time.Hour, "second"},
+		{"rewind earliest", ClockRewind, -time.Hour, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, _ := createSkewedStore(t, base, WithClockPolicy(tt.policy))
+			defer S.Close()
+			f, err := S.OpenAt("file", base.Add(tt.at))
+			if tt.expected == "" {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Error("Got", err, "but expected", os.ErrNotExist)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if b, err := io.ReadAll(f); err != nil || string(b) != tt.expected {
+				t.Error("Got", string(b), err, "but expected", tt.expected)
+			}
+		})
+	}
+	if _, err := New(t.TempDir(), WithClockPolicy(ClockPolicy(10))); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestGCClockPolicy(t *testing.T) {
+	base := time.Now().Add(-74 * time.Hour)
+	tests := []struct {
+		name     string
+		policy   ClockPolicy
+		expected []int // Indices of the removed versions, from the newest
+	}{
+		{"trust", ClockTrust, []int{0}},
+		{"monotonic", ClockMonotonic, []int{}},
+		{"rewind", ClockRewind, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, generations := createSkewedStore(t, base, WithClockPolicy(tt.policy))
+			defer S.Close()
+			report, err := S.GC(RetentionPolicy{KeepYoungerThan: 73 * time.Hour, DryRun: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := []string{}
+			for _, i := range tt.expected {
+				expected = append(expected, "file@"+strconv.FormatUint(generations[i], 10))
+			}
+			if !reflect.DeepEqual(report.Versions, expected) {
+				t.Error("Got", report.Versions, "but expected", expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package atylar
+
+import (
+	"fmt"
+	"path"
+)
+
+// Clone creates a new store at destRoot, which mustn't exist or must be an
+// empty directory, holding copies of the live files, their history and
+// descriptions, and opens it with the options of this store. Its generation
+// counter continues from this store's. If patterns are given, only files
+// whose names match any of them, as in path.Match, are copied. Versions are
+// copied as they're stored, so the content stays encoded by the write
+// pipeline. Channels, pins, snapshots and retention overrides aren't
+// copied, like with Export. Modifications wait until the clone is done.
+// It's listed by Operations while it runs. If it fails, whatever it
+// created is removed.
+func (S *Store) Clone(destRoot string, patterns ...string) (Store, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return Store{}, fmt.Errorf("clone %s: %q: %w", destRoot, p, err)
+		}
+	}
+	var match func(name string) bool
+	if len(patterns) != 0 {
+		match = func(name string) bool {
+			for _, p := range patterns {
+				if ok, _ := path.Match(p, name); ok {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	same := func(o *options) error {
+		*o = S.options
+		return nil
+	}
+	D, err := createStore(destRoot, []Option{same}, func(D *Store) error {
+		D.ChunkThreshold = S.ChunkThreshold
+		D.Retry = S.Retry
+		return S.cloneInto(D, match)
+	})
+	if err != nil {
+		return D, fmt.Errorf("clone %s: %w", destRoot, err)
+	}
+	return D, nil
+}
+
+// cloneInto copies the files matched by match, or all of them if it's nil,
+// into the new store D.
+func (S *Store) cloneInto(D *Store, match func(name string) bool) error {
+	op, end := S.begin("clone")
+	defer end()
+	defer S.lockStore()()
+	m, err := S.exportManifest(true, match)
+	if err != nil {
+		return err
+	}
+	op.progress(0, int64(len(m.Entries)))
+	for _, e := range m.Entries {
+		if op.isCanceled() {
+			return ErrCanceled
+		}
+		f, err := S.open(e.Name, e.Generation)
+		if err != nil {
+			return err
+		}
+		err = D.importEntry(e, f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.path(), err)
+		}
+		op.step()
+	}
+	if m.Generation > D.Generation {
+		D.Generation = m.Generation
+	}
+	return D.saveGeneration()
+}
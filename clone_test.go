@@ -0,0 +1,83 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		files    []string
+		history  []string
+	}{
+		{"Everything", nil, []string{"dir/page", "file"}, []string{"dir/page", "file", "file2"}},
+		{"Pattern", []string{"dir/*"}, []string{"dir/page"}, []string{"dir/page"}},
+		{"Patterns", []string{"file?", "nothing"}, []string{}, []string{"file2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S := createExportStore(t, WithDeltaHistory())
+			defer S.Close()
+			C, err := S.Clone(filepath.Join(t.TempDir(), "clone"), tt.patterns...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer C.Close()
+			if !C.delta {
+				t.Error("Expected the clone to have the options of the store")
+			}
+			if C.GetGeneration(false) != S.GetGeneration(false) {
+				t.Error("Got generation", C.GetGeneration(false), "but expected", S.GetGeneration(false))
+			}
+			if files, err := C.List(false); err != nil || !reflect.DeepEqual(files, tt.files) {
+				t.Error("Got", files, err, "but expected", tt.files)
+			}
+			files, err := C.List(true)
+			sort.Strings(files)
+			if err != nil || !reflect.DeepEqual(files, tt.history) {
+				t.Error("Got", files, err, "but expected", tt.history)
+			}
+			for _, file := range tt.history {
+				expected, _ := S.HistoryInfo(file)
+				if got, err := C.HistoryInfo(file); err != nil || !reflect.DeepEqual(got, expected) {
+					t.Error("Got", got, err, "for", file, "but expected", expected)
+				}
+			}
+			for _, file := range tt.files {
+				a, _ := S.ReadFile(file, 0)
+				if b, err := C.ReadFile(file, 0); err != nil || string(a) != string(b) {
+					t.Error("Got", string(b), err, "for", file, "but expected", string(a))
+				}
+			}
+		})
+	}
+}
+
+func TestCloneIndependent(t *testing.T) {
+	S := createExportStore(t)
+	defer S.Close()
+	C, err := S.Clone(filepath.Join(t.TempDir(), "clone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer C.Close()
+	if err := C.WriteFile("file", []byte("cloned")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "changed" {
+		t.Error("Got", string(b), err, "but expected the store to be unchanged")
+	}
+	if _, err := S.Clone(C.Directory); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	if _, err := S.Clone(filepath.Join(t.TempDir(), "clone"), "["); !errors.Is(err, path.ErrBadPattern) {
+		t.Error("Got", err, "but expected", path.ErrBadPattern)
+	}
+}
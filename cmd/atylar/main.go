@@ -0,0 +1,323 @@
+// Command atylar inspects and modifies atylar stores.
+//
+// Usage:
+//
+//	atylar [-store dir] command [arguments]
+//
+// The commands are:
+//
+//	ls [-history]                 list the live files, or the files with history
+//	cat [-gen N] file             print the file, or its version N
+//	put file [source]             replace the file with the source file, or standard input
+//	rm file                       remove the file
+//	history file                  list the versions of the file, newest first
+//	restore file N                restore version N of the file
+//	gc [-keep-last N] [-keep-younger D] [-max-bytes N] [-dry-run]
+//	                              remove historic versions not kept by the policy
+//	verify                        check the store against its checksums
+//	export [-history] [-o file]   write the store as a tar archive
+//
+// The store is the current directory, unless -store is given. Commands which
+// only read it open it read-only, so they can run while other processes read
+// it too, but not while it's open for writing.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atmatto/atylar"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// errUsage is returned by commands called with invalid arguments.
+var errUsage = errors.New("usage")
+
+// action runs a command on the store with its arguments.
+type action func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error
+
+// command is a subcommand of the tool. Its setup function defines the
+// command's flags and returns the action which uses them.
+type command struct {
+	usage string
+	write bool // Whether the store is opened for writing
+	setup func(flags *flag.FlagSet) action
+}
+
+// names lists the commands in the order of the usage message.
+var names = []string{"ls", "cat", "put", "rm", "history", "restore", "gc", "verify", "export"}
+
+var commands = map[string]command{
+	"ls":      {usage: "ls [-history]", setup: ls},
+	"cat":     {usage: "cat [-gen N] file", setup: cat},
+	"put":     {usage: "put file [source]", write: true, setup: put},
+	"rm":      {usage: "rm file", write: true, setup: rm},
+	"history": {usage: "history file", setup: history},
+	"restore": {usage: "restore file N", write: true, setup: restore},
+	"gc":      {usage: "gc [-keep-last N] [-keep-younger D] [-max-bytes N] [-dry-run]", write: true, setup: gc},
+	"verify":  {usage: "verify", write: true, setup: verify},
+	"export":  {usage: "export [-history] [-o file]", setup: export},
+}
+
+// run runs the tool with the arguments and returns the exit code: 0 on
+// success, 1 if the command failed and 2 on invalid usage.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("atylar", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	dir := global.String("store", ".", "directory of the store")
+	global.Usage = func() {
+		fmt.Fprintln(stderr, "usage: atylar [-store dir] command [arguments]\n\ncommands:")
+		for _, name := range names {
+			fmt.Fprintln(stderr, "\t"+commands[name].usage)
+		}
+	}
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return 2
+	}
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "atylar: unknown command %q\n", name)
+		global.Usage()
+		return 2
+	}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: atylar "+cmd.usage)
+		flags.PrintDefaults()
+	}
+	act := cmd.setup(flags)
+	if err := flags.Parse(global.Args()[1:]); err != nil {
+		return 2
+	}
+	S, err := open(*dir, cmd.write)
+	if err != nil {
+		fmt.Fprintln(stderr, "atylar:", err)
+		return 1
+	}
+	defer S.Close()
+	if err := act(&S, flags.Args(), stdin, stdout); errors.Is(err, errUsage) {
+		flags.Usage()
+		return 2
+	} else if err != nil {
+		fmt.Fprintln(stderr, "atylar:", err)
+		return 1
+	}
+	return 0
+}
+
+// open opens the store in the directory, which must exist, so that typos
+// don't create new stores.
+func open(dir string, write bool) (atylar.Store, error) {
+	if !write {
+		return atylar.NewReadOnly(dir)
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return atylar.Store{}, err
+	} else if !info.IsDir() {
+		return atylar.Store{}, fmt.Errorf("%s is not a directory", dir)
+	}
+	return atylar.New(dir)
+}
+
+func ls(flags *flag.FlagSet) action {
+	withHistory := flags.Bool("history", false, "list the files with history instead")
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		files, err := S.List(*withHistory)
+		if err != nil {
+			return err
+		}
+		if *withHistory {
+			for _, file := range files {
+				fmt.Fprintln(stdout, file)
+			}
+			return nil
+		}
+		w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		for _, file := range files {
+			info, err := S.Stat(file, false)
+			if errors.Is(err, atylar.ErrNotExist) {
+				continue // Removed in the meantime.
+			} else if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", info.Size(), info.ModTime().Format(time.RFC3339), file)
+		}
+		return w.Flush()
+	}
+}
+
+func cat(flags *flag.FlagSet) action {
+	generation := flags.Uint64("gen", 0, "generation of the version to print, 0 for the live file")
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		f, err := S.Open(args[0], *generation)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(stdout, f)
+		return err
+	}
+}
+
+func put(flags *flag.FlagSet) action {
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 1 && len(args) != 2 {
+			return errUsage
+		}
+		src := stdin
+		if len(args) == 2 {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			src = f
+		}
+		w, err := S.Overwrite(args[0])
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			w.Abort()
+			return err
+		}
+		return w.Commit()
+	}
+}
+
+func rm(flags *flag.FlagSet) action {
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		return S.Remove(args[0])
+	}
+}
+
+func history(flags *flag.FlagSet) action {
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 1 {
+			return errUsage
+		}
+		versions, err := S.HistoryInfo(args[0])
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+		for _, v := range versions {
+			message := ""
+			if v.Meta != nil {
+				message = v.Meta.Message
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", v.Generation, v.Size, v.ModTime.Format(time.RFC3339), message)
+		}
+		return w.Flush()
+	}
+}
+
+func restore(flags *flag.FlagSet) action {
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 2 {
+			return errUsage
+		}
+		generation, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil || generation == 0 {
+			return fmt.Errorf("invalid generation %q", args[1])
+		}
+		return S.Restore(args[0], generation)
+	}
+}
+
+func gc(flags *flag.FlagSet) action {
+	var policy atylar.RetentionPolicy
+	flags.IntVar(&policy.KeepLast, "keep-last", 0, "number of newest versions of each file to keep")
+	flags.DurationVar(&policy.KeepYoungerThan, "keep-younger", 0, "keep versions modified more recently")
+	flags.Int64Var(&policy.MaxBytes, "max-bytes", 0, "remove the oldest versions until the history fits")
+	flags.BoolVar(&policy.DryRun, "dry-run", false, "only print what would be removed")
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		report, err := S.GC(policy)
+		for _, v := range report.Versions {
+			fmt.Fprintln(stdout, v)
+		}
+		if err != nil {
+			return err
+		}
+		verb := "removed"
+		if policy.DryRun {
+			verb = "would remove"
+		}
+		fmt.Fprintf(stdout, "%s %d versions, %d chunks, %d bytes\n", verb, len(report.Versions), report.Chunks, report.Bytes)
+		return nil
+	}
+}
+
+func verify(flags *flag.FlagSet) action {
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		report, err := S.Verify()
+		if err != nil {
+			return err
+		}
+		for _, p := range report.Problems {
+			if p.Err != nil {
+				fmt.Fprintf(stdout, "%s: %s: %v\n", p.Name, p.Kind, p.Err)
+			} else {
+				fmt.Fprintf(stdout, "%s: %s\n", p.Name, p.Kind)
+			}
+		}
+		fmt.Fprintf(stdout, "checked %d, %d new, %d problems\n", report.Checked, report.Added, len(report.Problems))
+		if len(report.Problems) != 0 {
+			return fmt.Errorf("verify: found %d problems", len(report.Problems))
+		}
+		return nil
+	}
+}
+
+func export(flags *flag.FlagSet) action {
+	includeHistory := flags.Bool("history", false, "include the historic versions")
+	out := flags.String("o", "", "file to write the archive to instead of standard output")
+	return func(S *atylar.Store, args []string, stdin io.Reader, stdout io.Writer) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		if *out == "" {
+			return S.Export(stdout, *includeHistory)
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		if err := S.Export(f, *includeHistory); err != nil {
+			f.Close()
+			os.Remove(*out)
+			return err
+		}
+		return f.Close()
+	}
+}
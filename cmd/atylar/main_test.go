@@ -0,0 +1,137 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/atmatto/atylar"
+)
+
+// runTool runs the tool on the store in dir and returns its exit code and
+// standard output.
+func runTool(t *testing.T, dir, stdin string, args ...string) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-store", dir}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	if code != 0 {
+		t.Log(stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	S, err := atylar.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	S.Close()
+	src := filepath.Join(t.TempDir(), "source")
+	if err := os.WriteFile(src, []byte("second"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := runTool(t, dir, "first", "put", "dir/file"); code != 0 {
+		t.Fatal("Got", code, "but expected 0")
+	}
+	if code, _ := runTool(t, dir, "", "put", "dir/file", src); code != 0 {
+		t.Fatal("Got", code, "but expected 0")
+	}
+	code, out := runTool(t, dir, "", "history", "dir/file")
+	fields := strings.Fields(out)
+	if code != 0 || len(fields) != 3 || fields[1] != "5" {
+		t.Fatal("Got", code, out, "but expected one version of 5 bytes")
+	}
+	generation, _ := strconv.ParseUint(fields[0], 10, 64)
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		expected string
+	}{
+		{"Cat", []string{"cat", "dir/file"}, 0, "second"},
+		{"Cat version", []string{"cat", "-gen", fields[0], "dir/file"}, 0, "first"},
+		{"Cat missing", []string{"cat", "missing"}, 1, ""},
+		{"Ls history", []string{"ls", "-history"}, 0, "dir/file\n"},
+		{"Restore", []string{"restore", "dir/file", fields[0]}, 0, ""},
+		{"Cat restored", []string{"cat", "dir/file"}, 0, "first"},
+		{"Restore invalid", []string{"restore", "dir/file", "x"}, 1, ""},
+		{"Gc dry run", []string{"gc", "-keep-last", "1", "-dry-run"}, 0, "dir/file@" + strconv.FormatUint(generation, 10) + "\nwould remove 1 versions, 0 chunks, 5 bytes\n"},
+		{"Verify", []string{"verify"}, 0, ""},
+		{"Rm", []string{"rm", "dir/file"}, 0, ""},
+		{"Rm missing", []string{"rm", "dir/file"}, 1, ""},
+		{"Ls empty", []string{"ls"}, 0, ""},
+		{"Usage", []string{"cat"}, 2, ""},
+		{"Unknown flag", []string{"ls", "-x"}, 2, ""},
+		{"Unknown command", []string{"mv"}, 2, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, out := runTool(t, dir, "", tt.args...)
+			if code != tt.code || tt.expected != "" && out != tt.expected {
+				t.Error("Got", code, out, "but expected", tt.code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLs(t *testing.T) {
+	dir := t.TempDir()
+	S, err := atylar.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	S.WriteFile("a", []byte("abc"))
+	S.Close()
+	code, out := runTool(t, dir, "", "ls")
+	fields := strings.Fields(out)
+	if code != 0 || len(fields) != 3 || fields[0] != "3" || fields[2] != "a" {
+		t.Error("Got", code, out, "but expected a of 3 bytes")
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	S, err := atylar.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	S.WriteFile("a", []byte("abc"))
+	S.Close()
+	out := filepath.Join(t.TempDir(), "export.tar")
+	if code, _ := runTool(t, dir, "", "export", "-o", out); code != 0 {
+		t.Fatal("Got", code, "but expected 0")
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	names := []string{}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, h.Name)
+	}
+	if len(names) != 2 || names[1] != "files/a" {
+		t.Error("Got", names, "but expected the manifest and files/a")
+	}
+}
+
+func TestMissingStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	for _, args := range [][]string{{"ls"}, {"put", "a"}} {
+		if code, _ := runTool(t, dir, "", args...); code != 1 {
+			t.Error("Got", code, "but expected 1")
+		}
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected the store not to be created")
+	}
+}
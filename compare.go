@@ -0,0 +1,121 @@
+package atylar
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"sync"
+)
+
+// CompareStrategy is the way the store decides whether the current version
+// of a file is already the newest historic version, in which case it isn't
+// captured again.
+type CompareStrategy int
+
+const (
+	// CompareBytes compares the content of the file and of the version.
+	// Both are read in full, unless their sizes differ.
+	CompareBytes CompareStrategy = iota
+	// CompareHash compares the SHA-256 hashes of the file and of the
+	// version. The hashes of versions are kept in memory, so the version
+	// is only read the first time after the store is opened, unless it
+	// was captured since.
+	CompareHash
+	// CompareSizeModTime considers the file unchanged if its size and
+	// modification time match the version. Nothing is read, but changes
+	// which preserve both, e.g. by tools restoring modification times,
+	// aren't captured.
+	CompareSizeModTime
+	// CompareNever captures every version, even identical ones.
+	CompareNever
+)
+
+// WithCompareStrategy sets how the store detects that the current version
+// of a file is already in its history, CompareBytes by default.
+func WithCompareStrategy(c CompareStrategy) Option {
+	return func(o *options) error {
+		if c < CompareBytes || c > CompareNever {
+			return fmt.Errorf("withCompareStrategy %d: unknown strategy", c)
+		}
+		o.compare = c
+		return nil
+	}
+}
+
+// hashCache holds the hashes of historic versions computed by CompareHash,
+// keyed by `name@generation`.
+type hashCache struct {
+	mu     sync.Mutex
+	hashes map[string]string
+}
+
+// get returns the cached hash of the version, or "" if there is none.
+func (c *hashCache) get(key string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[key]
+}
+
+// set caches the hash of the version.
+func (c *hashCache) set(key, hash string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hashes == nil {
+		c.hashes = make(map[string]string)
+	}
+	c.hashes[key] = hash
+}
+
+// hashFile returns the SHA-256 hash of the file at path.
+func hashFile(fsys Backend, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// unchanged reports whether the file at path, described by info, is the
+// given historic version of the file, according to the compare strategy.
+// With CompareHash, it also returns the hash of the file.
+func (S *Store) unchanged(path string, info fs.FileInfo, file string, generation uint64) (bool, string, error) {
+	switch S.compare {
+	case CompareNever:
+		return false, "", nil
+	case CompareSizeModTime:
+		v, err := S.versionInfo(file, generation)
+		if err != nil {
+			return false, "", err
+		}
+		return v.Size == info.Size() && v.ModTime.Equal(info.ModTime()), "", nil
+	case CompareHash:
+		hash, err := hashFile(S.fs(), path)
+		if err != nil {
+			return false, "", err
+		}
+		key := file + "@" + strconv.FormatUint(generation, 10)
+		stored := S.hashes.get(key)
+		if stored == "" {
+			f, err := S.open(file, generation)
+			if err != nil {
+				return false, "", err
+			}
+			stored, err = hashReader(f)
+			f.Close()
+			if err != nil {
+				return false, "", err
+			}
+			S.hashes.set(key, stored)
+		}
+		return hash == stored, hash, nil
+	}
+	eq, err := S.equalsVersion(path, file, generation)
+	return eq, "", err
+}
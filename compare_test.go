@@ -0,0 +1,122 @@
+package atylar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCompareStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  CompareStrategy
+		identical int // Versions after capturing the same content twice
+		touched   int // Versions after a change keeping the size and time
+	}{
+		{"bytes", CompareBytes, 1, 2},
+		{"hash", CompareHash, 1, 2},
+		{"size and time", CompareSizeModTime, 1, 1},
+		{"never", CompareNever, 2, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(t.TempDir(), WithCompareStrategy(tt.strategy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			path := S.filePath("file", false)
+			if err := os.WriteFile(path, []byte("one"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if err := S.recordHistory("file"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if h, _ := S.History("file"); len(h) != tt.identical {
+				t.Error("Got", h, "but expected", tt.identical, "versions")
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("two"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+				t.Fatal(err)
+			}
+			if err := S.recordHistory("file"); err != nil {
+				t.Fatal(err)
+			}
+			if h, _ := S.History("file"); len(h) != tt.touched {
+				t.Error("Got", h, "but expected", tt.touched, "versions")
+			}
+		})
+	}
+	if _, err := New(t.TempDir(), WithCompareStrategy(CompareStrategy(-1))); err == nil {
+		t.Error("Expected an unknown strategy to be rejected")
+	}
+}
+
+func TestCompareReaders(t *testing.T) {
+	long := bytes.Repeat([]byte("0123456789"), 20000)
+	changed := append([]byte{}, long...)
+	changed[len(changed)-1] = 'x'
+	tests := []struct {
+		name     string
+		a, b     []byte
+		short    bool // Read b one byte at a time
+		expected bool
+	}{
+		{"Empty", nil, nil, false, true},
+		{"Equal", long, long, false, true},
+		{"Short reads", long, long, true, true},
+		{"Different end", long, changed, true, false},
+		{"Prefix", long, long[:len(long)-1], false, false},
+		{"Longer", long[:65536], long[:65537], false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b io.Reader = bytes.NewReader(tt.b)
+			if tt.short {
+				b = iotest.OneByteReader(b)
+			}
+			if eq, err := compareReaders(bytes.NewReader(tt.a), b); err != nil || eq != tt.expected {
+				t.Error("Got", eq, err, "but expected", tt.expected)
+			}
+		})
+	}
+	failure := errors.New("failure")
+	if _, err := compareReaders(bytes.NewReader(long), iotest.ErrReader(failure)); !errors.Is(err, failure) {
+		t.Error("Got", err, "but expected", failure)
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	d := createMockStore(t)
+	os.WriteFile(filepath.Join(d, "same"), []byte("Hello!"), 0644)
+	os.WriteFile(filepath.Join(d, "other"), []byte("Hallo!"), 0644)
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"file", "same", true},
+		{"file", "other", false},
+		{"file", "file2", false},
+	}
+	for _, tt := range tests {
+		eq, err := compareFiles(osBackend{}, filepath.Join(d, tt.a), filepath.Join(d, tt.b))
+		if err != nil || eq != tt.expected {
+			t.Error("Got", eq, err, "but expected", tt.expected, "for", tt.a, tt.b)
+		}
+	}
+	if _, err := compareFiles(osBackend{}, filepath.Join(d, "file"), filepath.Join(d, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+}
@@ -0,0 +1,240 @@
+package atylar
+
+// Compressed storage of historic versions.
+//
+// With WithHistoryCompression, captured versions are compressed and stored
+// as `name@generation.gz`. They are decompressed transparently when opened,
+// compared or read, so the rest of the store doesn't distinguish them from
+// plain versions. Versions stored in chunks, see chunk.go, aren't compressed.
+// RecompressHistory converts the versions captured before the option was
+// set, or back after it's unset.
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Compression is an algorithm used to compress historic versions.
+type Compression int
+
+const (
+	NoCompression Compression = iota // Versions are stored as they are
+	Gzip                             // Versions are compressed with gzip
+)
+
+// compressedSuffix is the suffix of compressed versions.
+const compressedSuffix = ".gz"
+
+// WithHistoryCompression compresses the versions captured to history with
+// the given algorithm. Existing versions are left as they are, but they can
+// be converted with RecompressHistory.
+func WithHistoryCompression(c Compression) Option {
+	return func(o *options) error {
+		if c != NoCompression && c != Gzip {
+			return fmt.Errorf("withHistoryCompression %d: unknown compression", c)
+		}
+		o.compression = c
+		return nil
+	}
+}
+
+// writeCompressed writes the file at path compressed to the given path,
+// reporting the progress p.
+func (S *Store) writeCompressed(path, version string, p Progress) error {
+	src, err := S.fs().Open(path)
+	if err != nil {
+		return fmt.Errorf("writeCompressed %s: %w", path, err)
+	}
+	defer src.Close()
+	if err = S.fs().MkdirAll(filepath.Dir(version), S.dirPerm()); err != nil {
+		return fmt.Errorf("writeCompressed %s: %w", path, err)
+	}
+	dst, err := S.fs().OpenFile(version, os.O_CREATE|os.O_WRONLY|os.O_EXCL, S.filePerm())
+	if err != nil {
+		return fmt.Errorf("writeCompressed %s: %w", path, err)
+	}
+	zw := gzip.NewWriter(dst)
+	if err = S.copyData(zw, src, p); err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		dst.Close()
+		S.fs().Remove(version)
+		return fmt.Errorf("writeCompressed %s: %w", path, err)
+	}
+	if err = dst.Close(); err != nil {
+		S.fs().Remove(version)
+		return fmt.Errorf("writeCompressed %s: %w", path, err)
+	}
+	return nil
+}
+
+// openCompressed returns a reader of the content of the compressed version.
+func openCompressed(fsys Backend, version string) (io.ReadCloser, error) {
+	f, err := fsys.Open(version)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &compressedReader{zr, f}, nil
+}
+
+// compressedReader closes the underlying file along with the decompressor.
+type compressedReader struct {
+	*gzip.Reader
+	f File
+}
+
+func (r *compressedReader) Close() error {
+	r.Reader.Close()
+	return r.f.Close()
+}
+
+// decompress decompresses the version into a temporary file, see spool.
+func (S *Store) decompress(version string) (File, error) {
+	r, err := openCompressed(S.fs(), version)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", version, err)
+	}
+	defer r.Close()
+	f, err := S.spool(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", version, err)
+	}
+	return f, nil
+}
+
+// compressedSize returns the size of the content of the compressed version.
+// The size recorded by gzip is only modulo 4 GiB, so the version is read.
+func compressedSize(fsys Backend, version string) (int64, error) {
+	r, err := openCompressed(fsys, version)
+	if err != nil {
+		return 0, fmt.Errorf("compressedSize %s: %w", version, err)
+	}
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return 0, fmt.Errorf("compressedSize %s: %w", version, err)
+	}
+	return n, nil
+}
+
+// compareCompressed returns true if the file at path has the same content
+// as the compressed version.
+func compareCompressed(fsys Backend, path, version string) (bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("compareCompressed %s %s: %w", path, version, err)
+	}
+	defer f.Close()
+	r, err := openCompressed(fsys, version)
+	if err != nil {
+		return false, fmt.Errorf("compareCompressed %s %s: %w", path, version, err)
+	}
+	defer r.Close()
+	eq, err := compareReaders(f, r)
+	if err != nil {
+		return false, fmt.Errorf("compareCompressed %s %s: %w", path, version, err)
+	}
+	return eq, nil
+}
+
+// RecompressHistory converts the historic versions to the compression set
+// by WithHistoryCompression: plain versions are compressed, or compressed
+// versions are decompressed if compression isn't enabled. Versions stored
+// in chunks or as deltas are left as they are. It returns the number of converted
+// versions, which keep their modification times.
+func (S *Store) RecompressHistory() (int, error) {
+	if err := S.writable(); err != nil {
+		return 0, fmt.Errorf("recompressHistory: %w", err)
+	}
+	defer S.lockStore()()
+	paths := []string{}
+	err := S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+		if entry.IsDir() || generation(name) == 0 {
+			return nil
+		}
+		isPlain := !strings.HasSuffix(name, chunkedSuffix) && !strings.HasSuffix(name, compressedSuffix) &&
+			!strings.HasSuffix(name, deltaSuffix)
+		if S.compression != NoCompression && isPlain || S.compression == NoCompression && strings.HasSuffix(name, compressedSuffix) {
+			paths = append(paths, filepath.Join(S.historyDir(), filepath.FromSlash(name)))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("recompressHistory: %w", err)
+	}
+	converted := 0
+	for _, path := range paths {
+		if err := S.recompress(path); err != nil {
+			return converted, fmt.Errorf("recompressHistory: %w", err)
+		}
+		converted++
+	}
+	return converted, nil
+}
+
+// recompress converts a single history entry, see RecompressHistory.
+func (S *Store) recompress(path string) error {
+	info, err := S.fs().Stat(path)
+	if err != nil {
+		return err
+	}
+	target := path + compressedSuffix
+	if strings.HasSuffix(path, compressedSuffix) {
+		target = strings.TrimSuffix(path, compressedSuffix)
+	}
+	// Left behind by an interrupted conversion, as the source still exists.
+	if err := S.fs().Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if strings.HasSuffix(path, compressedSuffix) {
+		err = S.retry(func() error {
+			r, err := openCompressed(S.fs(), path)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return writeNew(S.fs(), target, r, S.filePerm())
+		})
+	} else {
+		err = S.retry(func() error { return S.writeCompressed(path, target, Progress{}) })
+	}
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		S.fs().Remove(target)
+		return err
+	}
+	return S.fs().Remove(path)
+}
+
+// writeNew writes the content read from r to a new file at path,
+// which is removed if it fails.
+func writeNew(fsys Backend, path string, r io.Reader, perm fs.FileMode) error {
+	f, err := fsys.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		fsys.Remove(path)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		fsys.Remove(path)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHistoryCompression(t *testing.T) {
+	S, err := New(t.TempDir(), WithHistoryCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	content := strings.Repeat("# Heading\n\nSome text.\n", 100)
+	for _, c := range []string{content, content, "changed", "changed again"} {
+		if err := S.WriteFile("notes.md", []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := S.HistoryInfo("notes.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writing the same content twice doesn't capture an identical version.
+	if len(versions) != 2 {
+		t.Fatal("Got", versions, "but expected 2 versions")
+	}
+	tests := []struct {
+		generation uint64
+		expected   string
+	}{
+		{versions[0].Generation, "changed"},
+		{versions[1].Generation, content},
+	}
+	for i, tt := range tests {
+		t.Run(tt.expected[:7], func(t *testing.T) {
+			path := S.versionPath("notes.md", tt.generation)
+			info, err := os.Stat(path + compressedSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Error("Expected no uncompressed version but got", err)
+			}
+			if tt.expected == content && info.Size() >= int64(len(content)) {
+				t.Error("Got", info.Size(), "bytes stored but expected less than", len(content))
+			}
+			if versions[i].Size != int64(len(tt.expected)) {
+				t.Error("Got size", versions[i].Size, "but expected", len(tt.expected))
+			}
+			if b, err := S.ReadFile("notes.md", tt.generation); err != nil || string(b) != tt.expected {
+				t.Error("Got", len(b), err, "but expected", len(tt.expected), "bytes")
+			}
+			if b, err := S.ReadRange("notes.md", tt.generation, 2, 5); err != nil || string(b) != tt.expected[2:7] {
+				t.Error("Got", string(b), err, "but expected", tt.expected[2:7])
+			}
+		})
+	}
+	if _, err := New(t.TempDir(), WithHistoryCompression(Compression(100))); err == nil {
+		t.Error("Expected an unknown compression to be rejected")
+	}
+}
+
+func TestCompareCompressed(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	long := strings.Repeat("0123456789", 10000)
+	tests := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{"equal", "hello", "hello", true},
+		{"empty", "", "", true},
+		{"different", "hello", "hellO", false},
+		{"prefix", "hello", "hello world", false},
+		{"longer", "hello world", "hello", false},
+		{"long equal", long, long, true},
+		{"long different", long, long[:len(long)-1] + "x", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := S.filePath("a", false)
+			if err := os.WriteFile(a, []byte(tt.a), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(S.filePath("b", false), []byte(tt.b), 0644); err != nil {
+				t.Fatal(err)
+			}
+			version := S.versionPath("b", uint64(i+1)) + compressedSuffix
+			if err := S.writeCompressed(S.filePath("b", false), version, Progress{}); err != nil {
+				t.Fatal(err)
+			}
+			if eq, err := compareCompressed(osBackend{}, a, version); err != nil || eq != tt.expected {
+				t.Error("Got", eq, err, "but expected", tt.expected)
+			}
+		})
+	}
+}
+
+func TestRecompressHistory(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file2", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(S.versionPath("file2", 124))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		suffix   string
+		expected int
+	}{
+		{"compress", []Option{WithHistoryCompression(Gzip)}, compressedSuffix, 2},
+		{"again", []Option{WithHistoryCompression(Gzip)}, compressedSuffix, 0},
+		{"decompress", nil, "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(d, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			n, err := S.RecompressHistory()
+			if err != nil || n != tt.expected {
+				t.Error("Got", n, err, "but expected", tt.expected)
+			}
+			info, err := os.Stat(S.versionPath("file2", 124) + tt.suffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(before.ModTime()) {
+				t.Error("Got", info.ModTime(), "but expected", before.ModTime())
+			}
+			if b, err := S.ReadFile("file2", 124); err != nil || string(b) != "Hello from the second file!" {
+				t.Error("Got", string(b), err)
+			}
+			if b, err := S.ReadFile("file", 123); err != nil || len(b) != 0 {
+				t.Error("Got", string(b), err, "but expected an empty version")
+			}
+		})
+	}
+}
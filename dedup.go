@@ -0,0 +1,98 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DedupStats describes how much space content addressing of historic
+// versions saves. Chunked versions, see chunk.go, share identical chunks,
+// while plain versions are stored in full. Compressed and delta-encoded
+// versions, see compress.go and delta.go, count with the size of their
+// content, so the savings include them.
+type DedupStats struct {
+	Versions        int   // Number of historic versions
+	ChunkedVersions int   // Number of versions stored in chunks
+	Chunks          int   // Number of stored chunks
+	SharedChunks    int   // Number of chunks used more than once
+	LogicalBytes    int64 // Total size of the content of all versions
+	StoredBytes     int64 // Disk space used by versions, manifests and chunks
+}
+
+// Saved returns the number of bytes deduplication saves.
+func (d DedupStats) Saved() int64 {
+	return d.LogicalBytes - d.StoredBytes
+}
+
+// DedupStats reports the deduplication of the history of the store.
+func (S *Store) DedupStats() (DedupStats, error) {
+	var d DedupStats
+	uses := make(map[string]int)
+	err := S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+		if generation(name) == 0 {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		d.Versions++
+		d.StoredBytes += info.Size()
+		path := filepath.Join(S.historyDir(), filepath.FromSlash(name))
+		switch filepath.Ext(name) {
+		case compressedSuffix:
+			size, err := compressedSize(S.fs(), path)
+			if err != nil {
+				return err
+			}
+			d.LogicalBytes += size
+			return nil
+		case deltaSuffix:
+			h, err := deltaInfo(S.fs(), path)
+			if err != nil {
+				return err
+			}
+			d.LogicalBytes += h.size
+			return nil
+		case chunkedSuffix:
+		default:
+			d.LogicalBytes += info.Size()
+			return nil
+		}
+		d.ChunkedVersions++
+		refs, err := readManifest(S.fs(), path)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			d.LogicalBytes += ref.size
+			uses[ref.hash]++
+		}
+		return nil
+	})
+	if err != nil {
+		return d, fmt.Errorf("dedupStats: %w", err)
+	}
+	dir, err := S.fs().ReadDir(S.chunkDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return d, fmt.Errorf("dedupStats: %w", err)
+	}
+	for _, entry := range dir {
+		if entry.IsDir() || isMetadata(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return d, fmt.Errorf("dedupStats: %w", err)
+		}
+		d.Chunks++
+		d.StoredBytes += info.Size()
+		if uses[entry.Name()] > 1 {
+			d.SharedChunks++
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,51 @@
+package atylar
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	S, err := New(t.TempDir(), WithDedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	content := strings.Repeat("x", 1000)
+	steps := []func() error{
+		func() error { return S.WriteFile("a", []byte(content)) },
+		func() error { return S.Copy("a", "b") },
+		func() error { return S.WriteFile("a", []byte("changed")) },
+		func() error { return S.WriteFile("b", nil) },
+		func() error { return S.WriteFile("b", []byte("changed")) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := S.DedupStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Versions != 3 || d.ChunkedVersions != 3 || d.Chunks != 1 || d.SharedChunks != 1 || d.LogicalBytes != 2000 {
+		t.Error("Got", d)
+	}
+	if d.Saved() < 1000-200 {
+		t.Error("Got", d.Saved(), "bytes saved but expected about 1000")
+	}
+	for _, file := range []string{"a", "b"} {
+		h, err := S.History(file)
+		if err != nil || len(h) == 0 {
+			t.Fatal("Got", h, err)
+		}
+		if b, err := S.ReadFile(file, h[len(h)-1]); err != nil || string(b) != content {
+			t.Error("Got", len(b), err, "but expected the original content")
+		}
+	}
+	if h, _ := S.History("b"); len(h) != 2 {
+		t.Error("Got", h, "but expected the empty version too")
+	} else if b, err := S.ReadFile("b", h[0]); err != nil || len(b) != 0 {
+		t.Error("Got", b, err, "but expected an empty version")
+	}
+}
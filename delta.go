@@ -0,0 +1,360 @@
+package atylar
+
+// Delta-encoded storage of historic versions.
+//
+// With WithDeltaHistory, a captured version is stored as a binary delta
+// against the previous version of the file, named `name@generation.delta`,
+// if the delta is smaller than half of the version. The first version, and
+// every version once the chain of deltas reaches deltaChainMax, is stored
+// in full, so reading a version applies a bounded number of deltas. The
+// entry begins with the line
+//
+//	atylar-delta <base generation> <size> <depth>
+//
+// followed by instructions which copy ranges of the base version and insert
+// new bytes. Both versions are held in memory while the delta is computed
+// or applied. When GC removes a version which a remaining delta is based
+// on, the delta is replaced by the full version first.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	deltaSuffix   = ".delta" // Suffix of delta-encoded versions
+	deltaMagic    = "atylar-delta"
+	deltaBlock    = 32 // Length of the blocks of the base matched in the version
+	deltaChainMax = 16 // Maximal number of deltas applied to read a version
+
+	deltaCopy   = 'c' // Followed by the offset and length in the base
+	deltaInsert = 'i' // Followed by the length and the bytes
+)
+
+// errCorruptDelta is returned when a delta can't be applied.
+var errCorruptDelta = errors.New("corrupt delta")
+
+// WithDeltaHistory stores captured versions as deltas against the previous
+// version of the file when it saves space, which suits big files changing
+// slightly. Versions stored in chunks aren't delta-encoded. See delta.go.
+func WithDeltaHistory() Option {
+	return func(o *options) error {
+		o.delta = true
+		return nil
+	}
+}
+
+// deltaHeader is the first line of a delta-encoded version.
+type deltaHeader struct {
+	base  uint64 // Generation of the version the delta applies to
+	size  int64  // Size of the version
+	depth int    // Number of deltas applied to read the version
+}
+
+// readDeltaHeader reads the header of the delta-encoded version from r.
+func readDeltaHeader(r *bufio.Reader) (deltaHeader, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return deltaHeader{}, fmt.Errorf("%w: %v", errCorruptDelta, err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != deltaMagic {
+		return deltaHeader{}, errCorruptDelta
+	}
+	var h deltaHeader
+	h.base, err = strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return deltaHeader{}, errCorruptDelta
+	}
+	if h.size, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return deltaHeader{}, errCorruptDelta
+	}
+	if h.depth, err = strconv.Atoi(fields[3]); err != nil {
+		return deltaHeader{}, errCorruptDelta
+	}
+	return h, nil
+}
+
+// deltaInfo returns the header of the delta-encoded version at path.
+func deltaInfo(fsys Backend, path string) (deltaHeader, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return deltaHeader{}, fmt.Errorf("deltaInfo %s: %w", path, err)
+	}
+	defer f.Close()
+	h, err := readDeltaHeader(bufio.NewReader(f))
+	if err != nil {
+		return h, fmt.Errorf("deltaInfo %s: %w", path, err)
+	}
+	return h, nil
+}
+
+// blockHash hashes a block of deltaBlock bytes. It can be rolled by one
+// byte with rollHash.
+func blockHash(b []byte) uint32 {
+	var h uint32
+	for _, c := range b {
+		h = h*16777619 + uint32(c)
+	}
+	return h
+}
+
+// deltaPow is 16777619 to the power of deltaBlock, for rollHash.
+var deltaPow = func() uint32 {
+	p := uint32(1)
+	for i := 0; i < deltaBlock; i++ {
+		p *= 16777619
+	}
+	return p
+}()
+
+// rollHash moves the hashed block by one byte, removing out and adding in.
+func rollHash(h uint32, out, in byte) uint32 {
+	return h*16777619 + uint32(in) - deltaPow*uint32(out)
+}
+
+// makeDelta returns the instructions which produce target from base.
+// Blocks of the base are located in the target with a rolling hash and
+// matches are extended in both directions.
+func makeDelta(base, target []byte) []byte {
+	blocks := make(map[uint32]int)
+	for o := 0; o+deltaBlock <= len(base); o += deltaBlock {
+		h := blockHash(base[o : o+deltaBlock])
+		if _, ok := blocks[h]; !ok {
+			blocks[h] = o
+		}
+	}
+	var out bytes.Buffer
+	var num [binary.MaxVarintLen64]byte
+	emit := func(op byte, args ...int) {
+		out.WriteByte(op)
+		for _, a := range args {
+			out.Write(num[:binary.PutUvarint(num[:], uint64(a))])
+		}
+	}
+	pending := 0 // Start of the bytes to be inserted
+	i := 0
+	var h uint32
+	fresh := true
+	for i+deltaBlock <= len(target) {
+		if fresh {
+			h = blockHash(target[i : i+deltaBlock])
+			fresh = false
+		}
+		o, ok := blocks[h]
+		if ok && bytes.Equal(base[o:o+deltaBlock], target[i:i+deltaBlock]) {
+			for i > pending && o > 0 && target[i-1] == base[o-1] {
+				i--
+				o--
+			}
+			n := 0
+			for i+n < len(target) && o+n < len(base) && target[i+n] == base[o+n] {
+				n++
+			}
+			if i > pending {
+				emit(deltaInsert, i-pending)
+				out.Write(target[pending:i])
+			}
+			emit(deltaCopy, o, n)
+			i += n
+			pending = i
+			fresh = true
+			continue
+		}
+		if i+deltaBlock < len(target) {
+			h = rollHash(h, target[i], target[i+deltaBlock])
+		}
+		i++
+	}
+	if pending < len(target) {
+		emit(deltaInsert, len(target)-pending)
+		out.Write(target[pending:])
+	}
+	return out.Bytes()
+}
+
+// applyDelta returns the version produced by the instructions from base.
+func applyDelta(base []byte, r *bufio.Reader, size int64) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch op {
+		case deltaCopy:
+			o, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || o > uint64(len(base)) || n > uint64(len(base))-o {
+				return nil, errCorruptDelta
+			}
+			out = append(out, base[o:o+n]...)
+		case deltaInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(size)-uint64(len(out)) {
+				return nil, errCorruptDelta
+			}
+			start := len(out)
+			out = append(out, make([]byte, n)...)
+			if _, err := io.ReadFull(r, out[start:]); err != nil {
+				return nil, errCorruptDelta
+			}
+		default:
+			return nil, errCorruptDelta
+		}
+	}
+	if int64(len(out)) != size {
+		return nil, errCorruptDelta
+	}
+	return out, nil
+}
+
+// readDelta reconstructs the delta-encoded version of the file at path.
+func (S *Store) readDelta(file, path string) ([]byte, error) {
+	f, err := S.fs().Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("readDelta %s: %w", path, err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	h, err := readDeltaHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("readDelta %s: %w", path, err)
+	}
+	base, err := S.versionData(file, h.base)
+	if err != nil {
+		return nil, fmt.Errorf("readDelta %s: %w", path, err)
+	}
+	b, err := applyDelta(base, r, h.size)
+	if err != nil {
+		return nil, fmt.Errorf("readDelta %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// versionData reads the whole historic version of the file.
+func (S *Store) versionData(file string, generation uint64) ([]byte, error) {
+	path, enc, err := S.versionEntry(file, generation)
+	if err != nil {
+		return nil, err
+	}
+	if enc == delta {
+		return S.readDelta(file, path)
+	}
+	return S.readVersion(file, generation)
+}
+
+// openDelta reconstructs the delta-encoded version into a temporary file,
+// see spool.
+func (S *Store) openDelta(file, path string) (File, error) {
+	b, err := S.readDelta(file, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := S.spool(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("openDelta %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// compareDelta returns true if the file at path has the same content as
+// the delta-encoded version of the file.
+func (S *Store) compareDelta(path, file, version string) (bool, error) {
+	h, err := deltaInfo(S.fs(), version)
+	if err != nil {
+		return false, err
+	}
+	info, err := S.fs().Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("compareDelta %s %s: %w", path, version, err)
+	}
+	if info.Size() != h.size {
+		return false, nil
+	}
+	current, err := readFile(S.fs(), path)
+	if err != nil {
+		return false, fmt.Errorf("compareDelta %s %s: %w", path, version, err)
+	}
+	stored, err := S.readDelta(file, version)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(current, stored), nil
+}
+
+// writeDelta writes the file at path to the given path as a delta against
+// the given version of the file. It returns false without writing anything
+// if the delta wouldn't save enough space or the chain would be too long.
+func (S *Store) writeDelta(path, file string, base uint64, version string) (bool, error) {
+	depth := 1
+	if entry, enc, err := S.versionEntry(file, base); err != nil {
+		return false, fmt.Errorf("writeDelta %s: %w", path, err)
+	} else if enc == delta {
+		h, err := deltaInfo(S.fs(), entry)
+		if err != nil {
+			return false, fmt.Errorf("writeDelta %s: %w", path, err)
+		}
+		depth = h.depth + 1
+	}
+	if depth > deltaChainMax {
+		return false, nil
+	}
+	target, err := readFile(S.fs(), path)
+	if err != nil {
+		return false, fmt.Errorf("writeDelta %s: %w", path, err)
+	}
+	b, err := S.versionData(file, base)
+	if err != nil {
+		return false, fmt.Errorf("writeDelta %s: %w", path, err)
+	}
+	d := makeDelta(b, target)
+	if len(d) >= len(target)/2 {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d %d %d\n", deltaMagic, base, len(target), depth)
+	buf.Write(d)
+	if err := writeNew(S.fs(), version, &buf, S.filePerm()); err != nil {
+		return false, fmt.Errorf("writeDelta %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// undelta replaces the delta-encoded version of the file at path with the
+// full version, so that it doesn't depend on its base anymore. The version
+// keeps its modification time.
+func (S *Store) undelta(file, path string) error {
+	info, err := S.fs().Stat(path)
+	if err != nil {
+		return fmt.Errorf("undelta %s: %w", path, err)
+	}
+	b, err := S.readDelta(file, path)
+	if err != nil {
+		return err
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return fmt.Errorf("undelta %s: %w", path, err)
+	}
+	defer S.fs().Remove(tmp)
+	version, err := S.writeFull(tmp, strings.TrimSuffix(path, deltaSuffix), Progress{})
+	if err != nil {
+		return fmt.Errorf("undelta %s: %w", path, err)
+	}
+	if err := S.fs().Chtimes(version, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("undelta %s: %w", path, err)
+	}
+	if err := S.fs().Remove(path); err != nil {
+		return fmt.Errorf("undelta %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package atylar
+
+import (
+	"bufio"
+	"bytes"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMakeDelta(t *testing.T) {
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	edited := append(append(append([]byte{}, random[:3000]...), "inserted"...), random[3100:]...)
+	tests := []struct {
+		name         string
+		base, target []byte
+	}{
+		{"empty", nil, nil},
+		{"from empty", nil, []byte("hello")},
+		{"to empty", random, nil},
+		{"same", random, random},
+		{"edited", random, edited},
+		{"shifted", random, append([]byte("x"), random...)},
+		{"truncated", random, random[:5555]},
+		{"unrelated", []byte(strings.Repeat("a", 100)), []byte(strings.Repeat("b", 100))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := makeDelta(tt.base, tt.target)
+			b, err := applyDelta(tt.base, bufio.NewReader(bytes.NewReader(d)), int64(len(tt.target)))
+			if err != nil || !bytes.Equal(b, tt.target) {
+				t.Error("Got", len(b), err, "but expected", len(tt.target), "bytes")
+			}
+			if tt.name == "edited" && len(d) > 100 {
+				t.Error("Got a delta of", len(d), "bytes but expected less than 100")
+			}
+		})
+	}
+	if _, err := applyDelta(random, bufio.NewReader(bytes.NewReader([]byte{deltaCopy, 100, 200})), 200); err == nil {
+		t.Error("Expected a copy beyond the base to be rejected")
+	}
+}
+
+func TestDeltaHistory(t *testing.T) {
+	S, err := New(t.TempDir(), WithDeltaHistory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	content := []byte(strings.Repeat("Some line of a big file.\n", 1000))
+	contents := [][]byte{}
+	for i := 0; i < deltaChainMax+3; i++ {
+		c := append([]byte{}, content...)
+		copy(c[i*100:], "changed")
+		contents = append(contents, c)
+		if err := S.WriteFile("big", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err := S.History("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The newest content is the live file.
+	contents = contents[:len(contents)-1]
+	if len(h) != len(contents) {
+		t.Fatal("Got", h, "but expected", len(contents), "versions")
+	}
+	deltas := 0
+	for i, g := range h {
+		expected := contents[len(contents)-1-i]
+		if b, err := S.ReadFile("big", g); err != nil || !bytes.Equal(b, expected) {
+			t.Error("Got", len(b), err, "but expected the content of version", g)
+		}
+		if _, enc, _ := S.versionEntry("big", g); enc == delta {
+			deltas++
+		}
+	}
+	// The first version and the one after the longest chain are full.
+	if deltas != len(h)-2 {
+		t.Error("Got", deltas, "delta-encoded versions but expected", len(h)-2)
+	}
+	versions, err := S.HistoryInfo("big")
+	if err != nil || versions[0].Size != int64(len(content)) {
+		t.Error("Got", versions, err)
+	}
+	if err := S.WriteFile("big", contents[len(contents)-1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The remaining versions stay readable after their bases are removed.
+	if _, err := S.GC(RetentionPolicy{KeepLast: 3}); err != nil {
+		t.Fatal(err)
+	}
+	h, err = S.History("big")
+	if err != nil || len(h) != 3 {
+		t.Fatal("Got", h, err)
+	}
+	for _, g := range h {
+		if _, err := S.ReadFile("big", g); err != nil {
+			t.Error("Got", err, "for version", g)
+		}
+	}
+	if _, err := os.Stat(S.versionPath("big", h[2])); err != nil {
+		t.Error("Expected the oldest remaining version to be stored in full but got", err)
+	}
+}
@@ -0,0 +1,98 @@
+package atylar
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// derivedPath returns the path to the cached artifact of the given version
+// of the file produced by the transform. Artifacts of live files are stored
+// without a generation and carry the modification time of their source.
+func (S *Store) derivedPath(file string, generation uint64, transform string) string {
+	path := filepath.Join(S.historyDir(), ".derived", normalizeName(transform, false), normalizeName(file, false))
+	if generation != 0 {
+		path += "@" + strconv.FormatUint(generation, 10)
+	}
+	return path
+}
+
+// Derived returns an artifact derived from the given version of the file,
+// such as a thumbnail or a preview, opened for reading. The transform names
+// the kind of the artifact. If it isn't cached yet, build is called with the
+// content of the version and its output is cached in the store. Historic
+// versions never change, while the artifact of a live file (generation 0)
+// is rebuilt whenever the file has been modified since it was built.
+// Read-only stores only return artifacts which are already cached.
+func (S *Store) Derived(file string, generation uint64, transform string, build func(w io.Writer, r io.Reader) error) (File, error) {
+	if normalizeName(file, false) == "" || normalizeName(transform, false) == "" {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, ErrInvalidName)
+	}
+	path := S.derivedPath(file, generation, transform)
+	var source os.FileInfo
+	if generation == 0 {
+		info, err := S.fs().Stat(S.filePath(file, false))
+		if err != nil {
+			return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+		}
+		source = info
+	}
+	if info, err := S.fs().Stat(path); err == nil && (source == nil || info.ModTime().Equal(source.ModTime())) {
+		f, err := S.fs().Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+		}
+		return f, nil
+	}
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+
+	src, err := S.Open(file, generation)
+	if err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	defer src.Close()
+	if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	tmp, err := S.fs().CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	defer S.fs().Remove(tmp.Name())
+	if err := build(tmp, src); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	if source != nil {
+		if err := S.fs().Chtimes(tmp.Name(), source.ModTime(), source.ModTime()); err != nil {
+			return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+		}
+	}
+	if err := S.fs().Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	f, err := S.fs().Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("derived %s %s: %w", file, transform, err)
+	}
+	return f, nil
+}
+
+// invalidateDerived removes the cached artifacts of the given version of
+// the file, where generation 0 refers to the live file.
+func (S *Store) invalidateDerived(file string, generation uint64) {
+	transforms, err := S.fs().ReadDir(filepath.Join(S.historyDir(), ".derived"))
+	if err != nil {
+		return
+	}
+	for _, t := range transforms {
+		S.fs().Remove(S.derivedPath(file, generation, t.Name()))
+	}
+}
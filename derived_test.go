@@ -0,0 +1,87 @@
+package atylar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// upper is a transform which converts the content to upper case,
+// counting its calls in builds.
+func upper(builds *int) func(w io.Writer, r io.Reader) error {
+	return func(w io.Writer, r io.Reader) error {
+		*builds++
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(b))
+		return err
+	}
+}
+
+// readDerived reads and closes the artifact returned by Derived.
+func readDerived(t *testing.T, S *Store, file string, generation uint64, build func(w io.Writer, r io.Reader) error) string {
+	f, err := S.Derived(file, generation, "upper", build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDerived(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if err := os.WriteFile(filepath.Join(d, ".history", "file@123"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builds := 0
+	build := upper(&builds)
+
+	if s := readDerived(t, &S, "file", 0, build); s != "HELLO!" {
+		t.Error("Expected HELLO! but got", s)
+	}
+	if s := readDerived(t, &S, "file", 0, build); s != "HELLO!" || builds != 1 {
+		t.Error("Expected a cached HELLO! but got", s, "after", builds, "builds")
+	}
+	if s := readDerived(t, &S, "file", 123, build); s != "OLD" || builds != 2 {
+		t.Error("Expected OLD after 2 builds but got", s, "after", builds)
+	}
+
+	// Modifying the file invalidates the artifact of the live version only.
+	if err := os.WriteFile(filepath.Join(d, "file"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(d, "file"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if s := readDerived(t, &S, "file", 0, build); s != "NEW" || builds != 3 {
+		t.Error("Expected NEW after 3 builds but got", s, "after", builds)
+	}
+	if s := readDerived(t, &S, "file", 123, build); s != "OLD" || builds != 3 {
+		t.Error("Expected a cached OLD but got", s, "after", builds, "builds")
+	}
+
+	if err := S.Remove("file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.derivedPath("file", 0, "upper")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the artifact to be removed with the file but got", err)
+	}
+	if _, err := S.Derived("file", 0, "upper", build); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if _, err := S.Derived("file", 0, "", build); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+}
@@ -0,0 +1,186 @@
+package atylar
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes in hunks.
+const diffContext = 3
+
+// diffOp is a line of a line-based diff: an unchanged line (' '),
+// a removed line ('-') or an added line ('+'). Lines keep their
+// terminating newline, if they have one.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits the content into lines, keeping the newlines.
+func splitLines(b []byte) []string {
+	lines := []string{}
+	for len(b) != 0 {
+		i := bytes.IndexByte(b, '\n') + 1
+		if i == 0 {
+			i = len(b)
+		}
+		lines = append(lines, string(b[:i]))
+		b = b[i:]
+	}
+	return lines
+}
+
+// isBinary reports whether the content can't be diffed line by line.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b, 0) >= 0
+}
+
+// diffLines returns a shortest edit script turning a into b,
+// computed with Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+3)
+	off := max + 1
+	// trace[d] holds v[-d..d] as it was before step d.
+	trace := [][]int{}
+	var d int
+search:
+	for d = 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	x, y := n, m
+	for ; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var pk int
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := at(pk)
+		py := px - pk
+		for x > px && y > py {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == px {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunkRange formats a range of a hunk header the way diff does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writeUnified writes a unified diff between a and b, with the given names
+// in the header, which are "/dev/null" for missing content. Binary content
+// is only reported to differ.
+func writeUnified(w *bufio.Writer, from, to string, a, b []byte) {
+	if bytes.Equal(a, b) {
+		return
+	}
+	if isBinary(a) || isBinary(b) {
+		fmt.Fprintf(w, "Binary files %s and %s differ\n", from, to)
+		return
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	// Positions in a and b before each op.
+	apos := make([]int, len(ops)+1)
+	bpos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		apos[i+1], bpos[i+1] = apos[i], bpos[i]
+		if op.kind != '+' {
+			apos[i+1]++
+		}
+		if op.kind != '-' {
+			bpos[i+1]++
+		}
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to)
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == ' ' && j-end < 2*diffContext {
+				j++
+			}
+			if j == len(ops) || ops[j].kind == ' ' {
+				break
+			}
+			end = j
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n",
+			hunkRange(apos[start], apos[stop]-apos[start]), hunkRange(bpos[start], bpos[stop]-bpos[start]))
+		for _, op := range ops[start:stop] {
+			w.WriteByte(op.kind)
+			w.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				w.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+}
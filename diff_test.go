@@ -0,0 +1,71 @@
+package atylar
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "a\nx\nb\nc\ny\n"},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"a\nb", "a\nb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"|"+tt.b, func(t *testing.T) {
+			ops := diffLines(splitLines([]byte(tt.a)), splitLines([]byte(tt.b)))
+			var from, to strings.Builder
+			for _, op := range ops {
+				if op.kind != '+' {
+					from.WriteString(op.line)
+				}
+				if op.kind != '-' {
+					to.WriteString(op.line)
+				}
+			}
+			if from.String() != tt.a || to.String() != tt.b {
+				t.Error("Got", from.String(), to.String(), "but expected", tt.a, tt.b)
+			}
+		})
+	}
+	if ops := diffLines(splitLines([]byte("a\nb\nc\na\nb\nb\na\n")), splitLines([]byte("c\nb\na\nb\na\nc\n"))); len(ops) != 9 {
+		t.Error("Got", len(ops), "ops but expected a shortest script of", 9)
+	}
+}
+
+func TestWriteUnified(t *testing.T) {
+	tests := []struct {
+		name, a, b, expected string
+	}{
+		{"equal", "a\n", "a\n", ""},
+		{"binary", "a\n", "\x00", "Binary files a and b differ\n"},
+		{"create", "", "a\nb\n", "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"newline", "a", "a\n", "--- a\n+++ b\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{"hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\n2\nx\n4\n5\n6\n7\n8\n9\n10\ny\n12\n",
+			"--- a\n+++ b\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n+y\n 12\n"},
+		{"merged",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\nx\n3\n4\n5\n6\ny\n8\n",
+			"--- a\n+++ b\n@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n-7\n+y\n 8\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s strings.Builder
+			w := bufio.NewWriter(&s)
+			writeUnified(w, "a", "b", []byte(tt.a), []byte(tt.b))
+			w.Flush()
+			if s.String() != tt.expected {
+				t.Errorf("Got\n%s\nbut expected\n%s", s.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package atylar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directories containing live files are created and removed along with
+// them, but applications modeling folders may also create empty ones with
+// Mkdir. Such directories are kept when they become empty, until they are
+// removed with RemoveDir. Both are recorded in `.history/.dirs`, one event
+// per line as `generation time op name`, where time is in Unix nanoseconds
+// and op is `mkdir` or `rmdir`, so that the existence of directories has
+// a history like the content of files.
+
+// DirEvent is the creation or removal of a directory, see DirHistory.
+type DirEvent struct {
+	Generation uint64
+	Time       time.Time
+	Removed    bool // The directory was removed, rather than created
+}
+
+// dirSet holds the directories created with Mkdir which weren't removed.
+type dirSet struct {
+	mu   sync.Mutex
+	kept map[string]bool
+}
+
+// has reports whether the directory is kept.
+func (d *dirSet) has(dir string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.kept[dir]
+}
+
+// dirsPath returns the path to the log of directory events.
+func (S *Store) dirsPath() string {
+	return filepath.Join(S.historyDir(), ".dirs")
+}
+
+// readDirEvents calls fn for every directory event in the log,
+// from the oldest.
+func (S *Store) readDirEvents(fn func(name string, e DirEvent)) error {
+	f, err := S.fs().Open(S.dirsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 || fields[2] != "mkdir" && fields[2] != "rmdir" {
+			return fmt.Errorf("malformed directory event %q", scanner.Text())
+		}
+		g, err1 := strconv.ParseUint(fields[0], 10, 64)
+		nanos, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("malformed directory event %q", scanner.Text())
+		}
+		fn(fields[3], DirEvent{Generation: g, Time: time.Unix(0, nanos), Removed: fields[2] == "rmdir"})
+	}
+	return scanner.Err()
+}
+
+// loadDirs reads the kept directories from the log. The generation is
+// raised to cover the events, which have no history entries.
+func (S *Store) loadDirs() error {
+	d := &dirSet{kept: make(map[string]bool)}
+	err := S.readDirEvents(func(name string, e DirEvent) {
+		d.kept[name] = !e.Removed
+		if e.Generation > S.Generation {
+			S.Generation = e.Generation
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("loadDirs: %w", err)
+	}
+	S.dirs = d
+	return nil
+}
+
+// recordDir appends an event to the log and updates the kept directories.
+func (S *Store) recordDir(dir string, removed bool) error {
+	op := "mkdir"
+	if removed {
+		op = "rmdir"
+	}
+	f, err := S.fs().OpenFile(S.dirsPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, S.filePerm())
+	if err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%d %d %s %s\n", S.GetGeneration(true), time.Now().UnixNano(), op, dir)
+	if _, err := f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if S.dirs != nil {
+		S.dirs.mu.Lock()
+		S.dirs.kept[dir] = !removed
+		S.dirs.mu.Unlock()
+	}
+	return nil
+}
+
+// Mkdir creates the directory, along with any missing parents, and keeps
+// it when it's empty, until it's removed with RemoveDir. The creation is
+// recorded in its history, unless it was already created with Mkdir.
+func (S *Store) Mkdir(dir string) error {
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "mkdir", Name: dir, Err: err}
+	}
+	dir = normalizeName(dir, false)
+	if dir == "" {
+		return &StoreError{Op: "mkdir", Name: dir, Err: ErrInvalidName}
+	}
+	defer S.lock(dir)()
+	if err := S.retry(func() error { return S.fs().MkdirAll(S.filePath(dir, false), S.dirPerm()) }); err != nil {
+		return &StoreError{Op: "mkdir", Name: dir, Err: err}
+	}
+	if S.dirs.has(dir) {
+		return nil
+	}
+	if err := S.recordDir(dir, false); err != nil {
+		return &StoreError{Op: "mkdir", Name: dir, Err: err}
+	}
+	return nil
+}
+
+// RemoveDir removes the empty directory and records the removal in its
+// history. Its parents which were left empty are removed too, unless they
+// were created with Mkdir.
+func (S *Store) RemoveDir(dir string) error {
+	if err := S.writable(); err != nil {
+		return &StoreError{Op: "removeDir", Name: dir, Err: err}
+	}
+	dir = normalizeName(dir, false)
+	if dir == "" {
+		return &StoreError{Op: "removeDir", Name: dir, Err: ErrInvalidName}
+	}
+	defer S.lock(dir)()
+	path := S.filePath(dir, false)
+	if info, err := S.fs().Stat(path); err != nil {
+		return &StoreError{Op: "removeDir", Name: dir, Err: err}
+	} else if !info.IsDir() {
+		return &StoreError{Op: "removeDir", Name: dir, Err: fmt.Errorf("not a directory")}
+	}
+	if err := S.retry(func() error { return S.fs().Remove(path) }); err != nil {
+		return &StoreError{Op: "removeDir", Name: dir, Err: err}
+	}
+	if err := S.recordDir(dir, true); err != nil {
+		return &StoreError{Op: "removeDir", Name: dir, Err: err}
+	}
+	S.pruneParent(dir)
+	return nil
+}
+
+// Dirs returns the directories created with Mkdir which weren't removed,
+// sorted by name.
+func (S *Store) Dirs() ([]string, error) {
+	kept := make(map[string]bool)
+	if err := S.readDirEvents(func(name string, e DirEvent) { kept[name] = !e.Removed }); err != nil {
+		return nil, fmt.Errorf("dirs: %w", err)
+	}
+	dirs := []string{}
+	for name, k := range kept {
+		if k {
+			dirs = append(dirs, name)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// ReadDir returns the entries of the live directory, "" for the store
+// root, sorted by name, like os.ReadDir. The history directory and other
+// names which can't be live files are left out. It goes through the
+// backend of the store, see WithBackend.
+func (S *Store) ReadDir(dir string) ([]fs.DirEntry, error) {
+	defer S.lock()()
+	entries, err := S.fs().ReadDir(S.filePath(dir, false))
+	if err != nil {
+		return []fs.DirEntry{}, fmt.Errorf("readDir %s: %w", dir, err)
+	}
+	live := []fs.DirEntry{}
+	for _, e := range entries {
+		if normalizeName(e.Name(), false) == e.Name() {
+			live = append(live, e)
+		}
+	}
+	return live, nil
+}
+
+// DirHistory returns the creations and removals of the directory with
+// Mkdir and RemoveDir, starting from the newest. The name is normalized.
+func (S *Store) DirHistory(dir string) ([]DirEvent, error) {
+	dir = normalizeName(dir, false)
+	events := []DirEvent{}
+	err := S.readDirEvents(func(name string, e DirEvent) {
+		if name == dir {
+			events = append(events, e)
+		}
+	})
+	if err != nil {
+		return events, fmt.Errorf("dirHistory %s: %w", dir, err)
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
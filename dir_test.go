@@ -0,0 +1,131 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDirs(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"empty", "a/b", "a/b"} {
+		if err := S.Mkdir(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := S.WriteFile("a/b/file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Remove("a/b/file"); err != nil {
+		t.Fatal(err)
+	}
+	// Kept directories survive removing their last file.
+	if info, err := os.Stat(S.filePath("a/b", false)); err != nil || !info.IsDir() {
+		t.Error("Expected a/b to be kept but got", err)
+	}
+	if dirs, err := S.Dirs(); err != nil || !reflect.DeepEqual(dirs, []string{"a/b", "empty"}) {
+		t.Error("Got", dirs, err)
+	}
+
+	if err := S.RemoveDir("file"); err == nil {
+		t.Error("Expected removing a file as a directory to fail")
+	}
+	if err := S.RemoveDir("missing"); !errors.Is(err, ErrNotExist) {
+		t.Error("Got", err, "but expected", ErrNotExist)
+	}
+	if err := S.RemoveDir("a/b"); err != nil {
+		t.Fatal(err)
+	}
+	// The parent wasn't created with Mkdir, so it's removed too.
+	if _, err := os.Stat(S.filePath("a", false)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a to be removed but got", err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	tests := []struct {
+		dir      string
+		expected []bool // Removed, from the newest
+	}{
+		{"empty", []bool{false}},
+		{"a/b", []bool{true, false}},
+		{"a", []bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			events, err := S.DirHistory(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []bool{}
+			for i, e := range events {
+				got = append(got, e.Removed)
+				if i > 0 && e.Generation >= events[i-1].Generation {
+					t.Error("Got", events, "but expected the newest first")
+				}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Error("Got", got, "but expected", tt.expected)
+			}
+		})
+	}
+	if dirs, _ := S.Dirs(); !reflect.DeepEqual(dirs, []string{"empty"}) {
+		t.Error("Got", dirs, "but expected", []string{"empty"})
+	}
+	if err := S.WriteFile("empty/file", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Remove("empty/file"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.filePath("empty", false)); err != nil {
+		t.Error("Expected empty to be kept after reopening but got", err)
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	for _, memory := range []bool{false, true} {
+		S, err := New(t.TempDir())
+		if memory {
+			S, err = NewMemory()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		S.WriteFile("file", []byte("content"))
+		S.WriteFile("dir/inner", []byte("content"))
+		S.Mkdir("empty")
+		names := func(dir string) []string {
+			entries, err := S.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			return names
+		}
+		if got := names(""); !reflect.DeepEqual(got, []string{"dir", "empty", "file"}) {
+			t.Error("Got", got, "but expected the live entries without the history directory")
+		}
+		if got := names("dir"); !reflect.DeepEqual(got, []string{"inner"}) {
+			t.Error("Got", got, "but expected [inner]")
+		}
+		if _, err := S.ReadDir("missing"); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Got", err, "but expected", os.ErrNotExist)
+		}
+		S.Close()
+	}
+}
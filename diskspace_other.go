@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || windows)
+
+package atylar
+
+// diskFree returns the number of bytes available on the file system
+// holding path. It isn't supported on this platform.
+func diskFree(path string) (int64, error) {
+	return 0, errUnsupported
+}
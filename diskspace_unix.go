@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || linux
+
+package atylar
+
+import "syscall"
+
+// diskFree returns the number of bytes available to the process on the
+// file system holding path.
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
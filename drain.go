@@ -0,0 +1,111 @@
+package atylar
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// drainPoll is how often Drain checks whether the store is quiescent.
+const drainPoll = 5 * time.Millisecond
+
+// enter registers a pending modification, like an open Writer or
+// transaction, which Drain waits for. It fails once the store is draining.
+func (l *locks) enter() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.draining {
+		return ErrDraining
+	}
+	l.pending++
+	return nil
+}
+
+// leave ends a pending modification registered by enter.
+func (l *locks) leave() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.pending--
+	l.mu.Unlock()
+}
+
+// isDraining returns true once Drain was called.
+func (l *locks) isDraining() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.draining
+}
+
+// quiescent returns true if no modification is pending or in progress.
+func (l *locks) quiescent() bool {
+	l.mu.Lock()
+	pending := l.pending
+	l.mu.Unlock()
+	if pending != 0 || !l.writes.TryLock() {
+		return false
+	}
+	l.writes.Unlock()
+	return true
+}
+
+// idle returns true if all events were delivered to the subscribers.
+func (s *subscribers) idle() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		sub.mu.Lock()
+		busy := len(sub.queue) != 0 || sub.delivering
+		sub.mu.Unlock()
+		if busy {
+			return false
+		}
+	}
+	return true
+}
+
+// Drain prepares the store for a graceful shutdown. New modifications fail
+// with ErrDraining from then on, while the ones in progress, including open
+// writers and transactions, can finish. Drain waits for them, for operations
+// like GC and for the delivery of events to subscribers, and then saves the
+// state which is otherwise saved by Close. If the context ends first, it
+// returns its error. Reads aren't affected, and the store stays draining
+// until it's closed. Stores which weren't opened with New can't be drained.
+func (S *Store) Drain(ctx context.Context) error {
+	l := S.locks
+	if l == nil {
+		return fmt.Errorf("drain: %w", errUnsupported)
+	}
+	l.mu.Lock()
+	l.draining = true
+	l.mu.Unlock()
+	t := time.NewTicker(drainPoll)
+	defer t.Stop()
+	for !l.quiescent() || !S.subs.idle() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("drain: %w", ctx.Err())
+		case <-t.C:
+		}
+	}
+	if S.closed || S.readOnly {
+		return nil
+	}
+	if err := S.saveGeneration(); err != nil {
+		return fmt.Errorf("drain: %w", err)
+	}
+	if err := S.saveIndex(); err != nil {
+		return fmt.Errorf("drain: %w", err)
+	}
+	return nil
+}
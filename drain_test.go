@@ -0,0 +1,112 @@
+package atylar
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	w, err := S.Overwrite("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile("file2", []byte("transaction")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pending writers and transactions hold up the drain.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := S.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Got", err, "but expected", context.DeadlineExceeded)
+	}
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"WriteFile", func() error { return S.WriteFile("file", []byte("new")) }},
+		{"Remove", func() error { return S.Remove("file2") }},
+		{"Begin", func() error { _, err := S.Begin(); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(); !errors.Is(err, ErrDraining) {
+				t.Error("Got", err, "but expected", ErrDraining)
+			}
+		})
+	}
+
+	// Once they finish, the store is drained.
+	done := make(chan error)
+	go func() { done <- S.Drain(context.Background()) }()
+	if _, err := w.WriteString("written"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain didn't return")
+	}
+	for file, expected := range map[string]string{"file": "written", "file2": "transaction"} {
+		if b, err := S.ReadFile(file, 0); err != nil || string(b) != expected {
+			t.Error("Got", string(b), err, "but expected", expected)
+		}
+	}
+	g, err := S.readGeneration()
+	if err != nil || g != S.GetGeneration(false) {
+		t.Error("Got", g, err, "but expected the generation", S.GetGeneration(false), "to be saved")
+	}
+}
+
+func TestDrainSubscribers(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	var delivered int32
+	cancel := S.Subscribe(func(Event) {
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&delivered, 1)
+	})
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		if err := S.WriteFile("file", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := S.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&delivered); n != 3 {
+		t.Error("Got", n, "delivered events but expected 3")
+	}
+}
+
+func TestDrainUnsupported(t *testing.T) {
+	S := Store{Directory: createMockStore(t)}
+	if err := S.Drain(context.Background()); !errors.Is(err, errUnsupported) {
+		t.Error("Got", err, "but expected", errUnsupported)
+	}
+}
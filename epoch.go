@@ -0,0 +1,61 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Epochs fence off stale writers. Every time the store is opened with New,
+// the number in `.history/.epoch` is incremented while the lock is held,
+// and the store remembers it. Before every modification, the store checks
+// that the number wasn't incremented since, so if the lock file fails to
+// exclude another writer, e.g. on a network filesystem or after it was
+// removed by hand, the former writer stops modifying the store with
+// ErrFenced instead of interleaving its changes with the new one. The check
+// precedes the modification, so a modification already underneath when
+// the new writer takes over still completes.
+
+// epochPath returns the path to the epoch file.
+func (S *Store) epochPath() string {
+	return filepath.Join(S.historyDir(), ".epoch")
+}
+
+// takeEpoch increments the epoch of the store and makes it the store's.
+func (S *Store) takeEpoch() error {
+	epoch, err := readNumber(S.fs(), S.epochPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("takeEpoch: %w", err)
+	}
+	epoch++
+	if err := S.writeNumber(S.epochPath(), epoch); err != nil {
+		return fmt.Errorf("takeEpoch: %w", err)
+	}
+	S.epoch = epoch
+	return nil
+}
+
+// checkEpoch returns ErrFenced if the store was opened by another writer
+// since it was opened. Stores which weren't opened with New aren't fenced.
+func (S *Store) checkEpoch() error {
+	if S.epoch == 0 {
+		return nil
+	}
+	epoch, err := readNumber(S.fs(), S.epochPath())
+	if err != nil {
+		return fmt.Errorf("checkEpoch: %w", err)
+	}
+	if epoch != S.epoch {
+		return ErrFenced
+	}
+	return nil
+}
+
+// Epoch returns the fencing token of the store: the number of times it was
+// opened with New, including this one, or 0 if it wasn't opened with New.
+// Services which accept writes on behalf of the store can pass it along
+// and reject requests carrying a lower epoch than the newest they saw.
+func (S *Store) Epoch() uint64 {
+	return S.epoch
+}
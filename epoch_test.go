@@ -0,0 +1,60 @@
+package atylar
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEpoch(t *testing.T) {
+	d := t.TempDir()
+	for _, expected := range []uint64{1, 2, 3} {
+		S, err := New(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if S.Epoch() != expected {
+			t.Error("Got", S.Epoch(), "but expected", expected)
+		}
+		if err := S.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	R, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R.Close()
+	if R.Epoch() != 0 {
+		t.Error("Got", R.Epoch(), "but expected 0 for a read-only store")
+	}
+}
+
+func TestFencing(t *testing.T) {
+	d := createMockStore(t)
+	old, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The lock fails to exclude the new writer.
+	if err := funlock(old.lockHandle); err != nil {
+		t.Fatal(err)
+	}
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := old.WriteFile("file", []byte("stale")); !errors.Is(err, ErrFenced) {
+		t.Error("Got", err, "but expected", ErrFenced)
+	}
+	if err := old.Remove("file2"); !errors.Is(err, ErrFenced) {
+		t.Error("Got", err, "but expected", ErrFenced)
+	}
+	if err := S.WriteFile("file", []byte("new")); err != nil {
+		t.Error("Got", err)
+	}
+	old.Close()
+	if g, err := S.readGeneration(); err != nil || g < S.Generation {
+		t.Error("Got", g, err, "but expected the counter of the new writer to be kept")
+	}
+}
@@ -0,0 +1,65 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+)
+
+var (
+	// ErrNotExist is returned when a file doesn't exist. It's the same
+	// as fs.ErrNotExist, so both can be used with errors.Is.
+	ErrNotExist = fs.ErrNotExist
+	// ErrVersionNotFound is returned when a historic version of a file
+	// doesn't exist. It wraps ErrNotExist.
+	ErrVersionNotFound = fmt.Errorf("version not found: %w", ErrNotExist)
+	// ErrInvalidName is returned when a name doesn't refer to a file in the store.
+	ErrInvalidName = errors.New("invalid file name")
+	// ErrReadOnly is returned by modifications of a store opened with NewReadOnly.
+	ErrReadOnly = errors.New("store is read-only")
+	// ErrLocked is returned by New when another process has the store open.
+	ErrLocked = errors.New("store is locked by another process")
+	// ErrClosed is returned by modifications of a store after Close.
+	ErrClosed = errors.New("store is closed")
+	// ErrFrozen is returned by Freeze if the store is already frozen.
+	ErrFrozen = errors.New("store is frozen")
+	// ErrConflict is returned by writers created with OverwriteIf when
+	// another version of the file was recorded in the meantime.
+	ErrConflict = errors.New("file was modified concurrently")
+	// ErrCanceled is returned by operations stopped with Operation.Cancel.
+	ErrCanceled = errors.New("operation canceled")
+	// ErrFenced is returned by modifications of a store after another
+	// writer opened it with New, see Epoch.
+	ErrFenced = errors.New("store was opened by a newer writer")
+	// ErrDraining is returned by modifications of a store after Drain.
+	ErrDraining = errors.New("store is draining")
+	// ErrNoChangeLog is returned by Log and Watch when the store doesn't
+	// record changes, see WithChangeLog.
+	ErrNoChangeLog = errors.New("change log isn't enabled")
+)
+
+// StoreError records an error and the operation and file that caused it,
+// like fs.PathError.
+type StoreError struct {
+	Op         string
+	Name       string
+	Generation uint64 // Version the operation was working with, if any
+	To         string // Destination of copies and moves, if any
+	Err        error
+}
+
+func (e *StoreError) Error() string {
+	s := e.Op + " " + e.Name
+	if e.Generation != 0 {
+		s += "@" + strconv.FormatUint(e.Generation, 10)
+	}
+	if e.To != "" {
+		s += " " + e.To
+	}
+	return s + ": " + e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,62 @@
+package atylar
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func TestStoreError(t *testing.T) {
+	tests := []struct {
+		err *StoreError
+		msg string
+	}{
+		{&StoreError{Op: "remove", Name: "a", Err: ErrReadOnly}, "remove a: store is read-only"},
+		{&StoreError{Op: "open", Name: "a", Generation: 3, Err: ErrVersionNotFound}, "open a@3: version not found: file does not exist"},
+		{&StoreError{Op: "move", Name: "a", To: "b", Err: ErrInvalidName}, "move a b: invalid file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			if msg := tt.err.Error(); msg != tt.msg {
+				t.Error("Got", msg, "but expected", tt.msg)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	tests := []struct {
+		name       string
+		err        error
+		op         string
+		generation uint64
+		is         []error
+	}{
+		{"Open missing file", func() error { _, err := S.Open("missing", 0); return err }(), "open", 0, []error{ErrNotExist, os.ErrNotExist}},
+		{"Open missing version", func() error { _, err := S.Open("file", 7); return err }(), "open", 7, []error{ErrVersionNotFound, ErrNotExist, fs.ErrNotExist}},
+		{"Overwrite invalid name", func() error { _, err := S.Overwrite(".."); return err }(), "overwrite", 0, []error{ErrInvalidName}},
+		{"Copy missing file", S.Copy("missing", "file3"), "copy", 0, []error{ErrNotExist}},
+		{"Move missing file", S.Move("missing", "file3"), "move", 0, []error{ErrNotExist}},
+		{"Remove missing file", S.Remove("missing"), "remove", 0, []error{ErrNotExist}},
+		{"Restore missing version", S.Restore("file", 7), "restore", 7, []error{ErrVersionNotFound}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e *StoreError
+			if !errors.As(tt.err, &e) {
+				t.Fatal("Expected a *StoreError but got", tt.err)
+			}
+			if e.Op != tt.op || e.Generation != tt.generation {
+				t.Error("Got", e.Op, e.Generation, "but expected", tt.op, tt.generation)
+			}
+			for _, target := range tt.is {
+				if !errors.Is(tt.err, target) {
+					t.Error("Expected", tt.err, "to be", target)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package atylar
+
+import (
+	"strconv"
+	"sync"
+)
+
+// EventKind is the kind of a change reported to subscribers.
+type EventKind int
+
+const (
+	EventWrite   EventKind = iota // A file was written
+	EventRemove                   // A file was removed
+	EventMove                     // A file was moved to To
+	EventCopy                     // A file was copied to To
+	EventRestore                  // A version of a file was restored, to To if set
+	EventGC                       // A version of a file was removed by GC
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventWrite:
+		return "write"
+	case EventRemove:
+		return "remove"
+	case EventMove:
+		return "move"
+	case EventCopy:
+		return "copy"
+	case EventRestore:
+		return "restore"
+	case EventGC:
+		return "gc"
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Event is a change of the store, reported to subscribers. Names are
+// normalized. Generation is the generation under which the previous
+// version of the modified file was recorded, or 0 if none was, e.g. when
+// a file was created. For EventRestore, it's the restored version, and
+// for EventGC, the removed one.
+type Event struct {
+	Kind       EventKind
+	Name       string
+	To         string // Destination of moves, copies and restores to another file
+	Generation uint64
+}
+
+// subscription delivers events to a subscriber in order, from its own
+// goroutine, so that slow subscribers don't hold up the store.
+type subscription struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []Event
+	delivering bool // An event was taken from the queue and is being delivered
+	stopped    bool
+}
+
+// subscribers holds the subscriptions of a store.
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[*subscription]bool
+}
+
+// Subscribe calls fn with every subsequent change of the store, in the
+// order of the changes. It's called from a separate goroutine after the
+// change is done, so it may use the store. Changes made through other
+// stores or outside the store aren't reported. The returned function
+// stops the subscription, discarding the events which weren't delivered.
+func (S *Store) Subscribe(fn func(Event)) (cancel func()) {
+	if S.subs == nil {
+		S.subs = &subscribers{}
+	}
+	s := &subscription{}
+	s.cond = sync.NewCond(&s.mu)
+	S.subs.mu.Lock()
+	if S.subs.subs == nil {
+		S.subs.subs = make(map[*subscription]bool)
+	}
+	S.subs.subs[s] = true
+	S.subs.mu.Unlock()
+	go func() {
+		for {
+			s.mu.Lock()
+			for len(s.queue) == 0 && !s.stopped {
+				s.cond.Wait()
+			}
+			if s.stopped {
+				s.mu.Unlock()
+				return
+			}
+			e := s.queue[0]
+			s.queue = s.queue[1:]
+			s.delivering = true
+			s.mu.Unlock()
+			fn(e)
+			s.mu.Lock()
+			s.delivering = false
+			s.mu.Unlock()
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			S.subs.mu.Lock()
+			delete(S.subs.subs, s)
+			S.subs.mu.Unlock()
+			s.mu.Lock()
+			s.stopped = true
+			s.queue = nil
+			s.mu.Unlock()
+			s.cond.Signal()
+		})
+	}
+}
+
+// emit reports the change to the subscribers, counts it for ListVersion
+// and records it in the change log, if it's enabled. The generation is
+// the one under which the change captured a version, 0 if it didn't
+// capture any.
+func (S *Store) emit(e Event, generation uint64) {
+	if e.Kind != EventGC {
+		S.mutated()
+		if S.changeLog {
+			S.logChange(e, generation)
+		}
+	}
+	if S.subs == nil {
+		return
+	}
+	S.subs.mu.Lock()
+	defer S.subs.mu.Unlock()
+	for s := range S.subs.subs {
+		s.mu.Lock()
+		s.queue = append(s.queue, e)
+		s.mu.Unlock()
+		s.cond.Signal()
+	}
+}
+
+// tracked returns a function calling next, which stores the last
+// generation it returned in g, for events.
+func tracked(next func() uint64, g *uint64) func() uint64 {
+	return func() uint64 {
+		*g = next()
+		return *g
+	}
+}
@@ -0,0 +1,88 @@
+package atylar
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	events := make(chan Event, 100)
+	cancel := S.Subscribe(func(e Event) { events <- e })
+	steps := []func() error{
+		func() error { return S.WriteFile("new", []byte("one")) },
+		func() error { return S.WriteFile("new", []byte("two")) },
+		func() error { return S.Copy("new", "dir/copy") },
+		func() error { return S.Move("file2", "moved") },
+		func() error { return S.Remove("dir/copy") },
+		func() error { return S.RestoreAs("file", "restored", 123) },
+		// Every file has a single version, so GC removes nothing.
+		func() error { _, err := S.GC(RetentionPolicy{KeepLast: 1}); return err },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []Event{
+		{Kind: EventWrite, Name: "new"},
+		{Kind: EventWrite, Name: "new", Generation: 124},
+		{Kind: EventCopy, Name: "new", To: "dir/copy"},
+		{Kind: EventMove, Name: "file2", To: "moved", Generation: 125},
+		{Kind: EventRemove, Name: "dir/copy", Generation: 126},
+		{Kind: EventRestore, Name: "file", To: "restored", Generation: 123},
+	}
+	for i, e := range expected {
+		select {
+		case got := <-events:
+			if !reflect.DeepEqual(got, e) {
+				t.Error("Got", got, "but expected", e, "at", i)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected", e)
+		}
+	}
+	cancel()
+	cancel()
+	if err := S.WriteFile("new", []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Error("Got", e, "after canceling")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscribeGC(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := make(chan Event, 10)
+	defer S.Subscribe(func(e Event) { events <- e })()
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1}); err != nil {
+		t.Fatal(err)
+	}
+	expected := Event{Kind: EventGC, Name: "file", Generation: 1}
+	select {
+	case got := <-events:
+		if !reflect.DeepEqual(got, expected) {
+			t.Error("Got", got, "but expected", expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected", expected)
+	}
+}
@@ -0,0 +1,527 @@
+package atylar
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export writes a store to a tar archive, which Import turns into a new
+// store. The archive begins with `manifest.json`, followed by the live
+// files under `files/` and, optionally, the historic versions under
+// `history/`, named `name@generation`. Content is archived as it's stored
+// in the files, i.e. still encoded by the write pipeline, regardless of
+// how versions are stored in the history directory. Descriptions of
+// versions are kept in the manifest, but channels, pins, snapshots and
+// other metadata aren't exported.
+//
+// Exporting the same state of a store always yields the same archive:
+// entries are sorted, their times are the modification times of the
+// files and versions, and ownership is left out.
+
+// exportFormat identifies the manifest of an export.
+const exportFormat = "atylar-export/1"
+
+// exportManifest is the manifest of an export.
+type exportManifest struct {
+	Format     string        `json:"format"`
+	Generation uint64        `json:"generation"`
+	History    bool          `json:"history"`
+	Entries    []exportEntry `json:"entries"`
+}
+
+// exportEntry describes a live file or a version in an export.
+type exportEntry struct {
+	Name       string      `json:"name"`
+	Generation uint64      `json:"generation,omitempty"` // 0 for live files
+	Size       int64       `json:"size"`
+	ModTime    time.Time   `json:"modTime"`
+	Meta       *CommitMeta `json:"meta,omitempty"`
+}
+
+// path returns the name of the entry's content in the archive.
+func (e exportEntry) path() string {
+	if e.Generation == 0 {
+		return "files/" + e.Name
+	}
+	return "history/" + e.Name + "@" + strconv.FormatUint(e.Generation, 10)
+}
+
+// Export writes the live files of the store and, if includeHistory is
+// true, their historic versions to w as a tar archive, which Import reads.
+// The archive can be compressed by passing a gzip.Writer, which Import
+// detects. Modifications wait until the export is done. It's listed by
+// Operations while it runs.
+func (S *Store) Export(w io.Writer, includeHistory bool) error {
+	op, end := S.begin("export")
+	defer end()
+	defer S.lockStore()()
+	m, err := S.exportManifest(includeHistory, nil)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	tw := tar.NewWriter(w)
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	header := &tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest)), ModTime: time.Unix(0, 0), Format: tar.FormatPAX}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	op.progress(0, int64(len(m.Entries)))
+	for _, e := range m.Entries {
+		if op.isCanceled() {
+			return fmt.Errorf("export: %w", ErrCanceled)
+		}
+		if err := S.exportEntry(tw, e); err != nil {
+			return fmt.Errorf("export %s: %w", e.path(), err)
+		}
+		op.step()
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// exportManifest lists the live files and, if history is true, their
+// versions, in the order of an export. If match isn't nil, only files
+// whose names it matches are listed. The store must be locked.
+func (S *Store) exportManifest(history bool, match func(name string) bool) (exportManifest, error) {
+	m := exportManifest{Format: exportFormat, Generation: S.GetGeneration(false), History: history, Entries: []exportEntry{}}
+	err := S.walkFiles(false, func(name string, entry fs.DirEntry) error {
+		if match != nil && !match(name) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		meta, err := S.readMeta(name, 0)
+		if err != nil {
+			return err
+		}
+		m.Entries = append(m.Entries, exportEntry{Name: name, Size: info.Size(), ModTime: info.ModTime(), Meta: meta})
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Name < m.Entries[j].Name })
+	if !history {
+		return m, nil
+	}
+	versions := []exportEntry{}
+	err = S.walkFiles(true, func(name string, _ fs.DirEntry) error {
+		file, g := parseVersion(name)
+		if g == 0 || match != nil && !match(file) {
+			return nil
+		}
+		v, err := S.versionInfo(file, g)
+		if err != nil {
+			return err
+		}
+		versions = append(versions, exportEntry{Name: file, Generation: g, Size: v.Size, ModTime: v.ModTime, Meta: v.Meta})
+		return nil
+	})
+	if err != nil {
+		return m, err
+	}
+	// Versions of each file from the oldest, so deltas can be imported.
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].Name != versions[j].Name {
+			return versions[i].Name < versions[j].Name
+		}
+		return versions[i].Generation < versions[j].Generation
+	})
+	m.Entries = append(m.Entries, versions...)
+	return m, nil
+}
+
+// exportEntry writes the content of the live file or version to the archive.
+func (S *Store) exportEntry(tw *tar.Writer, e exportEntry) error {
+	f, err := S.open(e.Name, e.Generation)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: e.path(), Mode: 0644, Size: info.Size(), ModTime: e.ModTime, Format: tar.FormatPAX}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import creates a new store at root, which mustn't exist or must be an
+// empty directory, from an archive written by Export, compressed with gzip
+// or not, and opens it with New. Versions are stored according to the
+// options. If it fails, whatever it created is removed.
+func Import(root string, r io.Reader, opts ...Option) (Store, error) {
+	S, err := createStore(root, opts, func(S *Store) error { return S.importArchive(r) })
+	if err != nil {
+		return S, fmt.Errorf("import: %w", err)
+	}
+	return S, nil
+}
+
+// createStore creates a new store at root, which mustn't exist or must be
+// an empty directory, opens it with New and fills it with fill. If it
+// fails, whatever it created is removed.
+func createStore(root string, opts []Option, fill func(S *Store) error) (S Store, err error) {
+	if err := S.apply(opts); err != nil {
+		return Store{}, err
+	}
+	fsys := S.fs()
+	entries, err := fsys.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := fsys.MkdirAll(root, 0755); err != nil {
+			return Store{}, err
+		}
+		defer func() {
+			if err != nil {
+				fsys.RemoveAll(root)
+			}
+		}()
+	} else if err != nil {
+		return Store{}, err
+	} else if len(entries) != 0 {
+		return Store{}, fmt.Errorf("%s: %w", root, os.ErrExist)
+	} else {
+		defer func() {
+			if err != nil {
+				entries, _ := fsys.ReadDir(root)
+				for _, e := range entries {
+					fsys.RemoveAll(filepath.Join(root, e.Name()))
+				}
+			}
+		}()
+	}
+	S, err = New(root, opts...)
+	if err != nil {
+		return S, err
+	}
+	if err := fill(&S); err != nil {
+		S.Close()
+		return Store{}, err
+	}
+	return S, nil
+}
+
+// importArchive fills the new store with the content of the archive.
+func (S *Store) importArchive(r io.Reader) error {
+	m, err := readArchive(r, S.importEntry)
+	if err != nil {
+		return err
+	}
+	if m.Generation > S.Generation {
+		S.Generation = m.Generation
+	}
+	return S.saveGeneration()
+}
+
+// readArchive reads an archive written by Export, compressed with gzip or
+// not, calling each for the entries in the order of the archive, with the
+// content as r. It fails if an entry of the manifest is missing.
+func readArchive(r io.Reader, each func(e exportEntry, r io.Reader) error) (exportManifest, error) {
+	var m exportManifest
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return m, err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil {
+		return m, fmt.Errorf("reading manifest: %w", err)
+	}
+	if header.Name != "manifest.json" {
+		return m, fmt.Errorf("missing manifest, got %s", header.Name)
+	}
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return m, fmt.Errorf("reading manifest: %w", err)
+	}
+	if m.Format != exportFormat {
+		return m, fmt.Errorf("unknown format %q", m.Format)
+	}
+	entries := make(map[string]exportEntry)
+	for _, e := range m.Entries {
+		entries[e.path()] = e
+	}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return m, err
+		}
+		e, ok := entries[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg || normalizeName(e.Name, false) != e.Name {
+			return m, fmt.Errorf("unexpected entry %s", header.Name)
+		}
+		delete(entries, header.Name) // Each is expected once.
+		if err := each(e, tr); err != nil {
+			return m, fmt.Errorf("%s: %w", header.Name, err)
+		}
+	}
+	// An archive cut off between entries ends cleanly, so the entries
+	// which never arrived have to be noticed.
+	for _, e := range m.Entries {
+		if _, ok := entries[e.path()]; ok {
+			return m, fmt.Errorf("truncated archive, missing %s: %w", e.path(), io.ErrUnexpectedEOF)
+		}
+	}
+	return m, nil
+}
+
+// stageEntry writes the content of an entry read from r to a temporary
+// file, with the modification time of the entry, and returns its path.
+func (S *Store) stageEntry(e exportEntry, r io.Reader) (string, error) {
+	tmp, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	if err := tmp.Chmod(S.filePerm()); err == nil {
+		_, err = io.Copy(tmp, r)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = S.fs().Chtimes(tmp.Name(), e.ModTime, e.ModTime)
+	}
+	if err != nil {
+		S.fs().Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// importEntry writes the content of a live file or a version read from r.
+func (S *Store) importEntry(e exportEntry, r io.Reader) error {
+	tmp, err := S.stageEntry(e, r)
+	if err != nil {
+		return err
+	}
+	defer S.fs().Remove(tmp)
+	if e.Generation == 0 {
+		if err := S.makeParent(e.Name); err != nil {
+			return err
+		}
+		if err := S.fs().Rename(tmp, S.filePath(e.Name, false)); err != nil {
+			return err
+		}
+		S.mutated()
+		return S.setMeta(e.Name, e.Meta)
+	}
+	if e.Generation > S.Generation {
+		S.Generation = e.Generation
+	}
+	previous, err := S.History(e.Name)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(S.versionPath(e.Name, e.Generation)), S.dirPerm()); err != nil {
+		return err
+	}
+	version, err := S.writeVersion(tmp, e.Size, e.Name, e.Generation, previous)
+	if err != nil {
+		return err
+	}
+	S.index.add(e.Name, e.Generation)
+	if err := S.fs().Chtimes(version, e.ModTime, e.ModTime); err != nil {
+		return err
+	}
+	if e.Meta != nil {
+		b, err := json.Marshal(e.Meta)
+		if err != nil {
+			return err
+		}
+		path := S.metaPath(e.Name, e.Generation)
+		if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+			return err
+		}
+		return writeFile(S.fs(), path, b, S.filePerm())
+	}
+	return nil
+}
+
+// ConflictPolicy decides what Store.Import does with the files of an archive
+// which already exist in the store.
+type ConflictPolicy int
+
+const (
+	SkipExisting      ConflictPolicy = iota // The existing file is kept
+	OverwriteExisting                       // The existing file is replaced, recording it to history
+	KeepBoth                                // The archived file is written next to the existing one
+)
+
+// ImportAction is what Store.Import did with a file of an archive.
+type ImportAction int
+
+const (
+	ImportCreated     ImportAction = iota // The file didn't exist and was created
+	ImportSkipped                         // The file existed and was kept
+	ImportOverwritten                     // The file existed and was replaced
+	ImportRenamed                         // The file existed and the archived one was written to To
+)
+
+func (a ImportAction) String() string {
+	switch a {
+	case ImportCreated:
+		return "created"
+	case ImportSkipped:
+		return "skipped"
+	case ImportOverwritten:
+		return "overwritten"
+	case ImportRenamed:
+		return "renamed"
+	}
+	return "ImportAction(" + strconv.Itoa(int(a)) + ")"
+}
+
+// ImportDecision reports what Store.Import did with a file of an archive.
+type ImportDecision struct {
+	Name   string
+	Action ImportAction
+	To     string // Name the file was written to, for ImportRenamed
+}
+
+// Import writes the live files of an archive written by Export into the
+// store, e.g. to restore a partial backup, while the package-level Import
+// creates a new store from it. Files which already exist are handled
+// according to the policy, and the others are created. Each file is
+// written like with Overwrite, so the replaced versions are recorded to
+// history. Historic versions in the archive are ignored, as their
+// generations belong to the exported store. Content is written as it's
+// archived, so the store should encode files like the exported one. It
+// returns the decisions about the files in the order of the archive,
+// including those made before it failed. It's listed by Operations while
+// it runs.
+func (S *Store) Import(r io.Reader, policy ConflictPolicy) ([]ImportDecision, error) {
+	decisions := []ImportDecision{}
+	if err := S.writable(); err != nil {
+		return decisions, fmt.Errorf("import: %w", err)
+	}
+	op, end := S.begin("import")
+	defer end()
+	_, err := readArchive(r, func(e exportEntry, r io.Reader) error {
+		if e.Generation != 0 {
+			return nil
+		}
+		if op.isCanceled() {
+			return ErrCanceled
+		}
+		d, err := S.importLive(e, r, policy)
+		if err != nil {
+			return err
+		}
+		decisions = append(decisions, d)
+		op.step()
+		return nil
+	})
+	if err != nil {
+		return decisions, fmt.Errorf("import: %w", err)
+	}
+	return decisions, nil
+}
+
+// importLive writes the content of a live file read from r to the store,
+// resolving a conflict with an existing file according to the policy.
+func (S *Store) importLive(e exportEntry, r io.Reader, policy ConflictPolicy) (ImportDecision, error) {
+	d := ImportDecision{Name: e.Name, Action: ImportCreated}
+	if err := S.checkName(e.Name); err != nil {
+		return d, err
+	}
+	tmp, err := S.stageEntry(e, r)
+	if err != nil {
+		return d, err
+	}
+	for {
+		alt := ""
+		if policy == KeepBoth {
+			if alt, err = S.freeName(e.Name); err != nil {
+				S.fs().Remove(tmp)
+				return d, err
+			}
+		}
+		names := []string{e.Name}
+		if alt != "" {
+			names = append(names, alt)
+		}
+		unlock := S.lock(names...)
+		target := e.Name
+		if S.exists(e.Name) {
+			switch policy {
+			case SkipExisting:
+				unlock()
+				S.fs().Remove(tmp)
+				d.Action = ImportSkipped
+				return d, nil
+			case OverwriteExisting:
+				d.Action = ImportOverwritten
+			case KeepBoth:
+				if S.exists(alt) { // Taken in the meantime
+					unlock()
+					continue
+				}
+				d.Action, d.To, target = ImportRenamed, alt, alt
+			default:
+				unlock()
+				S.fs().Remove(tmp)
+				return d, fmt.Errorf("unknown conflict policy %d", policy)
+			}
+		}
+		err = S.commit(target, tmp, e.Meta)
+		unlock()
+		return d, err
+	}
+}
+
+// exists reports whether the live file exists.
+func (S *Store) exists(file string) bool {
+	_, err := S.fs().Stat(S.filePath(file, false))
+	return err == nil
+}
+
+// freeName returns the first name of the form `name (n).ext` under which
+// no file exists.
+func (S *Store) freeName(file string) (string, error) {
+	ext := path.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	for n := 1; ; n++ {
+		name := base + " (" + strconv.Itoa(n) + ")" + ext
+		if !S.exists(name) {
+			return name, S.checkName(name)
+		}
+	}
+}
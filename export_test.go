@@ -0,0 +1,296 @@
+package atylar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createExportStore creates a store with some history and descriptions.
+func createExportStore(t *testing.T, opts ...Option) Store {
+	S, err := New(createMockStore(t), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeWithMeta(t, &S, "dir/page", "first", CommitMeta{Author: "alice", Message: "created"})
+	writeWithMeta(t, &S, "dir/page", "second", CommitMeta{Author: "bob"})
+	if err := S.WriteFile("file", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Remove("file2"); err != nil {
+		t.Fatal(err)
+	}
+	return S
+}
+
+func TestExportImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		history bool
+		gzip    bool
+		opts    []Option
+	}{
+		{"history", true, false, nil},
+		{"live files", false, false, nil},
+		{"gzip", true, true, []Option{WithDeltaHistory()}},
+		{"compressed", true, false, []Option{WithHistoryCompression(Gzip), WithDedup()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S := createExportStore(t)
+			defer S.Close()
+			var buf bytes.Buffer
+			if tt.gzip {
+				zw := gzip.NewWriter(&buf)
+				if err := S.Export(zw, tt.history); err != nil {
+					t.Fatal(err)
+				}
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := S.Export(&buf, tt.history); err != nil {
+				t.Fatal(err)
+			}
+			I, err := Import(filepath.Join(t.TempDir(), "imported"), &buf, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer I.Close()
+			if I.GetGeneration(false) < S.GetGeneration(false) {
+				t.Error("Got generation", I.GetGeneration(false), "but expected at least", S.GetGeneration(false))
+			}
+			files, err := S.List(tt.history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				expected, err := S.HistoryInfo(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.history {
+					expected = []Version{}
+				}
+				got, err := I.HistoryInfo(file)
+				if err != nil || !reflect.DeepEqual(got, expected) {
+					t.Error("Got", got, err, "for", file, "but expected", expected)
+				}
+				for _, v := range got {
+					a, _ := S.ReadFile(file, v.Generation)
+					if b, err := I.ReadFile(file, v.Generation); err != nil || !bytes.Equal(a, b) {
+						t.Error("Got", string(b), err, "for", file, "but expected", string(a))
+					}
+				}
+			}
+			live, _ := S.List(false)
+			if got, err := I.List(false); err != nil || !reflect.DeepEqual(got, live) {
+				t.Error("Got", got, err, "but expected", live)
+			}
+			for _, file := range live {
+				a, _ := S.ReadFile(file, 0)
+				if b, err := I.ReadFile(file, 0); err != nil || !bytes.Equal(a, b) {
+					t.Error("Got", string(b), err, "for", file, "but expected", string(a))
+				}
+				if got, err := I.Meta(file, 0); err != nil {
+					t.Error(err)
+				} else if expected, _ := S.Meta(file, 0); !reflect.DeepEqual(got, expected) {
+					t.Error("Got", got, "for", file, "but expected", expected)
+				}
+			}
+		})
+	}
+}
+
+func TestExportDeterministic(t *testing.T) {
+	S := createExportStore(t)
+	defer S.Close()
+	var a, b bytes.Buffer
+	if err := S.Export(&a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Export(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Error("Expected exports of the same state to be identical")
+	}
+	tr := tar.NewReader(&a)
+	names := []string{}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if h.Uid != 0 || h.Gid != 0 || h.Uname != "" || h.Gname != "" {
+			t.Error("Got ownership", h.Uid, h.Gid, h.Uname, h.Gname, "for", h.Name)
+		}
+		names = append(names, h.Name)
+	}
+	expected := []string{"manifest.json", "files/dir/page", "files/file",
+		"history/dir/page@124", "history/file@123", "history/file@125", "history/file2@126"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Error("Got", names, "but expected", expected)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	archive := func(name string) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		m, _ := json.Marshal(exportManifest{Format: exportFormat, Entries: []exportEntry{{Name: name, Size: 1}}})
+		tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(m))})
+		tw.Write(m)
+		tw.WriteHeader(&tar.Header{Name: exportEntry{Name: name}.path(), Mode: 0644, Size: 1})
+		tw.Write([]byte("x"))
+		tw.Close()
+		return &buf
+	}
+	root := filepath.Join(t.TempDir(), "imported")
+	if _, err := Import(root, archive("../escape")); err == nil {
+		t.Error("Expected an entry outside of the store to be rejected")
+	}
+	if _, err := os.Stat(root); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected the store to be removed")
+	}
+	if _, err := Import(createMockStore(t), archive("file")); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	S, err := Import(root, archive("file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "x" {
+		t.Error("Got", string(b), err, "but expected x")
+	}
+}
+
+func TestImportTruncated(t *testing.T) {
+	S := createExportStore(t)
+	defer S.Close()
+	var buf bytes.Buffer
+	if err := S.Export(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	// The archive is cut off after the manifest and the first entry, as if
+	// the backup was interrupted.
+	var cut bytes.Buffer
+	tr := tar.NewReader(&buf)
+	tw := tar.NewWriter(&cut)
+	for i := 0; i < 2; i++ {
+		header, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(t.TempDir(), "imported")
+	if _, err := Import(root, &cut); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error("Got", err, "but expected", io.ErrUnexpectedEOF)
+	}
+	if _, err := os.Stat(root); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected the store to be removed")
+	}
+}
+
+func TestImportInto(t *testing.T) {
+	S := createExportStore(t)
+	defer S.Close()
+	var buf bytes.Buffer
+	if err := S.Export(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+	tests := []struct {
+		name      string
+		policy    ConflictPolicy
+		decisions []ImportDecision
+		files     map[string]string
+	}{
+		{"skip", SkipExisting, []ImportDecision{{"dir/page", ImportCreated, ""}, {"file", ImportSkipped, ""}},
+			map[string]string{"dir/page": "second", "file": "mine"}},
+		{"overwrite", OverwriteExisting, []ImportDecision{{"dir/page", ImportCreated, ""}, {"file", ImportOverwritten, ""}},
+			map[string]string{"dir/page": "second", "file": "changed"}},
+		{"keep both", KeepBoth, []ImportDecision{{"dir/page", ImportCreated, ""}, {"file", ImportRenamed, "file (1)"}},
+			map[string]string{"dir/page": "second", "file": "mine", "file (1)": "changed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			T, err := NewMemory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer T.Close()
+			if err := T.WriteFile("file", []byte("mine")); err != nil {
+				t.Fatal(err)
+			}
+			decisions, err := T.Import(bytes.NewReader(archive), tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decisions, tt.decisions) {
+				t.Error("Got", decisions, "but expected", tt.decisions)
+			}
+			files, err := T.List(false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.files) {
+				t.Error("Got", files, "but expected", tt.files)
+			}
+			for name, content := range tt.files {
+				if b, err := T.ReadFile(name, 0); err != nil || string(b) != content {
+					t.Error("Got", string(b), err, "but expected", content, "in", name)
+				}
+			}
+			if meta, err := T.Meta("dir/page", 0); err != nil || meta.Author != "bob" {
+				t.Error("Got", meta, err, "but expected the description to be imported")
+			}
+			history, err := T.History("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.policy == OverwriteExisting {
+				if len(history) != 1 {
+					t.Fatal("Got", history, "but expected the replaced version")
+				}
+				if b, _ := T.ReadFile("file", history[0]); string(b) != "mine" {
+					t.Error("Got", string(b), "but expected the replaced version to be kept")
+				}
+			} else if len(history) != 0 {
+				t.Error("Got", history, "but expected no history")
+			}
+		})
+	}
+
+	// Keeping both again picks the next free name.
+	T, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer T.Close()
+	for i, expected := range []string{"", "file (1)", "file (2)"} {
+		decisions, err := T.Import(bytes.NewReader(archive), KeepBoth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := decisions[len(decisions)-1]; d.To != expected {
+			t.Error("Got", d, "but expected", expected, "in import", i)
+		}
+	}
+}
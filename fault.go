@@ -0,0 +1,237 @@
+package atylar
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultBackend wraps a backend and injects failures into it, so that the
+// handling of a full disk, I/O errors and slow storage can be tested
+// deterministically, both by atylar and by applications using it. Use it
+// with WithBackend. It's safe for concurrent use, and the failures can be
+// changed while the store is open.
+type FaultBackend struct {
+	Backend
+	mu      sync.Mutex
+	space   int64            // Bytes which can still be written, negative if unlimited
+	faults  map[string]error // Errors of operations on paths matching the patterns
+	latency time.Duration    // Delay of every operation
+}
+
+// NewFaultBackend returns a backend passing every operation to b, until
+// failures are configured.
+func NewFaultBackend(b Backend) *FaultBackend {
+	return &FaultBackend{Backend: b, space: -1, faults: make(map[string]error)}
+}
+
+// FailAfter makes writes fail with syscall.ENOSPC, as if the disk was full,
+// once n more bytes are written to any of the files. The write crossing the
+// limit writes the bytes which fit. A negative n removes the limit.
+func (b *FaultBackend) FailAfter(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.space = n
+}
+
+// FailOn makes every operation on the paths matching the pattern, as in
+// filepath.Match, fail with err, e.g. syscall.EIO. That includes reads and
+// writes of the files which are already open. A nil err removes the
+// failure.
+func (b *FaultBackend) FailOn(pattern string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.faults, pattern)
+	} else {
+		b.faults[pattern] = err
+	}
+}
+
+// Delay makes every operation, including reads and writes of open files,
+// take at least d longer, to simulate slow storage.
+func (b *FaultBackend) Delay(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latency = d
+}
+
+// check delays the operation and returns the error it has to fail with
+// if any of the paths match a failure, wrapped in a *fs.PathError.
+func (b *FaultBackend) check(op string, paths ...string) error {
+	b.mu.Lock()
+	latency := b.latency
+	var err error
+	for pattern, e := range b.faults {
+		for _, path := range paths {
+			if ok, _ := filepath.Match(pattern, path); ok {
+				err = &fs.PathError{Op: op, Path: path, Err: e}
+			}
+		}
+	}
+	b.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return err
+}
+
+// reserve takes up to n bytes of the remaining space and returns how many
+// it took.
+func (b *FaultBackend) reserve(n int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.space < 0 {
+		return n
+	}
+	if int64(n) > b.space {
+		n = int(b.space)
+	}
+	b.space -= int64(n)
+	return n
+}
+
+// wrap returns the file opened by the wrapped backend with the failures
+// injected.
+func (b *FaultBackend) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: f, b: b}, nil
+}
+
+func (b *FaultBackend) Open(name string) (File, error) {
+	if err := b.check("open", name); err != nil {
+		return nil, err
+	}
+	return b.wrap(b.Backend.Open(name))
+}
+
+func (b *FaultBackend) Create(name string) (File, error) {
+	if err := b.check("open", name); err != nil {
+		return nil, err
+	}
+	return b.wrap(b.Backend.Create(name))
+}
+
+func (b *FaultBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if err := b.check("open", name); err != nil {
+		return nil, err
+	}
+	return b.wrap(b.Backend.OpenFile(name, flag, perm))
+}
+
+func (b *FaultBackend) CreateTemp(dir, pattern string) (File, error) {
+	if err := b.check("createtemp", filepath.Join(dir, pattern)); err != nil {
+		return nil, err
+	}
+	return b.wrap(b.Backend.CreateTemp(dir, pattern))
+}
+
+func (b *FaultBackend) Mkdir(name string, perm fs.FileMode) error {
+	if err := b.check("mkdir", name); err != nil {
+		return err
+	}
+	return b.Backend.Mkdir(name, perm)
+}
+
+func (b *FaultBackend) MkdirAll(path string, perm fs.FileMode) error {
+	if err := b.check("mkdir", path); err != nil {
+		return err
+	}
+	return b.Backend.MkdirAll(path, perm)
+}
+
+func (b *FaultBackend) Rename(oldpath, newpath string) error {
+	if err := b.check("rename", oldpath, newpath); err != nil {
+		return err
+	}
+	return b.Backend.Rename(oldpath, newpath)
+}
+
+func (b *FaultBackend) Remove(name string) error {
+	if err := b.check("remove", name); err != nil {
+		return err
+	}
+	return b.Backend.Remove(name)
+}
+
+func (b *FaultBackend) RemoveAll(path string) error {
+	if err := b.check("removeall", path); err != nil {
+		return err
+	}
+	return b.Backend.RemoveAll(path)
+}
+
+func (b *FaultBackend) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := b.check("readdir", name); err != nil {
+		return nil, err
+	}
+	return b.Backend.ReadDir(name)
+}
+
+func (b *FaultBackend) Stat(name string) (fs.FileInfo, error) {
+	if err := b.check("stat", name); err != nil {
+		return nil, err
+	}
+	return b.Backend.Stat(name)
+}
+
+func (b *FaultBackend) Chtimes(name string, atime, mtime time.Time) error {
+	if err := b.check("chtimes", name); err != nil {
+		return err
+	}
+	return b.Backend.Chtimes(name, atime, mtime)
+}
+
+func (b *FaultBackend) Link(oldname, newname string) error {
+	if err := b.check("link", oldname, newname); err != nil {
+		return err
+	}
+	return b.Backend.Link(oldname, newname)
+}
+
+// faultFile is a file opened by a FaultBackend.
+type faultFile struct {
+	File
+	b *FaultBackend
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.b.check("read", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.b.check("read", f.Name()); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.b.check("write", f.Name()); err != nil {
+		return 0, err
+	}
+	n := f.b.reserve(len(p))
+	m, err := f.File.Write(p[:n])
+	if err == nil && n < len(p) {
+		err = &fs.PathError{Op: "write", Path: f.Name(), Err: syscall.ENOSPC}
+	}
+	return m, err
+}
+
+func (f *faultFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.b.check("sync", f.Name()); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
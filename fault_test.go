@@ -0,0 +1,65 @@
+package atylar
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFaultBackend(t *testing.T) {
+	b := NewFaultBackend(NewMemoryBackend())
+	S, err := New("store", WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	b.FailAfter(3)
+	if err := S.WriteFile("file", []byte("a longer content")); !errors.Is(err, syscall.ENOSPC) {
+		t.Error("Got", err, "but expected", syscall.ENOSPC)
+	}
+	if content, err := S.ReadFile("file", 0); err != nil || string(content) != "hello" {
+		t.Error("Got", string(content), err, "but expected the file to be unchanged")
+	}
+	entries, err := b.ReadDir(S.historyDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			t.Error("Expected no temporary files but got", entry.Name())
+		}
+	}
+	b.FailAfter(-1)
+	if err := S.WriteFile("file", []byte("a longer content")); err != nil {
+		t.Fatal(err)
+	}
+
+	b.FailOn(filepath.Join("store", "file"), syscall.EIO)
+	if _, err := S.ReadFile("file", 0); !errors.Is(err, syscall.EIO) {
+		t.Error("Got", err, "but expected", syscall.EIO)
+	}
+	if err := S.WriteFile("other", []byte("written")); err != nil {
+		t.Error("Got", err, "but expected other files to work")
+	}
+	b.FailOn(filepath.Join("store", "file"), nil)
+	if content, err := S.ReadFile("file", 0); err != nil || string(content) != "a longer content" {
+		t.Error("Got", string(content), err, "but expected a longer content")
+	}
+
+	b.Delay(20 * time.Millisecond)
+	start := time.Now()
+	if _, err := S.Stat("file", false); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Error("Got", d, "but expected the operation to be delayed")
+	}
+	b.Delay(0)
+}
@@ -0,0 +1,82 @@
+package atylar
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// UsageForecast estimates when the store runs out of space, as returned
+// by Forecast.
+type UsageForecast struct {
+	Bytes       int64     // Current size of live files and history
+	BytesPerDay float64   // Growth rate since the oldest recorded stats
+	Quota       int64     // Set by WithQuota, 0 if there is none
+	QuotaFull   time.Time // When the size reaches the quota, zero if not within the horizon
+	Available   int64     // Free disk space, -1 if it can't be determined
+	DiskFull    time.Time // When the growth uses up the free space, zero if not within the horizon
+}
+
+// WithQuota sets the size of live files and history which the store is
+// expected to stay within. It isn't enforced, but Forecast reports when
+// the store will reach it, so that applications can warn their users.
+func WithQuota(bytes int64) Option {
+	return func(o *options) error {
+		if bytes <= 0 {
+			return fmt.Errorf("withQuota %d: invalid quota", bytes)
+		}
+		o.quota = bytes
+		return nil
+	}
+}
+
+// Forecast estimates when the store will reach its quota, see WithQuota,
+// and when it will fill the disk, assuming it keeps growing at the rate
+// since the oldest stats recorded with RecordStats. Without recorded stats,
+// the rate is 0. Times beyond the horizon are left zero, unless the horizon
+// isn't positive, and limits which are already reached give the current
+// time.
+func (S *Store) Forecast(horizon time.Duration) (UsageForecast, error) {
+	f := UsageForecast{Quota: S.quota, Available: -1}
+	current, err := S.Stats()
+	if err != nil {
+		return f, fmt.Errorf("forecast: %w", err)
+	}
+	f.Bytes = current.Bytes + current.HistoryBytes
+	history, err := S.StatsHistory()
+	if err != nil {
+		return f, fmt.Errorf("forecast: %w", err)
+	}
+	if len(history) != 0 {
+		d := current.Diff(history[0])
+		f.BytesPerDay = d.BytesPerDay() + d.HistoryBytesPerDay()
+	}
+	if free, err := diskFree(S.historyDir()); err == nil {
+		f.Available = free
+		f.DiskFull = f.reaches(current.Time, free, horizon)
+	}
+	if f.Quota > 0 {
+		f.QuotaFull = f.reaches(current.Time, f.Quota-f.Bytes, horizon)
+	}
+	return f, nil
+}
+
+// reaches returns when the store grows by the given number of bytes from
+// now at the forecast rate, or zero if it doesn't within the horizon.
+func (f UsageForecast) reaches(now time.Time, bytes int64, horizon time.Duration) time.Time {
+	if bytes <= 0 {
+		return now
+	}
+	if f.BytesPerDay <= 0 {
+		return time.Time{}
+	}
+	days := float64(bytes) / f.BytesPerDay
+	limit := float64(math.MaxInt64) / float64(24*time.Hour)
+	if horizon > 0 {
+		limit = float64(horizon) / float64(24*time.Hour)
+	}
+	if days > limit {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(days * float64(24*time.Hour)))
+}
@@ -0,0 +1,62 @@
+package atylar
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestForecast(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		quota    int64
+		recorded bool
+		horizon  time.Duration
+		expected time.Duration // From now until the quota is reached, -1 if never
+	}{
+		{"No stats", 66, false, 0, -1},
+		{"Growth", 66, true, 0, 10 * day},
+		{"Within horizon", 66, true, 11 * day, 10 * day},
+		{"Beyond horizon", 66, true, 5 * day, -1},
+		{"Reached", 20, true, day, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(createMockStore(t), WithQuota(tt.quota))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			// The mock store holds 33 bytes, which grew from nothing in 10 days.
+			if tt.recorded {
+				line, _ := json.Marshal(Stats{Time: time.Now().Add(-10 * day)})
+				if err := os.WriteFile(S.statsPath(), append(line, '\n'), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			now := time.Now()
+			f, err := S.Forecast(tt.horizon)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Bytes != 33 || f.Quota != tt.quota {
+				t.Error("Got", f.Bytes, f.Quota, "but expected", 33, tt.quota)
+			}
+			if tt.expected < 0 {
+				if !f.QuotaFull.IsZero() {
+					t.Error("Got", f.QuotaFull, "but expected the quota not to be reached")
+				}
+			} else if d := f.QuotaFull.Sub(now) - tt.expected; d < -time.Minute || d > time.Minute {
+				t.Error("Got", f.QuotaFull, "but expected", now.Add(tt.expected))
+			}
+			if f.Available < 0 {
+				t.Error("Expected the free disk space to be known")
+			}
+		})
+	}
+	if _, err := New(createMockStore(t), WithQuota(0)); err == nil {
+		t.Error("Expected an invalid quota to be rejected")
+	}
+}
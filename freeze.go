@@ -0,0 +1,51 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Frozen describes the state of a store frozen by Freeze.
+type Frozen struct {
+	Generation uint64 // Newest generation captured before the freeze
+	Time       time.Time
+}
+
+// Freeze suspends all modifications of files and their history, so that an
+// external tool can take a consistent snapshot of the store's directory,
+// until Thaw is called.
+// It waits for the modifications in progress to finish, while the new ones
+// block until the store is thawed. Reads aren't affected. Stores which
+// weren't opened with New have no locks and can't be frozen.
+func (S *Store) Freeze() (Frozen, error) {
+	l := S.locks
+	if l == nil {
+		return Frozen{}, fmt.Errorf("freeze: %w", errUnsupported)
+	}
+	l.mu.Lock()
+	if l.frozen {
+		l.mu.Unlock()
+		return Frozen{}, fmt.Errorf("freeze: %w", ErrFrozen)
+	}
+	l.frozen = true
+	l.mu.Unlock()
+	l.writes.Lock()
+	return Frozen{Generation: S.GetGeneration(false), Time: time.Now()}, nil
+}
+
+// Thaw resumes the modifications suspended by Freeze.
+func (S *Store) Thaw() error {
+	l := S.locks
+	if l == nil {
+		return fmt.Errorf("thaw: %w", errUnsupported)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.frozen {
+		return errors.New("thaw: store isn't frozen")
+	}
+	l.frozen = false
+	l.writes.Unlock()
+	return nil
+}
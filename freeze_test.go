@@ -0,0 +1,51 @@
+package atylar
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFreeze(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	frozen, err := S.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frozen.Generation != 123 {
+		t.Error("Got generation", frozen.Generation, "but expected", 123)
+	}
+	if _, err := S.Freeze(); !errors.Is(err, ErrFrozen) {
+		t.Error("Expected ErrFrozen but got", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- S.WriteFile("file", []byte("New"))
+	}()
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "Hello!" {
+		t.Error("Expected reads to work while frozen but got", string(b), err)
+	}
+	select {
+	case err := <-done:
+		t.Error("Expected the write to wait for Thaw but it returned", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := S.Thaw(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "New" {
+		t.Error("Expected New <nil> but got", string(b), err)
+	}
+	if err := S.Thaw(); err == nil {
+		t.Error("Expected thawing a store which isn't frozen to fail")
+	}
+}
@@ -0,0 +1,242 @@
+package atylar
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// IssueKind classifies inconsistencies found by Check.
+type IssueKind int
+
+const (
+	// IssueTemporary is a temporary file or directory in the history
+	// directory, left behind by an interrupted write. Repair removes it.
+	IssueTemporary IssueKind = iota
+	// IssueName is a live file whose name isn't normalized, e.g. after an
+	// interrupted normalization, or a history entry whose name isn't a valid
+	// `name@generation` with a known encoding. Repair normalizes the names
+	// it can, and moves the remaining entries to `.history/.lost`.
+	IssueName
+	// IssueGeneration is a history entry with a generation above the
+	// generation counter, which would be assigned again. Repair raises
+	// the counter.
+	IssueGeneration
+	// IssueTransaction is a committed transaction which wasn't applied
+	// completely. Repair finishes it, like New does.
+	IssueTransaction
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case IssueTemporary:
+		return "temporary"
+	case IssueName:
+		return "name"
+	case IssueGeneration:
+		return "generation"
+	case IssueTransaction:
+		return "transaction"
+	}
+	return "IssueKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Issue is an inconsistency found by Check or Repair.
+type Issue struct {
+	Name   string // Slash-separated path relative to the store root
+	Kind   IssueKind
+	Detail string // Description of the inconsistency
+	Fixed  bool   // Set by Repair if it was fixed
+}
+
+// validEntry reports whether the name of a history entry, relative to the
+// history directory, is a valid version of a file with a known encoding.
+func validEntry(name string) bool {
+	_, g := parseVersion(name)
+	if g == 0 || normalizeName(name, true) != name {
+		return false
+	}
+	rest := name[strings.LastIndexByte(name, '@')+1:]
+	digits, suffix := rest, ""
+	if i := strings.IndexByte(rest, '.'); i >= 0 {
+		digits, suffix = rest[:i], rest[i:]
+	}
+	if digits != strconv.FormatUint(g, 10) {
+		return false
+	}
+	for _, s := range suffixes {
+		if suffix == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Check looks for inconsistencies left behind by crashes, like temporary
+// files, malformed names, history entries above the generation counter
+// and unfinished transactions, without modifying anything. Temporary files
+// of writers which are still open are reported too.
+func (S *Store) Check() ([]Issue, error) {
+	issues, err := S.check(false)
+	if err != nil {
+		return issues, fmt.Errorf("check: %w", err)
+	}
+	return issues, nil
+}
+
+// Repair fixes the inconsistencies found by Check and reports them. It
+// removes temporary files of writers which are still open, so it shouldn't
+// run while anything is being written to the store.
+func (S *Store) Repair() ([]Issue, error) {
+	if err := S.writable(); err != nil {
+		return []Issue{}, fmt.Errorf("repair: %w", err)
+	}
+	issues, err := S.check(true)
+	if err != nil {
+		return issues, fmt.Errorf("repair: %w", err)
+	}
+	return issues, nil
+}
+
+// check implements Check and Repair.
+func (S *Store) check(repair bool) ([]Issue, error) {
+	name := "check"
+	if repair {
+		name = "repair"
+	}
+	_, end := S.begin(name)
+	defer end()
+	defer S.lockStore()()
+	issues := []Issue{}
+
+	// Unfinished transactions, first, as they may capture versions.
+	entries, err := S.fs().ReadDir(S.historyDir())
+	if err != nil {
+		return issues, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), txPrefix) {
+			continue
+		}
+		dir := filepath.Join(S.historyDir(), entry.Name())
+		if _, err := S.fs().Stat(filepath.Join(dir, "commit")); err != nil {
+			continue // Uncommitted, so it's temporary.
+		}
+		issue := Issue{Name: S.historyName() + "/" + entry.Name(), Kind: IssueTransaction, Detail: "committed transaction wasn't applied"}
+		if repair {
+			if err := S.applyTx(dir); err != nil {
+				return issues, err
+			}
+			issue.Fixed = true
+		}
+		issues = append(issues, issue)
+	}
+
+	// Temporary files.
+	temporary, paths, err := S.findTemporary(time.Now(), 0)
+	if err != nil {
+		return issues, err
+	}
+	for i, t := range temporary {
+		issue := Issue{Name: t.Name, Kind: IssueTemporary, Detail: "temporary file"}
+		if repair {
+			if err := S.fs().RemoveAll(paths[i]); err != nil {
+				return issues, err
+			}
+			issue.Fixed = true
+		}
+		issues = append(issues, issue)
+	}
+
+	// Malformed names, normalized where possible.
+	names := []Issue{}
+	err = S.walkFiles(false, func(name string, entry fs.DirEntry) error {
+		if normalizeName(name, false) != name {
+			names = append(names, Issue{Name: name, Kind: IssueName, Detail: "name isn't normalized"})
+		}
+		return nil
+	})
+	if err != nil {
+		return issues, err
+	}
+	invalid := func() ([]Issue, error) {
+		found := []Issue{}
+		err := S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+			if !validEntry(name) {
+				found = append(found, Issue{Name: S.historyName() + "/" + name, Kind: IssueName, Detail: "not a valid version"})
+			}
+			return nil
+		})
+		return found, err
+	}
+	history, err := invalid()
+	if err != nil {
+		return issues, err
+	}
+	names = append(names, history...)
+	if repair && len(names) != 0 {
+		if err := S.normalize(); err != nil {
+			return issues, err
+		}
+		remaining, err := invalid()
+		if err != nil {
+			return issues, err
+		}
+		for _, r := range remaining {
+			rel := strings.TrimPrefix(r.Name, S.historyName()+"/")
+			lost := filepath.Join(S.historyDir(), ".lost", filepath.FromSlash(rel))
+			if err := S.fs().MkdirAll(filepath.Dir(lost), S.dirPerm()); err != nil {
+				return issues, err
+			}
+			if err := S.fs().Rename(filepath.Join(S.historyDir(), filepath.FromSlash(rel)), lost); err != nil {
+				return issues, err
+			}
+			S.pruneHistory(filepath.Join(S.historyDir(), filepath.FromSlash(rel)))
+		}
+		for i := range names {
+			names[i].Fixed = true
+		}
+		if S.index != nil {
+			x, err := S.buildIndex()
+			if err != nil {
+				return issues, err
+			}
+			S.index.mu.Lock()
+			S.index.files = x.files
+			S.index.mu.Unlock()
+		}
+	}
+	issues = append(issues, names...)
+
+	// History entries above the generation counter.
+	current := S.GetGeneration(false)
+	var max uint64
+	var newest string
+	err = S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+		if g := generation(name); validEntry(name) && g > max {
+			max, newest = g, name
+		}
+		return nil
+	})
+	if err != nil {
+		return issues, err
+	}
+	if max > current {
+		issue := Issue{
+			Name:   S.historyName() + "/" + newest,
+			Kind:   IssueGeneration,
+			Detail: fmt.Sprintf("generation %d is above the counter %d", max, current),
+		}
+		if repair {
+			atomic.StoreUint64(&S.Generation, max)
+			S.persistGeneration(max)
+			issue.Fixed = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
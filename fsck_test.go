@@ -0,0 +1,89 @@
+package atylar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCheckRepair(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d, WithoutNormalize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	h := S.historyDir()
+	tx := filepath.Join(h, txPrefix+"1")
+	if err := os.Mkdir(tx, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(tx, "commit"):     `{"generation":130,"ops":[]}`,
+		filepath.Join(h, ".tmp-1"):      "partial",
+		filepath.Join(d, "a@b"):         "unnormalized",
+		filepath.Join(h, "file@abc"):    "no generation",
+		filepath.Join(h, "file@0124"):   "leading zero",
+		filepath.Join(h, "file@125.xz"): "unknown encoding",
+		filepath.Join(h, "file2@500"):   "ahead",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		".history/.tmp-1 temporary",
+		".history/.tmp-tx-1 transaction",
+		".history/file2@500 generation",
+		".history/file@0124 name",
+		".history/file@125.xz name",
+		".history/file@abc name",
+		"a@b name",
+	}
+	summary := func(issues []Issue, fixed bool) []string {
+		got := []string{}
+		for _, i := range issues {
+			got = append(got, i.Name+" "+i.Kind.String())
+			if i.Fixed != fixed {
+				t.Error("Got", i, "but expected Fixed to be", fixed)
+			}
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	issues, err := S.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(issues, false); !reflect.DeepEqual(got, expected) {
+		t.Error("Got", got, "but expected", expected)
+	}
+	if _, err := os.Stat(filepath.Join(h, ".tmp-1")); err != nil {
+		t.Error("Expected Check not to modify anything but got", err)
+	}
+	issues, err = S.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(issues, true); !reflect.DeepEqual(got, expected) {
+		t.Error("Got", got, "but expected", expected)
+	}
+	if issues, err := S.Check(); err != nil || len(issues) != 0 {
+		t.Error("Got", issues, err, "after repairing")
+	}
+	if g := S.GetGeneration(false); g < 500 {
+		t.Error("Got generation", g, "but expected at least 500")
+	}
+	for _, name := range []string{"a_b", ".history/.lost/file@abc", ".history/.lost/file@125.xz"} {
+		if _, err := os.Stat(filepath.Join(d, filepath.FromSlash(name))); err != nil {
+			t.Error("Expected", name, "to exist but got", err)
+		}
+	}
+	if h, _ := S.History("file2"); !reflect.DeepEqual(h, []uint64{500}) {
+		t.Error("Got", h, "but expected", []uint64{500})
+	}
+}
@@ -0,0 +1,377 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy specifies which historic versions are kept by GC.
+// Zero values disable the respective rules. A version is kept if any of the
+// keep rules keeps it, and if none of them is enabled, all versions are kept.
+// MaxBytes is applied afterwards and may remove any version, except for
+// pinned ones and those which channels or snapshots point at, which are
+// always kept. Files with overrides set by SetRetention follow those
+// instead.
+type RetentionPolicy struct {
+	KeepLast        int           // Number of newest versions of each file to keep
+	KeepYoungerThan time.Duration // Versions last modified more recently are kept
+	MaxBytes        int64         // Oldest versions are removed until the history fits
+	DryRun          bool          // Only report what would be removed
+}
+
+// GCReport describes the outcome of GC.
+type GCReport struct {
+	Versions []string // Removed versions, as `name@generation`
+	Chunks   int      // Number of removed chunks, including ones no version used
+	Bytes    int64    // Disk space freed
+}
+
+// gcVersion is a history entry considered by GC.
+type gcVersion struct {
+	file       string
+	generation uint64
+	path       string
+	size       int64 // Size of the entry itself, without chunks
+	modTime    time.Time
+	refs       []chunkRef // Chunks of a chunked version
+	base       uint64     // Generation of the base of a delta-encoded version
+}
+
+// GC removes historic versions which aren't retained by the policy,
+// and chunks which no remaining version uses. It's listed by Operations
+// while it runs. If it's canceled, the report covers what was removed.
+func (S *Store) GC(policy RetentionPolicy) (GCReport, error) {
+	report := GCReport{Versions: []string{}}
+	if err := S.writable(); err != nil && !policy.DryRun {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+	op, end := S.begin("gc")
+	defer end()
+	defer S.lockStore()()
+	versions := []*gcVersion{}
+	err := S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+		file, g := parseVersion(name)
+		if g == 0 {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		v := &gcVersion{file: file, generation: g, size: info.Size(), modTime: info.ModTime()}
+		v.path = filepath.Join(S.historyDir(), filepath.FromSlash(name))
+		switch filepath.Ext(name) {
+		case chunkedSuffix:
+			if v.refs, err = readManifest(S.fs(), v.path); err != nil {
+				return err
+			}
+		case deltaSuffix:
+			h, err := deltaInfo(S.fs(), v.path)
+			if err != nil {
+				return err
+			}
+			v.base = h.base
+		}
+		versions = append(versions, v)
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+
+	pinned, err := S.channelVersions()
+	if err != nil {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+	pins, err := S.Pins()
+	if err != nil {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+	for _, p := range pins {
+		pinned[p.File+"@"+strconv.FormatUint(p.Generation, 10)] = true
+	}
+	snapshotted, err := S.snapshotVersions()
+	if err != nil {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+	for v := range snapshotted {
+		pinned[v] = true
+	}
+	overrides, err := S.retentionOverrides()
+	if err != nil {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+
+	// Usage counts and sizes of the stored chunks.
+	uses := make(map[string]int)
+	for _, v := range versions {
+		for _, ref := range v.refs {
+			uses[ref.hash]++
+		}
+	}
+	chunkSizes := make(map[string]int64)
+	dir, err := S.fs().ReadDir(S.chunkDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, fmt.Errorf("gc: %w", err)
+	}
+	var total int64
+	for _, entry := range dir {
+		if entry.IsDir() || isMetadata(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return report, fmt.Errorf("gc: %w", err)
+		}
+		chunkSizes[entry.Name()] = info.Size()
+		total += info.Size()
+	}
+	for _, v := range versions {
+		total += v.size
+	}
+
+	removed := []*gcVersion{}
+	remove := func(v *gcVersion) {
+		removed = append(removed, v)
+		total -= v.size
+		for _, ref := range v.refs {
+			if uses[ref.hash]--; uses[ref.hash] == 0 {
+				total -= chunkSizes[ref.hash]
+			}
+		}
+	}
+
+	// Keep rules, applied to the versions of each file from the newest.
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].file != versions[j].file {
+			return versions[i].file < versions[j].file
+		}
+		return versions[i].generation > versions[j].generation
+	})
+	// Modification times of the versions of each file, in order.
+	for i := 0; i < len(versions); {
+		j := i
+		for j < len(versions) && versions[j].file == versions[i].file {
+			j++
+		}
+		times := make([]time.Time, j-i)
+		for k := range times {
+			times[k] = versions[i+k].modTime
+		}
+		S.resolveTimes(times)
+		for k := range times {
+			versions[i+k].modTime = times[k]
+		}
+		i = j
+	}
+	now := time.Now()
+	kept := []*gcVersion{}
+	overridden := make(map[string][]*gcVersion) // Kept versions of files with overrides
+	n := 0
+	for i, v := range versions {
+		if i == 0 || v.file != versions[i-1].file {
+			n = 0
+		}
+		n++
+		if pinned[v.file+"@"+strconv.FormatUint(v.generation, 10)] {
+			continue
+		}
+		p, ok := overrides[v.file]
+		if !ok {
+			p = policy
+		}
+		keep := p.KeepLast <= 0 && p.KeepYoungerThan <= 0 ||
+			p.KeepLast > 0 && n <= p.KeepLast ||
+			p.KeepYoungerThan > 0 && now.Sub(v.modTime) < p.KeepYoungerThan
+		if !keep {
+			remove(v)
+		} else if ok {
+			overridden[v.file] = append(overridden[v.file], v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+
+	// Size limits of the overrides, removing the oldest versions of each
+	// file first. Chunks count once for each file using them.
+	for file, vs := range overridden {
+		limit := overrides[file].MaxBytes
+		if limit <= 0 {
+			continue
+		}
+		fileUses := make(map[string]int)
+		var size int64
+		for _, v := range vs {
+			size += v.size
+			for _, ref := range v.refs {
+				if fileUses[ref.hash]++; fileUses[ref.hash] == 1 {
+					size += chunkSizes[ref.hash]
+				}
+			}
+		}
+		for len(vs) != 0 && size > limit {
+			v := vs[len(vs)-1]
+			size -= v.size
+			for _, ref := range v.refs {
+				if fileUses[ref.hash]--; fileUses[ref.hash] == 0 {
+					size -= chunkSizes[ref.hash]
+				}
+			}
+			remove(v)
+			vs = vs[:len(vs)-1]
+		}
+		overridden[file] = vs
+	}
+
+	// Size limit, removing the oldest versions of the whole store first.
+	// Versions of files with overrides aren't counted against it.
+	if policy.MaxBytes > 0 {
+		overriddenUses := make(map[string]int)
+		for _, vs := range overridden {
+			for _, v := range vs {
+				total -= v.size
+				for _, ref := range v.refs {
+					overriddenUses[ref.hash]++
+				}
+			}
+		}
+		for hash, n := range overriddenUses {
+			if uses[hash] == n {
+				total -= chunkSizes[hash]
+			}
+		}
+		sort.Slice(kept, func(i, j int) bool { return kept[i].generation < kept[j].generation })
+		for len(kept) != 0 && total > policy.MaxBytes {
+			remove(kept[0])
+			kept = kept[1:]
+		}
+	}
+
+	// Remaining deltas against removed versions are stored in full, before
+	// anything is removed, as their bases may be deltas themselves.
+	if !policy.DryRun {
+		gone := make(map[string]bool)
+		for _, v := range removed {
+			gone[v.file+"@"+strconv.FormatUint(v.generation, 10)] = true
+		}
+		for _, v := range versions {
+			key := v.file + "@" + strconv.FormatUint(v.generation, 10)
+			if v.base != 0 && !gone[key] && gone[v.file+"@"+strconv.FormatUint(v.base, 10)] {
+				if err := S.undelta(v.file, v.path); err != nil {
+					return report, fmt.Errorf("gc: %w", err)
+				}
+			}
+		}
+	}
+
+	unused := 0
+	for hash := range chunkSizes {
+		if uses[hash] <= 0 {
+			unused++
+		}
+	}
+	op.progress(0, int64(len(removed)+unused))
+	pruned := make(map[string]uint64)
+	defer func() {
+		for file, g := range pruned {
+			S.markPruned(file, g)
+		}
+		if !policy.DryRun {
+			S.forgetChecksums(report.Versions)
+		}
+	}()
+	for _, v := range removed {
+		if op.isCanceled() {
+			return report, fmt.Errorf("gc: %w", ErrCanceled)
+		}
+		report.Versions = append(report.Versions, v.file+"@"+strconv.FormatUint(v.generation, 10))
+		report.Bytes += v.size
+		if !policy.DryRun {
+			if err := S.fs().Remove(v.path); err != nil {
+				return report, fmt.Errorf("gc: %w", err)
+			}
+			S.index.remove(v.file, v.generation)
+			if v.generation > pruned[v.file] {
+				pruned[v.file] = v.generation
+			}
+			S.invalidateDerived(v.file, v.generation)
+			S.fs().Remove(S.metaPath(v.file, v.generation))
+			S.pruneHistory(v.path)
+			S.emit(Event{Kind: EventGC, Name: v.file, Generation: v.generation}, 0)
+		}
+		op.step()
+	}
+	for hash, size := range chunkSizes {
+		if uses[hash] > 0 {
+			continue
+		}
+		if op.isCanceled() {
+			return report, fmt.Errorf("gc: %w", ErrCanceled)
+		}
+		report.Chunks++
+		report.Bytes += size
+		if !policy.DryRun {
+			if err := S.fs().Remove(filepath.Join(S.chunkDir(), hash)); err != nil {
+				return report, fmt.Errorf("gc: %w", err)
+			}
+		}
+		op.step()
+	}
+	return report, nil
+}
+
+// pruneHistory removes the history directories containing the entry
+// at the given path which were left empty.
+func (S *Store) pruneHistory(path string) {
+	root := S.historyDir()
+	for dir := filepath.Dir(path); len(dir) > len(root); dir = filepath.Dir(dir) {
+		if S.fs().Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// prunedPath returns the path to the record of the newest version of the
+// file removed by GC.
+func (S *Store) prunedPath(file string) string {
+	return filepath.Join(S.historyDir(), ".pruned", filepath.FromSlash(normalizeName(file, false)))
+}
+
+// Pruned returns the generation of the newest version of the file which
+// GC removed, or 0 if none was. Applications can use it to show that the
+// history of the file doesn't go back to its beginning. Older versions may
+// still exist, if they are pinned or channels point at them.
+func (S *Store) Pruned(file string) (uint64, error) {
+	b, err := readFile(S.fs(), S.prunedPath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("pruned %s: %w", file, err)
+	}
+	g, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("pruned %s: %w", file, err)
+	}
+	return g, nil
+}
+
+// markPruned records that GC removed the given version of the file,
+// unless a newer one is already recorded. Failures are ignored, as the
+// record is only informative.
+func (S *Store) markPruned(file string, generation uint64) {
+	if g, err := S.Pruned(file); err == nil && g >= generation {
+		return
+	}
+	path := S.prunedPath(file)
+	if S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()) != nil {
+		return
+	}
+	writeFile(S.fs(), path, []byte(strconv.FormatUint(generation, 10)+"\n"), S.filePerm())
+}
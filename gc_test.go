@@ -0,0 +1,213 @@
+package atylar
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createGCStore creates a store with versions 1 to 3 of `a`, version 4 of
+// `dir/b` and version 5 of `c`, each 10 bytes large. Version g is 10-g days old.
+func createGCStore(t *testing.T) string {
+	d := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(d, ".history", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a@1", "a@2", "a@3", "dir/b@4", "c@5"} {
+		path := filepath.Join(d, ".history", filepath.FromSlash(name))
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", 10)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-time.Duration(9-i) * 24 * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+func TestGC(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		removed []string
+	}{
+		{"No policy", RetentionPolicy{}, []string{}},
+		{"Keep last", RetentionPolicy{KeepLast: 1}, []string{"a@1", "a@2"}},
+		{"Keep younger", RetentionPolicy{KeepYoungerThan: 6*24*time.Hour + time.Hour}, []string{"a@1", "a@2", "a@3"}},
+		{"Keep either", RetentionPolicy{KeepLast: 2, KeepYoungerThan: 24 * time.Hour}, []string{"a@1"}},
+		{"Max bytes", RetentionPolicy{MaxBytes: 25}, []string{"a@1", "a@2", "a@3"}},
+		{"Keep last and max bytes", RetentionPolicy{KeepLast: 2, MaxBytes: 30}, []string{"a@1", "a@2"}},
+		{"Dry run", RetentionPolicy{KeepLast: 1, DryRun: true}, []string{"a@1", "a@2"}},
+		{"Everything", RetentionPolicy{MaxBytes: 1}, []string{"a@1", "a@2", "a@3", "dir/b@4", "c@5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := createGCStore(t)
+			S := Store{Directory: d, Generation: 5}
+			report, err := S.GC(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(report.Versions)
+			sort.Strings(tt.removed)
+			if strings.Join(report.Versions, " ") != strings.Join(tt.removed, " ") {
+				t.Error("Got", report.Versions, "but expected", tt.removed)
+			}
+			if report.Bytes != int64(10*len(tt.removed)) {
+				t.Error("Got", report.Bytes, "bytes but expected", 10*len(tt.removed))
+			}
+			for _, name := range []string{"a@1", "a@2", "a@3", "dir/b@4", "c@5"} {
+				_, err := os.Stat(filepath.Join(d, ".history", filepath.FromSlash(name)))
+				wasRemoved := false
+				for _, r := range tt.removed {
+					wasRemoved = wasRemoved || r == name
+				}
+				if exists := err == nil; exists == (wasRemoved && !tt.policy.DryRun) {
+					t.Error("Got", err, "for", name)
+				}
+			}
+		})
+	}
+}
+
+func TestGCPrunesDirectories(t *testing.T) {
+	d := createGCStore(t)
+	S := Store{Directory: d, Generation: 5}
+	if _, err := S.GC(RetentionPolicy{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d, ".history", "dir")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the empty history directory to be removed but got", err)
+	}
+}
+
+func TestGCChunks(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, ".history"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	S := Store{Directory: d, ChunkThreshold: 1}
+	v1 := randomBytes(4, 3<<20)
+	v2 := append([]byte{}, v1...)
+	copy(v2[2<<20:], "a small change near the end")
+	for _, v := range [][]byte{v1, v2} {
+		if err := os.WriteFile(filepath.Join(d, "big"), v, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := S.recordHistory("big"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A chunk left behind by an interrupted capture.
+	if err := os.WriteFile(filepath.Join(S.chunkDir(), "orphan"), []byte("lost"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := S.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := S.GC(RetentionPolicy{KeepLast: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Versions) != 1 || report.Versions[0] != "big@1" {
+		t.Error("Expected [big@1] but got", report.Versions)
+	}
+	if report.Chunks < 2 {
+		t.Error("Expected the orphan and the changed chunk to be removed but got", report.Chunks)
+	}
+	after, err := S.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed := before.HistoryBytes - after.HistoryBytes; freed != report.Bytes {
+		t.Error("Got", report.Bytes, "bytes in the report but", freed, "were freed")
+	}
+
+	f, err := S.Open("big", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, v2) {
+		t.Error("Content of the remaining version doesn't match")
+	}
+}
+
+func TestPruned(t *testing.T) {
+	d := createGCStore(t)
+	S := Store{Directory: d, Generation: 5}
+	if g, err := S.Pruned("a"); err != nil || g != 0 {
+		t.Error("Got", g, err, "but expected", 0)
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 2, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if g, err := S.Pruned("a"); err != nil || g != 0 {
+		t.Error("Got", g, err, "but expected nothing marked by a dry run")
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.GC(RetentionPolicy{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]uint64{"a": 3, "dir/b": 4, "c": 5, "d": 0} {
+		if g, err := S.Pruned(name); err != nil || g != expected {
+			t.Error("Got", g, err, "for", name, "but expected", expected)
+		}
+	}
+}
+
+func TestGCProgress(t *testing.T) {
+	b := &removeBackend{Backend: NewMemoryBackend()}
+	S, err := New("store", WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Progress is recorded as every version is removed.
+	var done []int64
+	b.onRemove = func() {
+		if ops := S.Operations(); len(ops) == 1 && ops[0].Total != 0 {
+			done = append(done, ops[0].Done)
+		}
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1}); err != nil {
+		t.Fatal(err)
+	}
+	b.onRemove = nil
+	if len(done) == 0 || done[0] != 0 || done[len(done)-1] != 1 {
+		t.Error("Got", done, "done when removing the versions but expected it to count them")
+	}
+}
+
+// removeBackend calls onRemove before removing files.
+type removeBackend struct {
+	Backend
+	onRemove func()
+}
+
+func (b *removeBackend) Remove(name string) error {
+	if b.onRemove != nil {
+		b.onRemove()
+	}
+	return b.Backend.Remove(name)
+}
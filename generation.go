@@ -0,0 +1,140 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The generation counter is persisted in `.history/.generation`, so that
+// opening a store doesn't need to scan the whole history, and generations
+// of versions removed by GC are never assigned again. While the store is
+// open, the file holds a limit a bit above the current generation, which
+// is raised before any generation beyond it is assigned, so a crash only
+// skips some generations. Close records the exact value.
+
+// generationBlock is the number of generations the counter file is raised
+// by at once.
+const generationBlock = 64
+
+// counter is the state of the counter file of a store opened with New.
+type counter struct {
+	mu    sync.Mutex
+	limit uint64 // Generations up to this one are covered by the file
+}
+
+// generationPath returns the path to the counter file.
+func (S *Store) generationPath() string {
+	return filepath.Join(S.historyDir(), ".generation")
+}
+
+// readGeneration reads the counter file.
+func (S *Store) readGeneration() (uint64, error) {
+	return readNumber(S.fs(), S.generationPath())
+}
+
+// writeGeneration atomically replaces the counter file.
+func (S *Store) writeGeneration(generation uint64) error {
+	return S.writeNumber(S.generationPath(), generation)
+}
+
+// readNumber reads a metadata file holding a single number.
+func readNumber(fsys Backend, path string) (uint64, error) {
+	b, err := readFile(fsys, path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// writeNumber atomically replaces a metadata file holding a single number.
+func (S *Store) writeNumber(path string, n uint64) error {
+	tmp, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(S.filePerm()); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if _, err := tmp.WriteString(strconv.FormatUint(n, 10) + "\n"); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := S.fs().Rename(tmp.Name(), path); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	return S.syncDir(filepath.Dir(path))
+}
+
+// loadGeneration sets the generation from the counter file, falling back
+// to the highest generation present in the history if it's missing.
+func (S *Store) loadGeneration() error {
+	g, err := S.readGeneration()
+	if errors.Is(err, os.ErrNotExist) && S.index != nil {
+		g = S.index.max()
+	} else if errors.Is(err, os.ErrNotExist) {
+		return S.initGeneration()
+	} else if err != nil {
+		return err
+	}
+	if g > S.Generation {
+		S.Generation = g
+	}
+	return nil
+}
+
+// persistGeneration raises the limit in the counter file, if needed, so that
+// it covers the given generation. If the file can't be written, it's removed,
+// so that the next time the store is opened, the history is scanned instead
+// of trusting an outdated value.
+func (S *Store) persistGeneration(generation uint64) {
+	c := S.counter
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation <= c.limit {
+		return
+	}
+	limit := (generation/generationBlock + 1) * generationBlock
+	if err := S.writeGeneration(limit); err != nil {
+		S.fs().Remove(S.generationPath())
+		return
+	}
+	c.limit = limit
+}
+
+// saveGeneration records the exact current generation in the counter file.
+func (S *Store) saveGeneration() error {
+	c := S.counter
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	g := atomic.LoadUint64(&S.Generation)
+	if err := S.writeGeneration(g); err != nil {
+		S.fs().Remove(S.generationPath())
+		return err
+	}
+	c.limit = g
+	return nil
+}
@@ -0,0 +1,68 @@
+package atylar
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGenerationFile(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, err := S.readGeneration(); err != nil || g != generationBlock {
+		t.Error("Got", g, err, "but expected the limit", generationBlock)
+	}
+	if _, err := S.GC(RetentionPolicy{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g, err := S.readGeneration(); err != nil || g != 2 {
+		t.Error("Got", g, err, "but expected", 2)
+	}
+
+	// Versions removed by GC don't lower the generation.
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := S.GetGeneration(false); g != 2 {
+		t.Error("Got", g, "but expected", 2)
+	}
+	if g := S.ReserveGenerations(generationBlock); g != 3 {
+		t.Error("Got", g, "but expected", 3)
+	}
+	if g, err := S.readGeneration(); err != nil || g != 2*generationBlock {
+		t.Error("Got", g, err, "but expected the limit", 2*generationBlock)
+	}
+	if err := S.WriteFile("file", []byte("four")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the file, the history is scanned.
+	if err := os.Remove(S.generationPath()); err != nil {
+		t.Fatal(err)
+	}
+	S, err = NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if g := S.GetGeneration(false); g != generationBlock+3 {
+		t.Error("Got", g, "but expected", generationBlock+3)
+	}
+	if _, err := os.Stat(S.generationPath()); !os.IsNotExist(err) {
+		t.Error("Expected the read-only store not to create the file but got", err)
+	}
+}
@@ -0,0 +1,165 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The process holding a store opened with New records itself in
+// `.history/.holder`, so that others can find out who holds the store
+// when New fails with ErrLocked. The file is separate from the lock file,
+// as locked files can't be read on all platforms.
+
+// LockInfo describes a holder of a lock, see Locks and Holder.
+type LockInfo struct {
+	Name     string    // Locked file, or "" for the whole store
+	PID      int       // Process holding the lock
+	Hostname string    // Host of the process
+	Acquired time.Time // When the lock was acquired
+}
+
+// holderPath returns the path to the record of the holder of the store.
+func (S *Store) holderPath() string {
+	return filepath.Join(S.historyDir(), ".holder")
+}
+
+// writeHolder records this process as the holder of the store.
+func (S *Store) writeHolder() error {
+	host, _ := os.Hostname()
+	S.holder = LockInfo{PID: os.Getpid(), Hostname: host, Acquired: time.Now().UTC().Round(0)}
+	b, err := json.Marshal(S.holder)
+	if err != nil {
+		return err
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Rename(tmp, S.holderPath()); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readHolder reads the record of the holder of the store.
+func (S *Store) readHolder() (LockInfo, error) {
+	var info LockInfo
+	b, err := readFile(S.fs(), S.holderPath())
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(b, &info)
+	return info, err
+}
+
+// Locks returns the lock of the store held by this store, if it was
+// opened with New, followed by the locks of files held by operations
+// in progress, sorted by name.
+func (S *Store) Locks() []LockInfo {
+	held := []LockInfo{}
+	if S.lockHandle != nil && !S.readOnly {
+		held = append(held, S.holder)
+	}
+	for _, l := range S.locks.heldFiles() {
+		l.PID, l.Hostname = S.holder.PID, S.holder.Hostname
+		if l.PID == 0 {
+			l.PID = os.Getpid()
+			l.Hostname, _ = os.Hostname()
+		}
+		held = append(held, l)
+	}
+	return held
+}
+
+// Holder returns the holder of the store in the given directory, opened
+// with New by another process. If the store isn't held, the error wraps
+// ErrNotExist. If it's held but the holder didn't record itself, e.g. an
+// older version of the package, the returned LockInfo is empty. Of the
+// options, only WithHistoryDir has any effect.
+func Holder(root string, opts ...Option) (LockInfo, error) {
+	S := Store{Directory: root}
+	if err := S.apply(opts); err != nil {
+		return LockInfo{}, fmt.Errorf("holder %s: %w", root, err)
+	}
+	held, err := S.held()
+	if err != nil {
+		return LockInfo{}, fmt.Errorf("holder %s: %w", root, err)
+	}
+	if !held {
+		return LockInfo{}, fmt.Errorf("holder %s: %w", root, ErrNotExist)
+	}
+	info, err := S.readHolder()
+	if errors.Is(err, os.ErrNotExist) {
+		return LockInfo{}, nil
+	} else if err != nil {
+		return LockInfo{}, fmt.Errorf("holder %s: %w", root, err)
+	}
+	return info, nil
+}
+
+// held reports whether another process holds the lock of the store.
+func (S *Store) held() (bool, error) {
+	f, err := S.fs().Open(S.lockPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	err = flock(f, false)
+	if errors.Is(err, ErrLocked) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	funlock(f)
+	return false, nil
+}
+
+// ForceUnlock cleans up the lock of the store in the given directory after
+// its holder crashed. If the lock isn't held anymore, only the stale record
+// of the holder is removed. If it's still held, e.g. by a child process
+// which inherited it, it's only broken if the holder recorded itself on
+// this host and its process doesn't exist, and fails with ErrLocked
+// otherwise. Breaking the lock removes the lock file and increments the
+// epoch, so the former holder is fenced off if it's still running. Of the
+// options, only WithHistoryDir, WithFileMode, WithDirMode and WithBackend
+// have any effect.
+func ForceUnlock(root string, opts ...Option) error {
+	S := Store{Directory: root}
+	if err := S.apply(opts); err != nil {
+		return fmt.Errorf("forceUnlock %s: %w", root, err)
+	}
+	held, err := S.held()
+	if err != nil {
+		return fmt.Errorf("forceUnlock %s: %w", root, err)
+	}
+	if held {
+		info, err := S.readHolder()
+		if err != nil {
+			return fmt.Errorf("forceUnlock %s: holder unknown: %w", root, ErrLocked)
+		}
+		host, _ := os.Hostname()
+		if info.Hostname != host {
+			return fmt.Errorf("forceUnlock %s: held on %s: %w", root, info.Hostname, ErrLocked)
+		}
+		if processAlive(info.PID) {
+			return fmt.Errorf("forceUnlock %s: held by running process %d: %w", root, info.PID, ErrLocked)
+		}
+		if err := S.takeEpoch(); err != nil {
+			return fmt.Errorf("forceUnlock %s: %w", root, err)
+		}
+		if err := S.fs().Remove(S.lockPath()); err != nil {
+			return fmt.Errorf("forceUnlock %s: %w", root, err)
+		}
+	}
+	if err := S.fs().Remove(S.holderPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("forceUnlock %s: %w", root, err)
+	}
+	return nil
+}
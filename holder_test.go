@@ -0,0 +1,95 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLocks(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock := S.lock("file", "dir/file")
+	locks := S.Locks()
+	unlock()
+	if len(locks) != 3 {
+		t.Fatal("Got", locks, "but expected the store and 2 files")
+	}
+	for i, name := range []string{"", "dir/file", "file"} {
+		if locks[i].Name != name || locks[i].PID != os.Getpid() || locks[i].Acquired.IsZero() {
+			t.Error("Got", locks[i], "but expected", name, "held by this process")
+		}
+	}
+	if locks := S.Locks(); len(locks) != 1 {
+		t.Error("Got", locks, "after unlocking the files")
+	}
+
+	info, err := Holder(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != S.holder {
+		t.Error("Got", info, "but expected", S.holder)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Holder(d); !errors.Is(err, ErrNotExist) {
+		t.Error("Got", err, "but expected", ErrNotExist)
+	}
+	if _, err := os.Stat(S.holderPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the holder record to be removed but got", err)
+	}
+}
+
+func TestForceUnlock(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := ForceUnlock(d); !errors.Is(err, ErrLocked) {
+		t.Error("Got", err, "but expected", ErrLocked, "while the holder is running")
+	}
+
+	// The recorded holder crashed, but the lock is still held.
+	crashed := S.holder
+	crashed.PID = 1 << 30
+	b, err := json.Marshal(crashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(S.holderPath(), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ForceUnlock(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("stale")); !errors.Is(err, ErrFenced) {
+		t.Error("Got", err, "but expected", ErrFenced)
+	}
+	N, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer N.Close()
+
+	// A stale record is removed without breaking anything.
+	if err := N.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(S.holderPath(), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ForceUnlock(d); err != nil {
+		t.Error("Got", err)
+	}
+	if _, err := os.Stat(S.holderPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the stale record to be removed but got", err)
+	}
+}
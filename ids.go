@@ -0,0 +1,101 @@
+package atylar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// IDKind is the kind of identifier an IDGenerator is asked for.
+type IDKind int
+
+const (
+	// IDShare is the token of a share, which grants access to a file,
+	// so it must be unguessable.
+	IDShare IDKind = iota
+	// IDReservation identifies a reservation made by Reserve.
+	IDReservation
+	// IDSnapshot is the label of a snapshot taken by NewSnapshot.
+	IDSnapshot
+)
+
+// IDGenerator creates the identifiers of shares, reservations and
+// snapshots. Identifiers are used as file names in the history directory,
+// so they mustn't be empty, begin with a dot or contain slashes,
+// backslashes or control characters. Generators must be safe for
+// concurrent use.
+type IDGenerator interface {
+	NewID(kind IDKind) (string, error)
+}
+
+// IDFunc adapts a function to the IDGenerator interface.
+type IDFunc func(kind IDKind) (string, error)
+
+// NewID calls f.
+func (f IDFunc) NewID(kind IDKind) (string, error) {
+	return f(kind)
+}
+
+// RandomIDs returns the default IDGenerator, which hex-encodes bytes read
+// from crypto/rand: 32 for share tokens and 16 for other identifiers.
+func RandomIDs() IDGenerator {
+	return IDFunc(randomID)
+}
+
+// randomID implements RandomIDs.
+func randomID(kind IDKind) (string, error) {
+	n := 16
+	if kind == IDShare {
+		n = 32
+	}
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WithIDGenerator sets the generator of identifiers of shares,
+// reservations and snapshots, RandomIDs by default, so that deployments
+// can use their own entropy sources and formats.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(o *options) error {
+		if g == nil {
+			return fmt.Errorf("withIDGenerator: no generator")
+		}
+		o.ids = g
+		return nil
+	}
+}
+
+// validID reports whether the identifier can be used as a file name in
+// the history directory.
+func validID(id string) bool {
+	if id == "" || len(id) > 255 || strings.HasPrefix(id, ".") {
+		return false
+	}
+	for _, c := range id {
+		if c == '/' || c == '\\' || c < ' ' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a new identifier of the given kind from the configured
+// generator. Invalid identifiers are reported as ErrInvalidName.
+func (S *Store) newID(kind IDKind) (string, error) {
+	g := S.ids
+	if g == nil {
+		g = RandomIDs()
+	}
+	id, err := g.NewID(kind)
+	if err != nil {
+		return "", err
+	}
+	if !validID(id) {
+		return "", fmt.Errorf("generated identifier %q: %w", id, ErrInvalidName)
+	}
+	return id, nil
+}
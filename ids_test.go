@@ -0,0 +1,103 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequentialIDs generates predictable identifiers, like "share-1".
+type sequentialIDs struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (g *sequentialIDs) NewID(kind IDKind) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return fmt.Sprintf("%s-%d", []string{"share", "reservation", "snapshot"}[kind], g.n), nil
+}
+
+func TestIDGenerator(t *testing.T) {
+	S, err := New(createMockStore(t), WithIDGenerator(&sequentialIDs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	s, err := S.CreateShare("file", 0, time.Time{})
+	if err != nil || s.Token != "share-1" {
+		t.Error("Got", s.Token, err, "but expected share-1")
+	}
+	if shared, err := S.Shared("share-1"); err != nil || shared != s {
+		t.Error("Got", shared, err, "but expected", s)
+	}
+	r, err := S.Reserve("upload", time.Hour)
+	if err != nil || r.ID != "reservation-2" {
+		t.Error("Got", r.ID, err, "but expected reservation-2")
+	}
+	label, g, err := S.NewSnapshot()
+	if err != nil || label != "snapshot-3" {
+		t.Error("Got", label, err, "but expected snapshot-3")
+	}
+	if snapshots, err := S.Snapshots(); err != nil || len(snapshots) != 1 || snapshots[0].Label != label || snapshots[0].Generation != g {
+		t.Error("Got", snapshots, err, "but expected the snapshot", label, g)
+	}
+}
+
+func TestIDGeneratorInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		err      error
+		expected error
+	}{
+		{"Empty", "", nil, ErrInvalidName},
+		{"Path", "../file", nil, ErrInvalidName},
+		{"Hidden", ".id", nil, ErrInvalidName},
+		{"Failure", "", os.ErrPermission, os.ErrPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := IDFunc(func(IDKind) (string, error) { return tt.id, tt.err })
+			S, err := New(createMockStore(t), WithIDGenerator(ids))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			if _, err := S.CreateShare("file", 0, time.Time{}); !errors.Is(err, tt.expected) {
+				t.Error("Got", err, "but expected", tt.expected)
+			}
+			if _, _, err := S.NewSnapshot(); !errors.Is(err, tt.expected) {
+				t.Error("Got", err, "but expected", tt.expected)
+			}
+		})
+	}
+	if _, err := New(createMockStore(t), WithIDGenerator(nil)); err == nil {
+		t.Error("Expected a missing generator to be rejected")
+	}
+}
+
+func TestNewSnapshotTaken(t *testing.T) {
+	ids := IDFunc(func(IDKind) (string, error) { return "same", nil })
+	S, err := New(createMockStore(t), WithIDGenerator(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if _, _, err := S.NewSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := S.NewSnapshot(); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	if _, err := S.CreateShare("file", 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.CreateShare("file", 0, time.Time{}); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+}
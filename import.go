@@ -0,0 +1,128 @@
+package atylar
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ImportDirectory creates a new store at root, which mustn't exist or must
+// be an empty directory, from the regular files in the directory tree at
+// src, and opens it with New. Names are normalized, and each file is
+// written like with Overwrite and then captured to history under its own
+// generation, with its modification time preserved, so the store starts
+// with a version of every file. Other entries, like symlinks, are skipped,
+// and so is root if it's inside src. If two names normalize to the same
+// one, it fails with an error wrapping os.ErrExist. If it fails, whatever
+// it created is removed.
+func ImportDirectory(src, root string, opts ...Option) (Store, error) {
+	S, err := createStore(root, opts, func(S *Store) error { return S.importDirectory(src, root) })
+	if err != nil {
+		return S, fmt.Errorf("importDirectory %s: %w", src, err)
+	}
+	return S, nil
+}
+
+// importDirectory fills the new store with the files of src.
+func (S *Store) importDirectory(src, root string) error {
+	op, end := S.begin("importDirectory")
+	defer end()
+	defer S.lockStore()()
+	skip, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]string) // Source paths by normalized names
+	err = filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		name := normalizeName(rel, false)
+		if name == "" {
+			return fmt.Errorf("%s: %w", rel, ErrInvalidName)
+		}
+		if other, ok := files[name]; ok {
+			return fmt.Errorf("%s and %s are both named %s: %w", other, path, name, os.ErrExist)
+		}
+		files[name] = path
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	op.progress(0, int64(len(names)))
+	for _, name := range names {
+		if op.isCanceled() {
+			return ErrCanceled
+		}
+		if err := S.importFile(name, files[name]); err != nil {
+			return fmt.Errorf("%s: %w", files[name], err)
+		}
+		op.step()
+	}
+	return nil
+}
+
+// importFile writes the file at path to the store under the given name
+// and captures it to history.
+func (S *Store) importFile(name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Chmod(S.filePerm()); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := S.encodeFile(name, tmp.Name()); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := S.commit(name, tmp.Name(), nil); err != nil {
+		return err
+	}
+	if err := S.fs().Chtimes(S.filePath(name, false), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return S.recordHistory(name)
+}
@@ -0,0 +1,79 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestImportDirectory(t *testing.T) {
+	src := t.TempDir()
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for name, content := range map[string]string{"a": "first", "dir/b@c": "second", "dir/sub/d": "third"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(filepath.Join(src, "a"), filepath.Join(src, "link"))
+	S, err := ImportDirectory(src, filepath.Join(src, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	expected := map[string]string{"a": "first", "dir/b_c": "second", "dir/sub/d": "third"}
+	files, err := S.List(false)
+	if err != nil || len(files) != len(expected) {
+		t.Error("Got", files, err, "but expected", expected)
+	}
+	generations := make(map[uint64]bool)
+	for name, content := range expected {
+		if b, err := S.ReadFile(name, 0); err != nil || string(b) != content {
+			t.Error("Got", string(b), err, "for", name, "but expected", content)
+		}
+		versions, err := S.HistoryInfo(name)
+		if err != nil || len(versions) != 1 {
+			t.Fatal("Got", versions, err, "for", name, "but expected a single version")
+		}
+		if !versions[0].ModTime.Equal(mtime) {
+			t.Error("Got", versions[0].ModTime, "for", name, "but expected", mtime)
+		}
+		generations[versions[0].Generation] = true
+	}
+	if len(generations) != len(expected) {
+		t.Error("Got generations", generations, "but expected one for each file")
+	}
+}
+
+func TestImportDirectoryConflict(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a@b", "a_b"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := filepath.Join(t.TempDir(), "store")
+	if _, err := ImportDirectory(src, root); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	if _, err := os.Stat(root); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected the store to be removed")
+	}
+	entries, _ := os.ReadDir(src)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if expected := []string{"a@b", "a_b"}; !reflect.DeepEqual(names, expected) {
+		t.Error("Got", names, "but expected the source to be unchanged", expected)
+	}
+}
@@ -0,0 +1,172 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// index is the in-memory index of the history of a store opened with New,
+// which spares History reading the history directory on every call.
+// It's built when the store is opened and updated when versions are
+// captured or removed. With WithPersistentIndex, it's saved to
+// `.history/.index` by Close and loaded from there by the next New, which
+// removes the file while the store is open, so that an index which may be
+// outdated after a crash is never loaded.
+type index struct {
+	mu    sync.RWMutex
+	files map[string][]uint64 // Generations of each file, newest first
+}
+
+// indexPath returns the path to the persisted index.
+func (S *Store) indexPath() string {
+	return filepath.Join(S.historyDir(), ".index")
+}
+
+// buildIndex indexes the history directory.
+func (S *Store) buildIndex() (*index, error) {
+	x := &index{files: make(map[string][]uint64)}
+	err := S.walkFiles(true, func(name string, _ fs.DirEntry) error {
+		if file, g := parseVersion(name); g != 0 {
+			x.files[file] = append(x.files[file], g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, generations := range x.files {
+		sort.Slice(generations, func(i, j int) bool { return generations[i] > generations[j] })
+	}
+	return x, nil
+}
+
+// openIndex loads the persisted index, if enabled and present, or builds it.
+func (S *Store) openIndex() error {
+	if S.persistIndex {
+		b, err := readFile(S.fs(), S.indexPath())
+		if err == nil {
+			x := &index{files: make(map[string][]uint64)}
+			if err := json.Unmarshal(b, &x.files); err != nil {
+				return fmt.Errorf("openIndex: %w", err)
+			}
+			if !S.readOnly {
+				if err := S.fs().Remove(S.indexPath()); err != nil {
+					return fmt.Errorf("openIndex: %w", err)
+				}
+			}
+			S.index = x
+			return nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("openIndex: %w", err)
+		}
+	}
+	x, err := S.buildIndex()
+	if err != nil {
+		return fmt.Errorf("openIndex: %w", err)
+	}
+	S.index = x
+	return nil
+}
+
+// saveIndex persists the index, if enabled.
+func (S *Store) saveIndex() error {
+	x := S.index
+	if x == nil || !S.persistIndex {
+		return nil
+	}
+	x.mu.RLock()
+	b, err := json.Marshal(x.files)
+	x.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := S.fs().CreateTemp(S.historyDir(), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		S.fs().Remove(tmp.Name())
+		return err
+	}
+	return S.fs().Rename(tmp.Name(), S.indexPath())
+}
+
+// get returns the generations of the file, newest first.
+func (x *index) get(file string) []uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return append([]uint64{}, x.files[file]...)
+}
+
+// newest returns the newest generation of the file, 0 if it has none.
+func (x *index) newest(file string) uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if generations := x.files[file]; len(generations) != 0 {
+		return generations[0]
+	}
+	return 0
+}
+
+// add records a new version of the file.
+func (x *index) add(file string, generation uint64) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	generations := x.files[file]
+	i := sort.Search(len(generations), func(i int) bool { return generations[i] <= generation })
+	if i < len(generations) && generations[i] == generation {
+		return
+	}
+	generations = append(generations, 0)
+	copy(generations[i+1:], generations[i:])
+	generations[i] = generation
+	x.files[file] = generations
+}
+
+// remove forgets a removed version of the file.
+func (x *index) remove(file string, generation uint64) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	generations := x.files[file]
+	for i, g := range generations {
+		if g == generation {
+			generations = append(generations[:i], generations[i+1:]...)
+			break
+		}
+	}
+	if len(generations) == 0 {
+		delete(x.files, file)
+	} else {
+		x.files[file] = generations
+	}
+}
+
+// max returns the highest indexed generation.
+func (x *index) max() uint64 {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	var max uint64
+	for _, generations := range x.files {
+		if len(generations) != 0 && generations[0] > max {
+			max = generations[0]
+		}
+	}
+	return max
+}
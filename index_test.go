@@ -0,0 +1,101 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("dir/file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		file     string
+		expected []uint64
+	}{
+		{"file", []uint64{123}},
+		{"dir/file", []uint64{125, 124}},
+		{"missing", []uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			h, err := S.History(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(h, tt.expected) {
+				t.Error("Got", h, "but expected", tt.expected)
+			}
+			x, err := S.buildIndex()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := x.get(tt.file); !reflect.DeepEqual(got, tt.expected) {
+				t.Error("Got", got, "from the directory but expected", tt.expected)
+			}
+		})
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := S.History("dir/file"); !reflect.DeepEqual(h, []uint64{125}) {
+		t.Error("Got", h, "but expected", []uint64{125})
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.indexPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected no persisted index but got", err)
+	}
+}
+
+func TestPersistentIndex(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d, WithPersistentIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The persisted index is trusted, even if the history directory differs.
+	if err := os.WriteFile(S.versionPath("file", 10), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	S, err = New(d, WithPersistentIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.indexPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the index to be removed while the store is open but got", err)
+	}
+	if h, _ := S.History("file"); !reflect.DeepEqual(h, []uint64{124, 123}) {
+		t.Error("Got", h, "but expected", []uint64{124, 123})
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the option, the directory is read.
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if h, _ := S.History("file"); !reflect.DeepEqual(h, []uint64{124, 123, 10}) {
+		t.Error("Got", h, "but expected", []uint64{124, 123, 10})
+	}
+}
@@ -0,0 +1,96 @@
+//go:build go1.23
+
+package atylar
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"path"
+	"path/filepath"
+)
+
+// Files returns an iterator over the live files in the store, including
+// those in subdirectories. Directories are read in small batches, so
+// breaking out of the loop early avoids reading the rest of them. A read
+// error is yielded once and ends the iteration.
+func (S *Store) Files() iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		pending := []string{""}
+		for len(pending) != 0 {
+			dir := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			subdirs, ok := S.files(dir, yield)
+			if !ok {
+				return
+			}
+			pending = append(pending, subdirs...)
+		}
+	}
+}
+
+// files yields the files in the given directory, named relative to the store
+// root, and returns its subdirectories. It returns false if the iteration
+// should stop.
+func (S *Store) files(dir string, yield func(Entry, error) bool) ([]string, bool) {
+	d, err := S.fs().Open(filepath.Join(S.Directory, filepath.FromSlash(dir)))
+	if err != nil {
+		yield(Entry{}, fmt.Errorf("files: %w", err))
+		return nil, false
+	}
+	defer d.Close()
+	subdirs := []string{}
+	for {
+		entries, err := d.ReadDir(64)
+		for _, entry := range entries {
+			if dir == "" && entry.Name() == S.historyName() {
+				continue
+			}
+			name := path.Join(dir, entry.Name())
+			if entry.IsDir() {
+				subdirs = append(subdirs, name)
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				if !yield(Entry{}, fmt.Errorf("files: %w", err)) {
+					return nil, false
+				}
+				continue
+			}
+			if !yield(Entry{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil) {
+				return nil, false
+			}
+		}
+		if err == io.EOF {
+			return subdirs, true
+		} else if err != nil {
+			yield(Entry{}, fmt.Errorf("files: %w", err))
+			return nil, false
+		}
+	}
+}
+
+// Versions returns an iterator over the historic versions of the given file,
+// starting from the newest. The name is normalized.
+func (S *Store) Versions(file string) iter.Seq2[Version, error] {
+	return func(yield func(Version, error) bool) {
+		generations, err := S.History(file)
+		if err != nil {
+			yield(Version{}, fmt.Errorf("versions %s: %w", file, err))
+			return
+		}
+		for _, g := range generations {
+			v, err := S.versionInfo(file, g)
+			if err != nil {
+				if !yield(Version{}, fmt.Errorf("versions %s: %w", file, err)) {
+					return
+				}
+				continue
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
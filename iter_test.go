@@ -0,0 +1,68 @@
+//go:build go1.23
+
+package atylar
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d}
+	if err := os.MkdirAll(filepath.Join(d, "dir", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "dir", "sub", "file3"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for e, err := range S.Files() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, e.Name)
+		if e.Name == "file" && e.Size != 6 {
+			t.Error("Got size", e.Size, "but expected", 6)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 3 || names[0] != "dir/sub/file3" || names[1] != "file" || names[2] != "file2" {
+		t.Error("Expected [dir/sub/file3 file file2] but got", names)
+	}
+
+	n := 0
+	for range S.Files() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Error("Expected the iteration to stop after", 1, "entry but got", n)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	d := t.TempDir()
+	if err := os.Mkdir(filepath.Join(d, ".history"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, ".history", "abc@12"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, ".history", "abc@14"), []byte("v02"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	S := Store{Directory: d}
+	versions := []Version{}
+	for v, err := range S.Versions("abc") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, v)
+	}
+	if len(versions) != 2 || versions[0].Generation != 14 || versions[0].Size != 3 || versions[1].Generation != 12 || versions[1].Size != 2 {
+		t.Error("Expected generations 14 (3 bytes) and 12 (2 bytes) but got", versions)
+	}
+}
@@ -0,0 +1,136 @@
+package atylar
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// locks serializes operations of a store opened with New. Every operation
+// holds the store lock for reading and the locks of the files it modifies,
+// while operations on the store as a whole, like GC, hold it for writing.
+// Modifications also hold the writes lock for reading, which Freeze holds
+// for writing to suspend them without blocking reads.
+type locks struct {
+	writes   sync.RWMutex
+	store    sync.RWMutex
+	mu       sync.Mutex // Guards files, frozen, draining and pending
+	files    map[string]*fileLock
+	frozen   bool
+	draining bool       // Set by Drain
+	pending  int        // Open writers and transactions, see drain.go
+	changes  sync.Mutex // Held along with file locks with the change log, see change.go
+}
+
+// fileLock is the lock of a single file, removed from the set
+// once nobody holds or waits for it.
+type fileLock struct {
+	sync.Mutex
+	refs     int
+	held     bool      // Guarded by locks.mu, like refs
+	acquired time.Time // When it was last acquired, if held
+}
+
+func newLocks() *locks {
+	return &locks{files: make(map[string]*fileLock)}
+}
+
+// lock acquires the store lock for reading and the locks of the given files,
+// and returns a function which releases them. Files are locked in order of
+// their normalized names, so concurrent calls can't deadlock. With the change
+// log, modifications are serialized by the changes lock, taken after the file
+// locks, so that changes are logged in the order of their generations. Stores
+// which weren't opened with New have no locks, and then it does nothing.
+func (S *Store) lock(files ...string) (unlock func()) {
+	l := S.locks
+	if l == nil {
+		return func() {}
+	}
+	names := make([]string, 0, len(files))
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if norm := normalizeName(file, false); !seen[norm] {
+			seen[norm] = true
+			names = append(names, norm)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) != 0 {
+		l.writes.RLock()
+	}
+	l.store.RLock()
+	held := make([]*fileLock, len(names))
+	for i, name := range names {
+		l.mu.Lock()
+		fl := l.files[name]
+		if fl == nil {
+			fl = &fileLock{}
+			l.files[name] = fl
+		}
+		fl.refs++
+		l.mu.Unlock()
+		fl.Lock()
+		l.mu.Lock()
+		fl.held, fl.acquired = true, time.Now()
+		l.mu.Unlock()
+		held[i] = fl
+	}
+	logged := len(names) != 0 && S.changeLog
+	if logged {
+		l.changes.Lock()
+	}
+	return func() {
+		if logged {
+			l.changes.Unlock()
+		}
+		for i := len(held) - 1; i >= 0; i-- {
+			l.mu.Lock()
+			held[i].held = false
+			l.mu.Unlock()
+			held[i].Unlock()
+			l.mu.Lock()
+			if held[i].refs--; held[i].refs == 0 {
+				delete(l.files, names[i])
+			}
+			l.mu.Unlock()
+		}
+		l.store.RUnlock()
+		if len(names) != 0 {
+			l.writes.RUnlock()
+		}
+	}
+}
+
+// lockStore acquires the store lock for writing, excluding all other
+// operations, and returns a function which releases it.
+func (S *Store) lockStore() (unlock func()) {
+	l := S.locks
+	if l == nil {
+		return func() {}
+	}
+	l.writes.Lock()
+	l.store.Lock()
+	return func() {
+		l.store.Unlock()
+		l.writes.Unlock()
+	}
+}
+
+// heldFiles returns the files whose locks are held, with the times they
+// were acquired, sorted by name.
+func (l *locks) heldFiles() []LockInfo {
+	if l == nil {
+		return []LockInfo{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	held := []LockInfo{}
+	for name, fl := range l.files {
+		if fl.held {
+			held = append(held, LockInfo{Name: name, Acquired: fl.acquired})
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return held[i].Name < held[j].Name })
+	return held
+}
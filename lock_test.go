@@ -0,0 +1,96 @@
+package atylar
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentOverwrite(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := S.Overwrite("file")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			fmt.Fprint(f, i)
+		}(i)
+	}
+	wg.Wait()
+	h, err := S.History("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]bool)
+	for _, g := range h {
+		if seen[g] {
+			t.Error("Generation", g, "was captured more than once")
+		}
+		seen[g] = true
+	}
+	if g := S.GetGeneration(false); g > writers {
+		t.Error("Got generation", g, "which is more than", writers, "writes")
+	}
+}
+
+func TestLockOrder(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			S.Copy("file", "file2")
+		}()
+		go func() {
+			defer wg.Done()
+			S.Copy("file2", "file")
+		}()
+	}
+	wg.Wait()
+	for _, name := range []string{"file", "file2"} {
+		if _, err := os.Stat(filepath.Join(d, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(S.locks.files) != 0 {
+		t.Error("Expected all file locks to be released but got", len(S.locks.files))
+	}
+}
+
+func TestGCExcludesWriters(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock := S.lockStore()
+	done := make(chan bool)
+	go func() {
+		S.Remove("file")
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Error("Expected Remove to wait for the store lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-done
+}
@@ -0,0 +1,118 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockPath returns the path to the file locked by processes using the store.
+func (S *Store) lockPath() string {
+	return filepath.Join(S.historyDir(), ".lock")
+}
+
+// acquire opens and locks the lock file of the store, exclusively unless
+// the store is read-only. Read-only stores never create the lock file, so
+// stores which were never opened with New aren't locked by them.
+func (S *Store) acquire() error {
+	var f File
+	var err error
+	if S.readOnly {
+		f, err = S.fs().Open(S.lockPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	} else {
+		f, err = S.fs().OpenFile(S.lockPath(), os.O_CREATE|os.O_RDWR, S.filePerm())
+	}
+	if err != nil {
+		return err
+	}
+	if err := flock(f, !S.readOnly); err != nil {
+		f.Close()
+		return err
+	}
+	S.lockHandle = f
+	if !S.readOnly {
+		if err := S.writeHolder(); err != nil {
+			funlock(f)
+			f.Close()
+			S.lockHandle = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the lock on the store, so that other processes can open it.
+// Modifications of the store fail with ErrClosed afterwards.
+func (S *Store) Close() error {
+	var err error
+	if S.writable() == nil {
+		err = S.saveGeneration()
+		if err == nil {
+			err = S.saveIndex()
+		}
+	}
+	S.closed = true
+	if S.lockHandle == nil {
+		if err != nil {
+			return fmt.Errorf("close: %w", err)
+		}
+		return nil
+	}
+	f := S.lockHandle
+	S.lockHandle = nil
+	if !S.readOnly {
+		if h, herr := S.readHolder(); herr == nil && h.PID == S.holder.PID && h.Acquired.Equal(S.holder.Acquired) {
+			S.fs().Remove(S.holderPath())
+		}
+	}
+	if err := funlock(f); err != nil {
+		f.Close()
+		return fmt.Errorf("close: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	return nil
+}
+
+// flock locks the file against other processes, exclusively or shared. Only
+// files of the operating system can be locked, others are left as they are,
+// see Backend.
+func flock(f File, exclusive bool) error {
+	if osf, ok := f.(*os.File); ok {
+		return lockFile(osf, exclusive)
+	}
+	return nil
+}
+
+// funlock releases the lock taken by flock.
+func funlock(f File) error {
+	if osf, ok := f.(*os.File); ok {
+		return unlockFile(osf)
+	}
+	return nil
+}
+
+// writable returns an error if the store can't be modified.
+func (S *Store) writable() error {
+	if S.closed {
+		return ErrClosed
+	}
+	if S.readOnly {
+		return ErrReadOnly
+	}
+	if err := S.checkEpoch(); err != nil {
+		return err
+	}
+	if S.locks.isDraining() {
+		return ErrDraining
+	}
+	return nil
+}
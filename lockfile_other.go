@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package atylar
+
+import "os"
+
+// lockFile does nothing, as there is no file locking on this platform.
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile does nothing, as there is no file locking on this platform.
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// processAlive reports that the process exists, as it can't be checked
+// on this platform.
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,92 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(d); !errors.Is(err, ErrLocked) {
+		t.Error("Expected ErrLocked but got", err)
+	}
+	if _, err := NewReadOnly(d); !errors.Is(err, ErrLocked) {
+		t.Error("Expected ErrLocked but got", err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Error("Expected closing twice to succeed but got", err)
+	}
+	if err := S.WriteFile("file", nil); !errors.Is(err, ErrClosed) {
+		t.Error("Expected ErrClosed but got", err)
+	}
+
+	R1, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R1.Close()
+	R2, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R2.Close()
+	if _, err := New(d); !errors.Is(err, ErrLocked) {
+		t.Error("Expected ErrLocked but got", err)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	if _, err := NewReadOnly(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	d := createMockStore(t)
+	if err := os.WriteFile(filepath.Join(d, ".unnormalized"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	S, err := NewReadOnly(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if _, err := os.Stat(S.lockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected no lock file to be created but got", err)
+	}
+	if S.Generation != 123 {
+		t.Error("Expected S.Generation to be", 123, "but it is", S.Generation)
+	}
+	if _, err := os.Stat(filepath.Join(d, ".unnormalized")); err != nil {
+		t.Error("Expected names not to be normalized but got", err)
+	}
+	if _, err := S.Overwrite("file"); !errors.Is(err, ErrReadOnly) {
+		t.Error("Expected ErrReadOnly but got", err)
+	}
+	if err := S.Remove("file"); !errors.Is(err, ErrReadOnly) {
+		t.Error("Expected ErrReadOnly but got", err)
+	}
+	if err := S.Move("file", "file3"); !errors.Is(err, ErrReadOnly) {
+		t.Error("Expected ErrReadOnly but got", err)
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1}); !errors.Is(err, ErrReadOnly) {
+		t.Error("Expected ErrReadOnly but got", err)
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1, DryRun: true}); err != nil {
+		t.Error("Expected a dry run to succeed but got", err)
+	}
+	if h, err := S.History("file"); err != nil || len(h) != 1 {
+		t.Error("Expected [123] <nil> but got", h, err)
+	}
+	f, err := S.Open("file", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
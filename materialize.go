@@ -0,0 +1,98 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MaterializeSnapshot builds a directory tree at path, which mustn't exist,
+// holding the files of the store as they looked at the given generation,
+// like the view returned by At, so that external tools can browse it.
+// Generation 0 refers to the live files. Historic versions which are stored
+// as they are are hardlinked into the tree if the file system supports it,
+// see Capabilities, so the tree takes little space, unless the store uses
+// another Backend.
+// Other files are copied. The tree is meant to be read only, as modifying
+// a hardlinked file would modify the history.
+// If it fails, the partially built tree is removed. It's listed by
+// Operations while it runs.
+func (S *Store) MaterializeSnapshot(generation uint64, path string) error {
+	op, end := S.begin("materializeSnapshot")
+	defer end()
+	defer S.lock()()
+	v := &view{store: S, generation: generation}
+	if err := v.resolve(); err != nil {
+		return fmt.Errorf("materializeSnapshot %d: %w", generation, err)
+	}
+	names := []string{}
+	for name := range v.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := os.Mkdir(path, S.dirPerm()); err != nil {
+		return fmt.Errorf("materializeSnapshot %d: %w", generation, err)
+	}
+	op.progress(0, int64(len(names)))
+	for _, name := range names {
+		if op.isCanceled() {
+			os.RemoveAll(path)
+			return fmt.Errorf("materializeSnapshot %d: %w", generation, ErrCanceled)
+		}
+		err := S.materializeFile(name, v.files[name], filepath.Join(path, filepath.FromSlash(name)))
+		if generation == 0 && errors.Is(err, os.ErrNotExist) {
+			err = nil // Removed in the meantime.
+		}
+		if err != nil {
+			os.RemoveAll(path)
+			return fmt.Errorf("materializeSnapshot %d: %w", generation, err)
+		}
+		op.step()
+	}
+	return nil
+}
+
+// materializeFile hardlinks or copies the given version of the file to
+// the target path, with the modification time of the version.
+func (S *Store) materializeFile(file string, generation uint64, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), S.dirPerm()); err != nil {
+		return err
+	}
+	var modTime time.Time
+	if generation == 0 {
+		info, err := S.fs().Stat(S.filePath(file, false))
+		if err != nil {
+			return err
+		}
+		modTime = info.ModTime()
+	} else {
+		path, enc, err := S.versionEntry(file, generation)
+		if err != nil {
+			return err
+		}
+		if enc == plain && !S.verifies() {
+			if encoded, err := isEncoded(S.fs(), path); err != nil {
+				return err
+			} else if !encoded && S.onOS() && S.capabilities.Hardlinks && os.Link(path, target) == nil {
+				return nil
+			}
+		}
+		v, err := S.versionInfo(file, generation)
+		if err != nil {
+			return err
+		}
+		modTime = v.ModTime
+	}
+	f, err := S.openDecoded(file, generation)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeNew(osBackend{}, target, f, S.filePerm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, modTime, modTime)
+}
@@ -0,0 +1,107 @@
+package atylar
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readTree returns the content of every file in the directory tree.
+func readTree(t *testing.T, fsys fs.FS) map[string]string {
+	files := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, name)
+		files[name] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestMaterializeSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		linked bool
+	}{
+		{"plain", nil, true},
+		{"compressed", []Option{WithHistoryCompression(Gzip)}, false},
+		{"encoded", []Option{WithWriteStages(GzipStage())}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(t.TempDir(), tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			writes := []struct{ file, content string }{
+				{"a", "first"},
+				{"dir/b", "nested"},
+				{"a", "second"},
+				{"dir/b", "nested again"},
+				{"a", "third"},
+			}
+			for _, w := range writes {
+				if err := S.WriteFile(w.file, []byte(w.content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			generations, err := S.History("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, g := range []uint64{0, generations[0], generations[1]} {
+				path := filepath.Join(t.TempDir(), "snapshot")
+				if err := S.MaterializeSnapshot(g, path); err != nil {
+					t.Fatal(err)
+				}
+				got, expected := readTree(t, os.DirFS(path)), readTree(t, S.At(g))
+				if !reflect.DeepEqual(got, expected) {
+					t.Error("Got", got, "at", g, "but expected", expected)
+				}
+				info, err := os.Stat(filepath.Join(path, "a"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if g == 0 {
+					continue
+				}
+				v, err := S.versionInfo("a", g)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !info.ModTime().Equal(v.ModTime) {
+					t.Error("Got", info.ModTime(), "but expected", v.ModTime)
+				}
+				version, err := os.Stat(S.versionPath("a", g))
+				if linked := err == nil && os.SameFile(info, version); linked != tt.linked {
+					t.Error("Got", linked, "but expected", tt.linked, "for a hardlink")
+				}
+			}
+		})
+	}
+}
+
+func TestMaterializeSnapshotExisting(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	path := t.TempDir()
+	if err := S.MaterializeSnapshot(0, path); !errors.Is(err, os.ErrExist) {
+		t.Error("Got", err, "but expected", os.ErrExist)
+	}
+	if entries, err := os.ReadDir(path); err != nil || len(entries) != 0 {
+		t.Error("Got", entries, err, "but expected the directory to be left alone")
+	}
+}
@@ -0,0 +1,574 @@
+package atylar
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NewMemory opens a new store which keeps its files and history in memory,
+// in a backend created by NewMemoryBackend, like New. It's meant for tests,
+// which don't need to touch the disk then. The store starts empty and its
+// content is lost once it's dropped.
+func NewMemory(opts ...Option) (Store, error) {
+	return New("memory", append([]Option{WithBackend(NewMemoryBackend())}, opts...)...)
+}
+
+// NewMemoryBackend returns a backend which keeps files in memory. It
+// behaves like the file system of a Unix-like operating system: names are
+// case-sensitive, hard links share their content, files stay readable
+// after they are removed until they're closed, and the errors wrap the
+// same errors as those of the os package. All paths are relative to the
+// same root, regardless of the working directory. It's safe for
+// concurrent use.
+func NewMemoryBackend() Backend {
+	return &memFS{root: newMemDir(0755)}
+}
+
+// memFS is the backend returned by NewMemoryBackend. All of its nodes are
+// guarded by the mutex.
+type memFS struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+// memNode is a file or a directory of a memFS. Hard links refer to the same
+// node from several directories.
+type memNode struct {
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte              // Content of a file
+	entries map[string]*memNode // Entries of a directory, by name
+}
+
+func newMemDir(perm fs.FileMode) *memNode {
+	return &memNode{mode: fs.ModeDir | perm&fs.ModePerm, modTime: time.Now(), entries: make(map[string]*memNode)}
+}
+
+// info describes the node under the given name.
+func (n *memNode) info(name string) fs.FileInfo {
+	return memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memInfo describes a node of a memFS.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() interface{}   { return nil }
+
+// elements splits the path into the names of its elements.
+func elements(name string) []string {
+	p := strings.Trim(filepath.ToSlash(filepath.Clean(name)), "/")
+	if p == "." || p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// lookup returns the node at the path. The mutex must be held.
+func (m *memFS) lookup(op, name string) (*memNode, error) {
+	n := m.root
+	for _, e := range elements(name) {
+		if !n.mode.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		next, ok := n.entries[e]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// parent returns the directory holding the path and the name of its last
+// element. The mutex must be held.
+func (m *memFS) parent(op, name string) (*memNode, string, error) {
+	elems := elements(name)
+	if len(elems) == 0 {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: fs.ErrExist}
+	}
+	dir, err := m.lookup(op, strings.Join(elems[:len(elems)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.mode.IsDir() {
+		return nil, "", &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return dir, elems[len(elems)-1], nil
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) Create(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	n, err := m.lookup("open", name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		dir, base, err := m.parent("open", name)
+		if err != nil {
+			return nil, err
+		}
+		n = &memNode{mode: perm & fs.ModePerm, modTime: time.Now()}
+		dir.entries[base] = n
+		dir.modTime = n.modTime
+	case err != nil:
+		return nil, err
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case n.mode.IsDir() && writable:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	case flag&os.O_TRUNC != 0 && writable:
+		n.data = nil
+		n.modTime = time.Now()
+	}
+	return &memFile{fs: m, node: n, name: name, flag: flag}, nil
+}
+
+func (m *memFS) CreateTemp(dir, pattern string) (File, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for try := 0; ; try++ {
+		var r [8]byte
+		if _, err := rand.Read(r[:]); err != nil {
+			return nil, err
+		}
+		f, err := m.OpenFile(filepath.Join(dir, prefix+hex.EncodeToString(r[:])+suffix), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, fs.ErrExist) || try == 100 {
+			return f, err
+		}
+	}
+}
+
+func (m *memFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.entries[base]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	dir.entries[base] = newMemDir(perm)
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (m *memFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.root
+	for _, e := range elements(path) {
+		next, ok := n.entries[e]
+		if !ok {
+			next = newMemDir(perm)
+			n.entries[e] = next
+			n.modTime = time.Now()
+		} else if !next.mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+		}
+		n = next
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wrap := func(err error) error {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	odir, obase, err := m.parent("rename", oldpath)
+	if err != nil {
+		return wrap(err)
+	}
+	n, ok := odir.entries[obase]
+	if !ok {
+		return wrap(fs.ErrNotExist)
+	}
+	ndir, nbase, err := m.parent("rename", newpath)
+	if err != nil {
+		return wrap(err)
+	}
+	if n.mode.IsDir() {
+		// A directory can't be moved into itself.
+		for d := ndir; d != nil; d = m.containing(d) {
+			if d == n {
+				return wrap(syscall.EINVAL)
+			}
+		}
+	}
+	if existing, ok := ndir.entries[nbase]; ok && existing != n {
+		switch {
+		case n.mode.IsDir() && !existing.mode.IsDir():
+			return wrap(syscall.ENOTDIR)
+		case !n.mode.IsDir() && existing.mode.IsDir():
+			return wrap(syscall.EISDIR)
+		case existing.mode.IsDir() && len(existing.entries) != 0:
+			return wrap(syscall.ENOTEMPTY)
+		}
+	}
+	delete(odir.entries, obase)
+	ndir.entries[nbase] = n
+	now := time.Now()
+	odir.modTime, ndir.modTime = now, now
+	return nil
+}
+
+// containing returns the directory which holds the directory d, or nil for
+// the root. The mutex must be held.
+func (m *memFS) containing(d *memNode) *memNode {
+	if d == m.root {
+		return nil
+	}
+	var find func(dir *memNode) *memNode
+	find = func(dir *memNode) *memNode {
+		for _, e := range dir.entries {
+			if e == d {
+				return dir
+			}
+			if e.mode.IsDir() {
+				if p := find(e); p != nil {
+					return p
+				}
+			}
+		}
+		return nil
+	}
+	return find(m.root)
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := dir.entries[base]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if n.mode.IsDir() && len(n.entries) != 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(dir.entries, base)
+	dir.modTime = time.Now()
+	return nil
+}
+
+func (m *memFS) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, base, err := m.parent("removeall", path)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, ok := dir.entries[base]; ok {
+		delete(dir.entries, base)
+		dir.modTime = time.Now()
+	}
+	return nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	return n.list(), nil
+}
+
+// list returns the entries of the directory, sorted by name. The mutex
+// must be held.
+func (n *memNode) list() []fs.DirEntry {
+	entries := []fs.DirEntry{}
+	for name, e := range n.entries {
+		entries = append(entries, fs.FileInfoToDirEntry(e.info(name)))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(filepath.Base(name)), nil
+}
+
+func (m *memFS) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	n.modTime = mtime
+	return nil
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wrap := func(err error) error {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: err}
+	}
+	n, err := m.lookup("link", oldname)
+	if err != nil {
+		return wrap(err)
+	}
+	if n.mode.IsDir() {
+		return wrap(syscall.EPERM)
+	}
+	dir, base, err := m.parent("link", newname)
+	if err != nil {
+		return wrap(err)
+	}
+	if _, ok := dir.entries[base]; ok {
+		return wrap(fs.ErrExist)
+	}
+	dir.entries[base] = n
+	dir.modTime = time.Now()
+	return nil
+}
+
+// memFile is a file opened by a memFS.
+type memFile struct {
+	fs      *memFS
+	node    *memNode
+	name    string
+	flag    int
+	off     int64
+	closed  bool
+	entries []fs.DirEntry // Remaining entries of a directory, once listed
+}
+
+// check returns an error if the file is closed, or if it wasn't opened
+// for the access. The mutex must be held.
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0 || !write && f.flag&os.O_WRONLY != 0 {
+		return &fs.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	if f.node.mode.IsDir() && op != "readdirent" && op != "stat" && op != "sync" && op != "chmod" && op != "seek" {
+		return &fs.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	return nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.off >= int64(len(f.node.data)) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.off:])
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "readat", Path: f.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+	data := f.node.data
+	if gap := f.off - int64(len(data)); gap > 0 {
+		data = append(data, make([]byte, gap)...)
+	}
+	n := copy(data[f.off:], p)
+	f.node.data = append(data, p[n:]...)
+	f.off += int64(len(p))
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("seek", false); err != nil && !errors.Is(err, syscall.EBADF) {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+func (f *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdirent", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: f.name, Err: syscall.ENOTDIR}
+	}
+	if f.entries == nil {
+		f.entries = f.node.list()
+	}
+	if n > 0 && len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *memFile) Chmod(mode fs.FileMode) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "chmod", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.node.mode = f.node.mode&^fs.ModePerm | mode&fs.ModePerm
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		data := make([]byte, size)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// scenario runs the same operations on a store and describes their
+// outcomes, so that stores with different backends can be compared.
+func scenario(t *testing.T, S *Store) string {
+	var out strings.Builder
+	log := func(format string, args ...interface{}) {
+		fmt.Fprintf(&out, format+"\n", args...)
+	}
+	read := func(file string, generation uint64) {
+		content, err := S.ReadFile(file, generation)
+		log("read %s@%d: %q %v", file, generation, content, errors.Is(err, fs.ErrNotExist))
+	}
+	history := func(file string) {
+		versions, err := S.HistoryInfo(file)
+		sizes := []int64{}
+		for _, v := range versions {
+			sizes = append(sizes, v.Size)
+		}
+		log("history %s: %v %v", file, sizes, err)
+	}
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("dir/file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := S.Overwrite("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "streamed")
+	w.Seek(0, io.SeekStart)
+	io.WriteString(w, "S")
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	read("dir/file", 0)
+	read("other", 0)
+	history("dir/file")
+	generations, _ := S.History("dir/file")
+	read("dir/file", generations[len(generations)-1])
+	log("restore: %v", S.Restore("dir/file", generations[len(generations)-1]))
+	read("dir/file", 0)
+	log("copy: %v", S.Copy("dir/file", "copy"))
+	log("move: %v", S.Move("other", "dir/sub/moved"))
+	log("move missing: %v", errors.Is(S.Move("other", "x"), fs.ErrNotExist))
+	log("remove: %v", S.Remove("copy"))
+	read("copy", 0)
+	history("copy")
+	for _, h := range []bool{false, true} {
+		files, err := S.List(h)
+		sort.Strings(files)
+		log("list %v: %v %v", h, files, err)
+	}
+	dirs, err := S.Dirs()
+	log("dirs: %v %v", dirs, err)
+	f, err := S.Open("dir/sub/moved", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 3)
+	n, err := f.ReadAt(b, 1)
+	log("readAt: %q %v", b[:n], err)
+	f.Close()
+	report, err := S.GC(RetentionPolicy{KeepLast: 1})
+	log("gc: %d %v", len(report.Versions), err)
+	history("dir/file")
+	verified, err := S.Verify()
+	log("verify: %d %v %v", verified.Checked, verified.Problems, err)
+	issues, err := S.Check()
+	log("check: %v %v", issues, err)
+	return out.String()
+}
+
+func TestMemory(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithDedup()}, {WithHistoryCompression(Gzip)}, {WithDeltaHistory()}} {
+		D, err := New(t.TempDir(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := scenario(t, &D)
+		D.Close()
+		M, err := NewMemory(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scenario(t, &M); got != expected {
+			t.Error("Got\n" + got + "but expected\n" + expected)
+		}
+		M.Close()
+	}
+}
+
+func TestMemoryNoDisk(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	M, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer M.Close()
+	if err := M.WriteFile("file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(wd, M.Directory)); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Got", err, "but expected nothing on the disk")
+	}
+	N, err := NewMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer N.Close()
+	if _, err := N.ReadFile("file", 0); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Got", err, "but expected the stores to be separate")
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	b := NewMemoryBackend()
+	if err := b.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(b, "a/b/file", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Link("a/b/file", "a/link"); err != nil {
+		t.Fatal(err)
+	}
+	f, err := b.Open("a/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := b.Remove("a/b/file"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(f); err != nil || string(content) != "content" {
+		t.Error("Got", string(content), err, "but expected the removed file to stay readable")
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"Remove non-empty", b.Remove("a"), nil},
+		{"Open missing", func() error { _, err := b.Open("a/missing"); return err }(), fs.ErrNotExist},
+		{"Mkdir existing", b.Mkdir("a/b", 0755), fs.ErrExist},
+		{"Create exclusive", func() error {
+			_, err := b.OpenFile("a/link", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			return err
+		}(), fs.ErrExist},
+		{"Rename into itself", b.Rename("a", "a/b/a"), nil},
+		{"Write read-only", func() error { _, err := f.Write([]byte("x")); return err }(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil || tt.expected != nil && !errors.Is(tt.err, tt.expected) {
+				t.Error("Got", tt.err, "but expected", tt.expected)
+			}
+		})
+	}
+	if err := b.Rename("a/b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := b.ReadDir(".")
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if err != nil || strings.Join(names, " ") != "a c" {
+		t.Error("Got", names, err, "but expected a c")
+	}
+}
@@ -0,0 +1,127 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Content written with OverwriteWithMeta carries a description of the
+// change, recorded in `.history/.meta`. The description of a live file is
+// stored under its name and follows it when it's moved or copied. When the
+// content is captured to history, the description is moved to
+// `name@generation` along with it. Writes without a description, restores
+// and removals drop the description of the live file.
+
+// CommitMeta describes a write.
+type CommitMeta struct {
+	Author  string            `json:"author,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Custom  map[string]string `json:"custom,omitempty"` // Application-defined fields
+}
+
+// metaPath returns the path to the description of the given version of the
+// file, or of the live file if the generation is 0.
+func (S *Store) metaPath(file string, generation uint64) string {
+	name := normalizeName(file, false)
+	if generation != 0 {
+		name += "@" + strconv.FormatUint(generation, 10)
+	}
+	return filepath.Join(S.historyDir(), ".meta", filepath.FromSlash(name))
+}
+
+// readMeta reads the description of the given version of the file, which
+// is nil if there is none.
+func (S *Store) readMeta(file string, generation uint64) (*CommitMeta, error) {
+	b, err := readFile(S.fs(), S.metaPath(file, generation))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	meta := &CommitMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// setMeta replaces the description of the live file, or removes it if meta
+// is nil.
+func (S *Store) setMeta(file string, meta *CommitMeta) error {
+	path := S.metaPath(file, 0)
+	if meta == nil {
+		if err := S.fs().Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+		return err
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Rename(tmp, path); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// captureMeta moves the description of the live file to the version
+// captured under the given generation. The file must be locked.
+func (S *Store) captureMeta(file string, generation uint64) {
+	S.fs().Rename(S.metaPath(file, 0), S.metaPath(file, generation))
+}
+
+// copyMeta copies the description of the live file from to the live file
+// to, which loses its own.
+func (S *Store) copyMeta(from, to string) error {
+	meta, err := S.readMeta(from, 0)
+	if err != nil {
+		return err
+	}
+	return S.setMeta(to, meta)
+}
+
+// OverwriteWithMeta works like Overwrite, but the written content is
+// described by meta, which is returned by Meta and, once the content is
+// captured, by HistoryInfo.
+func (S *Store) OverwriteWithMeta(file string, meta CommitMeta) (*Writer, error) {
+	w, err := S.Overwrite(file)
+	if err != nil {
+		return nil, err
+	}
+	w.meta = &meta
+	return w, nil
+}
+
+// Meta returns the description of the given version of the file, or of the
+// live file if the generation is 0. It's empty if the content was written
+// without one.
+func (S *Store) Meta(file string, generation uint64) (CommitMeta, error) {
+	defer S.lock()()
+	if generation == 0 {
+		if _, err := S.fs().Stat(S.filePath(file, false)); err != nil {
+			return CommitMeta{}, fmt.Errorf("meta %s: %w", file, err)
+		}
+	} else if _, _, err := S.versionEntry(file, generation); err != nil {
+		return CommitMeta{}, fmt.Errorf("meta %s: %w", file, err)
+	}
+	meta, err := S.readMeta(file, generation)
+	if err != nil {
+		return CommitMeta{}, fmt.Errorf("meta %s: %w", file, err)
+	} else if meta == nil {
+		return CommitMeta{}, nil
+	}
+	return *meta, nil
+}
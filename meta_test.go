@@ -0,0 +1,113 @@
+package atylar
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func writeWithMeta(t *testing.T, S *Store, file, content string, meta CommitMeta) {
+	w, err := S.OverwriteWithMeta(file, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverwriteWithMeta(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	first := CommitMeta{Author: "alice", Message: "fixed typo"}
+	second := CommitMeta{Author: "bob", Message: "expanded", Custom: map[string]string{"ticket": "42"}}
+	writeWithMeta(t, &S, "page", "Helo", first)
+	writeWithMeta(t, &S, "page", "Hello", second)
+	if err := S.WriteFile("page", []byte("Hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := S.HistoryInfo("page")
+	if err != nil || len(versions) != 2 {
+		t.Fatal("Got", versions, err, "but expected 2 versions")
+	}
+	tests := []struct {
+		name       string
+		generation uint64
+		expected   *CommitMeta
+	}{
+		{"live", 0, nil},
+		{"newest", versions[0].Generation, &second},
+		{"oldest", versions[1].Generation, &first},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if i > 0 && !reflect.DeepEqual(versions[i-1].Meta, tt.expected) {
+				t.Error("Got", versions[i-1].Meta, "but expected", tt.expected)
+			}
+			expected := CommitMeta{}
+			if tt.expected != nil {
+				expected = *tt.expected
+			}
+			if meta, err := S.Meta("page", tt.generation); err != nil || !reflect.DeepEqual(meta, expected) {
+				t.Error("Got", meta, err, "but expected", expected)
+			}
+		})
+	}
+	if _, err := S.Meta("page", 1); err == nil {
+		t.Error("Expected an error for a missing version")
+	}
+	// Versions without a description, like the one captured before.
+	if versions, err := S.HistoryInfo("file"); err != nil || versions[0].Meta != nil {
+		t.Error("Got", versions, err, "but expected no description")
+	}
+}
+
+func TestMetaFollowsFile(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	meta := CommitMeta{Author: "alice"}
+	writeWithMeta(t, &S, "a", "content", meta)
+	steps := []struct {
+		name     string
+		step     func() error
+		expected map[string]*CommitMeta
+	}{
+		{"copy", func() error { return S.Copy("a", "b") }, map[string]*CommitMeta{"a": &meta, "b": &meta}},
+		{"move", func() error { return S.Move("a", "c") }, map[string]*CommitMeta{"a": nil, "b": &meta, "c": &meta}},
+		{"overwrite", func() error { return S.WriteFile("b", []byte("other")) }, map[string]*CommitMeta{"b": nil, "c": &meta}},
+		{"remove", func() error { return S.Remove("c") }, map[string]*CommitMeta{"c": nil}},
+	}
+	for _, tt := range steps {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.step(); err != nil {
+				t.Fatal(err)
+			}
+			for file, expected := range tt.expected {
+				meta, err := S.readMeta(file, 0)
+				if err != nil || !reflect.DeepEqual(meta, expected) {
+					t.Error("Got", meta, err, "for", file, "but expected", expected)
+				}
+			}
+		})
+	}
+	// The description of the removed file was captured with it.
+	versions, err := S.HistoryInfo("c")
+	if err != nil || len(versions) != 1 || !reflect.DeepEqual(versions[0].Meta, &meta) {
+		t.Error("Got", versions, err, "but expected a version described by", meta)
+	}
+	if _, err := S.GC(RetentionPolicy{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.metaPath("c", versions[0].Generation)); !os.IsNotExist(err) {
+		t.Error("Got", err, "but expected the description to be removed with the version")
+	}
+}
@@ -0,0 +1,103 @@
+package atylar
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operation describes a long-running operation in progress, like GC.
+type Operation struct {
+	ID      uint64
+	Name    string // Name of the method, like "gc"
+	Started time.Time
+	Done    int64  // Units of work completed
+	Total   int64  // Units of work in total, 0 until known
+	Cancel  func() // Asks the operation to stop, after which it fails with ErrCanceled
+}
+
+// operations is the registry of operations in progress of a store
+// opened with New.
+type operations struct {
+	mu      sync.Mutex
+	next    uint64
+	running map[uint64]*operation
+}
+
+// operation is the state of a running operation. It may be updated
+// while the registry is being read.
+type operation struct {
+	id       uint64
+	name     string
+	started  time.Time
+	done     int64
+	total    int64
+	canceled int32
+}
+
+func newOperations() *operations {
+	return &operations{running: make(map[uint64]*operation)}
+}
+
+// begin registers a new operation, which must be ended by calling the
+// returned function. Stores which weren't opened with New don't list
+// their operations.
+func (S *Store) begin(name string) (*operation, func()) {
+	op := &operation{name: name, started: time.Now()}
+	r := S.ops
+	if r == nil {
+		return op, func() {}
+	}
+	r.mu.Lock()
+	r.next++
+	op.id = r.next
+	r.running[op.id] = op
+	r.mu.Unlock()
+	return op, func() {
+		r.mu.Lock()
+		delete(r.running, op.id)
+		r.mu.Unlock()
+	}
+}
+
+// progress sets the completed and total units of work.
+func (op *operation) progress(done, total int64) {
+	atomic.StoreInt64(&op.done, done)
+	atomic.StoreInt64(&op.total, total)
+}
+
+// step adds a completed unit of work.
+func (op *operation) step() {
+	atomic.AddInt64(&op.done, 1)
+}
+
+// isCanceled reports whether the operation was asked to stop.
+func (op *operation) isCanceled() bool {
+	return atomic.LoadInt32(&op.canceled) != 0
+}
+
+// Operations returns the long-running operations in progress,
+// in the order they were started.
+func (S *Store) Operations() []Operation {
+	list := []Operation{}
+	r := S.ops
+	if r == nil {
+		return list
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, op := range r.running {
+		op := op
+		list = append(list, Operation{
+			ID:      op.id,
+			Name:    op.name,
+			Started: op.started,
+			Done:    atomic.LoadInt64(&op.done),
+			Total:   atomic.LoadInt64(&op.total),
+			Cancel:  func() { atomic.StoreInt32(&op.canceled, 1) },
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
@@ -0,0 +1,50 @@
+package atylar
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOperations(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ops := S.Operations(); len(ops) != 0 {
+		t.Error("Got", ops, "but expected no operations")
+	}
+
+	// GC waits for the file lock, so it can be canceled before it removes anything.
+	unlock := S.lock("file")
+	result := make(chan error)
+	go func() {
+		_, err := S.GC(RetentionPolicy{KeepLast: 1})
+		result <- err
+	}()
+	var ops []Operation
+	for i := 0; i < 100 && len(ops) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		ops = S.Operations()
+	}
+	if len(ops) != 1 || ops[0].Name != "gc" || ops[0].Started.IsZero() {
+		t.Fatal("Got", ops, "but expected a running gc")
+	}
+	ops[0].Cancel()
+	unlock()
+	if err := <-result; !errors.Is(err, ErrCanceled) {
+		t.Error("Expected ErrCanceled but got", err)
+	}
+	if ops := S.Operations(); len(ops) != 0 {
+		t.Error("Got", ops, "but expected no operations")
+	}
+	if h, _ := S.History("file"); len(h) != 2 {
+		t.Error("Got", h, "but expected both versions to be kept")
+	}
+}
@@ -0,0 +1,143 @@
+package atylar
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Option configures a store opened with New.
+type Option func(*options) error
+
+// options holds the configuration set by options. The zero value is the
+// default configuration, so stores which weren't opened with New behave
+// as before.
+type options struct {
+	fileMode     fs.FileMode     // Permissions of created files, 0644 if zero
+	dirMode      fs.FileMode     // Permissions of created directories, 0755 if zero
+	history      string          // Name of the history directory, `.history` if empty
+	noNormalize  bool            // Don't normalize names when the store is opened
+	persistIndex bool            // Save the history index when the store is closed
+	dedup        bool            // Store all versions in chunks
+	compression  Compression     // Compression of captured versions
+	delta        bool            // Store versions as deltas against the previous ones
+	compare      CompareStrategy // Detection of versions which are already captured
+	changeLog    bool            // Log changes of live files, see change.go
+	writeStages  []WriteStage    // Write pipeline, see pipeline.go
+	readStages   []ReadStage     // Read pipeline, see pipeline.go
+	clock        ClockPolicy     // Resolution of out of order times, see clock.go
+	ids          IDGenerator     // Identifiers of shares and others, see ids.go
+	quota        int64           // Expected limit of the size, see forecast.go
+	backend      Backend         // File system of the store, see backend.go
+	onProgress   func(Progress)  // Progress of copies, see progress.go
+	copyBuffer   int             // Buffer size of copies, see progress.go
+}
+
+// WithFileMode sets the permissions of files created in the store, both
+// live files and history. They are subject to the umask, like with os.OpenFile.
+func WithFileMode(mode fs.FileMode) Option {
+	return func(o *options) error {
+		if mode&^fs.ModePerm != 0 || mode == 0 {
+			return fmt.Errorf("withFileMode %v: invalid permissions", mode)
+		}
+		o.fileMode = mode
+		return nil
+	}
+}
+
+// WithDirMode sets the permissions of directories created in the store.
+// They are subject to the umask, like with os.MkdirAll.
+func WithDirMode(mode fs.FileMode) Option {
+	return func(o *options) error {
+		if mode&^fs.ModePerm != 0 || mode == 0 {
+			return fmt.Errorf("withDirMode %v: invalid permissions", mode)
+		}
+		o.dirMode = mode
+		return nil
+	}
+}
+
+// WithHistoryDir sets the name of the history directory in the store root,
+// `.history` by default. The name must begin with a dot, so that it can't
+// be taken by a live file, whose names never do.
+func WithHistoryDir(name string) Option {
+	return func(o *options) error {
+		if !strings.HasPrefix(name, ".") || strings.Trim(name, ".") == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("withHistoryDir %s: %w", name, ErrInvalidName)
+		}
+		o.history = name
+		return nil
+	}
+}
+
+// WithoutNormalize disables the normalization of names of existing files
+// when the store is opened, which renames files with names the store
+// wouldn't create. Such files aren't accessible by their names then.
+func WithoutNormalize() Option {
+	return func(o *options) error {
+		o.noNormalize = true
+		return nil
+	}
+}
+
+// WithPersistentIndex saves the index of the history when the store is
+// closed and loads it when it's opened, instead of reading the whole history
+// directory. Versions added to the history directory while the store is
+// closed are then missing from History. See index.go.
+func WithPersistentIndex() Option {
+	return func(o *options) error {
+		o.persistIndex = true
+		return nil
+	}
+}
+
+// WithDedup stores every captured version in chunks, however small, so that
+// identical versions, e.g. of a file and its copy, are stored only once.
+// Versions smaller than the minimal chunk size become a single chunk, which
+// is their content addressed by its hash. See chunk.go and DedupStats.
+func WithDedup() Option {
+	return func(o *options) error {
+		o.dedup = true
+		return nil
+	}
+}
+
+// apply sets the options of the store.
+func (S *Store) apply(opts []Option) error {
+	for _, opt := range opts {
+		if err := opt(&S.options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filePerm returns the permissions of files created in the store.
+func (S *Store) filePerm() fs.FileMode {
+	if S.fileMode == 0 {
+		return 0644
+	}
+	return S.fileMode
+}
+
+// dirPerm returns the permissions of directories created in the store.
+func (S *Store) dirPerm() fs.FileMode {
+	if S.dirMode == 0 {
+		return 0755
+	}
+	return S.dirMode
+}
+
+// historyName returns the name of the history directory.
+func (S *Store) historyName() string {
+	if S.history == "" {
+		return ".history"
+	}
+	return S.history
+}
+
+// historyDir returns the path to the history directory.
+func (S *Store) historyDir() string {
+	return filepath.Join(S.Directory, S.historyName())
+}
@@ -0,0 +1,134 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"file mode", WithFileMode(0)},
+		{"file mode type", WithFileMode(os.ModeDir | 0755)},
+		{"dir mode", WithDirMode(0)},
+		{"history", WithHistoryDir("versions")},
+		{"history dots", WithHistoryDir("..")},
+		{"history path", WithHistoryDir(".a/.b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(t.TempDir(), tt.opt); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestWithHistoryDir(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d, WithHistoryDir(".versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(d, ".history")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected no .history directory but got", err)
+	}
+	if _, err := os.Stat(filepath.Join(d, ".versions", "file@1")); err != nil {
+		t.Error(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	R, err := NewReadOnly(d, WithHistoryDir(".versions"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer R.Close()
+	if R.GetGeneration(false) != 1 {
+		t.Error("Got", R.GetGeneration(false), "but expected", 1)
+	}
+	files, err := R.List(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "file" {
+		t.Error("Got", files, "but expected only file")
+	}
+	b, err := R.ReadFile("file", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "one" {
+		t.Error("Got", string(b), "but expected", "one")
+	}
+}
+
+// The modes aren't affected by any sensible umask.
+func TestWithModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions aren't supported")
+	}
+	d := t.TempDir()
+	S, err := New(d, WithFileMode(0600), WithDirMode(0700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("dir/file", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Copy("dir/file", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("dir/file", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"dir", os.ModeDir | 0700},
+		{"dir/file", 0600},
+		{"copy", 0600},
+		{".history/dir", os.ModeDir | 0700},
+		{".history/dir/file@1", 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := os.Stat(filepath.Join(d, filepath.FromSlash(tt.name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode() != tt.mode {
+				t.Error("Got", info.Mode(), "but expected", tt.mode)
+			}
+		})
+	}
+}
+
+func TestWithoutNormalize(t *testing.T) {
+	d := t.TempDir()
+	if err := os.WriteFile(filepath.Join(d, "a@b"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	S, err := New(d, WithoutNormalize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if _, err := os.Stat(filepath.Join(d, "a@b")); err != nil {
+		t.Error("Expected the file not to be renamed but got", err)
+	}
+}
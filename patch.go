@@ -0,0 +1,303 @@
+package atylar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Patch series represent the history of a file as an mbox of unified diffs,
+// one for every version, oldest first, like those of `git format-patch`.
+// The first patch creates the file and the last one, unless the file was
+// removed, leads to its live content. Each patch looks like this:
+//
+//	From 12 Mon Sep 17 00:00:00 2001
+//	From: atylar <atylar@localhost>
+//	Date: Tue, 02 Jan 2024 15:04:05 +0000
+//	Subject: [PATCH 2/3] notes/todo.txt@12
+//
+//	---
+//	--- a/notes/todo.txt
+//	+++ b/notes/todo.txt
+//	@@ -1 +1,2 @@
+//	 first
+//	+second
+//
+// The number in the first line is the generation of the version, 0 for the
+// live file, whose subject has no `@` suffix. The author is made up, as the
+// store doesn't record who wrote the versions. Versions of binary files are
+// only reported to differ, so the series can't recreate them.
+//
+// ImportPatches reads any series of unified diffs, ignoring everything
+// between them, like the mbox headers, and applies them strictly: hunks
+// must match the content exactly, at the lines they specify.
+
+// filePatch is a unified diff of a single file.
+type filePatch struct {
+	from, to string // Names in the header, "/dev/null" if the file is missing
+	hunks    []hunk
+	binary   bool // Only reports that binary files differ
+}
+
+// hunk is a hunk of a unified diff.
+type hunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []diffOp
+}
+
+// readVersion reads the given version of the file.
+func (S *Store) readVersion(file string, generation uint64) ([]byte, error) {
+	f, err := S.open(file, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// ExportPatches writes the history of the file to w as a patch series.
+// If the file was removed, the series ends with its last version.
+func (S *Store) ExportPatches(file string, w io.Writer) error {
+	file = normalizeName(file, false)
+	defer S.lock()()
+	history, err := S.HistoryInfo(file)
+	if err != nil {
+		return fmt.Errorf("exportPatches %s: %w", file, err)
+	}
+	versions := make([]Version, 0, len(history)+1)
+	for i := len(history) - 1; i >= 0; i-- {
+		versions = append(versions, history[i])
+	}
+	if info, err := S.fs().Stat(S.filePath(file, false)); err == nil {
+		versions = append(versions, Version{Size: info.Size(), ModTime: info.ModTime()})
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("exportPatches %s: %w", file, err)
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("exportPatches %s: %w", file, os.ErrNotExist)
+	}
+
+	bw := bufio.NewWriter(w)
+	var previous []byte
+	for i, v := range versions {
+		content, err := S.readVersion(file, v.Generation)
+		if err != nil {
+			return fmt.Errorf("exportPatches %s: %w", file, err)
+		}
+		subject := file
+		if v.Generation != 0 {
+			subject = fmt.Sprintf("%s@%d", file, v.Generation)
+		}
+		fmt.Fprintf(bw, "From %d Mon Sep 17 00:00:00 2001\nFrom: atylar <atylar@localhost>\n", v.Generation)
+		fmt.Fprintf(bw, "Date: %s\n", v.ModTime.Format(time.RFC1123Z))
+		fmt.Fprintf(bw, "Subject: [PATCH %d/%d] %s\n\n---\n", i+1, len(versions), subject)
+		from := "a/" + file
+		if i == 0 {
+			from = "/dev/null"
+		}
+		writeUnified(bw, from, "b/"+file, previous, content)
+		bw.WriteString("\n")
+		previous = content
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("exportPatches %s: %w", file, err)
+	}
+	return nil
+}
+
+// parseRange parses a range of a hunk header, like "-3,2" or "+1".
+func parseRange(s string) (start, count int, err error) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if count, err = strconv.Atoi(s[i+1:]); err != nil {
+			return
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s[1:])
+	return
+}
+
+// parsePatches reads a series of unified diffs.
+func parsePatches(r io.Reader) ([]*filePatch, error) {
+	br := bufio.NewReader(r)
+	patches := []*filePatch{}
+	var p *filePatch
+	var h *hunk
+	oldLeft, newLeft := 0, 0
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if line == "" && err == io.EOF {
+			break
+		} else if err != nil && err != io.EOF {
+			return patches, err
+		}
+		// Marks the preceding line of a hunk as lacking a newline.
+		if strings.HasPrefix(line, "\\") && h != nil && len(h.lines) != 0 {
+			last := &h.lines[len(h.lines)-1]
+			last.line = strings.TrimSuffix(last.line, "\n")
+			continue
+		}
+		if oldLeft > 0 || newLeft > 0 {
+			kind := line[0]
+			if line == "\n" {
+				kind = ' ' // Context line stripped of its trailing space.
+				line = " \n"
+			}
+			switch kind {
+			case ' ':
+				oldLeft--
+				newLeft--
+			case '-':
+				oldLeft--
+			case '+':
+				newLeft--
+			default:
+				return patches, fmt.Errorf("line %d: malformed hunk", n)
+			}
+			if oldLeft < 0 || newLeft < 0 {
+				return patches, fmt.Errorf("line %d: malformed hunk", n)
+			}
+			h.lines = append(h.lines, diffOp{kind, line[1:]})
+			continue
+		}
+		h = nil
+		name := ""
+		if len(line) > 4 {
+			name = strings.TrimSpace(line[4:])
+		}
+		if i := strings.IndexByte(name, '\t'); i >= 0 {
+			name = name[:i] // Timestamp
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			p = &filePatch{from: name}
+			patches = append(patches, p)
+		case strings.HasPrefix(line, "+++ ") && p != nil && p.to == "":
+			p.to = name
+		case strings.HasPrefix(line, "@@ ") && p != nil && p.to != "":
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[1][0] != '-' || fields[2][0] != '+' {
+				return patches, fmt.Errorf("line %d: malformed hunk header", n)
+			}
+			h = &hunk{}
+			var err1, err2 error
+			h.oldStart, h.oldCount, err1 = parseRange(fields[1])
+			h.newStart, h.newCount, err2 = parseRange(fields[2])
+			if err1 != nil || err2 != nil {
+				return patches, fmt.Errorf("line %d: malformed hunk header", n)
+			}
+			oldLeft, newLeft = h.oldCount, h.newCount
+			p.hunks = append(p.hunks, *h)
+			h = &p.hunks[len(p.hunks)-1]
+		case strings.HasPrefix(line, "Binary files "):
+			patches = append(patches, &filePatch{binary: true})
+			p = nil
+		}
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return patches, fmt.Errorf("%w in hunk", io.ErrUnexpectedEOF)
+	}
+	return patches, nil
+}
+
+// applyPatch applies the hunks of the patch to the content.
+func applyPatch(content []byte, p *filePatch) ([]byte, error) {
+	lines := splitLines(content)
+	var out strings.Builder
+	pos := 0
+	for i, h := range p.hunks {
+		start := h.oldStart - 1
+		if h.oldCount == 0 {
+			start = h.oldStart
+		}
+		if start < pos || start > len(lines) {
+			return nil, fmt.Errorf("hunk %d doesn't apply", i+1)
+		}
+		for _, line := range lines[pos:start] {
+			out.WriteString(line)
+		}
+		pos = start
+		for _, op := range h.lines {
+			if op.kind == '+' {
+				out.WriteString(op.line)
+				continue
+			}
+			if pos >= len(lines) || lines[pos] != op.line {
+				return nil, fmt.Errorf("hunk %d doesn't apply", i+1)
+			}
+			if op.kind == ' ' {
+				out.WriteString(op.line)
+			}
+			pos++
+		}
+	}
+	for _, line := range lines[pos:] {
+		out.WriteString(line)
+	}
+	return []byte(out.String()), nil
+}
+
+// ImportPatches applies a series of patches to the file, like one written by
+// ExportPatches, recording the result of each patch as a new version. The
+// names of files in the patches are ignored. Patches which create the file
+// require that it doesn't exist and patches which delete it remove it.
+// Nothing is modified unless all patches apply.
+func (S *Store) ImportPatches(file string, r io.Reader) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("importPatches %s: %w", file, err)
+	}
+	file = normalizeName(file, false)
+	if file == "" {
+		return fmt.Errorf("importPatches %s: %w", file, ErrInvalidName)
+	}
+	patches, err := parsePatches(r)
+	if err != nil {
+		return fmt.Errorf("importPatches %s: %w", file, err)
+	}
+	defer S.lock(file)()
+	content, err := S.readVersion(file, 0)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("importPatches %s: %w", file, err)
+	}
+
+	results := make([][]byte, len(patches))
+	deleted := make([]bool, len(patches))
+	for i, p := range patches {
+		if p.binary {
+			return fmt.Errorf("importPatches %s: patch %d: binary patches aren't supported", file, i+1)
+		}
+		if p.from == "/dev/null" && exists {
+			return fmt.Errorf("importPatches %s: patch %d: %w", file, i+1, os.ErrExist)
+		} else if p.from != "/dev/null" && !exists {
+			return fmt.Errorf("importPatches %s: patch %d: %w", file, i+1, os.ErrNotExist)
+		}
+		if content, err = applyPatch(content, p); err != nil {
+			return fmt.Errorf("importPatches %s: patch %d: %w", file, i+1, err)
+		}
+		exists = p.to != "/dev/null"
+		results[i], deleted[i] = content, !exists
+	}
+
+	for i, content := range results {
+		if deleted[i] {
+			err = S.remove(file, func() uint64 { return S.GetGeneration(true) })
+		} else {
+			var tmp string
+			if tmp, err = S.writeTemp(content); err == nil {
+				err = S.commit(file, tmp, nil)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("importPatches %s: %w", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportPatches(t *testing.T) {
+	S, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.ExportPatches("file", &strings.Builder{}); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	for _, content := range []string{"one\n", "one\ntwo\n", "two\n"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, path := range []string{S.versionPath("file", 1), S.versionPath("file", 2), S.filePath("file", false)} {
+		if err := os.Chtimes(path, date, date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var s strings.Builder
+	if err := S.ExportPatches("file", &s); err != nil {
+		t.Fatal(err)
+	}
+	d := date.Local().Format(time.RFC1123Z)
+	expected := "From 1 Mon Sep 17 00:00:00 2001\nFrom: atylar <atylar@localhost>\nDate: " + d + "\nSubject: [PATCH 1/3] file@1\n\n---\n" +
+		"--- /dev/null\n+++ b/file\n@@ -0,0 +1 @@\n+one\n\n" +
+		"From 2 Mon Sep 17 00:00:00 2001\nFrom: atylar <atylar@localhost>\nDate: " + d + "\nSubject: [PATCH 2/3] file@2\n\n---\n" +
+		"--- a/file\n+++ b/file\n@@ -1 +1,2 @@\n one\n+two\n\n" +
+		"From 0 Mon Sep 17 00:00:00 2001\nFrom: atylar <atylar@localhost>\nDate: " + d + "\nSubject: [PATCH 3/3] file\n\n---\n" +
+		"--- a/file\n+++ b/file\n@@ -1,2 +1 @@\n-one\n two\n\n"
+	if s.String() != expected {
+		t.Errorf("Got\n%s\nbut expected\n%s", s.String(), expected)
+	}
+}
+
+func TestImportPatches(t *testing.T) {
+	A, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+	contents := []string{"one\n", "one\ntwo\nthree", "zero\none\ntwo\nthree\n", ""}
+	for _, content := range contents {
+		if err := A.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var series strings.Builder
+	if err := A.ExportPatches("file", &series); err != nil {
+		t.Fatal(err)
+	}
+
+	B, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+	if err := B.ImportPatches("copy", strings.NewReader(series.String())); err != nil {
+		t.Fatal(err)
+	}
+	h, err := B.History("copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != len(contents)-1 {
+		t.Fatal("Got", h, "but expected", len(contents)-1, "versions")
+	}
+	for i, content := range contents {
+		var g uint64
+		if i < len(h) {
+			g = h[len(h)-1-i]
+		}
+		if b, err := B.ReadFile("copy", g); err != nil || string(b) != content {
+			t.Error("Got", string(b), err, "but expected", content)
+		}
+	}
+
+	tests := []struct {
+		name, patch string
+	}{
+		{"exists", "--- /dev/null\n+++ b/copy\n@@ -0,0 +1 @@\n+x\n"},
+		{"mismatch", "--- a/copy\n+++ b/copy\n@@ -1 +1 @@\n-x\n+y\n"},
+		{"second", "--- a/copy\n+++ b/copy\n@@ -0,0 +1 @@\n+x\n--- a/copy\n+++ b/copy\n@@ -5 +5 @@\n-x\n+y\n"},
+		{"truncated", "--- a/copy\n+++ b/copy\n@@ -1,2 +1,2 @@\n-x\n"},
+		{"binary", "Binary files a/copy and b/copy differ\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := B.ImportPatches("copy", strings.NewReader(tt.patch)); err == nil {
+				t.Error("Expected an error")
+			}
+			if h2, _ := B.History("copy"); len(h2) != len(h) {
+				t.Error("Got", h2, "but expected the history not to change")
+			}
+		})
+	}
+
+	// Deletion.
+	if err := B.ImportPatches("copy", strings.NewReader("--- a/copy\n+++ /dev/null\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := B.ReadFile("copy", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+}
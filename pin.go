@@ -0,0 +1,151 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Pinned versions are never removed by GC, whatever the retention policy.
+// They are recorded in `.history/.pins`, in one file per store file,
+// like channels.
+
+// Pin is a pinned version of a file.
+type Pin struct {
+	File       string
+	Generation uint64
+}
+
+// pinPath returns the path to the record of the file's pinned versions.
+func (S *Store) pinPath(file string) string {
+	return filepath.Join(S.historyDir(), ".pins", filepath.FromSlash(normalizeName(file, false)))
+}
+
+// readPins reads the pinned generations of the file, in ascending order.
+func (S *Store) readPins(file string) ([]uint64, error) {
+	pins := []uint64{}
+	b, err := readFile(S.fs(), S.pinPath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return pins, nil
+	} else if err != nil {
+		return pins, err
+	}
+	if err := json.Unmarshal(b, &pins); err != nil {
+		return pins, err
+	}
+	return pins, nil
+}
+
+// writePins replaces the record of the file's pinned generations.
+func (S *Store) writePins(file string, pins []uint64) error {
+	path := S.pinPath(file)
+	if len(pins) == 0 {
+		if err := S.fs().Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i] < pins[j] })
+	b, err := json.Marshal(pins)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+		return err
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Rename(tmp, path); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Pin protects the given version of the file from GC. Pinning a version
+// which is already pinned does nothing.
+func (S *Store) Pin(file string, generation uint64) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("pin %s: %w", file, err)
+	}
+	defer S.lock(file)()
+	if _, _, err := S.versionEntry(file, generation); err != nil {
+		return fmt.Errorf("pin %s: %w", file, err)
+	}
+	pins, err := S.readPins(file)
+	if err != nil {
+		return fmt.Errorf("pin %s: %w", file, err)
+	}
+	for _, g := range pins {
+		if g == generation {
+			return nil
+		}
+	}
+	if err := S.writePins(file, append(pins, generation)); err != nil {
+		return fmt.Errorf("pin %s: %w", file, err)
+	}
+	return nil
+}
+
+// Unpin lets GC remove the given version of the file again. If it isn't
+// pinned, the returned error wraps os.ErrNotExist.
+func (S *Store) Unpin(file string, generation uint64) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("unpin %s: %w", file, err)
+	}
+	defer S.lock(file)()
+	pins, err := S.readPins(file)
+	if err != nil {
+		return fmt.Errorf("unpin %s: %w", file, err)
+	}
+	kept := []uint64{}
+	for _, g := range pins {
+		if g != generation {
+			kept = append(kept, g)
+		}
+	}
+	if len(kept) == len(pins) {
+		return fmt.Errorf("unpin %s: %w", file, os.ErrNotExist)
+	}
+	if err := S.writePins(file, kept); err != nil {
+		return fmt.Errorf("unpin %s: %w", file, err)
+	}
+	return nil
+}
+
+// Pins returns all pinned versions, ordered by file name and generation.
+func (S *Store) Pins() ([]Pin, error) {
+	pins := []Pin{}
+	root := filepath.Join(S.historyDir(), ".pins")
+	err := walkDir(S.fs(), root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == root {
+			return nil // No pins yet.
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		generations, err := S.readPins(name)
+		if err != nil {
+			return err
+		}
+		for _, g := range generations {
+			pins = append(pins, Pin{File: name, Generation: g})
+		}
+		return nil
+	})
+	if err != nil {
+		return pins, fmt.Errorf("pins: %w", err)
+	}
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].File < pins[j].File })
+	return pins, nil
+}
@@ -0,0 +1,56 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPins(t *testing.T) {
+	d := createGCStore(t)
+	S := Store{Directory: d, Generation: 5}
+	for _, p := range []Pin{{"c", 5}, {"a", 2}, {"a", 1}, {"a", 2}} {
+		if err := S.Pin(p.File, p.Generation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := S.Pin("a", 4); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist, "for a missing version")
+	}
+	if err := S.Unpin("c", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Unpin("c", 5); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist, "for a version which isn't pinned")
+	}
+	expected := []Pin{{"a", 1}, {"a", 2}}
+	if pins, err := S.Pins(); err != nil || !reflect.DeepEqual(pins, expected) {
+		t.Error("Got", pins, err, "but expected", expected)
+	}
+
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		removed []string
+	}{
+		{"Keep last", RetentionPolicy{KeepLast: 1}, []string{}},
+		{"Everything", RetentionPolicy{MaxBytes: 1}, []string{"a@3", "c@5", "dir/b@4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := S.GC(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(report.Versions)
+			if !reflect.DeepEqual(report.Versions, tt.removed) {
+				t.Error("Got", report.Versions, "but expected", tt.removed)
+			}
+		})
+	}
+	if generations, err := S.History("a"); err != nil || !reflect.DeepEqual(generations, []uint64{2, 1}) {
+		t.Error("Got", generations, err, "but expected the pinned versions to be kept")
+	}
+}
@@ -0,0 +1,402 @@
+package atylar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Content written with Overwrite, WriteFile or transactions passes through
+// the write pipeline set by WithWriteStages before it replaces the live
+// file. Stages may check it, e.g. reject malformed documents, observe it,
+// e.g. compute checksums, or encode it, e.g. compress or encrypt it. The
+// names of encoding stages are recorded in a header line preceding the
+// encoded content,
+//
+//	\x00atylar-stages gzip,aes
+//
+// in the order they were applied, so the content carries the information
+// needed to decode it into copies and historic versions.
+//
+// Open and the functions reading through it decode the content with the
+// read pipeline, which reverses the named stages in the opposite order.
+// Write stages which also implement ReadStage decode their own content, and
+// gzip is always known, so that content written under older configurations
+// stays readable. Decoders of other stages which are no longer used for
+// writing can be registered with WithReadStages. Unnamed read stages, e.g.
+// ones verifying the content, process all content read, after decoding.
+// Internal operations, like restoring or comparing versions, work with the
+// content as stored.
+
+// stagesMagic begins the header of encoded content.
+const stagesMagic = "\x00atylar-stages "
+
+// WriteStage is a stage of the write pipeline.
+type WriteStage interface {
+	// Name identifies the encoding applied by the stage, which is recorded
+	// with the content. Stages which don't change the content return "".
+	Name() string
+	// NewWriter returns a writer passing the content of the file on to w,
+	// possibly modified. If its Write or Close fails, e.g. because the
+	// content is invalid, the write is rejected with the error. Close
+	// mustn't close w.
+	NewWriter(file string, w io.Writer) (io.WriteCloser, error)
+}
+
+// ReadStage is a stage of the read pipeline.
+type ReadStage interface {
+	// Name identifies the encoding reversed by the stage. Stages which
+	// process all content read return "".
+	Name() string
+	// NewReader returns a reader of the content of the file read from r,
+	// e.g. decoded. If its Read fails, e.g. because the content is corrupt,
+	// opening the file fails with the error. Close mustn't close r.
+	NewReader(file string, r io.Reader) (io.ReadCloser, error)
+}
+
+// WithWriteStages sets the write pipeline. The content passes through the
+// stages in the given order.
+func WithWriteStages(stages ...WriteStage) Option {
+	return func(o *options) error {
+		for _, s := range stages {
+			if strings.ContainsAny(s.Name(), ", \n") {
+				return fmt.Errorf("withWriteStages %q: invalid stage name", s.Name())
+			}
+		}
+		o.writeStages = stages
+		return nil
+	}
+}
+
+// WithReadStages adds stages to the read pipeline: decoders of encodings
+// which aren't reversed by the write stages, and unnamed stages, which
+// process all content read in the given order.
+func WithReadStages(stages ...ReadStage) Option {
+	return func(o *options) error {
+		for _, s := range stages {
+			if strings.ContainsAny(s.Name(), ", \n") {
+				return fmt.Errorf("withReadStages %q: invalid stage name", s.Name())
+			}
+		}
+		o.readStages = stages
+		return nil
+	}
+}
+
+// encodeFile passes the content of the file written to the temporary file
+// at path through the write pipeline, replacing it with the result.
+func (S *Store) encodeFile(file, path string) error {
+	if len(S.writeStages) == 0 {
+		return nil
+	}
+	src, err := S.fs().Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := S.fs().CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if err := S.encode(file, src, dst); err != nil {
+		dst.Close()
+		S.fs().Remove(dst.Name())
+		return err
+	}
+	if err := dst.Chmod(S.filePerm()); err != nil {
+		dst.Close()
+		S.fs().Remove(dst.Name())
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		S.fs().Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		S.fs().Remove(dst.Name())
+		return err
+	}
+	src.Close()
+	if err := S.fs().Rename(dst.Name(), path); err != nil {
+		S.fs().Remove(dst.Name())
+		return err
+	}
+	return nil
+}
+
+// encode writes the content read from r, passed through the write pipeline,
+// to w, preceded by the header if any stage encodes it.
+func (S *Store) encode(file string, r io.Reader, w io.Writer) error {
+	names := []string{}
+	for _, s := range S.writeStages {
+		if s.Name() != "" {
+			names = append(names, s.Name())
+		}
+	}
+	if len(names) != 0 {
+		if _, err := io.WriteString(w, stagesMagic+strings.Join(names, ",")+"\n"); err != nil {
+			return err
+		}
+	}
+	writers := make([]io.WriteCloser, len(S.writeStages))
+	next := w
+	for i := len(S.writeStages) - 1; i >= 0; i-- {
+		sw, err := S.writeStages[i].NewWriter(file, next)
+		if err != nil {
+			return fmt.Errorf("%s: %w", stageName(S.writeStages[i]), err)
+		}
+		writers[i] = sw
+		next = sw
+	}
+	if _, err := io.Copy(next, r); err != nil {
+		return err
+	}
+	for i, sw := range writers {
+		if err := sw.Close(); err != nil {
+			return fmt.Errorf("%s: %w", stageName(S.writeStages[i]), err)
+		}
+	}
+	return nil
+}
+
+// decoder returns the read stage reversing the named encoding.
+func (S *Store) decoder(name string) (ReadStage, error) {
+	for _, s := range S.readStages {
+		if s.Name() == name {
+			return s, nil
+		}
+	}
+	for _, s := range S.writeStages {
+		if r, ok := s.(ReadStage); ok && s.Name() == name {
+			return r, nil
+		}
+	}
+	if name == "gzip" {
+		return gzipStage{}, nil
+	}
+	return nil, fmt.Errorf("unknown stage %q", name)
+}
+
+// verifies returns true if the read pipeline processes all content.
+func (S *Store) verifies() bool {
+	for _, s := range S.readStages {
+		if s.Name() == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isEncoded returns true if the content of the file at path begins with
+// the header of encoded content.
+func isEncoded(fsys Backend, path string) (bool, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(stagesMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return string(magic[:n]) == stagesMagic, nil
+}
+
+// encodedChunks returns true if the content of the chunked version may be
+// encoded, so ranges can't be read from the chunks directly.
+func (S *Store) encodedChunks(manifest string) bool {
+	b, err := S.readChunkedRange(manifest, 0, int64(len(stagesMagic)))
+	return err != nil || string(b) == stagesMagic
+}
+
+// openDecoded opens the version of the file like open, and passes it
+// through the read pipeline.
+func (S *Store) openDecoded(file string, generation uint64) (File, error) {
+	f, err := S.open(file, generation)
+	if err != nil {
+		return nil, err
+	}
+	d, err := S.decode(file, f)
+	if err != nil {
+		return nil, &StoreError{Op: "open", Name: file, Generation: generation, Err: err}
+	}
+	return d, nil
+}
+
+// decode passes the content of the file read from f through the read
+// pipeline. Unless it's unchanged, f is closed and a temporary file holding
+// the result is returned.
+func (S *Store) decode(file string, f File) (File, error) {
+	magic := make([]byte, len(stagesMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, err
+	}
+	encoded := string(magic[:n]) == stagesMagic
+	if !encoded && !S.verifies() {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	if encoded {
+		line, err := r.(*bufio.Reader).ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("malformed stages header: %w", err)
+		}
+		names := strings.Split(strings.TrimSuffix(line, "\n"), ",")
+		for i := len(names) - 1; i >= 0; i-- {
+			s, err := S.decoder(names[i])
+			if err != nil {
+				return nil, err
+			}
+			sr, err := s.NewReader(file, r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", names[i], err)
+			}
+			defer sr.Close()
+			r = sr
+		}
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	} else {
+		r = f
+	}
+	for _, s := range S.readStages {
+		if s.Name() != "" {
+			continue
+		}
+		sr, err := s.NewReader(file, r)
+		if err != nil {
+			return nil, fmt.Errorf("%T: %w", s, err)
+		}
+		defer sr.Close()
+		r = sr
+	}
+	return S.spool(r)
+}
+
+// stageName returns a name of the stage for errors.
+func stageName(s WriteStage) string {
+	if s.Name() != "" {
+		return s.Name()
+	}
+	return fmt.Sprintf("%T", s)
+}
+
+// GzipStage compresses the content with gzip.
+func GzipStage() WriteStage {
+	return gzipStage{}
+}
+
+type gzipStage struct{}
+
+func (gzipStage) Name() string { return "gzip" }
+
+func (gzipStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipStage) NewReader(file string, r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ValidateStage checks the whole content of the file with validate, which
+// rejects the write by returning an error. The content is held in memory.
+func ValidateStage(validate func(file string, data []byte) error) WriteStage {
+	return validateStage(validate)
+}
+
+type validateStage func(file string, data []byte) error
+
+func (validateStage) Name() string { return "" }
+
+func (v validateStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return &validateWriter{validate: v, file: file, w: w}, nil
+}
+
+// validateWriter passes the content on once it's validated on Close.
+type validateWriter struct {
+	validate validateStage
+	file     string
+	w        io.Writer
+	buf      bytes.Buffer
+}
+
+func (v *validateWriter) Write(p []byte) (int, error) {
+	return v.buf.Write(p)
+}
+
+func (v *validateWriter) Close() error {
+	if err := v.validate(v.file, v.buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := v.w.Write(v.buf.Bytes())
+	return err
+}
+
+// VerifyStage is a read stage checking the whole content of every file read
+// with verify, which makes opening the file fail by returning an error.
+// The content is held in memory.
+func VerifyStage(verify func(file string, data []byte) error) ReadStage {
+	return verifyStage(verify)
+}
+
+type verifyStage func(file string, data []byte) error
+
+func (verifyStage) Name() string { return "" }
+
+func (v verifyStage) NewReader(file string, r io.Reader) (io.ReadCloser, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := v(file, b); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+// ChecksumStage computes the SHA-256 checksum of the content and passes it
+// to record once the content is written, before the write is committed.
+func ChecksumStage(record func(file string, sum []byte)) WriteStage {
+	return checksumStage(record)
+}
+
+type checksumStage func(file string, sum []byte)
+
+func (checksumStage) Name() string { return "" }
+
+func (c checksumStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return &checksumWriter{record: c, file: file, w: w, h: sha256.New()}, nil
+}
+
+// checksumWriter hashes the content passing through it.
+type checksumWriter struct {
+	record checksumStage
+	file   string
+	w      io.Writer
+	h      hash.Hash
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	c.h.Write(p)
+	return c.w.Write(p)
+}
+
+func (c *checksumWriter) Close() error {
+	c.record(c.file, c.h.Sum(nil))
+	return nil
+}
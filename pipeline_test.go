@@ -0,0 +1,344 @@
+package atylar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperStage converts the content to upper case.
+type upperStage struct{}
+
+func (upperStage) Name() string { return "upper" }
+
+func (upperStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{upperWriter{w}}, nil
+}
+
+type upperWriter struct{ w io.Writer }
+
+func (u upperWriter) Write(p []byte) (int, error) {
+	return u.w.Write(bytes.ToUpper(p))
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestWriteStages(t *testing.T) {
+	tests := []struct {
+		name     string
+		stages   []WriteStage
+		expected string
+	}{
+		{"none", nil, "hello"},
+		{"unnamed", []WriteStage{ValidateStage(func(string, []byte) error { return nil })}, "hello"},
+		{"upper", []WriteStage{upperStage{}}, stagesMagic + "upper\nHELLO"},
+		{"gzip", []WriteStage{GzipStage()}, ""},
+		{"ordered", []WriteStage{upperStage{}, GzipStage()}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(t.TempDir(), WithWriteStages(tt.stages...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			if err := S.WriteFile("file", []byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(S.filePath("file", false))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.expected != "" {
+				if string(b) != tt.expected {
+					t.Error("Got", string(b), "but expected", tt.expected)
+				}
+				return
+			}
+			// Content compressed by the last stage.
+			names := []string{}
+			for _, s := range tt.stages {
+				names = append(names, s.Name())
+			}
+			header := stagesMagic + strings.Join(names, ",") + "\n"
+			if !strings.HasPrefix(string(b), header) {
+				t.Fatal("Got", string(b), "but expected the header", header)
+			}
+			r, err := gzip.NewReader(bytes.NewReader(b[len(header):]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(r)
+			expected := "hello"
+			if len(tt.stages) > 1 {
+				expected = "HELLO"
+			}
+			if err != nil || string(content) != expected {
+				t.Error("Got", string(content), err, "but expected", expected)
+			}
+		})
+	}
+	if _, err := New(t.TempDir(), WithWriteStages(namedStage("a,b"))); err == nil {
+		t.Error("Expected an invalid stage name to be rejected")
+	}
+}
+
+// namedStage passes the content on unchanged under the given name.
+type namedStage string
+
+func (n namedStage) Name() string { return string(n) }
+
+func (namedStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{w}, nil
+}
+
+func TestValidateStage(t *testing.T) {
+	invalid := errors.New("invalid")
+	validate := func(file string, data []byte) error {
+		if !bytes.HasPrefix(data, []byte("{")) {
+			return invalid
+		}
+		return nil
+	}
+	S, err := New(createMockStore(t), WithWriteStages(ValidateStage(validate)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		write    func() error
+		expected string
+		err      error
+	}{
+		{"valid", func() error { return S.WriteFile("file", []byte("{ }")) }, "{ }", nil},
+		{"invalid", func() error { return S.WriteFile("file", []byte("[]")) }, "{ }", invalid},
+		{"transaction", func() error {
+			tx, err := S.Begin()
+			if err != nil {
+				return err
+			}
+			if err := tx.WriteFile("file", []byte("nope")); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}, "{ }", invalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); !errors.Is(err, tt.err) {
+				t.Error("Got", err, "but expected", tt.err)
+			}
+			if b, err := S.ReadFile("file", 0); err != nil || string(b) != tt.expected {
+				t.Error("Got", string(b), err, "but expected", tt.expected)
+			}
+		})
+	}
+	artifacts, _, err := S.findTemporary(time.Now(), 0)
+	if err != nil || len(artifacts) != 0 {
+		t.Error("Got", artifacts, err, "but expected no temporary files")
+	}
+}
+
+func TestChecksumStage(t *testing.T) {
+	sums := make(map[string][]byte)
+	S, err := New(t.TempDir(), WithWriteStages(ChecksumStage(func(file string, sum []byte) {
+		sums[file] = sum
+	}), GzipStage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile("dir/file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256([]byte("content"))
+	if !bytes.Equal(sums["dir/file"], expected[:]) {
+		t.Error("Got", sums, "but expected", expected)
+	}
+	if b, err := os.ReadFile(S.filePath("dir/file", false)); err != nil || !strings.HasPrefix(string(b), stagesMagic+"gzip\n") {
+		t.Error("Got", string(b), err, "but expected gzip-encoded content")
+	}
+	if b, err := S.ReadFile("dir/file", 0); err != nil || string(b) != "content" {
+		t.Error("Got", string(b), err, "but expected content")
+	}
+}
+
+// xorStage flips bits of the content, reversibly.
+type xorStage struct{}
+
+func (xorStage) Name() string { return "xor" }
+
+func (xorStage) NewWriter(file string, w io.Writer) (io.WriteCloser, error) {
+	return nopCloser{xorWriter{w}}, nil
+}
+
+func (xorStage) NewReader(file string, r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(xorReader{r}), nil
+}
+
+type xorWriter struct{ w io.Writer }
+
+func (x xorWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	for i := range p {
+		b[i] = p[i] ^ 0x5a
+	}
+	return x.w.Write(b)
+}
+
+type xorReader struct{ r io.Reader }
+
+func (x xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x5a
+	}
+	return n, err
+}
+
+func TestReadStages(t *testing.T) {
+	d := t.TempDir()
+	S, err := New(d, WithWriteStages(xorStage{}, GzipStage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("first version\n", 100)
+	if err := S.WriteFile("file", []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("second version")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Content written under an older configuration.
+	S, err = New(d, WithWriteStages(GzipStage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("gzipped", []byte("gzip only")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	generation := uint64(1)
+	tests := []struct {
+		name       string
+		opts       []Option
+		file       string
+		generation uint64
+		expected   string
+		fails      bool
+	}{
+		{"live", []Option{WithWriteStages(xorStage{}, GzipStage())}, "file", 0, "second version", false},
+		{"historic", []Option{WithWriteStages(xorStage{}, GzipStage())}, "file", generation, content, false},
+		{"known", nil, "gzipped", 0, "gzip only", false},
+		{"unknown", nil, "file", 0, "", true},
+		{"registered", []Option{WithReadStages(xorStage{})}, "file", generation, content, false},
+		{"missing", []Option{WithReadStages(xorStage{})}, "missing", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S, err := New(d, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			b, err := S.ReadFile(tt.file, tt.generation)
+			if tt.fails {
+				if err == nil {
+					t.Error("Got", string(b), "but expected an error")
+				}
+				return
+			}
+			if err != nil || string(b) != tt.expected {
+				t.Error("Got", string(b), err, "but expected", tt.expected)
+			}
+			if b, err := S.ReadRange(tt.file, tt.generation, 1, 5); err != nil || string(b) != tt.expected[1:6] {
+				t.Error("Got", string(b), err, "but expected", tt.expected[1:6])
+			}
+		})
+	}
+}
+
+func TestReadStagesRestore(t *testing.T) {
+	S, err := New(t.TempDir(), WithWriteStages(GzipStage()), WithDedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := S.History("file")
+	if err != nil || len(versions) != 1 {
+		t.Fatal("Got", versions, err, "but expected 1 version")
+	}
+	if b, err := S.ReadRange("file", versions[0], 0, 3); err != nil || string(b) != "old" {
+		t.Error("Got", string(b), err, "but expected old")
+	}
+	// The restored content is still encoded.
+	if err := S.Restore("file", versions[0]); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(S.filePath("file", false)); err != nil || !strings.HasPrefix(string(b), stagesMagic+"gzip\n") {
+		t.Error("Got", string(b), err, "but expected gzip-encoded content")
+	}
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "old" {
+		t.Error("Got", string(b), err, "but expected old")
+	}
+}
+
+func TestVerifyStage(t *testing.T) {
+	corrupt := errors.New("corrupt")
+	S, err := New(createMockStore(t), WithReadStages(VerifyStage(func(file string, data []byte) error {
+		if bytes.Contains(data, []byte("second")) {
+			return corrupt
+		}
+		return nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	tests := []struct {
+		file     string
+		expected string
+		err      error
+	}{
+		{"file", "Hello!", nil},
+		{"file2", "", corrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			b, err := S.ReadFile(tt.file, 0)
+			if !errors.Is(err, tt.err) || string(b) != tt.expected {
+				t.Error("Got", string(b), err, "but expected", tt.expected, tt.err)
+			}
+		})
+	}
+}
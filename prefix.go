@@ -0,0 +1,115 @@
+package atylar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// normalizePrefix normalizes a name prefix. Unlike normalizeName, it keeps a
+// trailing separator, so that the prefix "notes/" matches "notes/todo",
+// but not "notesmisc".
+func normalizePrefix(prefix string) string {
+	norm := normalizeName(prefix, false)
+	if norm != "" && (strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, "\\")) {
+		norm += "/"
+	}
+	return norm
+}
+
+// withPrefix returns the names of the live files starting with the prefix.
+func (S *Store) withPrefix(prefix string) ([]string, error) {
+	files, err := S.List(false)
+	if err != nil {
+		return nil, err
+	}
+	matching := []string{}
+	for _, file := range files {
+		if strings.HasPrefix(file, prefix) {
+			matching = append(matching, file)
+		}
+	}
+	return matching, nil
+}
+
+// RemovePrefix removes all files whose names start with the prefix,
+// as a single batch. The returned map holds the error of removing
+// each matched file, which is nil on success.
+func (S *Store) RemovePrefix(prefix string) (map[string]error, error) {
+	prefix = normalizePrefix(prefix)
+	if prefix == "" {
+		return nil, fmt.Errorf("removePrefix: %w", ErrInvalidName)
+	}
+	files, err := S.withPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("removePrefix %s: %w", prefix, err)
+	}
+	errs, err := S.RemoveAll(files)
+	if err != nil {
+		return nil, fmt.Errorf("removePrefix %s: %w", prefix, err)
+	}
+	results := make(map[string]error, len(files))
+	for i, file := range files {
+		results[file] = errs[i]
+	}
+	return results, nil
+}
+
+// prefixPairs pairs every file starting with the prefix old with its name
+// after replacing that prefix with new.
+func (S *Store) prefixPairs(old, new string) ([]Pair, error) {
+	files, err := S.withPrefix(old)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([]Pair, len(files))
+	for i, file := range files {
+		pairs[i] = Pair{From: file, To: new + strings.TrimPrefix(file, old)}
+	}
+	return pairs, nil
+}
+
+// MovePrefix renames all files whose names start with old, so that they
+// start with new instead, as a single batch. The returned map holds the
+// error of moving each matched file, which is nil on success.
+func (S *Store) MovePrefix(old, new string) (map[string]error, error) {
+	old, new = normalizePrefix(old), normalizePrefix(new)
+	if old == "" {
+		return nil, fmt.Errorf("movePrefix: %w", ErrInvalidName)
+	}
+	pairs, err := S.prefixPairs(old, new)
+	if err != nil {
+		return nil, fmt.Errorf("movePrefix %s %s: %w", old, new, err)
+	}
+	errs, err := S.MoveAll(pairs)
+	if err != nil {
+		return nil, fmt.Errorf("movePrefix %s %s: %w", old, new, err)
+	}
+	results := make(map[string]error, len(pairs))
+	for i, p := range pairs {
+		results[p.From] = errs[i]
+	}
+	return results, nil
+}
+
+// CopyPrefix copies all files whose names start with old to names starting
+// with new instead, as a single batch. The returned map holds the error of
+// copying each matched file, which is nil on success.
+func (S *Store) CopyPrefix(old, new string) (map[string]error, error) {
+	old, new = normalizePrefix(old), normalizePrefix(new)
+	if old == "" {
+		return nil, fmt.Errorf("copyPrefix: %w", ErrInvalidName)
+	}
+	pairs, err := S.prefixPairs(old, new)
+	if err != nil {
+		return nil, fmt.Errorf("copyPrefix %s %s: %w", old, new, err)
+	}
+	errs, err := S.CopyAll(pairs)
+	if err != nil {
+		return nil, fmt.Errorf("copyPrefix %s %s: %w", old, new, err)
+	}
+	results := make(map[string]error, len(pairs))
+	for i, p := range pairs {
+		results[p.From] = errs[i]
+	}
+	return results, nil
+}
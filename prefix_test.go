@@ -0,0 +1,115 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestNormalizePrefix(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"notes", "notes"},
+		{"notes/", "notes/"},
+		{"notes\\", "notes/"},
+		{"/notes/2024/", "notes/2024/"},
+		{"notes_", "notes_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if p := normalizePrefix(tt.in); p != tt.out {
+				t.Error("Got", p, "but expected", tt.out)
+			}
+		})
+	}
+}
+
+// createPrefixStore returns a store with files notes/a, notes/b and notesc.
+func createPrefixStore(t *testing.T) Store {
+	d := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(d, ".history"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(d, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"notes/a", "notes/b", "notesc"} {
+		if err := os.WriteFile(filepath.Join(d, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Store{Directory: d}
+}
+
+// listSorted returns the sorted names of live files.
+func listSorted(t *testing.T, S *Store) []string {
+	files, err := S.List(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestRemovePrefix(t *testing.T) {
+	S := createPrefixStore(t)
+	if _, err := S.RemovePrefix("/"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+	results, err := S.RemovePrefix("notes/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["notes/a"] != nil || results["notes/b"] != nil {
+		t.Error("Expected notes/a and notes/b to be removed but got", results)
+	}
+	if files := listSorted(t, &S); len(files) != 1 || files[0] != "notesc" {
+		t.Error("Expected [notesc] but got", files)
+	}
+	if _, err := os.Stat(filepath.Join(S.Directory, "notes")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the empty directory to be removed but got", err)
+	}
+	if S.Generation != 1 {
+		t.Error("Expected S.Generation to be", 1, "but it is", S.Generation)
+	}
+}
+
+func TestMovePrefix(t *testing.T) {
+	S := createPrefixStore(t)
+	results, err := S.MovePrefix("notes/", "archive/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["notes/a"] != nil || results["notes/b"] != nil {
+		t.Error("Expected notes/a and notes/b to be moved but got", results)
+	}
+	if files := listSorted(t, &S); len(files) != 3 || files[0] != "archive/a" || files[1] != "archive/b" || files[2] != "notesc" {
+		t.Error("Expected [archive/a archive/b notesc] but got", files)
+	}
+	if b, err := os.ReadFile(S.filePath("archive/a", false)); err != nil || string(b) != "notes/a" {
+		t.Error("Expected notes/a <nil> but got", string(b), err)
+	}
+	if h, err := S.History("notes/a"); err != nil || len(h) != 1 {
+		t.Error("Expected one version of notes/a but got", h, err)
+	}
+}
+
+func TestCopyPrefix(t *testing.T) {
+	S := createPrefixStore(t)
+	results, err := S.CopyPrefix("notes", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Error("Expected 3 files to be copied but got", results)
+	}
+	if files := listSorted(t, &S); len(files) != 6 || files[0] != "backup/a" || files[2] != "backupc" {
+		t.Error("Expected [backup/a backup/b backupc notes/a notes/b notesc] but got", files)
+	}
+}
@@ -0,0 +1,85 @@
+package atylar
+
+import (
+	"fmt"
+	"io"
+)
+
+// Progress describes how far copying the content of a file has got, as
+// reported to the function set by WithProgress.
+type Progress struct {
+	Op     string // "copy", "restore" or "recordHistory"
+	Name   string // Name of the file
+	Copied int64  // Bytes copied so far
+	Total  int64  // Bytes to copy in total
+}
+
+// WithProgress sets a function which is called as the content of files is
+// copied by Copy and Restore, and as versions are captured to history, so
+// that applications can display the progress of copying large files. It's
+// called after each buffer is copied, and at least once per file, with
+// Copied equal to Total once the copy completes. It's called by the copying
+// goroutine while the store is locked, so it mustn't use the store.
+func WithProgress(fn func(Progress)) Option {
+	return func(o *options) error {
+		o.onProgress = fn
+		return nil
+	}
+}
+
+// WithCopyBuffer sets the size of the buffer used to copy the content of
+// files, 32 KiB by default. Setting it also disables copying within the
+// kernel, which the os package uses where it can.
+func WithCopyBuffer(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("withCopyBuffer %d: invalid size", size)
+		}
+		o.copyBuffer = size
+		return nil
+	}
+}
+
+// report passes the progress to the function set by WithProgress. Progress
+// without an operation isn't reported.
+func (S *Store) report(p Progress) {
+	if S.onProgress != nil && p.Op != "" {
+		S.onProgress(p)
+	}
+}
+
+// copyData copies the content of src to dst with the buffer size of the
+// store, reporting the progress p as it goes.
+func (S *Store) copyData(dst io.Writer, src io.Reader, p Progress) error {
+	if S.copyBuffer == 0 && (S.onProgress == nil || p.Op == "") {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+	size := S.copyBuffer
+	if size == 0 {
+		size = 32 * 1024
+	}
+	buf := make([]byte, size)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			p.Copied += int64(n)
+			if p.Copied > p.Total {
+				p.Total = p.Copied // The file grew
+			}
+			S.report(p)
+		}
+		if err == io.EOF {
+			if p.Copied == 0 || p.Copied < p.Total {
+				p.Total = p.Copied // The file was empty or shrank
+				S.report(p)
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package atylar
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	tests := []struct {
+		name    string
+		opts    []Option
+		reports int // Minimum number of reports of the capture
+	}{
+		{"Plain", nil, 4},
+		{"Compressed", []Option{WithHistoryCompression(Gzip)}, 4},
+		{"Chunked", []Option{WithDedup()}, 1},
+		{"Delta", []Option{WithDeltaHistory()}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []Progress
+			opts := append([]Option{WithCopyBuffer(4096), WithProgress(func(p Progress) { reports = append(reports, p) })}, tt.opts...)
+			S, err := NewMemory(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer S.Close()
+			if err := S.WriteFile("file", content); err != nil {
+				t.Fatal(err)
+			}
+			if len(reports) != 0 {
+				t.Error("Got", reports, "but expected no reports for a new file")
+			}
+			if err := S.WriteFile("file", append(content, '!')); err != nil {
+				t.Fatal(err)
+			}
+			checkProgress(t, reports, "recordHistory", "file", int64(len(content)), tt.reports)
+
+			reports = nil
+			if err := S.Copy("file", "copy"); err != nil {
+				t.Fatal(err)
+			}
+			checkProgress(t, reports, "copy", "file", int64(len(content)+1), 5)
+		})
+	}
+}
+
+// checkProgress checks that the reports are of the given operation and
+// file, that they grow up to the size, and that there are no fewer than
+// least of them.
+func checkProgress(t *testing.T, reports []Progress, op, name string, size int64, least int) {
+	t.Helper()
+	if len(reports) < least {
+		t.Error("Got", len(reports), "reports but expected at least", least)
+		return
+	}
+	copied := int64(0)
+	for _, p := range reports {
+		if p.Op != op || p.Name != name || p.Total != size || p.Copied < copied || p.Copied > size {
+			t.Error("Got", p, "but expected", op, name, "of", size, "bytes")
+		}
+		copied = p.Copied
+	}
+	if copied != size {
+		t.Error("Got", copied, "copied bytes but expected", size)
+	}
+}
+
+func TestProgressEmpty(t *testing.T) {
+	var reports []Progress
+	S, err := NewMemory(WithProgress(func(p Progress) { reports = append(reports, p) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("empty", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Copy("empty", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0] != (Progress{Op: "copy", Name: "empty"}) {
+		t.Error("Got", reports, "but expected a single report of an empty copy")
+	}
+}
+
+func TestWithCopyBuffer(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		if _, err := NewMemory(WithCopyBuffer(size)); err == nil {
+			t.Error("Got", err, "but expected an error for", size)
+		}
+	}
+	S, err := NewMemory(WithCopyBuffer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("file", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Copy("file", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := S.ReadFile("copy", 0); err != nil || string(content) != "content" {
+		t.Error("Got", string(content), err, "but expected content")
+	}
+}
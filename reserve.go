@@ -0,0 +1,178 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Reservation is a claim on a file name made by Reserve.
+type Reservation struct {
+	Name    string
+	ID      string
+	Expires time.Time
+}
+
+// reservationPath returns the path to the marker of a reserved name.
+func (S *Store) reservationPath(name string) string {
+	return filepath.Join(S.historyDir(), ".reservations", normalizeName(name, false))
+}
+
+// Reserve atomically claims the name of a file which doesn't exist yet,
+// creating an empty placeholder in its place, so that concurrent uploaders
+// can agree on names before any content exists. The reservation is meant
+// to be released with Release once the content is written. Otherwise it
+// expires after ttl and its placeholder is removed by ExpireReservations,
+// unless something was written to it. The placeholder isn't recorded to
+// history when the file is first written.
+func (S *Store) Reserve(name string, ttl time.Duration) (Reservation, error) {
+	if err := S.writable(); err != nil {
+		return Reservation{}, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	r := Reservation{Name: normalizeName(name, false), Expires: time.Now().Add(ttl)}
+	if r.Name == "" {
+		return r, fmt.Errorf("reserve %s: %w", name, ErrInvalidName)
+	}
+	defer S.lock(r.Name)()
+	if _, err := S.expireReservation(r.Name, time.Now()); err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	id, err := S.newID(IDReservation)
+	if err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	r.ID = id
+	if err := S.makeParent(r.Name); err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	f, err := S.fs().OpenFile(S.filePath(r.Name, false), os.O_CREATE|os.O_WRONLY|os.O_EXCL, S.filePerm())
+	if err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	f.Close()
+	S.mutated()
+	marker, err := json.Marshal(r)
+	if err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(S.reservationPath(r.Name)), S.dirPerm()); err != nil {
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	if err := writeFile(S.fs(), S.reservationPath(r.Name), marker, S.filePerm()); err != nil {
+		S.fs().Remove(S.filePath(r.Name, false))
+		return r, fmt.Errorf("reserve %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// Reserved returns the reservation of the given name. If the name isn't
+// reserved, the returned error wraps os.ErrNotExist.
+func (S *Store) Reserved(name string) (Reservation, error) {
+	var r Reservation
+	b, err := readFile(S.fs(), S.reservationPath(name))
+	if err != nil {
+		return r, fmt.Errorf("reserved %s: %w", name, err)
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return r, fmt.Errorf("reserved %s: %w", name, err)
+	}
+	return r, nil
+}
+
+// Release ends the reservation, keeping the file. It fails if the name
+// is now reserved by someone else.
+func (S *Store) Release(r Reservation) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("release %s: %w", r.Name, err)
+	}
+	defer S.lock(r.Name)()
+	current, err := S.Reserved(r.Name)
+	if err != nil {
+		return fmt.Errorf("release %s: %w", r.Name, err)
+	}
+	if current.ID != r.ID {
+		return fmt.Errorf("release %s: reserved by someone else", r.Name)
+	}
+	if err := S.fs().Remove(S.reservationPath(r.Name)); err != nil {
+		return fmt.Errorf("release %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// isPlaceholder reports whether the live file, described by info, is the
+// empty placeholder created by Reserve, which isn't recorded to history
+// when it's replaced. It's the case while the name is reserved and the
+// file is empty.
+func (S *Store) isPlaceholder(file string, info fs.FileInfo) bool {
+	if info.Size() != 0 {
+		return false
+	}
+	_, err := S.fs().Stat(S.reservationPath(file))
+	return err == nil
+}
+
+// expireReservation ends the reservation of the name if it expired before
+// now, removing the placeholder if it's still empty. It returns true if
+// the reservation was expired.
+func (S *Store) expireReservation(name string, now time.Time) (bool, error) {
+	r, err := S.Reserved(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if now.Before(r.Expires) {
+		return false, nil
+	}
+	if info, err := S.fs().Stat(S.filePath(name, false)); err == nil && info.Size() == 0 {
+		if err := S.fs().Remove(S.filePath(name, false)); err != nil {
+			return false, err
+		}
+		S.mutated()
+		S.pruneParent(name)
+	}
+	if err := S.fs().Remove(S.reservationPath(name)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExpireReservations ends all expired reservations and removes their
+// placeholders which are still empty. It returns the expired names.
+func (S *Store) ExpireReservations() ([]string, error) {
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("expireReservations: %w", err)
+	}
+	expired := []string{}
+	root := filepath.Join(S.historyDir(), ".reservations")
+	now := time.Now()
+	err := walkDir(S.fs(), root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == root {
+			return nil // Nothing was ever reserved.
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		unlock := S.lock(name)
+		ok, err := S.expireReservation(name, now)
+		unlock()
+		if err != nil {
+			return err
+		} else if ok {
+			expired = append(expired, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return expired, fmt.Errorf("expireReservations: %w", err)
+	}
+	return expired, nil
+}
@@ -0,0 +1,110 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d}
+	if _, err := S.Reserve("file", time.Hour); !errors.Is(err, os.ErrExist) {
+		t.Error("Expected an exist error but got", err)
+	}
+	if _, err := S.Reserve("/", time.Hour); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+	r, err := S.Reserve("upload", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(d, "upload")); err != nil || info.Size() != 0 {
+		t.Error("Expected an empty placeholder but got", info, err)
+	}
+	if _, err := S.Reserve("upload", time.Hour); !errors.Is(err, os.ErrExist) {
+		t.Error("Expected an exist error but got", err)
+	}
+	if current, err := S.Reserved("upload"); err != nil || current.ID != r.ID {
+		t.Error("Expected", r, "<nil> but got", current, err)
+	}
+	if err := S.Release(Reservation{Name: "upload", ID: "other"}); err == nil {
+		t.Error("Expected releasing someone else's reservation to fail")
+	}
+	if err := S.Release(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Reserved("upload"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if _, err := os.Stat(filepath.Join(d, "upload")); err != nil {
+		t.Error("Expected the file to be kept but got", err)
+	}
+}
+
+func TestExpireReservations(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d}
+	if _, err := S.Reserve("abandoned", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Reserve("written", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Reserve("pending", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "written"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := S.ExpireReservations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 2 {
+		t.Error("Expected [abandoned written] but got", expired)
+	}
+	if _, err := os.Stat(filepath.Join(d, "abandoned")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the abandoned placeholder to be removed but got", err)
+	}
+	if _, err := os.Stat(filepath.Join(d, "written")); err != nil {
+		t.Error("Expected the written file to be kept but got", err)
+	}
+	if _, err := S.Reserved("pending"); err != nil {
+		t.Error("Expected the pending reservation to be kept but got", err)
+	}
+
+	// An expired reservation doesn't block reserving the name again.
+	if _, err := S.Reserve("late", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Reserve("late", time.Hour); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReservePlaceholder(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	r, err := S.Reserve("upload", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("upload", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := S.History("upload"); err != nil || len(h) != 0 {
+		t.Error("Got", h, err, "but expected the placeholder not to be recorded")
+	}
+	if err := S.Release(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("upload", []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := S.History("upload"); err != nil || len(h) != 1 {
+		t.Error("Got", h, err, "but expected the written content to be recorded")
+	}
+}
@@ -0,0 +1,120 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Retention overrides replace the policy passed to GC for individual files.
+// They are recorded in `.history/.retention`, in one file per store file,
+// like pins.
+
+// retentionPath returns the path to the record of the file's retention
+// override.
+func (S *Store) retentionPath(file string) string {
+	return filepath.Join(S.historyDir(), ".retention", filepath.FromSlash(normalizeName(file, false)))
+}
+
+// readRetention reads the file's retention override, or returns false
+// if there is none.
+func (S *Store) readRetention(file string) (RetentionPolicy, bool, error) {
+	var policy RetentionPolicy
+	b, err := readFile(S.fs(), S.retentionPath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return policy, false, nil
+	} else if err != nil {
+		return policy, false, err
+	}
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return policy, false, err
+	}
+	return policy, true, nil
+}
+
+// SetRetention makes GC retain the versions of the file according to the
+// given policy instead of the one it's called with. Its keep rules apply to
+// the versions of the file, and its MaxBytes limits the size of the file's
+// history alone, while the size limit of the store's policy doesn't remove
+// them. The zero policy keeps every version forever. DryRun is ignored.
+// The override belongs to the file name, so it isn't moved with the file.
+func (S *Store) SetRetention(file string, policy RetentionPolicy) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("setRetention %s: %w", file, err)
+	}
+	if normalizeName(file, false) == "" {
+		return fmt.Errorf("setRetention %s: %w", file, ErrInvalidName)
+	}
+	defer S.lock(file)()
+	policy.DryRun = false
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("setRetention %s: %w", file, err)
+	}
+	path := S.retentionPath(file)
+	if err := S.fs().MkdirAll(filepath.Dir(path), S.dirPerm()); err != nil {
+		return fmt.Errorf("setRetention %s: %w", file, err)
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return fmt.Errorf("setRetention %s: %w", file, err)
+	}
+	if err := S.fs().Rename(tmp, path); err != nil {
+		S.fs().Remove(tmp)
+		return fmt.Errorf("setRetention %s: %w", file, err)
+	}
+	return nil
+}
+
+// ClearRetention removes the file's retention override, so that GC applies
+// the policy it's called with again. If there is none, the returned error
+// wraps os.ErrNotExist.
+func (S *Store) ClearRetention(file string) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("clearRetention %s: %w", file, err)
+	}
+	defer S.lock(file)()
+	if err := S.fs().Remove(S.retentionPath(file)); err != nil {
+		return fmt.Errorf("clearRetention %s: %w", file, err)
+	}
+	return nil
+}
+
+// Retention returns the file's retention override, or false if it has none.
+func (S *Store) Retention(file string) (RetentionPolicy, bool, error) {
+	policy, ok, err := S.readRetention(file)
+	if err != nil {
+		return policy, false, fmt.Errorf("retention %s: %w", file, err)
+	}
+	return policy, ok, nil
+}
+
+// retentionOverrides returns the retention overrides of all files.
+func (S *Store) retentionOverrides() (map[string]RetentionPolicy, error) {
+	overrides := make(map[string]RetentionPolicy)
+	root := filepath.Join(S.historyDir(), ".retention")
+	err := walkDir(S.fs(), root, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && path == root {
+			return nil // No overrides yet.
+		} else if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		policy, ok, err := S.readRetention(name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			overrides[name] = policy
+		}
+		return nil
+	})
+	return overrides, err
+}
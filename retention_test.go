@@ -0,0 +1,63 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRetention(t *testing.T) {
+	S := Store{Directory: createGCStore(t), Generation: 5}
+	if _, ok, err := S.Retention("a"); err != nil || ok {
+		t.Error("Got", ok, err, "but expected no override")
+	}
+	expected := RetentionPolicy{KeepLast: 2}
+	if err := S.SetRetention("a", RetentionPolicy{KeepLast: 2, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if policy, ok, err := S.Retention("a"); err != nil || !ok || policy != expected {
+		t.Error("Got", policy, ok, err, "but expected", expected)
+	}
+	if err := S.ClearRetention("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.ClearRetention("a"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	if err := S.SetRetention("/", RetentionPolicy{}); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+}
+
+func TestGCRetentionOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		override RetentionPolicy
+		policy   RetentionPolicy
+		removed  []string
+	}{
+		{"Keep forever", RetentionPolicy{}, RetentionPolicy{KeepLast: 1}, []string{}},
+		{"Keep forever with size limit", RetentionPolicy{}, RetentionPolicy{MaxBytes: 1}, []string{"c@5", "dir/b@4"}},
+		{"Keep more", RetentionPolicy{KeepLast: 2}, RetentionPolicy{KeepLast: 1}, []string{"a@1"}},
+		{"Keep less", RetentionPolicy{KeepLast: 1}, RetentionPolicy{}, []string{"a@1", "a@2"}},
+		{"Own size limit", RetentionPolicy{MaxBytes: 25}, RetentionPolicy{MaxBytes: 15}, []string{"a@1", "dir/b@4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			S := Store{Directory: createGCStore(t), Generation: 5}
+			if err := S.SetRetention("a", tt.override); err != nil {
+				t.Fatal(err)
+			}
+			report, err := S.GC(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(report.Versions)
+			if !reflect.DeepEqual(report.Versions, tt.removed) {
+				t.Error("Got", report.Versions, "but expected", tt.removed)
+			}
+		})
+	}
+}
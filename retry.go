@@ -0,0 +1,63 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures retrying of filesystem operations performed by the
+// store. Transient errors are common on network filesystems such as NFS and
+// SMB. Only single filesystem calls are retried, never whole store operations.
+type RetryPolicy struct {
+	Attempts   int              // Maximal number of attempts; less than 2 disables retrying
+	Backoff    time.Duration    // Delay before the first retry, doubled after each one
+	MaxBackoff time.Duration    // Upper bound of the delay; 0 means no bound
+	Timeout    time.Duration    // Time after which no more retries are started; 0 means no limit
+	Retryable  func(error) bool // Reports whether an error should be retried; IsTransient if nil
+}
+
+// IsTransient reports whether err is likely to go away when the failed
+// operation is retried.
+func IsTransient(err error) bool {
+	for _, target := range []error{
+		syscall.EAGAIN,
+		syscall.EINTR,
+		syscall.EBUSY,
+		syscall.ETIMEDOUT,
+		syscall.ESTALE,
+		os.ErrDeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls fn until it succeeds or the store's retry policy
+// stops retrying, and returns the last error.
+func (S *Store) retry(fn func() error) error {
+	p := S.Retry
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+	start := time.Now()
+	delay := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !retryable(err) {
+			return err
+		}
+		if p.Timeout > 0 && time.Since(start)+delay > p.Timeout {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			delay = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		in  error
+		out bool
+	}{
+		{nil, false},
+		{os.ErrNotExist, false},
+		{syscall.EAGAIN, true},
+		{&os.PathError{Op: "open", Path: "abc", Err: syscall.ESTALE}, true},
+		{fmt.Errorf("open abc: %w", syscall.EINTR), true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.in), func(t *testing.T) {
+			if r := IsTransient(tt.in); r != tt.out {
+				t.Error("Got", r, "but expected", tt.out)
+			}
+		})
+	}
+}
+
+// failing returns a function which fails with err the given number of times
+// and then succeeds, counting its calls in calls.
+func failing(times int, err error, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= times {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		S := Store{}
+		calls := 0
+		if err := S.retry(failing(1, syscall.EAGAIN, &calls)); !errors.Is(err, syscall.EAGAIN) || calls != 1 {
+			t.Error("Expected EAGAIN after 1 call but got", err, "after", calls)
+		}
+	})
+	t.Run("Recovered", func(t *testing.T) {
+		S := Store{Retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond}}
+		calls := 0
+		if err := S.retry(failing(2, syscall.EAGAIN, &calls)); err != nil || calls != 3 {
+			t.Error("Expected <nil> after 3 calls but got", err, "after", calls)
+		}
+	})
+	t.Run("Exhausted", func(t *testing.T) {
+		S := Store{Retry: RetryPolicy{Attempts: 2, Backoff: time.Millisecond}}
+		calls := 0
+		if err := S.retry(failing(2, syscall.EAGAIN, &calls)); !errors.Is(err, syscall.EAGAIN) || calls != 2 {
+			t.Error("Expected EAGAIN after 2 calls but got", err, "after", calls)
+		}
+	})
+	t.Run("Permanent", func(t *testing.T) {
+		S := Store{Retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond}}
+		calls := 0
+		if err := S.retry(failing(2, os.ErrNotExist, &calls)); !errors.Is(err, os.ErrNotExist) || calls != 1 {
+			t.Error("Expected not exist after 1 call but got", err, "after", calls)
+		}
+	})
+	t.Run("Custom classification", func(t *testing.T) {
+		S := Store{Retry: RetryPolicy{Attempts: 3, Retryable: func(err error) bool { return errors.Is(err, os.ErrNotExist) }}}
+		calls := 0
+		if err := S.retry(failing(2, os.ErrNotExist, &calls)); err != nil || calls != 3 {
+			t.Error("Expected <nil> after 3 calls but got", err, "after", calls)
+		}
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		S := Store{Retry: RetryPolicy{Attempts: 10, Backoff: time.Hour, Timeout: time.Second}}
+		calls := 0
+		if err := S.retry(failing(2, syscall.EAGAIN, &calls)); !errors.Is(err, syscall.EAGAIN) || calls != 1 {
+			t.Error("Expected EAGAIN after 1 call but got", err, "after", calls)
+		}
+	})
+}
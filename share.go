@@ -0,0 +1,120 @@
+package atylar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Share is a read-only link to a version of a file, identified by an
+// unguessable token, created by CreateShare. Tokens come from the
+// store's IDGenerator, see WithIDGenerator.
+type Share struct {
+	Token      string
+	File       string
+	Generation uint64    // Shared historic version, 0 for the live file
+	Expires    time.Time // Zero if the share never expires
+}
+
+// sharePath returns the path to the record of the share with the given
+// token, or an empty string if the token is malformed.
+func (S *Store) sharePath(token string) string {
+	if !validID(token) {
+		return ""
+	}
+	return filepath.Join(S.historyDir(), ".shares", token)
+}
+
+// CreateShare creates a share of the given version of the file, which is
+// valid until it expires or is revoked with RevokeShare. If the generation is
+// 0, the share follows the live file. A zero expiry time never expires.
+func (S *Store) CreateShare(file string, generation uint64, expires time.Time) (Share, error) {
+	if err := S.writable(); err != nil {
+		return Share{}, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	s := Share{File: normalizeName(file, false), Generation: generation, Expires: expires}
+	if s.File == "" {
+		return s, fmt.Errorf("createShare %s: %w", file, ErrInvalidName)
+	}
+	if generation == 0 {
+		if _, err := S.fs().Stat(S.filePath(s.File, false)); err != nil {
+			return s, fmt.Errorf("createShare %s: %w", file, err)
+		}
+	} else if _, _, err := S.versionEntry(s.File, generation); err != nil {
+		return s, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	token, err := S.newID(IDShare)
+	if err != nil {
+		return s, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	s.Token = token
+	if _, err := S.fs().Stat(S.sharePath(token)); err == nil {
+		return s, fmt.Errorf("createShare %s: token %s: %w", file, token, os.ErrExist)
+	}
+	record, err := json.Marshal(s)
+	if err != nil {
+		return s, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	if err := S.fs().MkdirAll(filepath.Dir(S.sharePath(s.Token)), S.dirPerm()); err != nil {
+		return s, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	if err := writeFile(S.fs(), S.sharePath(s.Token), record, S.filePerm()); err != nil {
+		return s, fmt.Errorf("createShare %s: %w", file, err)
+	}
+	return s, nil
+}
+
+// Shared returns the share with the given token. If there is no such share
+// or it has expired, the returned error wraps os.ErrNotExist. Expired shares
+// are removed.
+func (S *Store) Shared(token string) (Share, error) {
+	var s Share
+	path := S.sharePath(token)
+	if path == "" {
+		return s, fmt.Errorf("shared: %w", os.ErrNotExist)
+	}
+	b, err := readFile(S.fs(), path)
+	if err != nil {
+		return s, fmt.Errorf("shared: %w", err)
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("shared: %w", err)
+	}
+	if !s.Expires.IsZero() && !time.Now().Before(s.Expires) {
+		if S.writable() == nil {
+			S.fs().Remove(path)
+		}
+		return Share{}, fmt.Errorf("shared: %w", os.ErrNotExist)
+	}
+	return s, nil
+}
+
+// OpenShare opens the shared version of the file for reading.
+func (S *Store) OpenShare(token string) (File, Share, error) {
+	s, err := S.Shared(token)
+	if err != nil {
+		return nil, s, fmt.Errorf("openShare: %w", err)
+	}
+	f, err := S.Open(s.File, s.Generation)
+	if err != nil {
+		return nil, s, fmt.Errorf("openShare: %w", err)
+	}
+	return f, s, nil
+}
+
+// RevokeShare ends the share with the given token.
+func (S *Store) RevokeShare(token string) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("revokeShare: %w", err)
+	}
+	path := S.sharePath(token)
+	if path == "" {
+		return fmt.Errorf("revokeShare: %w", os.ErrNotExist)
+	}
+	if err := S.fs().Remove(path); err != nil {
+		return fmt.Errorf("revokeShare: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package atylar
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShare(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.CreateShare("missing", 0, time.Time{}); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if _, err := S.CreateShare("file", 7, time.Time{}); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if _, err := S.CreateShare("/", 0, time.Time{}); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+
+	s, err := S.CreateShare("file", 0, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Token) != 64 {
+		t.Error("Got token", s.Token)
+	}
+	f, shared, err := S.OpenShare(s.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(b) != "Hello!" || shared != s {
+		t.Error("Expected Hello!", s, "<nil> but got", string(b), shared, err)
+	}
+
+	if err := S.RevokeShare(s.Token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Shared(s.Token); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	for _, token := range []string{"", "../../file", "abc"} {
+		if _, err := S.Shared(token); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Expected a not exist error for", token, "but got", err)
+		}
+	}
+}
+
+func TestShareExpiry(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	s, err := S.CreateShare("file", 123, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.Shared(s.Token); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if _, err := os.Stat(S.sharePath(s.Token)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected the expired share to be removed but got", err)
+	}
+
+	s, err = S.CreateShare("file", 123, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared, err := S.Shared(s.Token); err != nil || shared.Generation != 123 {
+		t.Error("Expected generation 123 <nil> but got", shared.Generation, err)
+	}
+}
@@ -0,0 +1,241 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Snapshots are named checkpoints of the whole store, which it can be
+// rolled back to. Taking one captures the current content of every file
+// which isn't captured yet, under a single new generation, and records
+// the version of every file in `.history/.snapshots`. These versions are
+// never removed by GC, until the snapshot is removed.
+
+// Snapshot is a checkpoint of the store taken by Snapshot.
+type Snapshot struct {
+	Label      string
+	Generation uint64
+	Time       time.Time
+	Files      map[string]uint64 // Versions of the files which existed
+}
+
+// snapshotsPath returns the path to the record of the snapshots.
+func (S *Store) snapshotsPath() string {
+	return filepath.Join(S.historyDir(), ".snapshots")
+}
+
+// readSnapshots reads the snapshots, by their labels.
+func (S *Store) readSnapshots() (map[string]Snapshot, error) {
+	snapshots := make(map[string]Snapshot)
+	b, err := readFile(S.fs(), S.snapshotsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return snapshots, nil
+	} else if err != nil {
+		return snapshots, err
+	}
+	if err := json.Unmarshal(b, &snapshots); err != nil {
+		return snapshots, err
+	}
+	return snapshots, nil
+}
+
+// writeSnapshots replaces the record of the snapshots.
+func (S *Store) writeSnapshots(snapshots map[string]Snapshot) error {
+	if len(snapshots) == 0 {
+		if err := S.fs().Remove(S.snapshotsPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(snapshots)
+	if err != nil {
+		return err
+	}
+	tmp, err := S.writeTemp(b)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Rename(tmp, S.snapshotsPath()); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Snapshot records the current state of the store as a checkpoint with the
+// given label, replacing any snapshot with the same label, and returns its
+// generation. The store can be rolled back to it with RollbackTo.
+func (S *Store) Snapshot(label string) (uint64, error) {
+	if err := S.writable(); err != nil {
+		return 0, fmt.Errorf("snapshot %s: %w", label, err)
+	}
+	if label == "" {
+		return 0, fmt.Errorf("snapshot %s: %w", label, ErrInvalidName)
+	}
+	g, err := S.snapshot(label, true)
+	if err != nil {
+		return 0, fmt.Errorf("snapshot %s: %w", label, err)
+	}
+	return g, nil
+}
+
+// NewSnapshot works like Snapshot, but labels the snapshot with a new
+// identifier from the store's IDGenerator, see WithIDGenerator, and returns
+// the label too. If the label is taken, it fails with an error wrapping
+// os.ErrExist instead of replacing the snapshot.
+func (S *Store) NewSnapshot() (string, uint64, error) {
+	if err := S.writable(); err != nil {
+		return "", 0, fmt.Errorf("newSnapshot: %w", err)
+	}
+	label, err := S.newID(IDSnapshot)
+	if err != nil {
+		return "", 0, fmt.Errorf("newSnapshot: %w", err)
+	}
+	g, err := S.snapshot(label, false)
+	if err != nil {
+		return "", 0, fmt.Errorf("newSnapshot %s: %w", label, err)
+	}
+	return label, g, nil
+}
+
+// snapshot implements Snapshot. Unless replace is true, it fails if the
+// label is taken.
+func (S *Store) snapshot(label string, replace bool) (uint64, error) {
+	defer S.lockStore()()
+	snapshots, err := S.readSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := snapshots[label]; ok && !replace {
+		return 0, os.ErrExist
+	}
+	files, err := S.List(false)
+	if err != nil {
+		return 0, err
+	}
+	g := S.GetGeneration(true)
+	s := Snapshot{Label: label, Generation: g, Time: time.Now(), Files: make(map[string]uint64)}
+	for _, file := range files {
+		if err := S.recordHistoryAs(file, func() uint64 { return g }); err != nil {
+			return 0, err
+		}
+		generations, err := S.History(file)
+		if err != nil {
+			return 0, err
+		}
+		if len(generations) != 0 {
+			s.Files[file] = generations[0]
+		}
+	}
+	snapshots[label] = s
+	if err := S.writeSnapshots(snapshots); err != nil {
+		return 0, err
+	}
+	return g, nil
+}
+
+// Snapshots returns all snapshots, from the oldest.
+func (S *Store) Snapshots() ([]Snapshot, error) {
+	snapshots, err := S.readSnapshots()
+	if err != nil {
+		return []Snapshot{}, fmt.Errorf("snapshots: %w", err)
+	}
+	list := []Snapshot{}
+	for _, s := range snapshots {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Generation < list[j].Generation })
+	return list, nil
+}
+
+// RemoveSnapshot removes the snapshot with the given label, so that GC can
+// remove its versions. If there is no such snapshot, the returned error
+// wraps os.ErrNotExist.
+func (S *Store) RemoveSnapshot(label string) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("removeSnapshot %s: %w", label, err)
+	}
+	defer S.lockStore()()
+	snapshots, err := S.readSnapshots()
+	if err != nil {
+		return fmt.Errorf("removeSnapshot %s: %w", label, err)
+	}
+	if _, ok := snapshots[label]; !ok {
+		return fmt.Errorf("removeSnapshot %s: %w", label, os.ErrNotExist)
+	}
+	delete(snapshots, label)
+	if err := S.writeSnapshots(snapshots); err != nil {
+		return fmt.Errorf("removeSnapshot %s: %w", label, err)
+	}
+	return nil
+}
+
+// RollbackTo restores every file to its state at the snapshot with the given
+// label: files which changed are restored, files which were removed are
+// recreated and files which were created since are removed, recording their
+// current versions to history like Restore and Remove do. If there is no
+// such snapshot, the returned error wraps os.ErrNotExist.
+func (S *Store) RollbackTo(label string) error {
+	if err := S.writable(); err != nil {
+		return fmt.Errorf("rollbackTo %s: %w", label, err)
+	}
+	defer S.lockStore()()
+	snapshots, err := S.readSnapshots()
+	if err != nil {
+		return fmt.Errorf("rollbackTo %s: %w", label, err)
+	}
+	s, ok := snapshots[label]
+	if !ok {
+		return fmt.Errorf("rollbackTo %s: %w", label, os.ErrNotExist)
+	}
+	files, err := S.List(false)
+	if err != nil {
+		return fmt.Errorf("rollbackTo %s: %w", label, err)
+	}
+	// Removals first, so that they make room for restored files which were
+	// replaced by directories, and vice versa.
+	for _, file := range files {
+		if _, ok := s.Files[file]; ok {
+			continue
+		}
+		if err := S.remove(file, func() uint64 { return S.GetGeneration(true) }); err != nil {
+			return fmt.Errorf("rollbackTo %s: %w", label, err)
+		}
+	}
+	names := []string{}
+	for file := range s.Files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		g := s.Files[file]
+		if eq, err := S.equalsVersion(S.filePath(file, false), file, g); err == nil && eq {
+			continue
+		}
+		if err := S.restore(file, file, g); err != nil {
+			return fmt.Errorf("rollbackTo %s: %w", label, err)
+		}
+	}
+	return nil
+}
+
+// snapshotVersions returns the set of versions of snapshots, named
+// `name@generation`.
+func (S *Store) snapshotVersions() (map[string]bool, error) {
+	versions := make(map[string]bool)
+	snapshots, err := S.readSnapshots()
+	if err != nil {
+		return versions, err
+	}
+	for _, s := range snapshots {
+		for file, g := range s.Files {
+			versions[fmt.Sprintf("%s@%d", file, g)] = true
+		}
+	}
+	return versions, nil
+}
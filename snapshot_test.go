@@ -0,0 +1,88 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	g, err := S.Snapshot("before import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := S.Snapshots()
+	if err != nil || len(snapshots) != 1 || snapshots[0].Generation != g || len(snapshots[0].Files) != 2 {
+		t.Fatal("Got", snapshots, err, "but expected a snapshot of 2 files at", g)
+	}
+	steps := []func() error{
+		func() error { return S.WriteFile("file", []byte("changed")) },
+		func() error { return S.Remove("file2") },
+		func() error { return S.WriteFile("new", []byte("imported")) },
+		func() error { return S.WriteFile("file2/nested", []byte("replaces a file")) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := S.RollbackTo("before import"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := S.List(false)
+	if err != nil || !reflect.DeepEqual(files, []string{"file", "file2"}) {
+		t.Error("Got", files, err, "but expected file and file2")
+	}
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"file", "Hello!"},
+		{"file2", "Hello from the second file!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			if b, err := S.ReadFile(tt.file, 0); err != nil || string(b) != tt.expected {
+				t.Error("Got", string(b), err, "but expected", tt.expected)
+			}
+		})
+	}
+	// The rollback itself is recorded to history.
+	for _, file := range []string{"file", "new", "file2/nested"} {
+		if versions, err := S.History(file); err != nil || len(versions) == 0 || versions[0] <= g {
+			t.Error("Got", versions, err, "for", file, "but expected a version recorded by the rollback")
+		}
+	}
+
+	// The versions of the snapshot are kept by GC until it's removed.
+	if _, err := S.GC(RetentionPolicy{MaxBytes: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("file", []byte("changed again")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.RollbackTo("before import"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("file", 0); err != nil || string(b) != "Hello!" {
+		t.Error("Got", string(b), err, "but expected Hello!")
+	}
+	if err := S.RemoveSnapshot("before import"); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.RemoveSnapshot("before import"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	if err := S.RollbackTo("before import"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+	if _, err := S.Snapshot(""); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+}
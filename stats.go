@@ -0,0 +1,168 @@
+package atylar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Stats is a snapshot of the store's size at a point in time.
+type Stats struct {
+	Time         time.Time
+	Generation   uint64
+	Files        int   // Number of live files
+	Bytes        int64 // Total size of live files
+	HistoryFiles int   // Number of historic versions
+	HistoryBytes int64 // Disk space used by historic versions, including shared chunks
+}
+
+// StatsDiff is the change between two Stats snapshots.
+type StatsDiff struct {
+	Duration     time.Duration
+	Generations  int64
+	Files        int
+	Bytes        int64
+	HistoryFiles int
+	HistoryBytes int64
+}
+
+// Diff returns the change from the previous snapshot to this one.
+func (s Stats) Diff(previous Stats) StatsDiff {
+	return StatsDiff{
+		Duration:     s.Time.Sub(previous.Time),
+		Generations:  int64(s.Generation) - int64(previous.Generation),
+		Files:        s.Files - previous.Files,
+		Bytes:        s.Bytes - previous.Bytes,
+		HistoryFiles: s.HistoryFiles - previous.HistoryFiles,
+		HistoryBytes: s.HistoryBytes - previous.HistoryBytes,
+	}
+}
+
+// perDay scales the change n to a daily rate. It returns 0 if the snapshots
+// were taken at the same time.
+func (d StatsDiff) perDay(n int64) float64 {
+	if d.Duration <= 0 {
+		return 0
+	}
+	return float64(n) / d.Duration.Hours() * 24
+}
+
+// FilesPerDay returns the growth rate of the number of live files.
+func (d StatsDiff) FilesPerDay() float64 {
+	return d.perDay(int64(d.Files))
+}
+
+// BytesPerDay returns the growth rate of the size of live files.
+func (d StatsDiff) BytesPerDay() float64 {
+	return d.perDay(d.Bytes)
+}
+
+// HistoryFilesPerDay returns the growth rate of the number of historic versions.
+func (d StatsDiff) HistoryFilesPerDay() float64 {
+	return d.perDay(int64(d.HistoryFiles))
+}
+
+// HistoryBytesPerDay returns the growth rate of the size of historic versions.
+func (d StatsDiff) HistoryBytesPerDay() float64 {
+	return d.perDay(d.HistoryBytes)
+}
+
+// statsPath returns the path to the file with persisted stats snapshots.
+func (S *Store) statsPath() string {
+	return filepath.Join(S.historyDir(), ".stats")
+}
+
+// Stats returns the current size of the store.
+func (S *Store) Stats() (Stats, error) {
+	stats := Stats{Time: time.Now(), Generation: S.GetGeneration(false)}
+	err := S.walkFiles(false, func(_ string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("stats: %w", err)
+	}
+	err = S.walkFiles(true, func(_ string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stats.HistoryFiles++
+		stats.HistoryBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("stats: %w", err)
+	}
+	dir, err := S.fs().ReadDir(S.chunkDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return stats, fmt.Errorf("stats: %w", err)
+	}
+	for _, entry := range dir {
+		info, err := entry.Info()
+		if err != nil {
+			return stats, fmt.Errorf("stats: %w", err)
+		}
+		stats.HistoryBytes += info.Size()
+	}
+	return stats, nil
+}
+
+// RecordStats takes a snapshot of the store's size and appends it
+// to the persisted stats history.
+func (S *Store) RecordStats() (Stats, error) {
+	if err := S.writable(); err != nil {
+		return Stats{}, fmt.Errorf("recordStats: %w", err)
+	}
+	stats, err := S.Stats()
+	if err != nil {
+		return stats, fmt.Errorf("recordStats: %w", err)
+	}
+	line, err := json.Marshal(stats)
+	if err != nil {
+		return stats, fmt.Errorf("recordStats: %w", err)
+	}
+	f, err := S.fs().OpenFile(S.statsPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, S.filePerm())
+	if err != nil {
+		return stats, fmt.Errorf("recordStats: %w", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return stats, fmt.Errorf("recordStats: %w", err)
+	}
+	return stats, nil
+}
+
+// StatsHistory returns the persisted stats snapshots, starting from the oldest.
+func (S *Store) StatsHistory() ([]Stats, error) {
+	history := []Stats{}
+	f, err := S.fs().Open(S.statsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return history, nil
+	} else if err != nil {
+		return history, fmt.Errorf("statsHistory: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var stats Stats
+		if err := json.Unmarshal(scanner.Bytes(), &stats); err != nil {
+			return history, fmt.Errorf("statsHistory: %w", err)
+		}
+		history = append(history, stats)
+	}
+	if err := scanner.Err(); err != nil {
+		return history, fmt.Errorf("statsHistory: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,78 @@
+package atylar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	stats, err := S.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Generation != 123 || stats.Files != 2 || stats.Bytes != 33 || stats.HistoryFiles != 1 || stats.HistoryBytes != 0 {
+		t.Error("Got", stats, "but expected generation 123, 2 files, 33 bytes, 1 historic version and 0 historic bytes")
+	}
+}
+
+func TestStatsDiff(t *testing.T) {
+	now := time.Now()
+	previous := Stats{Time: now.Add(-48 * time.Hour), Generation: 10, Files: 4, Bytes: 100, HistoryFiles: 2, HistoryBytes: 50}
+	current := Stats{Time: now, Generation: 20, Files: 8, Bytes: 90, HistoryFiles: 6, HistoryBytes: 250}
+	diff := current.Diff(previous)
+	if diff.Generations != 10 || diff.Files != 4 || diff.Bytes != -10 || diff.HistoryFiles != 4 || diff.HistoryBytes != 200 {
+		t.Error("Got", diff)
+	}
+	if r := diff.FilesPerDay(); r != 2 {
+		t.Error("Got", r, "files per day but expected", 2)
+	}
+	if r := diff.BytesPerDay(); r != -5 {
+		t.Error("Got", r, "bytes per day but expected", -5)
+	}
+	if r := diff.HistoryBytesPerDay(); r != 100 {
+		t.Error("Got", r, "history bytes per day but expected", 100)
+	}
+	if r := current.Diff(current).FilesPerDay(); r != 0 {
+		t.Error("Got", r, "files per day but expected", 0)
+	}
+}
+
+func TestRecordStats(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.RecordStats(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(d, "file3"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.RecordStats(); err != nil {
+		t.Fatal(err)
+	}
+	history, err := S.StatsHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Files != 2 || history[1].Files != 3 {
+		t.Error("Expected snapshots with 2 and 3 files but got", history)
+	}
+
+	// The stats file must not be mistaken for a historic version.
+	files, err := S.List(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "file" {
+		t.Error("Expected [file] but got", files)
+	}
+	if err := S.normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(S.statsPath()); err != nil {
+		t.Error(err)
+	}
+}
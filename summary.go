@@ -0,0 +1,71 @@
+package atylar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// ChangeSummary summarizes the difference between two versions of a file,
+// as returned by CompareVersions.
+type ChangeSummary struct {
+	Changed      bool  // The content differs
+	Binary       bool  // Either version is binary, so lines aren't counted
+	BytesAdded   int64 // Bytes of added lines, or by which binary content grew
+	BytesRemoved int64 // Bytes of removed lines, or by which binary content shrank
+	LinesAdded   int
+	LinesRemoved int
+}
+
+// CompareVersions summarizes how the file changed from generation genA to
+// genB, without producing a diff. Generation 0 refers to the live file,
+// like in Open. Changed lines count as removed and added. Binary content,
+// as detected for patches, is only reported to change, with the difference
+// of the sizes as the bytes added or removed.
+func (S *Store) CompareVersions(file string, genA, genB uint64) (ChangeSummary, error) {
+	var summary ChangeSummary
+	defer S.lock()()
+	a, err := S.readDecoded(file, genA)
+	if err != nil {
+		return summary, fmt.Errorf("compareVersions %s: %w", file, err)
+	}
+	b, err := S.readDecoded(file, genB)
+	if err != nil {
+		return summary, fmt.Errorf("compareVersions %s: %w", file, err)
+	}
+	if bytes.Equal(a, b) {
+		return summary, nil
+	}
+	summary.Changed = true
+	if isBinary(a) || isBinary(b) {
+		summary.Binary = true
+		if d := int64(len(b) - len(a)); d > 0 {
+			summary.BytesAdded = d
+		} else {
+			summary.BytesRemoved = -d
+		}
+		return summary, nil
+	}
+	for _, op := range diffLines(splitLines(a), splitLines(b)) {
+		switch op.kind {
+		case '+':
+			summary.LinesAdded++
+			summary.BytesAdded += int64(len(op.line))
+		case '-':
+			summary.LinesRemoved++
+			summary.BytesRemoved += int64(len(op.line))
+		}
+	}
+	return summary, nil
+}
+
+// readDecoded reads the given version of the file, decoded by the read
+// pipeline.
+func (S *Store) readDecoded(file string, generation uint64) ([]byte, error) {
+	f, err := S.openDecoded(file, generation)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,44 @@
+package atylar
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"a\nb\nc\n", "a\nx\nc\nd\n", "\x00\x01"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// file@123 is empty, file@124 "Hello!", file@125 "a\nb\nc\n",
+	// file@126 "a\nx\nc\nd\n" and the live file is binary.
+	tests := []struct {
+		name       string
+		genA, genB uint64
+		expected   ChangeSummary
+	}{
+		{"Equal", 125, 125, ChangeSummary{}},
+		{"Created", 123, 125, ChangeSummary{Changed: true, BytesAdded: 6, LinesAdded: 3}},
+		{"Changed", 125, 126, ChangeSummary{Changed: true, BytesAdded: 4, BytesRemoved: 2, LinesAdded: 2, LinesRemoved: 1}},
+		{"Reversed", 126, 125, ChangeSummary{Changed: true, BytesAdded: 2, BytesRemoved: 4, LinesAdded: 1, LinesRemoved: 2}},
+		{"Binary", 126, 0, ChangeSummary{Changed: true, Binary: true, BytesRemoved: 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := S.CompareVersions("file", tt.genA, tt.genB)
+			if err != nil || summary != tt.expected {
+				t.Error("Got", summary, err, "but expected", tt.expected)
+			}
+		})
+	}
+	if _, err := S.CompareVersions("file", 123, 1); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Got", err, "but expected", os.ErrNotExist)
+	}
+}
@@ -0,0 +1,269 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// Sync reconciles two stores, like copies of the same files on a laptop and
+// a NAS, which don't share generations. Which side of a file is newer is
+// decided by content: if one side's live file matches a version in the
+// other side's history, the other side changed it since, so its content is
+// copied over. Files which exist on one side only are copied, unless the
+// other side's history shows that it removed them, in which case they are
+// removed. Anything else is a conflict, where both sides changed the file
+// since their common version, or they have none, and neither is touched.
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	DryRun      bool // Only report what would be done
+	KeepRemoved bool // Copy files removed on one side back instead of removing them on the other
+}
+
+// SyncReport describes the outcome of Sync. Names are sorted.
+type SyncReport struct {
+	CopiedToA    []string
+	CopiedToB    []string
+	RemovedFromA []string
+	RemovedFromB []string
+	Conflicts    []string // Changed on both sides, left as they are
+}
+
+// syncSide holds what Sync learned about a file in one of the stores.
+type syncSide struct {
+	store   *Store
+	live    string          // Hash of the live file, "" if it doesn't exist
+	history []uint64        // Generations of its versions, from the newest
+	hashes  map[string]bool // Hashes of its versions, computed on demand
+}
+
+// hasVersion reports whether the side's history holds the content with
+// the given hash.
+func (s *syncSide) hasVersion(file, hash string) (bool, error) {
+	if s.hashes == nil {
+		s.hashes = make(map[string]bool)
+		for _, g := range s.history {
+			h, err := s.store.hashVersion(file, g)
+			if err != nil {
+				return false, err
+			}
+			s.hashes[h] = true
+		}
+	}
+	return s.hashes[hash], nil
+}
+
+// newest returns the newest generation of the side's history, 0 if it's empty.
+func (s *syncSide) newest() uint64 {
+	if len(s.history) == 0 {
+		return 0
+	}
+	return s.history[0]
+}
+
+// hashVersion returns the hash of the decoded content of the given version
+// of the file, or "" if it doesn't exist.
+func (S *Store) hashVersion(file string, generation uint64) (string, error) {
+	f, err := S.Open(file, generation)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return hashReader(f)
+}
+
+// Sync reconciles the files of the stores a and b, copying newer content
+// and removals both ways and reporting files which changed on both sides
+// as conflicts instead of overwriting them. Copies are conditional, like
+// with OverwriteIf, so files modified during the sync become conflicts too.
+// Copied files keep their descriptions and modification times. It's listed
+// by Operations of a while it runs.
+func Sync(a, b *Store, opts SyncOptions) (SyncReport, error) {
+	report := SyncReport{CopiedToA: []string{}, CopiedToB: []string{}, RemovedFromA: []string{}, RemovedFromB: []string{}, Conflicts: []string{}}
+	if same, err := sameStore(a, b); err != nil {
+		return report, fmt.Errorf("sync: %w", err)
+	} else if same {
+		return report, fmt.Errorf("sync: %s: can't sync a store with itself", a.Directory)
+	}
+	op, end := a.begin("sync")
+	defer end()
+	names := make(map[string]bool)
+	for _, S := range []*Store{a, b} {
+		for _, history := range []bool{false, true} {
+			files, err := S.List(history)
+			if err != nil {
+				return report, fmt.Errorf("sync: %w", err)
+			}
+			for _, file := range files {
+				names[file] = true
+			}
+		}
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	op.progress(0, int64(len(sorted)))
+	for _, file := range sorted {
+		if op.isCanceled() {
+			return report, fmt.Errorf("sync: %w", ErrCanceled)
+		}
+		if err := syncFile(a, b, file, opts, &report); err != nil {
+			return report, fmt.Errorf("sync %s: %w", file, err)
+		}
+		op.step()
+	}
+	return report, nil
+}
+
+// sameStore reports whether both stores are in the same directory. With
+// other backends than the default one, it compares the backends and paths.
+func sameStore(a, b *Store) (bool, error) {
+	if !a.onOS() || !b.onOS() {
+		fa, fb := a.fs(), b.fs()
+		if reflect.TypeOf(fa) != reflect.TypeOf(fb) || !reflect.TypeOf(fa).Comparable() {
+			return false, nil
+		}
+		return fa == fb && filepath.Clean(a.Directory) == filepath.Clean(b.Directory), nil
+	}
+	ia, err := os.Stat(a.Directory)
+	if err != nil {
+		return false, err
+	}
+	ib, err := os.Stat(b.Directory)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ia, ib), nil
+}
+
+// syncFile reconciles a single file of the stores.
+func syncFile(a, b *Store, file string, opts SyncOptions, report *SyncReport) error {
+	sides := [2]*syncSide{{store: a}, {store: b}}
+	for _, s := range sides {
+		var err error
+		if s.live, err = s.store.hashVersion(file, 0); err != nil {
+			return err
+		}
+		if s.history, err = s.store.History(file); err != nil {
+			return err
+		}
+	}
+	sa, sb := sides[0], sides[1]
+	if sa.live == sb.live {
+		return nil // Equal or removed on both sides.
+	}
+	// Whether the other side's content, or its absence, should replace
+	// the file in a and in b.
+	var toA, toB bool
+	var err error
+	switch {
+	case sa.live != "" && sb.live != "":
+		if toA, err = sb.hasVersion(file, sa.live); err != nil {
+			return err
+		}
+		if toB, err = sa.hasVersion(file, sb.live); err != nil {
+			return err
+		}
+	case sa.live == "":
+		toA, toB, err = syncMissing(file, sa, sb, opts)
+	default:
+		toB, toA, err = syncMissing(file, sb, sa, opts)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case toA && !toB:
+		return syncCopy(b, a, file, sa, opts, &report.CopiedToA, &report.RemovedFromA, report)
+	case toB && !toA:
+		return syncCopy(a, b, file, sb, opts, &report.CopiedToB, &report.RemovedFromB, report)
+	}
+	report.Conflicts = append(report.Conflicts, file)
+	return nil
+}
+
+// syncMissing decides what to do with a file which only exists on the
+// present side. It returns whether it should be copied to the missing side
+// and whether it should be removed from the present side. If neither, it's
+// a conflict, as the file was removed on one side and changed on the other.
+func syncMissing(file string, missing, present *syncSide, opts SyncOptions) (bool, bool, error) {
+	if len(missing.history) == 0 {
+		return true, false, nil // Never existed there.
+	}
+	found, err := missing.hasVersion(file, present.live)
+	if err != nil || !found {
+		return false, false, err
+	}
+	return opts.KeepRemoved, !opts.KeepRemoved, nil
+}
+
+// syncCopy makes the file in the store dst, described by side, match the
+// store src, copying it or removing it, and records the outcome.
+func syncCopy(src, dst *Store, file string, side *syncSide, opts SyncOptions, copied, removed *[]string, report *SyncReport) error {
+	info, err := src.fs().Stat(src.filePath(file, false))
+	if errors.Is(err, os.ErrNotExist) {
+		if opts.DryRun {
+			*removed = append(*removed, file)
+			return nil
+		}
+		if err := dst.Remove(file); errors.Is(err, os.ErrNotExist) {
+			report.Conflicts = append(report.Conflicts, file)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		*removed = append(*removed, file)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		*copied = append(*copied, file)
+		return nil
+	}
+	err = syncWrite(src, dst, file, side.newest(), info)
+	if errors.Is(err, ErrConflict) {
+		report.Conflicts = append(report.Conflicts, file)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	*copied = append(*copied, file)
+	return nil
+}
+
+// syncWrite copies the live file from src to dst, if dst's newest version
+// is still the expected one.
+func syncWrite(src, dst *Store, file string, expected uint64, info os.FileInfo) error {
+	f, err := src.Open(file, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	meta, err := src.readMeta(file, 0)
+	if err != nil {
+		return err
+	}
+	w, err := dst.OverwriteIf(file, expected)
+	if err != nil {
+		return err
+	}
+	w.meta = meta
+	if _, err := io.Copy(w, f); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Commit(); err != nil {
+		return err
+	}
+	return dst.fs().Chtimes(dst.filePath(file, false), info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,111 @@
+package atylar
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createSyncStores creates a store and a clone of it, both modified since.
+func createSyncStores(t *testing.T) (*Store, *Store) {
+	A, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { A.Close() })
+	for _, name := range []string{"both", "gone", "revived"} {
+		if err := A.WriteFile(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	B, err := A.Clone(filepath.Join(t.TempDir(), "clone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { B.Close() })
+	for _, w := range []struct {
+		S             *Store
+		name, content string
+	}{
+		{&A, "file", "changed on a"},
+		{&B, "file2", "changed on b"},
+		{&A, "new", "created on a"},
+		{&A, "both", "changed on a"},
+		{&B, "both", "changed on b"},
+		{&B, "revived", "changed on b"},
+	} {
+		if err := w.S.WriteFile(w.name, []byte(w.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := B.Remove("gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := A.Remove("revived"); err != nil {
+		t.Fatal(err)
+	}
+	return &A, &B
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     SyncOptions
+		expected SyncReport
+	}{
+		{"Sync", SyncOptions{}, SyncReport{
+			CopiedToA: []string{"file2"}, CopiedToB: []string{"file", "new"},
+			RemovedFromA: []string{"gone"}, RemovedFromB: []string{},
+			Conflicts: []string{"both", "revived"},
+		}},
+		{"Keep removed", SyncOptions{KeepRemoved: true}, SyncReport{
+			CopiedToA: []string{"file2"}, CopiedToB: []string{"file", "gone", "new"},
+			RemovedFromA: []string{}, RemovedFromB: []string{},
+			Conflicts: []string{"both", "revived"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			A, B := createSyncStores(t)
+			dry := tt.opts
+			dry.DryRun = true
+			if report, err := Sync(A, B, dry); err != nil || !reflect.DeepEqual(report, tt.expected) {
+				t.Error("Got", report, err, "but expected", tt.expected)
+			}
+			if b, err := B.ReadFile("new", 0); err == nil {
+				t.Error("Got", string(b), "but expected a dry run not to copy anything")
+			}
+			if report, err := Sync(A, B, tt.opts); err != nil || !reflect.DeepEqual(report, tt.expected) {
+				t.Error("Got", report, err, "but expected", tt.expected)
+			}
+			files := []string{"file", "file2", "new", "gone"}
+			for _, file := range files {
+				a, errA := A.ReadFile(file, 0)
+				b, errB := B.ReadFile(file, 0)
+				if (errA == nil) != (errB == nil) || string(a) != string(b) {
+					t.Error("Got", string(a), errA, "and", string(b), errB, "for", file)
+				}
+			}
+			for _, S := range []*Store{A, B} {
+				if b, err := S.ReadFile("new", 0); err != nil || string(b) != "created on a" {
+					t.Error("Got", string(b), err, "but expected created on a")
+				}
+			}
+			again := SyncReport{CopiedToA: []string{}, CopiedToB: []string{}, RemovedFromA: []string{}, RemovedFromB: []string{}, Conflicts: []string{"both", "revived"}}
+			if report, err := Sync(A, B, tt.opts); err != nil || !reflect.DeepEqual(report, again) {
+				t.Error("Got", report, err, "but expected", again)
+			}
+		})
+	}
+}
+
+func TestSyncItself(t *testing.T) {
+	S, err := New(createMockStore(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if _, err := Sync(&S, &S, SyncOptions{}); err == nil {
+		t.Error("Expected syncing a store with itself to fail")
+	}
+}
@@ -0,0 +1,415 @@
+package atylar
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Transactions group modifications of several files, which are applied
+// together on Commit, with the history of all of them captured under a
+// single generation.
+//
+// New content is staged in a directory `.history/.tmp-tx-*` until the
+// transaction is committed. Commit writes the list of operations and the
+// generation to the file `commit` there, which is the point after which
+// the transaction is applied even if the process crashes, and records
+// every applied operation in the file `done`. New finishes the committed
+// transactions it finds and discards the uncommitted ones, so a crash never
+// leaves a transaction half-applied after the store is reopened. Read-only
+// stores don't do that, so they may observe it.
+
+// txPrefix is the prefix of the staging directories of transactions.
+const txPrefix = ".tmp-tx-"
+
+// Tx is a transaction, created by Begin.
+type Tx struct {
+	store    *Store
+	dir      string // Staging directory
+	ops      []txOp
+	modified map[string]bool
+	done     bool
+}
+
+// txOp is an operation of a transaction.
+type txOp struct {
+	Op     string `json:"op"` // "overwrite", "remove", "move" or "copy"
+	Name   string `json:"name"`
+	To     string `json:"to,omitempty"`
+	Staged string `json:"staged,omitempty"` // Name of the staged content in the staging directory
+}
+
+// target returns the name of the file the operation creates or replaces,
+// if any.
+func (op txOp) target() string {
+	switch op.Op {
+	case "overwrite":
+		return op.Name
+	case "move", "copy":
+		return op.To
+	}
+	return ""
+}
+
+// txRecord is the content of the commit file of a transaction.
+type txRecord struct {
+	Generation uint64 `json:"generation"`
+	Ops        []txOp `json:"ops"`
+}
+
+// Begin starts a transaction. It must be ended with Commit or Rollback.
+func (S *Store) Begin() (*Tx, error) {
+	if err := S.writable(); err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	if err := S.locks.enter(); err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	dir, err := mkdirTemp(S.fs(), S.historyDir(), txPrefix)
+	if err != nil {
+		S.locks.leave()
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	return &Tx{store: S, dir: dir, modified: make(map[string]bool)}, nil
+}
+
+// add validates and records an operation. Like in batches, a file can
+// only be modified by one operation of a transaction, as two versions
+// of the file can't share a generation.
+func (t *Tx) add(op txOp, modified ...string) error {
+	if t.done {
+		return os.ErrClosed
+	}
+	names := []string{op.Name}
+	if op.To != "" {
+		names = append(names, op.To)
+	}
+	for _, name := range names {
+		if normalizeName(name, false) == "" {
+			return fmt.Errorf("%q: %w", name, ErrInvalidName)
+		}
+	}
+	// Destinations are checked before the transaction is committed, as it
+	// can't be stopped once the commit record is written.
+	if target := op.target(); target != "" {
+		if err := t.store.checkName(target); err != nil {
+			return err
+		}
+	}
+	for _, name := range modified {
+		norm := normalizeName(name, false)
+		if t.modified[norm] {
+			return fmt.Errorf("%s appears in the transaction more than once: %w", norm, ErrInvalidName)
+		}
+	}
+	if op.Op == "move" && normalizeName(op.Name, false) == normalizeName(op.To, false) {
+		return fmt.Errorf("%s appears in the transaction more than once: %w", op.Name, ErrInvalidName)
+	}
+	for _, name := range modified {
+		t.modified[normalizeName(name, false)] = true
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+// Overwrite returns a file to write the new content of the file to, which
+// replaces it when the transaction is committed. It must be closed before.
+func (t *Tx) Overwrite(file string) (File, error) {
+	staged := strconv.Itoa(len(t.ops))
+	if err := t.add(txOp{Op: "overwrite", Name: file, Staged: staged}, file); err != nil {
+		return nil, fmt.Errorf("overwrite %s: %w", file, err)
+	}
+	f, err := t.store.fs().OpenFile(filepath.Join(t.dir, staged), os.O_CREATE|os.O_WRONLY|os.O_EXCL, t.store.filePerm())
+	if err != nil {
+		t.ops = t.ops[:len(t.ops)-1]
+		delete(t.modified, normalizeName(file, false))
+		return nil, fmt.Errorf("overwrite %s: %w", file, err)
+	}
+	return f, nil
+}
+
+// WriteFile stages data as the new content of the file.
+func (t *Tx) WriteFile(file string, data []byte) error {
+	f, err := t.Overwrite(file)
+	if err != nil {
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	return nil
+}
+
+// Remove removes the file when the transaction is committed.
+func (t *Tx) Remove(file string) error {
+	if err := t.add(txOp{Op: "remove", Name: file}, file); err != nil {
+		return fmt.Errorf("remove %s: %w", file, err)
+	}
+	return nil
+}
+
+// Move moves the file when the transaction is committed.
+func (t *Tx) Move(from, to string) error {
+	if err := t.add(txOp{Op: "move", Name: from, To: to}, from, to); err != nil {
+		return fmt.Errorf("move %s %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// Copy copies the file when the transaction is committed. The source
+// is copied as it is at that point of the transaction.
+func (t *Tx) Copy(from, to string) error {
+	if err := t.add(txOp{Op: "copy", Name: from, To: to}, to); err != nil {
+		return fmt.Errorf("copy %s %s: %w", from, to, err)
+	}
+	return nil
+}
+
+// Rollback discards the transaction. It does nothing if the transaction
+// was already committed or rolled back, so it can be deferred.
+func (t *Tx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	defer t.store.locks.leave()
+	if err := t.store.fs().RemoveAll(t.dir); err != nil {
+		return fmt.Errorf("rollback: %w", err)
+	}
+	return nil
+}
+
+// Commit applies all operations of the transaction. The current versions
+// of the modified files are recorded to history under a single generation.
+// If a source of a move or a copy or a removed file won't exist, nothing
+// is modified.
+func (t *Tx) Commit() error {
+	if t.done {
+		return fmt.Errorf("commit: %w", os.ErrClosed)
+	}
+	S := t.store
+	// Transactions begun before Drain can be committed.
+	if err := S.writable(); err != nil && !errors.Is(err, ErrDraining) {
+		t.Rollback()
+		return fmt.Errorf("commit: %w", err)
+	}
+	t.done = true
+	defer S.locks.leave()
+	names := []string{}
+	for _, op := range t.ops {
+		names = append(names, op.Name)
+		if op.To != "" {
+			names = append(names, op.To)
+		}
+	}
+	defer S.lock(names...)()
+	for _, op := range t.ops {
+		if target := op.target(); target != "" {
+			if err := S.checkName(target); err != nil {
+				S.fs().RemoveAll(t.dir)
+				return fmt.Errorf("commit: %s: %w", target, err)
+			}
+		}
+	}
+
+	// Which files will exist at each point of the transaction.
+	exists := make(map[string]bool)
+	check := func(name string) bool {
+		norm := normalizeName(name, false)
+		if e, ok := exists[norm]; ok {
+			return e
+		}
+		_, err := S.fs().Stat(S.filePath(norm, false))
+		return err == nil
+	}
+	for _, op := range t.ops {
+		from, to := normalizeName(op.Name, false), normalizeName(op.To, false)
+		switch op.Op {
+		case "overwrite":
+			exists[from] = true
+		case "remove", "move", "copy":
+			if !check(from) {
+				S.fs().RemoveAll(t.dir)
+				return fmt.Errorf("commit: %s %s: %w", op.Op, from, os.ErrNotExist)
+			}
+			if op.Op != "copy" {
+				exists[from] = false
+			}
+			if op.Op != "remove" {
+				exists[to] = true
+			}
+		}
+	}
+
+	for _, op := range t.ops {
+		if op.Op != "overwrite" {
+			continue
+		}
+		name := normalizeName(op.Name, false)
+		if err := S.encodeFile(name, filepath.Join(t.dir, op.Staged)); err != nil {
+			S.fs().RemoveAll(t.dir)
+			return fmt.Errorf("commit: %s: %w", name, err)
+		}
+		if err := flushFile(S.fs(), filepath.Join(t.dir, op.Staged)); err != nil {
+			S.fs().RemoveAll(t.dir)
+			return fmt.Errorf("commit: %s: %w", name, err)
+		}
+	}
+
+	record, err := json.Marshal(txRecord{Generation: S.GetGeneration(true), Ops: t.ops})
+	if err != nil {
+		S.fs().RemoveAll(t.dir)
+		return fmt.Errorf("commit: %w", err)
+	}
+	tmp := filepath.Join(t.dir, "commit.tmp")
+	if err := writeFile(S.fs(), tmp, record, S.filePerm()); err != nil {
+		S.fs().RemoveAll(t.dir)
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := flushFile(S.fs(), tmp); err != nil {
+		S.fs().RemoveAll(t.dir)
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := S.fs().Rename(tmp, filepath.Join(t.dir, "commit")); err != nil {
+		S.fs().RemoveAll(t.dir)
+		return fmt.Errorf("commit: %w", err)
+	}
+	// Once the record is durable, the transaction is recovered after a crash.
+	if err := S.syncDir(t.dir); err != nil {
+		S.fs().RemoveAll(t.dir)
+		return fmt.Errorf("commit: %w", err)
+	}
+	if err := S.applyTx(t.dir); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// applyTx applies the operations of the committed transaction staged in
+// the directory which weren't applied yet, and removes the directory.
+// Operations interrupted by a crash are finished. The files must be locked.
+func (S *Store) applyTx(dir string) error {
+	b, err := readFile(S.fs(), filepath.Join(dir, "commit"))
+	if err != nil {
+		return err
+	}
+	var record txRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return err
+	}
+	done := make(map[int]bool)
+	if b, err := readFile(S.fs(), filepath.Join(dir, "done")); err == nil {
+		for _, line := range strings.Fields(string(b)) {
+			if i, err := strconv.Atoi(line); err == nil {
+				done[i] = true
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	log, err := S.fs().OpenFile(filepath.Join(dir, "done"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, S.filePerm())
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	w := bufio.NewWriter(log)
+
+	next := func() uint64 { return record.Generation }
+	for i, op := range record.Ops {
+		if done[i] {
+			continue
+		}
+		if err := S.applyTxOp(dir, op, next); err != nil {
+			w.Flush()
+			return fmt.Errorf("%s %s: %w", op.Op, op.Name, err)
+		}
+		fmt.Fprintln(w, i)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	log.Close()
+	return S.fs().RemoveAll(dir)
+}
+
+// applyTxOp applies a single operation of a transaction. Operations which
+// were already applied before a crash are recognized and skipped.
+func (S *Store) applyTxOp(dir string, op txOp, next func() uint64) error {
+	switch op.Op {
+	case "overwrite":
+		staged := filepath.Join(dir, op.Staged)
+		if _, err := S.fs().Stat(staged); errors.Is(err, os.ErrNotExist) {
+			return nil // Already renamed.
+		}
+		var g uint64
+		if err := S.recordHistoryAs(op.Name, tracked(next, &g)); err != nil {
+			return err
+		}
+		if err := S.makeParent(op.Name); err != nil {
+			return err
+		}
+		if err := S.retry(func() error { return S.fs().Rename(staged, S.filePath(op.Name, false)) }); err != nil {
+			return err
+		}
+		if err := S.syncDir(filepath.Dir(S.filePath(op.Name, false))); err != nil {
+			return err
+		}
+		if err := S.setMeta(op.Name, nil); err != nil {
+			return err
+		}
+		S.invalidateDerived(op.Name, 0)
+		S.emit(Event{Kind: EventWrite, Name: normalizeName(op.Name, false), Generation: g}, g)
+	case "remove":
+		if _, err := S.fs().Stat(S.filePath(op.Name, false)); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return S.remove(op.Name, next)
+	case "move":
+		if _, err := S.fs().Stat(S.filePath(op.Name, false)); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return S.move(op.Name, op.To, next)
+	case "copy":
+		if eq, err := compareFiles(S.fs(), S.filePath(op.Name, false), S.filePath(op.To, false)); err == nil && eq {
+			return nil
+		}
+		return S.copy(op.Name, op.To, next)
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	return nil
+}
+
+// recoverTx finishes the committed transactions left behind by a crash
+// and removes the staging directories of the uncommitted ones.
+func (S *Store) recoverTx() error {
+	entries, err := S.fs().ReadDir(S.historyDir())
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), txPrefix) {
+			continue
+		}
+		dir := filepath.Join(S.historyDir(), entry.Name())
+		if _, err := S.fs().Stat(filepath.Join(dir, "commit")); errors.Is(err, os.ErrNotExist) {
+			if err := S.fs().RemoveAll(dir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := S.applyTx(dir); err != nil {
+			return fmt.Errorf("recoverTx %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package atylar
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTx(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if err := S.WriteFile("a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile("file", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Copy("file", "copy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Move("a", "dir/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove("file2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove("file"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName for a file modified twice but got", err)
+	}
+	if b, _ := S.ReadFile("file", 0); string(b) != "Hello!" {
+		t.Error("Got", string(b), "before commit but expected", "Hello!")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); !errors.Is(err, os.ErrClosed) {
+		t.Error("Expected", os.ErrClosed, "but got", err)
+	}
+
+	g := S.GetGeneration(false)
+	tests := []struct {
+		file       string
+		generation uint64
+		expected   string
+	}{
+		{"file", 0, "new"},
+		{"copy", 0, "new"},
+		{"dir/b", 0, "a"},
+		{"file", g, "Hello!"},
+		{"a", g, "a"},
+		{"file2", g, "Hello from the second file!"},
+	}
+	for _, tt := range tests {
+		if b, err := S.ReadFile(tt.file, tt.generation); err != nil || string(b) != tt.expected {
+			t.Error("Got", string(b), err, "for", tt.file, tt.generation, "but expected", tt.expected)
+		}
+	}
+	for _, file := range []string{"a", "file2"} {
+		if _, err := os.Stat(filepath.Join(d, file)); !errors.Is(err, os.ErrNotExist) {
+			t.Error("Expected", file, "to be gone but got", err)
+		}
+	}
+	assertNoTx(t, d)
+}
+
+func TestTxRollback(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.WriteFile("file", []byte("new"))
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Error("Expected rolling back twice to succeed but got", err)
+	}
+
+	// A missing source aborts the whole transaction.
+	tx, err = S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.WriteFile("file", []byte("new"))
+	tx.Move("file2", "moved")
+	tx.Copy("file2", "copy")
+	if err := tx.Commit(); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if b, _ := S.ReadFile("file", 0); string(b) != "Hello!" {
+		t.Error("Got", string(b), "but expected", "Hello!")
+	}
+	if h, _ := S.History("file"); len(h) != 1 {
+		t.Error("Got", h, "but expected the history not to change")
+	}
+	assertNoTx(t, d)
+}
+
+func TestTxRecovery(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A committed transaction, interrupted after its first operation.
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.WriteFile("file", []byte("new"))
+	tx.Remove("file2")
+	record, err := json.Marshal(txRecord{Generation: S.GetGeneration(true), Ops: tx.ops})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tx.dir, "commit"), record, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.applyTxOp(tx.dir, tx.ops[0], func() uint64 { return 124 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tx.dir, "done"), []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An uncommitted one.
+	if _, err := S.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	S, err = New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if b, _ := S.ReadFile("file", 0); string(b) != "new" {
+		t.Error("Got", string(b), "but expected", "new")
+	}
+	if _, err := os.Stat(filepath.Join(d, "file2")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected file2 to be removed but got", err)
+	}
+	for _, file := range []string{"file", "file2"} {
+		if h, _ := S.History(file); len(h) == 0 || h[0] != 124 {
+			t.Error("Got", h, "for", file, "but expected the newest version", 124)
+		}
+	}
+	assertNoTx(t, d)
+}
+
+// assertNoTx checks that no staging directories of transactions are left.
+func assertNoTx(t *testing.T, d string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(d, ".history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), txPrefix) {
+			t.Error("Expected no staging directories but got", entry.Name())
+		}
+	}
+}
+
+func TestTxInvalidTarget(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("n", S.Capabilities().MaxNameLength)
+	tx, err := S.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile("file", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Copy("file2", long); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+	// Names are checked again on Commit, in case the store changed.
+	caps := S.capabilities
+	S.capabilities.MaxNameLength = 0
+	if err := tx.Copy("file2", long); err != nil {
+		t.Fatal(err)
+	}
+	S.capabilities = caps
+	if err := tx.Commit(); !errors.Is(err, ErrInvalidName) {
+		t.Error("Got", err, "but expected", ErrInvalidName)
+	}
+	if b, _ := S.ReadFile("file", 0); string(b) != "Hello!" {
+		t.Error("Got", string(b), "but expected the transaction not to be applied")
+	}
+	assertNoTx(t, d)
+	if err := S.Close(); err != nil {
+		t.Fatal(err)
+	}
+	S, err = New(d)
+	if err != nil {
+		t.Fatal("Expected the store to be reopened but got", err)
+	}
+	S.Close()
+}
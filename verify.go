@@ -0,0 +1,321 @@
+package atylar
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verify keeps the SHA-256 checksums of live files and historic versions in
+// `.history/.checksums`, one per line as `hash size mtime name`, where mtime
+// is in Unix nanoseconds. Versions are named `name@generation` and their
+// checksum covers their content, however they are stored, so recompression
+// and the conversion of deltas don't change it. Entries are checksummed the
+// first time Verify sees them and GC forgets the versions it removes.
+
+// ProblemKind classifies problems found by Verify.
+type ProblemKind int
+
+const (
+	// ProblemCorrupt is a live file or a version whose content changed while
+	// its size and modification time didn't, which suggests bit rot, or a
+	// chunk whose content doesn't match its hash.
+	ProblemCorrupt ProblemKind = iota
+	// ProblemModified is a version whose content changed, e.g. because
+	// it was truncated or tampered with. Versions never change otherwise.
+	ProblemModified
+	// ProblemMissing is a version which was checksummed before but doesn't
+	// exist anymore, or whose chunks or delta base don't.
+	ProblemMissing
+	// ProblemUnreadable is a file or version which can't be read, e.g.
+	// a truncated compressed version or a malformed chunk manifest.
+	ProblemUnreadable
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemCorrupt:
+		return "corrupt"
+	case ProblemModified:
+		return "modified"
+	case ProblemMissing:
+		return "missing"
+	case ProblemUnreadable:
+		return "unreadable"
+	}
+	return "ProblemKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Problem is a problem found by Verify.
+type Problem struct {
+	Name string // Live file, `name@generation` or `.chunks/hash`
+	Kind ProblemKind
+	Err  error // Cause of ProblemUnreadable and missing chunks or bases
+}
+
+// VerifyReport describes the outcome of Verify.
+type VerifyReport struct {
+	Checked  int // Number of checked live files and versions
+	Added    int // Number of those checksummed for the first time
+	Problems []Problem
+}
+
+// checksum is an entry of the checksum manifest.
+type checksum struct {
+	hash    string
+	size    int64
+	modTime time.Time
+}
+
+// checksumsPath returns the path to the checksum manifest.
+func (S *Store) checksumsPath() string {
+	return filepath.Join(S.historyDir(), ".checksums")
+}
+
+// readChecksums reads the checksum manifest. It's empty if it doesn't exist.
+func (S *Store) readChecksums() (map[string]checksum, error) {
+	sums := make(map[string]checksum)
+	f, err := S.fs().Open(S.checksumsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return sums, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("malformed checksum %q", scanner.Text())
+		}
+		size, err1 := strconv.ParseInt(fields[1], 10, 64)
+		nanos, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed checksum %q", scanner.Text())
+		}
+		sums[fields[3]] = checksum{fields[0], size, time.Unix(0, nanos)}
+	}
+	return sums, scanner.Err()
+}
+
+// writeChecksums atomically replaces the checksum manifest.
+func (S *Store) writeChecksums(sums map[string]checksum) error {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		c := sums[name]
+		fmt.Fprintf(&b, "%s %d %d %s\n", c.hash, c.size, c.modTime.UnixNano(), name)
+	}
+	data := []byte(b.String())
+	tmp, err := S.writeTemp(data)
+	if err != nil {
+		return err
+	}
+	if err := S.fs().Rename(tmp, S.checksumsPath()); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// forgetChecksums removes the given versions from the checksum manifest,
+// if there is one.
+func (S *Store) forgetChecksums(versions []string) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	if _, err := S.fs().Stat(S.checksumsPath()); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	sums, err := S.readChecksums()
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		delete(sums, v)
+	}
+	return S.writeChecksums(sums)
+}
+
+// hashReader returns the SHA-256 hash of the content read from r.
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify checks the live files, the historic versions and the chunks of
+// the store against their checksums, adding the ones which weren't
+// checksummed yet, and reports the problems it finds. Live files which
+// were modified since their last check are checksummed again, unlike
+// versions, which never change. It's listed by Operations while it runs.
+// Read-only stores are checked, but the checksums aren't saved.
+func (S *Store) Verify() (VerifyReport, error) {
+	report := VerifyReport{Problems: []Problem{}}
+	op, end := S.begin("verify")
+	defer end()
+	defer S.lockStore()()
+	old, err := S.readChecksums()
+	if err != nil {
+		return report, fmt.Errorf("verify: %w", err)
+	}
+	live := []string{}
+	err = S.walkFiles(false, func(name string, entry fs.DirEntry) error {
+		live = append(live, name)
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("verify: %w", err)
+	}
+	versions := []string{}
+	seen := make(map[string]bool)
+	err = S.walkFiles(true, func(name string, entry fs.DirEntry) error {
+		file, g := parseVersion(name)
+		key := file + "@" + strconv.FormatUint(g, 10)
+		if g != 0 && !seen[key] {
+			seen[key] = true
+			versions = append(versions, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("verify: %w", err)
+	}
+	chunks, err := S.fs().ReadDir(S.chunkDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, fmt.Errorf("verify: %w", err)
+	}
+	op.progress(0, int64(len(live)+len(versions)+len(chunks)))
+
+	sums := make(map[string]checksum)
+	check := func(name string, file string, generation uint64) error {
+		if op.isCanceled() {
+			return ErrCanceled
+		}
+		defer op.step()
+		f, err := S.open(file, generation)
+		if err != nil {
+			if generation == 0 && errors.Is(err, os.ErrNotExist) {
+				return nil // Removed in the meantime.
+			}
+			kind := ProblemUnreadable
+			if errors.Is(err, os.ErrNotExist) {
+				kind = ProblemMissing
+			}
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: kind, Err: err})
+			if c, ok := old[name]; ok {
+				sums[name] = c
+			}
+			return nil
+		}
+		defer f.Close()
+		var modTime time.Time
+		if generation == 0 {
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			modTime = info.ModTime()
+		} else if v, err := S.versionInfo(file, generation); err == nil {
+			modTime = v.ModTime
+		}
+		hash, err := hashReader(f)
+		if err != nil {
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemUnreadable, Err: err})
+			if c, ok := old[name]; ok {
+				sums[name] = c
+			}
+			return nil
+		}
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		report.Checked++
+		current := checksum{hash, size, modTime}
+		previous, ok := old[name]
+		switch {
+		case !ok:
+			report.Added++
+			sums[name] = current
+		case previous.hash == current.hash:
+			sums[name] = current
+		case previous.size == current.size && previous.modTime.Equal(current.modTime):
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemCorrupt})
+			sums[name] = previous
+		case generation != 0:
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemModified})
+			sums[name] = previous
+		default:
+			sums[name] = current // Modified live file
+		}
+		return nil
+	}
+	for _, name := range live {
+		if err := check(name, name, 0); err != nil {
+			return report, fmt.Errorf("verify: %w", err)
+		}
+	}
+	for _, key := range versions {
+		file, g := parseVersion(key)
+		if err := check(key, file, g); err != nil {
+			return report, fmt.Errorf("verify: %w", err)
+		}
+	}
+	for name, c := range old {
+		if _, ok := sums[name]; ok {
+			continue
+		}
+		if _, g := parseVersion(name); g != 0 && !seen[name] {
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemMissing})
+			sums[name] = c
+		}
+	}
+
+	for _, entry := range chunks {
+		if op.isCanceled() {
+			return report, fmt.Errorf("verify: %w", ErrCanceled)
+		}
+		if entry.IsDir() || isMetadata(entry.Name()) {
+			continue
+		}
+		name := ".chunks/" + entry.Name()
+		f, err := S.fs().Open(filepath.Join(S.chunkDir(), entry.Name()))
+		if err != nil {
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemUnreadable, Err: err})
+			continue
+		}
+		hash, err := hashReader(f)
+		f.Close()
+		if err != nil {
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemUnreadable, Err: err})
+		} else if hash != entry.Name() {
+			report.Problems = append(report.Problems, Problem{Name: name, Kind: ProblemCorrupt})
+		}
+		report.Checked++
+		op.step()
+	}
+
+	if S.writable() == nil {
+		if err := S.writeChecksums(sums); err != nil {
+			return report, fmt.Errorf("verify: %w", err)
+		}
+	}
+	return report, nil
+}
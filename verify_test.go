@@ -0,0 +1,144 @@
+package atylar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	d := createMockStore(t)
+	S, err := New(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := S.WriteFile("notes", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// file, file2, notes, file@123 and three versions of notes
+	report, err := S.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 7 || report.Added != 7 || len(report.Problems) != 0 {
+		t.Fatal("Got", report)
+	}
+
+	// Bit rot keeps the size and the modification time.
+	rotten := S.versionPath("notes", 124)
+	info, err := os.Stat(rotten)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rotten, []byte("ONE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(rotten, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(S.versionPath("notes", 125), []byte("tw"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(S.versionPath("notes", 126)); err != nil {
+		t.Fatal(err)
+	}
+	// Live files may be modified outside of the store.
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(filepath.Join(d, "file"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(d, "file"), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"notes@124 corrupt", "notes@125 modified", "notes@126 missing"}
+	for i := 0; i < 2; i++ {
+		report, err = S.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, p := range report.Problems {
+			got = append(got, p.Name+" "+p.Kind.String())
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, expected) {
+			t.Error("Got", got, "but expected", expected)
+		}
+	}
+}
+
+func TestVerifyAfterGC(t *testing.T) {
+	S, err := New(t.TempDir(), WithHistoryCompression(Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two", "three"} {
+		if err := S.WriteFile("file", []byte(strings.Repeat(content, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := S.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := S.GC(RetentionPolicy{KeepLast: 1}); err != nil {
+		t.Fatal(err)
+	}
+	S.compression = NoCompression
+	if _, err := S.RecompressHistory(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := S.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 0 || len(report.Problems) != 0 {
+		t.Error("Got", report, "but expected no problems after GC and recompression")
+	}
+}
+
+func TestVerifyChunks(t *testing.T) {
+	S, err := New(t.TempDir(), WithDedup())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	for _, content := range []string{"one", "two"} {
+		if err := S.WriteFile("file", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(S.chunkDir())
+	if err != nil || len(entries) != 1 {
+		t.Fatal("Got", entries, err)
+	}
+	chunk := filepath.Join(S.chunkDir(), entries[0].Name())
+	if err := os.WriteFile(chunk, []byte("ONE"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := S.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemCorrupt {
+		t.Error("Got", report.Problems, "but expected a corrupt chunk")
+	}
+	if err := os.Remove(chunk); err != nil {
+		t.Fatal(err)
+	}
+	report, err = S.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != ProblemMissing || report.Problems[0].Name != "file@1" {
+		t.Error("Got", report.Problems, "but expected a version with a missing chunk")
+	}
+}
@@ -0,0 +1,193 @@
+package atylar
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// At returns a read-only view of the whole store as it looked at the given
+// generation. Every file is resolved to its newest historic version not
+// exceeding the generation, and files without such a version are absent.
+// Generation 0 presents the live files, like in Open. The set of versions
+// is resolved on first use, so all reads through the view are consistent.
+func (S *Store) At(generation uint64) fs.FS {
+	return &view{store: S, generation: generation}
+}
+
+// view implements the file system returned by At.
+type view struct {
+	store      *Store
+	generation uint64
+
+	once  sync.Once
+	files map[string]uint64 // Resolved generation of every file
+	err   error
+}
+
+// resolve finds the version of every file which is visible in the view.
+func (v *view) resolve() error {
+	v.once.Do(func() {
+		v.files = make(map[string]uint64)
+		v.err = v.store.walkFiles(v.generation != 0, func(name string, _ fs.DirEntry) error {
+			if v.generation == 0 {
+				v.files[name] = 0
+				return nil
+			}
+			file, g := parseVersion(name)
+			if g != 0 && g <= v.generation && g > v.files[file] {
+				v.files[file] = g
+			}
+			return nil
+		})
+	})
+	return v.err
+}
+
+// info returns information about the visible version of the file.
+func (v *view) info(name string) (fs.FileInfo, error) {
+	g := v.files[name]
+	if g == 0 {
+		info, err := v.store.fs().Stat(v.store.filePath(name, false))
+		if err != nil {
+			return nil, err
+		}
+		return viewInfo{name: path.Base(name), size: info.Size(), modTime: info.ModTime()}, nil
+	}
+	version, err := v.store.versionInfo(name, g)
+	if err != nil {
+		return nil, err
+	}
+	return viewInfo{name: path.Base(name), size: version.Size, modTime: version.ModTime}, nil
+}
+
+// Open opens the named file or directory of the view.
+func (v *view) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := v.resolve(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if g, ok := v.files[name]; ok {
+		info, err := v.info(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		f, err := v.store.Open(name, g)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &viewFile{f: f, info: info}, nil
+	}
+	entries, err := v.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &viewDir{info: viewInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// readDir returns the sorted entries of the directory of the view.
+// A directory exists if any file visible in the view is inside it.
+func (v *view) readDir(dir string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if dir != "." {
+		prefix = dir + "/"
+	}
+	found := false
+	seen := make(map[string]bool)
+	entries := []fs.DirEntry{}
+	for name := range v.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		found = true
+		rest := name[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i != -1 {
+			if sub := rest[:i]; !seen[sub] {
+				seen[sub] = true
+				entries = append(entries, fs.FileInfoToDirEntry(viewInfo{name: sub, dir: true}))
+			}
+			continue
+		}
+		info, err := v.info(name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	if !found && dir != "." {
+		return nil, fs.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// viewInfo describes a file or a directory of the view.
+type viewInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i viewInfo) Name() string       { return i.name }
+func (i viewInfo) Size() int64        { return i.size }
+func (i viewInfo) ModTime() time.Time { return i.modTime }
+func (i viewInfo) IsDir() bool        { return i.dir }
+func (i viewInfo) Sys() interface{}   { return nil }
+
+func (i viewInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// viewFile is a file opened through the view.
+type viewFile struct {
+	f    File
+	info fs.FileInfo
+}
+
+func (f *viewFile) Stat() (fs.FileInfo, error)                   { return f.info, nil }
+func (f *viewFile) Read(p []byte) (int, error)                   { return f.f.Read(p) }
+func (f *viewFile) ReadAt(p []byte, off int64) (int, error)      { return f.f.ReadAt(p, off) }
+func (f *viewFile) Seek(offset int64, whence int) (int64, error) { return f.f.Seek(offset, whence) }
+func (f *viewFile) Close() error                                 { return f.f.Close() }
+
+// viewDir is a directory opened through the view.
+type viewDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *viewDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *viewDir) Close() error               { return nil }
+
+func (d *viewDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of the directory, or all of
+// the remaining ones if n isn't positive.
+func (d *viewDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAt(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	write := func(name, content string) {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(d, ".history", name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, ".history", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("file@5", "v5")
+	write("file@9", "v9")
+	write("dir/file3@7", "dir v7")
+	write("file2@8", "second v8")
+
+	tests := []struct {
+		generation uint64
+		files      map[string]string
+		top        int // Number of entries in the root directory
+	}{
+		{0, map[string]string{"file": "Hello!", "file2": "Hello from the second file!"}, 2},
+		{4, map[string]string{}, 0},
+		{5, map[string]string{"file": "v5"}, 1},
+		{8, map[string]string{"file": "v5", "file2": "second v8", "dir/file3": "dir v7"}, 3},
+		{100, map[string]string{"file": "v9", "file2": "second v8", "dir/file3": "dir v7"}, 3},
+		{123, map[string]string{"file": "", "file2": "second v8", "dir/file3": "dir v7"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.generation), func(t *testing.T) {
+			fsys := S.At(tt.generation)
+			names := []string{}
+			for name, content := range tt.files {
+				names = append(names, name)
+				b, err := fs.ReadFile(fsys, name)
+				if err != nil {
+					t.Error(err)
+				} else if string(b) != content {
+					t.Error("Got", string(b), "but expected", content)
+				}
+			}
+			if err := fstest.TestFS(fsys, names...); err != nil {
+				t.Error(err)
+			}
+			entries, err := fs.ReadDir(fsys, ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.top {
+				t.Error("Got", len(entries), "entries but expected", tt.top)
+			}
+		})
+	}
+
+	if _, err := S.At(5).Open("file2"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Expected", fs.ErrNotExist, "but got", err)
+	}
+}
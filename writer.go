@@ -0,0 +1,350 @@
+package atylar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Writer writes a new version of a file. It is returned by Overwrite.
+// The content is written to a temporary file, which atomically replaces
+// the file on Commit or Close, so neither readers nor a crash can leave
+// the file partially written. The current version is recorded to history
+// at that point. Abort discards the content instead.
+type Writer struct {
+	File
+	store       *Store
+	file        string
+	done        bool
+	conditional bool        // Set by OverwriteIf
+	expected    uint64      // Newest generation expected by OverwriteIf
+	ifChanged   bool        // Set by OverwriteIfChanged
+	appending   bool        // Set by Append
+	meta        *CommitMeta // Set by OverwriteWithMeta
+}
+
+// Commit replaces the file with the written content, recording the current
+// version to history. The writer can't be used afterwards.
+func (w *Writer) Commit() error {
+	if w.done {
+		return &StoreError{Op: "commit", Name: w.file, Err: os.ErrClosed}
+	}
+	w.done = true
+	defer w.store.locks.leave()
+	S := w.store
+	tmp := w.File.Name()
+	if err := w.File.Sync(); err != nil {
+		w.File.Close()
+		S.fs().Remove(tmp)
+		return &StoreError{Op: "commit", Name: w.file, Err: err}
+	}
+	if err := w.File.Close(); err != nil {
+		S.fs().Remove(tmp)
+		return &StoreError{Op: "commit", Name: w.file, Err: err}
+	}
+	if w.ifChanged {
+		unlock := S.lock(w.file)
+		same, err := S.sameAsLive(w.file, tmp)
+		unlock()
+		if err != nil {
+			S.fs().Remove(tmp)
+			return &StoreError{Op: "commit", Name: w.file, Err: err}
+		} else if same {
+			return S.fs().Remove(tmp)
+		}
+	}
+	if w.appending {
+		// The file stays locked until it's replaced, so that no append
+		// committed in the meantime is lost.
+		defer S.lock(w.file)()
+		joined, err := S.appendLive(w.file, tmp)
+		if err != nil {
+			return &StoreError{Op: "commit", Name: w.file, Err: err}
+		}
+		tmp = joined
+	}
+	if err := S.encodeFile(w.file, tmp); err != nil {
+		S.fs().Remove(tmp)
+		return &StoreError{Op: "commit", Name: w.file, Err: err}
+	}
+	if !w.appending {
+		defer S.lock(w.file)()
+	}
+	if w.conditional {
+		if err := S.checkLatest(w.file, w.expected); err != nil {
+			S.fs().Remove(tmp)
+			return &StoreError{Op: "commit", Name: w.file, Generation: w.expected, Err: err}
+		}
+	}
+	if err := S.commit(w.file, tmp, w.meta); err != nil {
+		return &StoreError{Op: "commit", Name: w.file, Err: err}
+	}
+	return nil
+}
+
+// commit replaces the file with the temporary file at tmp, recording the
+// current version to history, and sets its description to meta, which may
+// be nil. The temporary file is removed if it fails. It must have been
+// synced, and the directory is synced after the rename, so that the new
+// content survives a crash. The file must be locked.
+func (S *Store) commit(file, tmp string, meta *CommitMeta) error {
+	var g uint64
+	if err := S.recordHistoryAs(file, tracked(func() uint64 { return S.GetGeneration(true) }, &g)); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.makeParent(file); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.retry(func() error { return S.fs().Rename(tmp, S.filePath(file, false)) }); err != nil {
+		S.fs().Remove(tmp)
+		return err
+	}
+	if err := S.setMeta(file, meta); err != nil {
+		return err
+	}
+	S.emit(Event{Kind: EventWrite, Name: normalizeName(file, false), Generation: g}, g)
+	return S.syncDir(filepath.Dir(S.filePath(file, false)))
+}
+
+// flushFile flushes the content of the file at path to the disk, so that it
+// survives a crash once the file is renamed into place.
+func flushFile(fsys Backend, path string) error {
+	f, err := fsys.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// syncDir syncs the directory, so that renames into it survive a crash,
+// if the file system supports it, see Capabilities.
+func (S *Store) syncDir(dir string) error {
+	if !S.capabilities.SyncDirectories {
+		return nil
+	}
+	d, err := S.fs().Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// writeTemp writes the data to a new temporary file, to be committed,
+// and returns its path.
+func (S *Store) writeTemp(data []byte) (string, error) {
+	var f File
+	err := S.retry(func() (err error) {
+		f, err = S.fs().CreateTemp(S.historyDir(), ".tmp-")
+		return
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := f.Chmod(S.filePerm()); err != nil {
+		f.Close()
+		S.fs().Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		S.fs().Remove(f.Name())
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		S.fs().Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		S.fs().Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Close is the same as Commit.
+func (w *Writer) Close() error {
+	return w.Commit()
+}
+
+// Abort discards the written content, leaving the file unchanged.
+// It does nothing if the writer was already committed or aborted,
+// so it can be deferred right after Overwrite.
+func (w *Writer) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer w.store.locks.leave()
+	tmp := w.File.Name()
+	w.File.Close()
+	if err := w.store.fs().Remove(tmp); err != nil {
+		return fmt.Errorf("abort %s: %w", w.file, err)
+	}
+	return nil
+}
+
+// OverwriteIf works like Overwrite, but the content only replaces the file
+// if the newest version in its history is still the given generation, 0 if
+// it had none, when the writer is committed. Otherwise both OverwriteIf
+// and Commit fail with ErrConflict. This allows optimistic concurrency:
+// a client reads the file along with its history, and its changes are
+// rejected if anyone else modified the file since. Modifications which
+// don't record a version, like creating a file with no history, can't
+// be detected.
+func (S *Store) OverwriteIf(file string, expected uint64) (*Writer, error) {
+	if err := S.checkLatest(file, expected); err != nil {
+		return nil, &StoreError{Op: "overwrite", Name: file, Generation: expected, Err: err}
+	}
+	w, err := S.Overwrite(file)
+	if err != nil {
+		return nil, err
+	}
+	w.conditional, w.expected = true, expected
+	return w, nil
+}
+
+// OverwriteIfChanged works like Overwrite, but if the written content is
+// the same as the content of the file when the writer is committed, the
+// write is discarded: the file isn't replaced, no version is recorded to
+// history and no event is emitted. This suits saving periodically, which
+// would otherwise capture identical versions.
+func (S *Store) OverwriteIfChanged(file string) (*Writer, error) {
+	w, err := S.Overwrite(file)
+	if err != nil {
+		return nil, err
+	}
+	w.ifChanged = true
+	return w, nil
+}
+
+// sameAsLive returns true if the file at path has the same content as the
+// live file, as read through the read pipeline. The file must be locked.
+func (S *Store) sameAsLive(file, path string) (bool, error) {
+	live := S.filePath(file, false)
+	if len(S.writeStages) == 0 && len(S.readStages) == 0 {
+		eq, err := compareFiles(S.fs(), path, live)
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return eq, err
+	}
+	f1, err := S.openDecoded(file, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f1.Close()
+	f2, err := S.fs().Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f2.Close()
+	return compareReaders(f1, f2)
+}
+
+// checkLatest returns ErrConflict if the newest version of the file
+// isn't the expected one.
+func (S *Store) checkLatest(file string, expected uint64) error {
+	generations, err := S.History(file)
+	if err != nil {
+		return err
+	}
+	var latest uint64
+	if len(generations) != 0 {
+		latest = generations[0]
+	}
+	if latest != expected {
+		return ErrConflict
+	}
+	return nil
+}
+
+// WriteFile writes data to the file, recording the current version to
+// history, like os.WriteFile. The file is replaced atomically, so it's
+// never left partially written.
+func (S *Store) WriteFile(file string, data []byte) error {
+	w, err := S.Overwrite(file)
+	if err != nil {
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Abort()
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	if err := w.Commit(); err != nil {
+		return fmt.Errorf("writeFile %s: %w", file, err)
+	}
+	return nil
+}
+
+// ReadFile reads the whole given version of the file, like os.ReadFile.
+// Generation 0 refers to the live file, like in Open.
+func (S *Store) ReadFile(file string, generation uint64) ([]byte, error) {
+	f, err := S.Open(file, generation)
+	if err != nil {
+		return nil, fmt.Errorf("readFile %s: %w", file, err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("readFile %s: %w", file, err)
+	}
+	return b, nil
+}
+
+// ReadRange reads up to n bytes of the given version of the file, starting
+// at the offset off. Fewer bytes are returned if the version ends sooner.
+// Generation 0 refers to the live file, like in Open. Unlike with Open,
+// versions stored in chunks aren't reassembled, only the chunks holding
+// the range are read, unless the content has to be decoded.
+func (S *Store) ReadRange(file string, generation uint64, off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 {
+		return nil, fmt.Errorf("readRange %s: negative offset or length", file)
+	}
+	defer S.lock()()
+	if generation != 0 {
+		path, enc, err := S.versionEntry(file, generation)
+		if err != nil {
+			return nil, fmt.Errorf("readRange %s: %w", file, err)
+		}
+		if enc == chunked && !S.verifies() && !S.encodedChunks(path) {
+			b, err := S.readChunkedRange(path, off, n)
+			if err != nil {
+				return nil, fmt.Errorf("readRange %s: %w", file, err)
+			}
+			return b, nil
+		}
+	}
+	f, err := S.openDecoded(file, generation)
+	if err != nil {
+		return nil, fmt.Errorf("readRange %s: %w", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("readRange %s: %w", file, err)
+	}
+	if rest := info.Size() - off; rest < n {
+		n = rest
+	}
+	if n <= 0 {
+		return []byte{}, nil
+	}
+	b := make([]byte, n)
+	m, err := f.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("readRange %s: %w", file, err)
+	}
+	return b[:m], nil
+}
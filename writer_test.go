@@ -0,0 +1,298 @@
+package atylar
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	w, err := S.Overwrite("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("New")
+	if b, err := os.ReadFile(filepath.Join(d, "file")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> before commit but got", string(b), err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file")); err != nil || string(b) != "New" {
+		t.Error("Expected New <nil> but got", string(b), err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, ".history", "file@124")); err != nil || string(b) != "Hello!" {
+		t.Error("Expected Hello! <nil> but got", string(b), err)
+	}
+	if info, err := os.Stat(filepath.Join(d, "file")); err != nil || info.Mode().Perm()&0444 != 0444 {
+		t.Error("Expected a readable file but got", info, err)
+	}
+	if err := w.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Error("Expected", os.ErrClosed, "but got", err)
+	}
+	if err := w.Abort(); err != nil {
+		t.Error("Expected aborting a committed writer to do nothing but got", err)
+	}
+
+	w, err = S.Overwrite("file2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("Discarded")
+	if err := w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(d, "file2")); err != nil || string(b) != "Hello from the second file!" {
+		t.Error("Expected the file to be unchanged but got", string(b), err)
+	}
+	if h, err := S.History("file2"); err != nil || len(h) != 0 {
+		t.Error("Expected [] <nil> but got", h, err)
+	}
+	dir, err := os.ReadDir(filepath.Join(d, ".history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range dir {
+		if strings.HasPrefix(entry.Name(), ".tmp-") {
+			t.Error("Expected no temporary files but got", entry.Name())
+		}
+	}
+
+	if _, err := S.Overwrite("/"); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if err := S.WriteFile("dir/notes.txt", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("dir/notes.txt", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := S.ReadFile("dir/notes.txt", 0); err != nil || string(b) != "v2" {
+		t.Error("Expected v2 <nil> but got", string(b), err)
+	}
+	if b, err := S.ReadFile("dir/notes.txt", 124); err != nil || string(b) != "v1" {
+		t.Error("Expected v1 <nil> but got", string(b), err)
+	}
+	if _, err := S.ReadFile("missing", 0); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected a not exist error but got", err)
+	}
+	if err := S.WriteFile("..", nil); !errors.Is(err, ErrInvalidName) {
+		t.Error("Expected ErrInvalidName but got", err)
+	}
+}
+
+func TestOverwriteIf(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	if _, err := S.OverwriteIf("file", 100); !errors.Is(err, ErrConflict) {
+		t.Error("Expected ErrConflict but got", err)
+	}
+	if _, err := S.OverwriteIf("new", 123); !errors.Is(err, ErrConflict) {
+		t.Error("Expected ErrConflict but got", err)
+	}
+
+	// Two clients which read the same version.
+	w1, err := S.OverwriteIf("file", 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := S.OverwriteIf("file", 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w1.WriteString("first")
+	w2.WriteString("second")
+	if err := w1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.Commit(); !errors.Is(err, ErrConflict) {
+		t.Error("Expected ErrConflict but got", err)
+	}
+	if b, _ := S.ReadFile("file", 0); string(b) != "first" {
+		t.Error("Got", string(b), "but expected", "first")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(d, ".history")); len(entries) != 2 {
+		t.Error("Got", entries, "but expected no temporary files")
+	}
+
+	w, err := S.OverwriteIf("new", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOverwriteIfChanged(t *testing.T) {
+	overwrite := func(S *Store, file, content string) {
+		t.Helper()
+		w, err := S.OverwriteIfChanged(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.WriteString(content)
+		if err := w.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123}
+	before, err := os.Stat(filepath.Join(d, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overwrite(&S, "file", "Hello!")
+	if after, err := os.Stat(filepath.Join(d, "file")); err != nil || !os.SameFile(before, after) {
+		t.Error("Got", after, err, "but expected the file not to be replaced")
+	}
+	if h, err := S.History("file"); err != nil || len(h) != 1 || S.Generation != 123 {
+		t.Error("Got", h, err, S.Generation, "but expected [123] <nil> 123")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(d, ".history")); len(entries) != 1 {
+		t.Error("Got", entries, "but expected no temporary files")
+	}
+	overwrite(&S, "file", "Hello!!")
+	if h, err := S.History("file"); err != nil || len(h) != 2 {
+		t.Error("Got", h, err, "but expected the changed content to be committed")
+	}
+	overwrite(&S, "new", "")
+	if b, err := S.ReadFile("new", 0); err != nil || len(b) != 0 {
+		t.Error("Got", string(b), err, "but expected a new empty file")
+	}
+
+	// The live file is compared after decoding.
+	E, err := New(t.TempDir(), WithWriteStages(xorStage{}, GzipStage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer E.Close()
+	overwrite(&E, "file", "encoded")
+	overwrite(&E, "file", "encoded")
+	if h, err := E.History("file"); err != nil || len(h) != 0 {
+		t.Error("Got", h, err, "but expected the identical content to be discarded")
+	}
+	overwrite(&E, "file", "changed")
+	if b, err := E.ReadFile("file", 0); err != nil || string(b) != "changed" {
+		t.Error("Got", string(b), err, "but expected changed")
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	d := createMockStore(t)
+	S := Store{Directory: d, Generation: 123, ChunkThreshold: 1 << 20}
+	big := randomBytes(4, 3<<20)
+	if err := S.WriteFile("big", big); err != nil {
+		t.Fatal(err)
+	}
+	if err := S.WriteFile("big", nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		file       string
+		generation uint64
+		off, n     int64
+		expected   []byte
+	}{
+		{"live", "file2", 0, 6, 4, []byte("from")},
+		{"live end", "file2", 0, 20, 100, []byte("d file!")},
+		{"past end", "file", 0, 10, 5, []byte{}},
+		{"empty version", "file", 123, 0, 5, []byte{}},
+		{"chunked", "big", 124, 1000, 10, big[1000:1010]},
+		{"chunked across", "big", 124, 1<<20 - 5, 2 << 20, big[1<<20-5 : 3<<20-5]},
+		{"chunked end", "big", 124, 3<<20 - 3, 10, big[3<<20-3:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := S.ReadRange(tt.file, tt.generation, tt.off, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tt.expected) {
+				t.Error("Got", len(b), "bytes but expected", len(tt.expected))
+			}
+		})
+	}
+	if _, err := S.ReadRange("file", 0, -1, 1); err == nil {
+		t.Error("Expected an error for a negative offset")
+	}
+	if _, err := S.ReadRange("file", 1, 0, 1); !errors.Is(err, ErrVersionNotFound) {
+		t.Error("Expected ErrVersionNotFound but got", err)
+	}
+}
+
+// syncBackend wraps a backend, recording the paths of synced files.
+type syncBackend struct {
+	Backend
+	mu     sync.Mutex
+	synced []string
+}
+
+type syncedFile struct {
+	File
+	b *syncBackend
+}
+
+func (f syncedFile) Sync() error {
+	f.b.mu.Lock()
+	f.b.synced = append(f.b.synced, f.Name())
+	f.b.mu.Unlock()
+	return f.File.Sync()
+}
+
+func (b *syncBackend) wrap(f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return syncedFile{f, b}, nil
+}
+
+func (b *syncBackend) Open(name string) (File, error) { return b.wrap(b.Backend.Open(name)) }
+func (b *syncBackend) CreateTemp(dir, pattern string) (File, error) {
+	return b.wrap(b.Backend.CreateTemp(dir, pattern))
+}
+func (b *syncBackend) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return b.wrap(b.Backend.OpenFile(name, flag, perm))
+}
+
+func TestCommitSyncs(t *testing.T) {
+	b := &syncBackend{Backend: NewMemoryBackend()}
+	S, err := New("store", WithBackend(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer S.Close()
+	if !S.Capabilities().SyncDirectories {
+		t.Fatal("Expected the directories to be syncable")
+	}
+	for _, op := range []func() error{
+		func() error { return S.WriteFile("dir/file", []byte("content")) },
+		func() error { return S.Copy("dir/file", "copy") },
+	} {
+		b.synced = nil
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+		temp, dir := false, false
+		for _, path := range b.synced {
+			temp = temp || strings.HasPrefix(filepath.Base(path), ".tmp-")
+			dir = dir || path == filepath.Dir(S.filePath("dir/file", false)) || path == S.Directory
+		}
+		if !temp || !dir {
+			t.Error("Got", b.synced, "but expected the temporary file and the directory to be synced")
+		}
+	}
+}